@@ -0,0 +1,15 @@
+package adapter
+
+import "github.com/sagernet/sing/common/x/list"
+
+type ECHKeyManager interface {
+	Service
+	// ECHKeys returns the accepted ECH keys in "ECH KEYS" PEM format, current key first.
+	ECHKeys() []byte
+	// ECHConfigList returns the ECHConfigList of the current key.
+	ECHConfigList() []byte
+	RegisterCallback(callback ECHKeysUpdateCallback) *list.Element[ECHKeysUpdateCallback]
+	UnregisterCallback(element *list.Element[ECHKeysUpdateCallback])
+}
+
+type ECHKeysUpdateCallback func(echKeys []byte)
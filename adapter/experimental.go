@@ -50,6 +50,8 @@ type CacheFile interface {
 	StoreDNS() bool
 	DNSCacheStore
 
+	DHCPLeaseStore
+
 	SetDisableExpire(disableExpire bool)
 	SetOptimisticTimeout(timeout time.Duration)
 
@@ -139,6 +141,19 @@ type OutboundGroup interface {
 	All() []string
 }
 
+type ReversePortal interface {
+	Outbound
+	Bridges() []ReverseBridgeStatus
+}
+
+type ReverseBridgeStatus struct {
+	Name        string    `json:"name"`
+	Connections int       `json:"connections"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Upload      int64     `json:"upload"`
+	Download    int64     `json:"download"`
+}
+
 type URLTestGroup interface {
 	OutboundGroup
 	URLTest(ctx context.Context) (map[string]uint16, error)
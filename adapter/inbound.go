@@ -3,7 +3,9 @@ package adapter
 import (
 	"context"
 	"net"
+	"net/http"
 	"net/netip"
+	"net/url"
 	"time"
 
 	"github.com/sagernet/sing-box/common/tlsspoof"
@@ -31,6 +33,13 @@ type UDPInjectableInbound interface {
 	PacketConnectionHandler
 }
 
+// HTTPInjectableInbound is an inbound whose V2Ray transport can serve requests accepted by another HTTP server.
+type HTTPInjectableInbound interface {
+	Inbound
+	// HTTPHandler returns nil if the inbound has no HTTP based transport.
+	HTTPHandler() http.Handler
+}
+
 type InboundRegistry interface {
 	option.InboundOptionsRegistry
 	Create(ctx context.Context, router Router, logger log.ContextLogger, tag string, inboundType string, options any) (Inbound, error)
@@ -59,10 +68,17 @@ type InboundContext struct {
 	Protocol     string
 	Domain       string
 	Client       string
+	HTTPRequest  *HTTPRequest
 	SniffContext any
 	SnifferNames []string
 	SniffError   error
 
+	// PROXY protocol
+
+	ProxyProtocolUser       string
+	ProxyProtocolInbound    string
+	ProxyProtocolServerName string
+
 	// cache
 
 	// Deprecated: implement in rule action
@@ -78,6 +94,7 @@ type InboundContext struct {
 	TLSRecordFragment         bool
 	TLSSpoof                  string
 	TLSSpoofMethod            tlsspoof.Method
+	Capture                   string
 
 	NetworkStrategy     *C.NetworkStrategy
 	NetworkType         []C.InterfaceType
@@ -108,6 +125,25 @@ type InboundContext struct {
 	IgnoreDestinationIPCIDRMatch bool
 }
 
+// HTTPRequest is the head of a sniffed plain HTTP request.
+type HTTPRequest struct {
+	Method     string
+	URL        *url.URL
+	ProtoMajor int
+	ProtoMinor int
+	Header     http.Header
+}
+
+func NewHTTPRequest(request *http.Request) *HTTPRequest {
+	return &HTTPRequest{
+		Method:     request.Method,
+		URL:        request.URL,
+		ProtoMajor: request.ProtoMajor,
+		ProtoMinor: request.ProtoMinor,
+		Header:     request.Header,
+	}
+}
+
 func (c *InboundContext) ResetRuleCache() {
 	c.IPCIDRMatchSource = false
 	c.IPCIDRAcceptEmpty = false
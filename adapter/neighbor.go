@@ -3,6 +3,7 @@ package adapter
 import (
 	"net"
 	"net/netip"
+	"time"
 )
 
 type NeighborEntry struct {
@@ -22,3 +23,21 @@ type NeighborResolver interface {
 type NeighborUpdateListener interface {
 	UpdateNeighborTable(entries []NeighborEntry)
 }
+
+// NeighborLeaseUpdater accepts leases handed out by a built-in DHCP server,
+// entries of a source replace the previous entries of the same source.
+type NeighborLeaseUpdater interface {
+	UpdateLeases(source string, entries []NeighborEntry)
+}
+
+type DHCPLease struct {
+	Address    netip.Addr
+	MACAddress net.HardwareAddr
+	Hostname   string
+	Expiry     time.Time
+}
+
+type DHCPLeaseStore interface {
+	LoadDHCPLeases(tag string) []DHCPLease
+	StoreDHCPLeases(tag string, leases []DHCPLease) error
+}
@@ -0,0 +1,26 @@
+package adapter
+
+import (
+	"net/netip"
+	"time"
+)
+
+type PortMappingManager interface {
+	Register(mapping PortMapping)
+	Unregister(mapping PortMapping)
+	Mappings() []PortMappingStatus
+}
+
+type PortMapping interface {
+	Status() PortMappingStatus
+}
+
+type PortMappingStatus struct {
+	Network         string
+	InternalAddress netip.AddrPort
+	Protocol        string
+	Gateway         netip.Addr
+	ExternalAddress netip.AddrPort
+	Expires         time.Time
+	Error           string
+}
@@ -1,8 +1,28 @@
 package adapter
 
-import "time"
+import (
+	"time"
+
+	M "github.com/sagernet/sing/common/metadata"
+)
 
 type TimeService interface {
 	SimpleLifecycle
 	TimeFunc() func() time.Time
 }
+
+// TimeSyncStatusProvider is implemented by time services that can report
+// the state of the last upstream synchronisation.
+type TimeSyncStatusProvider interface {
+	SyncStatus() TimeSyncStatus
+}
+
+type TimeSyncStatus struct {
+	Synchronized   bool
+	Server         M.Socksaddr
+	LastSync       time.Time
+	Leap           uint8
+	Stratum        uint8
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+}
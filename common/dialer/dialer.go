@@ -62,6 +62,12 @@ func NewWithOptions(options Options) (N.Dialer, error) {
 			return nil, err
 		}
 	}
+	if dialOptions.ProxyProtocol != 0 {
+		if dialOptions.ProxyProtocol > 2 {
+			return nil, E.New("unknown PROXY protocol version: ", dialOptions.ProxyProtocol)
+		}
+		dialer = newProxyProtocolDialer(dialer, dialOptions.ProxyProtocol, options.DirectOutbound)
+	}
 	if options.RemoteIsDomain && (!hasDetour || options.ResolverOnDetour || dialOptions.DomainResolver != nil && dialOptions.DomainResolver.Server != "") {
 		networkManager := service.FromContext[adapter.NetworkManager](options.Context)
 		dnsTransport := service.FromContext[adapter.DNSTransportManager](options.Context)
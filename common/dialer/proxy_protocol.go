@@ -0,0 +1,202 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/proxyproto"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+var (
+	_ N.Dialer                = (*proxyProtocolDialer)(nil)
+	_ ParallelInterfaceDialer = (*proxyProtocolParallelInterfaceDialer)(nil)
+)
+
+// proxyProtocolDialer sends a PROXY protocol header describing the inbound connection
+// at the start of every TCP connection, and in front of every UDP packet if udpHeader is set.
+//
+// UDP headers are only sent by the direct outbound: other outbounds own their UDP socket
+// and speak QUIC, WireGuard or DNS on it, which a header would break.
+type proxyProtocolDialer struct {
+	dialer    N.Dialer
+	version   uint8
+	udpHeader bool
+}
+
+func newProxyProtocolDialer(dialer N.Dialer, version uint8, udpHeader bool) N.Dialer {
+	if parallelDialer, isParallel := dialer.(ParallelInterfaceDialer); isParallel {
+		return &proxyProtocolParallelInterfaceDialer{
+			proxyProtocolDialer{dialer, version, udpHeader},
+			parallelDialer,
+		}
+	}
+	return &proxyProtocolDialer{dialer, version, udpHeader}
+}
+
+type proxyProtocolParallelInterfaceDialer struct {
+	proxyProtocolDialer
+	dialer ParallelInterfaceDialer
+}
+
+func (d *proxyProtocolDialer) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, destination)
+	if err != nil {
+		return nil, err
+	}
+	return d.newConn(ctx, network, conn)
+}
+
+func (d *proxyProtocolDialer) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	conn, err := d.dialer.ListenPacket(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	return d.newPacketConn(ctx, conn, destination)
+}
+
+func (d *proxyProtocolDialer) Upstream() any {
+	return d.dialer
+}
+
+// headerInfo returns the source, the original destination if known and the TLVs of the inbound connection.
+func (d *proxyProtocolDialer) headerInfo(ctx context.Context, localAddr M.Socksaddr) (source M.Socksaddr, destination M.Socksaddr, info proxyproto.Info) {
+	source = localAddr
+	metadata := adapter.ContextFrom(ctx)
+	if metadata != nil {
+		if metadata.Source.IsValid() {
+			source = metadata.Source
+		}
+		originDestination := metadata.RouteOriginalDestination
+		if !originDestination.IsValid() {
+			originDestination = metadata.Destination
+		}
+		if originDestination.IsIP() {
+			destination = originDestination
+		}
+		info.User = metadata.User
+		info.Inbound = metadata.Inbound
+		if metadata.Protocol == C.ProtocolTLS || metadata.Protocol == C.ProtocolQUIC {
+			info.ServerName = metadata.Domain
+		}
+	}
+	return
+}
+
+func (d *proxyProtocolDialer) newConn(ctx context.Context, network string, conn net.Conn) (net.Conn, error) {
+	isUDP := N.NetworkName(network) == N.NetworkUDP
+	if isUDP && (!d.udpHeader || d.version == 1) {
+		// v1 has no UDP form, datagrams are sent without header
+		return conn, nil
+	}
+	source, destination, info := d.headerInfo(ctx, M.SocksaddrFromNet(conn.LocalAddr()))
+	if !destination.IsValid() {
+		destination = M.SocksaddrFromNet(conn.RemoteAddr())
+	}
+	header, err := proxyproto.Header(d.version, network, source, destination, info)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if isUDP {
+		return &proxyProtocolUDPConn{Conn: conn, header: header}, nil
+	}
+	_, err = conn.Write(header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *proxyProtocolDialer) newPacketConn(ctx context.Context, conn net.PacketConn, destination M.Socksaddr) (net.PacketConn, error) {
+	if !d.udpHeader || d.version == 1 {
+		return conn, nil
+	}
+	source, originDestination, info := d.headerInfo(ctx, M.SocksaddrFromNet(conn.LocalAddr()))
+	if !originDestination.IsValid() {
+		originDestination = destination
+	}
+	header, err := proxyproto.Header(d.version, N.NetworkUDP, source, originDestination, info)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &proxyProtocolPacketConn{
+		PacketConn:  conn,
+		version:     d.version,
+		source:      source,
+		info:        info,
+		destination: destination.Unwrap(),
+		header:      header,
+	}, nil
+}
+
+func (d *proxyProtocolParallelInterfaceDialer) DialParallelInterface(ctx context.Context, network string, destination M.Socksaddr, strategy *C.NetworkStrategy, interfaceType []C.InterfaceType, fallbackInterfaceType []C.InterfaceType, fallbackDelay time.Duration) (net.Conn, error) {
+	conn, err := d.dialer.DialParallelInterface(ctx, network, destination, strategy, interfaceType, fallbackInterfaceType, fallbackDelay)
+	if err != nil {
+		return nil, err
+	}
+	return d.newConn(ctx, network, conn)
+}
+
+func (d *proxyProtocolParallelInterfaceDialer) ListenSerialInterfacePacket(ctx context.Context, destination M.Socksaddr, strategy *C.NetworkStrategy, interfaceType []C.InterfaceType, fallbackInterfaceType []C.InterfaceType, fallbackDelay time.Duration) (net.PacketConn, error) {
+	conn, err := d.dialer.ListenSerialInterfacePacket(ctx, destination, strategy, interfaceType, fallbackInterfaceType, fallbackDelay)
+	if err != nil {
+		return nil, err
+	}
+	return d.newPacketConn(ctx, conn, destination)
+}
+
+type proxyProtocolUDPConn struct {
+	net.Conn
+	header []byte
+}
+
+func (c *proxyProtocolUDPConn) Write(p []byte) (n int, err error) {
+	buffer := buf.NewSize(len(c.header) + len(p))
+	defer buffer.Release()
+	common.Must1(buffer.Write(c.header))
+	common.Must1(buffer.Write(p))
+	_, err = c.Conn.Write(buffer.Bytes())
+	if err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// proxyProtocolPacketConn reuses the header built for the destination of ListenPacket,
+// and builds a new one for packets to other peers.
+type proxyProtocolPacketConn struct {
+	net.PacketConn
+	version     uint8
+	source      M.Socksaddr
+	info        proxyproto.Info
+	destination M.Socksaddr
+	header      []byte
+}
+
+func (c *proxyProtocolPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	header := c.header
+	if destination := M.SocksaddrFromNet(addr).Unwrap(); destination != c.destination {
+		header, err = proxyproto.Header(c.version, N.NetworkUDP, c.source, destination, c.info)
+		if err != nil {
+			return
+		}
+	}
+	buffer := buf.NewSize(len(header) + len(p))
+	defer buffer.Release()
+	common.Must1(buffer.Write(header))
+	common.Must1(buffer.Write(p))
+	_, err = c.PacketConn.WriteTo(buffer.Bytes(), addr)
+	if err != nil {
+		return
+	}
+	return len(p), nil
+}
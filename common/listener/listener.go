@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 
 	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/portmapping"
 	"github.com/sagernet/sing-box/common/settings"
 	"github.com/sagernet/sing-box/option"
 	"github.com/sagernet/sing/common"
@@ -38,8 +39,10 @@ type Listener struct {
 	systemProxy          settings.SystemProxy
 	udpConn              *net.UDPConn
 	udpAddr              M.Socksaddr
+	udpPortsConn         *udpPortsConn
 	packetOutbound       chan *N.PacketBuffer
 	packetOutboundClosed chan struct{}
+	portMappers          []*portmapping.Mapper
 	shutdown             atomic.Bool
 }
 
@@ -125,12 +128,29 @@ func (l *Listener) Close() error {
 	if l.systemProxy != nil && l.systemProxy.IsEnabled() {
 		err = l.systemProxy.Disable()
 	}
+	for _, mapper := range l.portMappers {
+		err = E.Errors(err, mapper.Close())
+	}
 	return E.Errors(err, common.Close(
 		l.tcpListener,
 		common.PtrOrNil(l.udpConn),
+		common.PtrOrNil(l.udpPortsConn),
 	))
 }
 
+func (l *Listener) startPortMapping(network string, listenAddr net.Addr) error {
+	if l.listenOptions.PortMapping == nil || !l.listenOptions.PortMapping.Enabled {
+		return nil
+	}
+	mapper, err := portmapping.New(l.ctx, l.logger, network, M.SocksaddrFromNet(listenAddr).AddrPort(), *l.listenOptions.PortMapping)
+	if err != nil {
+		return E.Cause(err, "initialize port mapping")
+	}
+	mapper.Start()
+	l.portMappers = append(l.portMappers, mapper)
+	return nil
+}
+
 func (l *Listener) TCPListener() net.Listener {
 	return l.tcpListener
 }
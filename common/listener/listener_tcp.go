@@ -21,10 +21,6 @@ import (
 )
 
 func (l *Listener) ListenTCP() (net.Listener, error) {
-	//nolint:staticcheck
-	if l.listenOptions.ProxyProtocol || l.listenOptions.ProxyProtocolAcceptNoHeader {
-		return nil, E.New("Proxy Protocol is deprecated and removed in sing-box 1.6.0")
-	}
 	var err error
 	bindAddr := M.SocksaddrFrom(l.listenOptions.Listen.Build(netip.AddrFrom4([4]byte{127, 0, 0, 1})), l.listenOptions.ListenPort)
 	var listenConfig net.ListenConfig
@@ -78,8 +74,15 @@ func (l *Listener) ListenTCP() (net.Listener, error) {
 		return nil, err
 	}
 	l.logger.Info("tcp server started at ", tcpListener.Addr())
+	if l.listenOptions.ProxyProtocol {
+		tcpListener = newProxyProtocolListener(tcpListener, l.logger, l.listenOptions.ProxyProtocolAcceptNoHeader)
+	}
 	l.tcpListener = tcpListener
-	return tcpListener, err
+	err = l.startPortMapping(N.NetworkTCP, tcpListener.Addr())
+	if err != nil {
+		return nil, err
+	}
+	return tcpListener, nil
 }
 
 func (l *Listener) loopTCPIn() {
@@ -104,6 +107,15 @@ func (l *Listener) loopTCPIn() {
 		metadata.InboundDetour = l.listenOptions.Detour
 		metadata.Source = M.SocksaddrFromNet(conn.RemoteAddr()).Unwrap()
 		metadata.OriginDestination = M.SocksaddrFromNet(conn.LocalAddr()).Unwrap()
+		if proxyConn, isProxyConn := conn.(*proxyProtocolConn); isProxyConn {
+			metadata.ProxyProtocolUser = proxyConn.metadata.User
+			metadata.ProxyProtocolInbound = proxyConn.metadata.Inbound
+			metadata.ProxyProtocolServerName = proxyConn.metadata.ServerName
+		} else {
+			metadata.ProxyProtocolUser = ""
+			metadata.ProxyProtocolInbound = ""
+			metadata.ProxyProtocolServerName = ""
+		}
 		ctx := log.ContextWithNewID(l.ctx)
 		l.logger.InfoContext(ctx, "inbound connection from ", metadata.Source)
 		go l.connHandler.NewConnection(ctx, conn, metadata, nil)
@@ -23,6 +23,21 @@ const udpOutputBatchSize = 128
 
 func (l *Listener) ListenUDP() (net.PacketConn, error) {
 	bindAddr := M.SocksaddrFrom(l.listenOptions.Listen.Build(netip.AddrFrom4([4]byte{127, 0, 0, 1})), l.listenOptions.ListenPort)
+	udpConn, err := l.listenUDP(bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	l.udpConn = udpConn
+	l.udpAddr = bindAddr
+	l.logger.Info("udp server started at ", udpConn.LocalAddr())
+	err = l.startPortMapping(N.NetworkUDP, udpConn.LocalAddr())
+	if err != nil {
+		return nil, err
+	}
+	return udpConn, nil
+}
+
+func (l *Listener) listenUDP(bindAddr M.Socksaddr) (*net.UDPConn, error) {
 	var listenConfig net.ListenConfig
 	if l.listenOptions.BindInterface != "" {
 		listenConfig.Control = control.Append(listenConfig.Control, control.BindToInterface(service.FromContext[adapter.NetworkManager](l.ctx).InterfaceFinder(), l.listenOptions.BindInterface, -1))
@@ -55,10 +70,7 @@ func (l *Listener) ListenUDP() (net.PacketConn, error) {
 	if err != nil {
 		return nil, err
 	}
-	l.udpConn = udpConn.(*net.UDPConn)
-	l.udpAddr = bindAddr
-	l.logger.Info("udp server started at ", udpConn.LocalAddr())
-	return udpConn, err
+	return udpConn.(*net.UDPConn), nil
 }
 
 func (l *Listener) DialContext(dialer net.Dialer, ctx context.Context, network string, address string) (net.Conn, error) {
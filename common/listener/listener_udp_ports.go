@@ -0,0 +1,182 @@
+package listener
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/buf"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/pipe"
+	"github.com/sagernet/sing/contrab/freelru"
+	"github.com/sagernet/sing/contrab/maphash"
+)
+
+// MaxListenPorts limits the ports an inbound may listen on, as every port
+// opens its own socket.
+const MaxListenPorts = 1024
+
+// ListenUDPPorts listens on every given port and merges the sockets into a
+// single packet conn, replies to a peer leave from the port it last sent to.
+//
+// The merged conn is not a *net.UDPConn, so QUIC servers on it run without
+// GSO, GRO and ECN.
+func (l *Listener) ListenUDPPorts(ports []uint16) (net.PacketConn, error) {
+	if len(ports) == 0 {
+		return nil, E.New("missing listen ports")
+	} else if len(ports) > MaxListenPorts {
+		return nil, E.New("too many listen ports, at most ", MaxListenPorts, " are supported")
+	}
+	listenAddr := l.listenOptions.Listen.Build(netip.AddrFrom4([4]byte{127, 0, 0, 1}))
+	udpConns := make([]*net.UDPConn, 0, len(ports))
+	for _, port := range ports {
+		udpConn, err := l.listenUDP(M.SocksaddrFrom(listenAddr, port))
+		if err != nil {
+			for _, conn := range udpConns {
+				conn.Close()
+			}
+			return nil, E.Cause(err, "listen udp port ", port)
+		}
+		udpConns = append(udpConns, udpConn)
+	}
+	conn := newUDPPortsConn(udpConns)
+	l.udpPortsConn = conn
+	l.udpAddr = M.SocksaddrFrom(listenAddr, ports[0])
+	l.logger.Info("udp server started at ", listenAddr, " on ", len(ports), " ports")
+	return conn, nil
+}
+
+var _ net.PacketConn = (*udpPortsConn)(nil)
+
+type udpPortsConn struct {
+	conns        []*net.UDPConn
+	peers        *freelru.SyncedLRU[netip.AddrPort, int]
+	packets      chan udpPortsPacket
+	done         chan struct{}
+	closeOnce    sync.Once
+	readDeadline pipe.Deadline
+}
+
+const (
+	udpPortsPeerCacheSize = 65536
+	udpPortsMinRetryDelay = 5 * time.Millisecond
+	udpPortsMaxRetryDelay = time.Second
+)
+
+var errUnknownUDPPortsPeer = E.New("unknown peer, no port to reply from")
+
+type udpPortsPacket struct {
+	buffer *buf.Buffer
+	source netip.AddrPort
+}
+
+func newUDPPortsConn(conns []*net.UDPConn) *udpPortsConn {
+	peers := common.Must1(freelru.NewSynced[netip.AddrPort, int](udpPortsPeerCacheSize, maphash.NewHasher[netip.AddrPort]().Hash32))
+	peers.SetLifetime(C.UDPTimeout)
+	conn := &udpPortsConn{
+		conns:        conns,
+		peers:        peers,
+		packets:      make(chan udpPortsPacket, 64),
+		done:         make(chan struct{}),
+		readDeadline: pipe.MakeDeadline(),
+	}
+	for index, udpConn := range conns {
+		go conn.loopRead(index, udpConn)
+	}
+	return conn
+}
+
+func (c *udpPortsConn) loopRead(index int, udpConn *net.UDPConn) {
+	var retryDelay time.Duration
+	for {
+		buffer := buf.NewPacket()
+		n, source, err := udpConn.ReadFromUDPAddrPort(buffer.FreeBytes())
+		if err != nil {
+			buffer.Release()
+			if E.IsClosed(err) {
+				c.Close()
+				return
+			}
+			// back off on persistent errors instead of spinning
+			if retryDelay == 0 {
+				retryDelay = udpPortsMinRetryDelay
+			} else {
+				retryDelay = min(retryDelay*2, udpPortsMaxRetryDelay)
+			}
+			select {
+			case <-time.After(retryDelay):
+				continue
+			case <-c.done:
+				return
+			}
+		}
+		retryDelay = 0
+		buffer.Truncate(n)
+		source = netip.AddrPortFrom(source.Addr().Unmap(), source.Port())
+		c.peers.Add(source, index)
+		select {
+		case c.packets <- udpPortsPacket{buffer, source}:
+		case <-c.done:
+			buffer.Release()
+			return
+		}
+	}
+}
+
+func (c *udpPortsConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	select {
+	case packet := <-c.packets:
+		n = copy(p, packet.buffer.Bytes())
+		packet.buffer.Release()
+		addr = net.UDPAddrFromAddrPort(packet.source)
+		return
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	case <-c.readDeadline.Wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *udpPortsConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	destination := M.SocksaddrFromNet(addr).Unwrap().AddrPort()
+	index, loaded := c.peers.Get(destination)
+	if !loaded {
+		// a reply from a port the peer did not send to is dropped by NATs,
+		// QUIC recovers once the peer sends again
+		return 0, errUnknownUDPPortsPeer
+	}
+	return c.conns[index].WriteToUDPAddrPort(p, destination)
+}
+
+func (c *udpPortsConn) Close() error {
+	var errs []error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		for _, conn := range c.conns {
+			errs = append(errs, conn.Close())
+		}
+	})
+	return E.Errors(errs...)
+}
+
+func (c *udpPortsConn) LocalAddr() net.Addr {
+	return c.conns[0].LocalAddr()
+}
+
+func (c *udpPortsConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *udpPortsConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+func (c *udpPortsConn) SetWriteDeadline(t time.Time) error {
+	return os.ErrInvalid
+}
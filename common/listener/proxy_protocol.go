@@ -0,0 +1,110 @@
+package listener
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/common/proxyproto"
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+)
+
+// proxyProtocolListener reads PROXY protocol headers off the accept loop,
+// so that slow clients cannot block other connections.
+type proxyProtocolListener struct {
+	net.Listener
+	logger         logger.ContextLogger
+	acceptNoHeader bool
+	conns          chan net.Conn
+	done           chan struct{}
+	closeOnce      sync.Once
+	err            error
+}
+
+func newProxyProtocolListener(listener net.Listener, logger logger.ContextLogger, acceptNoHeader bool) *proxyProtocolListener {
+	proxyListener := &proxyProtocolListener{
+		Listener:       listener,
+		logger:         logger,
+		acceptNoHeader: acceptNoHeader,
+		conns:          make(chan net.Conn),
+		done:           make(chan struct{}),
+	}
+	go proxyListener.loopAccept()
+	return proxyListener
+}
+
+func (l *proxyProtocolListener) loopAccept() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			//nolint:staticcheck
+			if netError, isNetError := err.(net.Error); isNetError && netError.Temporary() {
+				l.logger.Error(err)
+				continue
+			}
+			l.err = err
+			l.closeOnce.Do(func() {
+				close(l.done)
+			})
+			return
+		}
+		go l.readHeader(conn)
+	}
+}
+
+func (l *proxyProtocolListener) readHeader(conn net.Conn) {
+	err := conn.SetReadDeadline(time.Now().Add(C.TCPTimeout))
+	if err != nil {
+		conn.Close()
+		return
+	}
+	proxyConn, metadata, err := proxyproto.ReadConn(conn, l.acceptNoHeader)
+	if err == nil {
+		err = conn.SetReadDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		l.logger.Error(E.Cause(err, "read PROXY protocol header from ", conn.RemoteAddr()))
+		return
+	}
+	if metadata != nil {
+		proxyConn = &proxyProtocolConn{Conn: proxyConn, metadata: metadata}
+	}
+	select {
+	case l.conns <- proxyConn:
+	case <-l.done:
+		proxyConn.Close()
+	}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *proxyProtocolListener) Upstream() any {
+	return l.Listener
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	metadata *proxyproto.Metadata
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	return c.metadata.Source.TCPAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	return c.metadata.Destination.TCPAddr()
+}
+
+func (c *proxyProtocolConn) Upstream() any {
+	return c.Conn
+}
@@ -0,0 +1,135 @@
+package ntp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/ntp"
+)
+
+var (
+	_ adapter.TimeService            = (*Service)(nil)
+	_ adapter.TimeSyncStatusProvider = (*Service)(nil)
+)
+
+const (
+	headerLength  = 48
+	leapNotInSync = 3
+)
+
+// Service is the sing ntp service with the state of the last exchange
+// recorded from the packets it sends and receives through its dialer.
+type Service struct {
+	*ntp.Service
+	access sync.RWMutex
+	status adapter.TimeSyncStatus
+}
+
+func NewService(options ntp.Options) *Service {
+	service := &Service{}
+	dialer := options.Dialer
+	if dialer == nil {
+		dialer = N.SystemDialer
+	}
+	options.Dialer = &statusDialer{Dialer: dialer, service: service}
+	service.Service = ntp.NewService(options)
+	return service
+}
+
+func (s *Service) SyncStatus() adapter.TimeSyncStatus {
+	s.access.RLock()
+	defer s.access.RUnlock()
+	return s.status
+}
+
+func (s *Service) setServer(server M.Socksaddr) {
+	s.access.Lock()
+	defer s.access.Unlock()
+	s.status.Server = server
+}
+
+func (s *Service) setUnsynchronized() {
+	s.access.Lock()
+	defer s.access.Unlock()
+	s.status.Synchronized = false
+}
+
+func (s *Service) updateStatus(header []byte, rtt time.Duration) {
+	leap := header[0] >> 6
+	stratum := header[1]
+	s.access.Lock()
+	defer s.access.Unlock()
+	if leap == leapNotInSync || stratum == 0 {
+		s.status.Synchronized = false
+		return
+	}
+	s.status.Synchronized = true
+	s.status.LastSync = ntpTime(binary.BigEndian.Uint64(header[40:48]))
+	s.status.Leap = leap
+	s.status.Stratum = stratum
+	s.status.RootDelay = ntpShortDuration(binary.BigEndian.Uint32(header[4:8])) + rtt
+	s.status.RootDispersion = ntpShortDuration(binary.BigEndian.Uint32(header[8:12])) + ntpPrecision(int8(header[3]))
+}
+
+type statusDialer struct {
+	N.Dialer
+	service *Service
+}
+
+func (d *statusDialer) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	d.service.setServer(destination)
+	conn, err := d.Dialer.DialContext(ctx, network, destination)
+	if err != nil {
+		d.service.setUnsynchronized()
+		return nil, err
+	}
+	return &statusConn{Conn: conn, service: d.service}, nil
+}
+
+type statusConn struct {
+	net.Conn
+	service   *Service
+	writtenAt time.Time
+}
+
+func (c *statusConn) Write(b []byte) (int, error) {
+	c.writtenAt = time.Now()
+	return c.Conn.Write(b)
+}
+
+func (c *statusConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil || n < headerLength {
+		c.service.setUnsynchronized()
+	} else {
+		c.service.updateStatus(b[:headerLength], time.Since(c.writtenAt))
+	}
+	return n, err
+}
+
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func ntpTime(t uint64) time.Time {
+	seconds := time.Duration(t>>32) * time.Second
+	fraction := time.Duration((t & 0xffffffff) * uint64(time.Second) >> 32)
+	return ntpEpoch.Add(seconds + fraction)
+}
+
+func ntpShortDuration(t uint32) time.Duration {
+	seconds := time.Duration(t>>16) * time.Second
+	fraction := time.Duration(uint64(t&0xffff) * uint64(time.Second) >> 16)
+	return seconds + fraction
+}
+
+func ntpPrecision(exponent int8) time.Duration {
+	if exponent >= 0 {
+		return time.Second << exponent
+	}
+	return time.Second >> -exponent
+}
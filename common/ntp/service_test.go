@@ -0,0 +1,65 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/ntp"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startTestUpstream(t *testing.T, leap byte, stratum byte) M.Socksaddr {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { packetConn.Close() })
+	go func() {
+		buffer := make([]byte, headerLength)
+		for {
+			_, source, err := packetConn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			response := make([]byte, headerLength)
+			response[0] = leap<<6 | 4<<3 | 4
+			response[1] = stratum
+			response[3] = byte(0xec) // 2^-20 s
+			binary.BigEndian.PutUint32(response[4:], 1<<15)
+			binary.BigEndian.PutUint32(response[8:], 1<<14)
+			copy(response[24:32], buffer[40:48])
+			now := uint64(time.Now().Add(time.Hour).Sub(ntpEpoch))
+			timestamp := (now/uint64(time.Second))<<32 | (now%uint64(time.Second))<<32/uint64(time.Second)
+			binary.BigEndian.PutUint64(response[32:], timestamp)
+			binary.BigEndian.PutUint64(response[40:], timestamp)
+			packetConn.WriteTo(response, source)
+		}
+	}()
+	return M.SocksaddrFromNet(packetConn.LocalAddr())
+}
+
+func TestServiceSyncStatus(t *testing.T) {
+	t.Parallel()
+	server := startTestUpstream(t, 0, 2)
+	service := NewService(ntp.Options{Server: server, Timeout: 5 * time.Second})
+	require.NoError(t, service.Start())
+	defer service.Close()
+	status := service.SyncStatus()
+	require.True(t, status.Synchronized)
+	require.Equal(t, server, status.Server)
+	require.Equal(t, uint8(2), status.Stratum)
+	require.GreaterOrEqual(t, status.RootDelay, 500*time.Millisecond)
+	require.GreaterOrEqual(t, status.RootDispersion, 250*time.Millisecond)
+	require.InDelta(t, time.Now().Add(time.Hour).UnixNano(), status.LastSync.UnixNano(), float64(time.Second))
+	require.InDelta(t, time.Hour, service.TimeFunc()().Sub(time.Now()), float64(time.Second))
+}
+
+func TestServiceUnsynchronizedUpstream(t *testing.T) {
+	t.Parallel()
+	service := NewService(ntp.Options{Server: startTestUpstream(t, leapNotInSync, 0), Timeout: 5 * time.Second})
+	require.NoError(t, service.Start())
+	defer service.Close()
+	require.False(t, service.SyncStatus().Synchronized)
+}
@@ -0,0 +1,178 @@
+package pcapng
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// Capture records the plaintext payload of a single connection as synthesised TCP or UDP packets.
+type Capture struct {
+	access      sync.Mutex
+	file        *os.File
+	writer      *Writer
+	network     string
+	source      netip.AddrPort
+	destination netip.AddrPort
+	clientSeq   uint32
+	serverSeq   uint32
+	ipID        uint16
+	err         error
+	closed      bool
+}
+
+// Open creates the capture file and, for TCP, writes a synthesised three-way handshake.
+func Open(path string, network string, source netip.AddrPort, destination netip.AddrPort) (*Capture, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewWriter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	capture := &Capture{
+		file:        file,
+		writer:      writer,
+		network:     network,
+		source:      source,
+		destination: destination,
+		clientSeq:   1,
+		serverSeq:   1,
+	}
+	if network == N.NetworkTCP {
+		capture.access.Lock()
+		capture.writeTCP(true, tcpFlagSYN, nil)
+		capture.writeTCP(false, tcpFlagSYN|tcpFlagACK, nil)
+		capture.writeTCP(true, tcpFlagACK, nil)
+		capture.access.Unlock()
+	}
+	return capture, nil
+}
+
+// Upload records a client to server stream payload.
+func (c *Capture) Upload(payload []byte) {
+	c.writeStream(true, payload)
+}
+
+// Download records a server to client stream payload.
+func (c *Capture) Download(payload []byte) {
+	c.writeStream(false, payload)
+}
+
+// UploadPacket records a client to server datagram.
+func (c *Capture) UploadPacket(destination netip.AddrPort, payload []byte) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if !destination.Addr().IsValid() {
+		destination = c.destination
+	}
+	c.writePacket(c.source, destination, protocolUDP, nil, payload)
+}
+
+// DownloadPacket records a server to client datagram.
+func (c *Capture) DownloadPacket(source netip.AddrPort, payload []byte) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if !source.Addr().IsValid() {
+		source = c.destination
+	}
+	c.writePacket(source, c.source, protocolUDP, nil, payload)
+}
+
+func (c *Capture) Close() error {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if c.closed {
+		return c.err
+	}
+	if c.network == N.NetworkTCP {
+		c.writeTCP(true, tcpFlagFIN|tcpFlagACK, nil)
+		c.writeTCP(false, tcpFlagFIN|tcpFlagACK, nil)
+		c.writeTCP(true, tcpFlagACK, nil)
+	}
+	c.closed = true
+	return E.Errors(c.err, c.file.Close())
+}
+
+func (c *Capture) writeStream(upload bool, payload []byte) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	for len(payload) > 0 {
+		segmentLength := min(len(payload), maxSegmentPayload)
+		c.writeTCP(upload, tcpFlagPSH|tcpFlagACK, payload[:segmentLength])
+		payload = payload[segmentLength:]
+	}
+}
+
+func (c *Capture) writeTCP(upload bool, flags uint8, payload []byte) {
+	segment := &tcpSegment{flags: flags}
+	var source, destination netip.AddrPort
+	if upload {
+		source, destination = c.source, c.destination
+		segment.sequence, segment.ack = c.clientSeq, c.serverSeq
+	} else {
+		source, destination = c.destination, c.source
+		segment.sequence, segment.ack = c.serverSeq, c.clientSeq
+	}
+	if flags&tcpFlagACK == 0 {
+		segment.ack = 0
+	}
+	c.writePacket(source, destination, protocolTCP, segment, payload)
+	advance := uint32(len(payload))
+	if flags&(tcpFlagSYN|tcpFlagFIN) != 0 {
+		advance++
+	}
+	if upload {
+		c.clientSeq += advance
+	} else {
+		c.serverSeq += advance
+	}
+}
+
+func (c *Capture) writePacket(source netip.AddrPort, destination netip.AddrPort, protocol uint8, segment *tcpSegment, payload []byte) {
+	if c.closed || c.err != nil {
+		return
+	}
+	c.ipID++
+	c.err = c.writer.WritePacket(time.Now(), buildPacket(source, destination, protocol, segment, c.ipID, payload))
+}
+
+// FileName returns a capture file name describing the connection.
+func FileName(metadata adapter.InboundContext) string {
+	var destination string
+	if metadata.Destination.IsFqdn() {
+		destination = metadata.Destination.Fqdn
+	} else {
+		destination = metadata.Destination.Addr.String()
+	}
+	name := F.ToString(
+		time.Now().Format("20060102-150405.000000"), "-", metadata.Network, "-",
+		metadata.Source.Addr, "_", metadata.Source.Port, "-",
+		destination, "_", metadata.Destination.Port, ".pcapng",
+	)
+	return strings.NewReplacer(":", ".", "/", "_", "\\", "_").Replace(name)
+}
+
+func connectionAddrs(metadata adapter.InboundContext) (source netip.AddrPort, destination netip.AddrPort) {
+	source = metadata.Source.AddrPort()
+	destinationAddr := metadata.Destination.Addr
+	if !destinationAddr.IsValid() && len(metadata.DestinationAddresses) > 0 {
+		destinationAddr = metadata.DestinationAddresses[0]
+	}
+	destination = netip.AddrPortFrom(destinationAddr, metadata.Destination.Port)
+	return
+}
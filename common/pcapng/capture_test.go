@@ -0,0 +1,99 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readPackets(t *testing.T, path string) [][]byte {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var packets [][]byte
+	for len(content) > 0 {
+		require.GreaterOrEqual(t, len(content), 12)
+		blockType := binary.LittleEndian.Uint32(content)
+		blockLength := binary.LittleEndian.Uint32(content[4:])
+		require.Zero(t, blockLength%4)
+		require.Equal(t, blockLength, binary.LittleEndian.Uint32(content[blockLength-4:]))
+		if blockType == blockTypeEnhancedPacket {
+			capturedLength := binary.LittleEndian.Uint32(content[20:])
+			packets = append(packets, content[enhancedPacketHeaderLength:enhancedPacketHeaderLength+capturedLength])
+		}
+		content = content[blockLength:]
+	}
+	return packets
+}
+
+func TestCaptureTCP(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "tcp.pcapng")
+	capture, err := Open(path, N.NetworkTCP, netip.MustParseAddrPort("10.0.0.2:51234"), netip.MustParseAddrPort("1.1.1.1:443"))
+	require.NoError(t, err)
+	capture.Upload([]byte("hello"))
+	capture.Download([]byte("world!"))
+	require.NoError(t, capture.Close())
+
+	packets := readPackets(t, path)
+	require.Len(t, packets, 8)
+	for _, packet := range packets {
+		require.Equal(t, uint16(0xFFFF), checksum(0, packet[:ipv4HeaderLength]))
+		source := netip.AddrFrom4([4]byte(packet[12:16]))
+		destination := netip.AddrFrom4([4]byte(packet[16:20]))
+		transport := packet[ipv4HeaderLength:]
+		require.Equal(t, uint16(0xFFFF), checksum(pseudoHeaderChecksum(source, destination, protocolTCP, len(transport)), transport))
+	}
+	upload := packets[3]
+	require.Equal(t, uint8(tcpFlagPSH|tcpFlagACK), upload[ipv4HeaderLength+13])
+	require.Equal(t, uint32(2), binary.BigEndian.Uint32(upload[ipv4HeaderLength+4:]))
+	require.Equal(t, "hello", string(upload[ipv4HeaderLength+tcpHeaderLength:]))
+	download := packets[4]
+	require.Equal(t, uint16(443), binary.BigEndian.Uint16(download[ipv4HeaderLength:]))
+	require.Equal(t, uint32(7), binary.BigEndian.Uint32(download[ipv4HeaderLength+8:]))
+	require.Equal(t, "world!", string(download[ipv4HeaderLength+tcpHeaderLength:]))
+}
+
+func TestCaptureUDPMixedFamily(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "udp.pcapng")
+	capture, err := Open(path, N.NetworkUDP, netip.MustParseAddrPort("10.0.0.2:51234"), netip.MustParseAddrPort("[2001:db8::1]:53"))
+	require.NoError(t, err)
+	capture.UploadPacket(netip.AddrPort{}, []byte("query"))
+	capture.DownloadPacket(netip.MustParseAddrPort("[2001:db8::1]:53"), []byte("response"))
+	require.NoError(t, capture.Close())
+
+	packets := readPackets(t, path)
+	require.Len(t, packets, 2)
+	for _, packet := range packets {
+		require.Equal(t, uint8(0x60), packet[0])
+		source := netip.AddrFrom16([16]byte(packet[8:24]))
+		destination := netip.AddrFrom16([16]byte(packet[24:40]))
+		transport := packet[ipv6HeaderLength:]
+		require.Equal(t, uint16(0xFFFF), checksum(pseudoHeaderChecksum(source, destination, protocolUDP, len(transport)), transport))
+	}
+	require.Equal(t, netip.MustParseAddr("::ffff:10.0.0.2"), netip.AddrFrom16([16]byte(packets[0][8:24])))
+	require.Equal(t, "query", string(packets[0][ipv6HeaderLength+udpHeaderLength:]))
+	require.Equal(t, "response", string(packets[1][ipv6HeaderLength+udpHeaderLength:]))
+}
+
+func TestCaptureMissingDirectory(t *testing.T) {
+	t.Parallel()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	conn := NewConn(serverConn, adapter.InboundContext{
+		Source:      M.ParseSocksaddr("10.0.0.2:51234"),
+		Destination: M.ParseSocksaddr("1.1.1.1:443"),
+	})
+	_, err := conn.StartCapture("")
+	require.Error(t, err)
+}
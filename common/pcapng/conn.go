@@ -0,0 +1,172 @@
+package pcapng
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common/buf"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// Capturer is implemented by connections whose plaintext payload can be captured on demand.
+type Capturer interface {
+	StartCapture(directory string) (string, error)
+	StopCapture() error
+}
+
+var (
+	_ Capturer       = (*Conn)(nil)
+	_ N.ExtendedConn = (*Conn)(nil)
+	_ Capturer       = (*PacketConn)(nil)
+	_ N.PacketConn   = (*PacketConn)(nil)
+)
+
+type Conn struct {
+	N.ExtendedConn
+	metadata adapter.InboundContext
+	capture  atomic.Pointer[Capture]
+}
+
+func NewConn(conn net.Conn, metadata adapter.InboundContext) *Conn {
+	return &Conn{
+		ExtendedConn: bufio.NewExtendedConn(conn),
+		metadata:     metadata,
+	}
+}
+
+func (c *Conn) StartCapture(directory string) (string, error) {
+	return startCapture(&c.capture, directory, N.NetworkTCP, c.metadata)
+}
+
+func (c *Conn) StopCapture() error {
+	return stopCapture(&c.capture)
+}
+
+func (c *Conn) Read(p []byte) (n int, err error) {
+	n, err = c.ExtendedConn.Read(p)
+	if n > 0 {
+		if capture := c.capture.Load(); capture != nil {
+			capture.Upload(p[:n])
+		}
+	}
+	return
+}
+
+func (c *Conn) ReadBuffer(buffer *buf.Buffer) error {
+	start := buffer.Len()
+	err := c.ExtendedConn.ReadBuffer(buffer)
+	if err == nil {
+		if capture := c.capture.Load(); capture != nil {
+			capture.Upload(buffer.Bytes()[start:])
+		}
+	}
+	return err
+}
+
+func (c *Conn) Write(p []byte) (n int, err error) {
+	n, err = c.ExtendedConn.Write(p)
+	if n > 0 {
+		if capture := c.capture.Load(); capture != nil {
+			capture.Download(p[:n])
+		}
+	}
+	return
+}
+
+func (c *Conn) WriteBuffer(buffer *buf.Buffer) error {
+	if capture := c.capture.Load(); capture != nil {
+		capture.Download(buffer.Bytes())
+	}
+	return c.ExtendedConn.WriteBuffer(buffer)
+}
+
+func (c *Conn) Close() error {
+	return E.Errors(c.StopCapture(), c.ExtendedConn.Close())
+}
+
+func (c *Conn) Upstream() any {
+	return c.ExtendedConn
+}
+
+type PacketConn struct {
+	N.PacketConn
+	metadata adapter.InboundContext
+	capture  atomic.Pointer[Capture]
+}
+
+func NewPacketConn(conn N.PacketConn, metadata adapter.InboundContext) *PacketConn {
+	return &PacketConn{
+		PacketConn: conn,
+		metadata:   metadata,
+	}
+}
+
+func (c *PacketConn) StartCapture(directory string) (string, error) {
+	return startCapture(&c.capture, directory, N.NetworkUDP, c.metadata)
+}
+
+func (c *PacketConn) StopCapture() error {
+	return stopCapture(&c.capture)
+}
+
+func (c *PacketConn) ReadPacket(buffer *buf.Buffer) (destination M.Socksaddr, err error) {
+	start := buffer.Len()
+	destination, err = c.PacketConn.ReadPacket(buffer)
+	if err == nil {
+		if capture := c.capture.Load(); capture != nil {
+			capture.UploadPacket(destination.AddrPort(), buffer.Bytes()[start:])
+		}
+	}
+	return
+}
+
+func (c *PacketConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	if capture := c.capture.Load(); capture != nil {
+		capture.DownloadPacket(destination.AddrPort(), buffer.Bytes())
+	}
+	return c.PacketConn.WritePacket(buffer, destination)
+}
+
+func (c *PacketConn) Close() error {
+	return E.Errors(c.StopCapture(), c.PacketConn.Close())
+}
+
+func (c *PacketConn) Upstream() any {
+	return c.PacketConn
+}
+
+func startCapture(pointer *atomic.Pointer[Capture], directory string, network string, metadata adapter.InboundContext) (string, error) {
+	if directory == "" {
+		return "", E.New("missing capture directory")
+	}
+	if pointer.Load() != nil {
+		return "", E.New("capture already started")
+	}
+	metadata.Network = network
+	path := filepath.Join(directory, FileName(metadata))
+	source, destination := connectionAddrs(metadata)
+	capture, err := Open(path, network, source, destination)
+	if err != nil {
+		return "", E.Cause(err, "open capture file")
+	}
+	if !pointer.CompareAndSwap(nil, capture) {
+		capture.Close()
+		os.Remove(path)
+		return "", E.New("capture already started")
+	}
+	return path, nil
+}
+
+func stopCapture(pointer *atomic.Pointer[Capture]) error {
+	capture := pointer.Swap(nil)
+	if capture == nil {
+		return nil
+	}
+	return capture.Close()
+}
@@ -0,0 +1,146 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagPSH = 0x08
+	tcpFlagACK = 0x10
+
+	ipv4HeaderLength = 20
+	ipv6HeaderLength = 40
+	tcpHeaderLength  = 20
+	udpHeaderLength  = 8
+
+	maxSegmentPayload = 0xFFFF - ipv6HeaderLength - tcpHeaderLength
+)
+
+type tcpSegment struct {
+	sequence uint32
+	ack      uint32
+	flags    uint8
+}
+
+// unifyAddrs makes the source and the destination address the same family,
+// since both addresses are written into a single synthesised IP header.
+func unifyAddrs(source netip.Addr, destination netip.Addr) (netip.Addr, netip.Addr) {
+	if !source.IsValid() && !destination.IsValid() {
+		return netip.IPv4Unspecified(), netip.IPv4Unspecified()
+	}
+	if !source.IsValid() {
+		source = unspecifiedOf(destination)
+	} else if !destination.IsValid() {
+		destination = unspecifiedOf(source)
+	}
+	source = source.Unmap()
+	destination = destination.Unmap()
+	if source.Is4() != destination.Is4() {
+		source = netip.AddrFrom16(source.As16())
+		destination = netip.AddrFrom16(destination.As16())
+	}
+	return source, destination
+}
+
+func unspecifiedOf(addr netip.Addr) netip.Addr {
+	if addr.Unmap().Is4() {
+		return netip.IPv4Unspecified()
+	}
+	return netip.IPv6Unspecified()
+}
+
+func buildPacket(source netip.AddrPort, destination netip.AddrPort, protocol uint8, segment *tcpSegment, ipID uint16, payload []byte) []byte {
+	sourceAddr, destinationAddr := unifyAddrs(source.Addr(), destination.Addr())
+	var transportHeaderLength int
+	if protocol == protocolTCP {
+		transportHeaderLength = tcpHeaderLength
+	} else {
+		transportHeaderLength = udpHeaderLength
+	}
+	var ipHeaderLength int
+	if sourceAddr.Is4() {
+		ipHeaderLength = ipv4HeaderLength
+	} else {
+		ipHeaderLength = ipv6HeaderLength
+	}
+	transportLength := transportHeaderLength + len(payload)
+	packet := make([]byte, ipHeaderLength+transportLength)
+	if sourceAddr.Is4() {
+		header := packet[:ipv4HeaderLength]
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(len(packet)))
+		binary.BigEndian.PutUint16(header[4:], ipID)
+		binary.BigEndian.PutUint16(header[6:], 0x4000)
+		header[8] = 64
+		header[9] = protocol
+		sourceBytes := sourceAddr.As4()
+		destinationBytes := destinationAddr.As4()
+		copy(header[12:], sourceBytes[:])
+		copy(header[16:], destinationBytes[:])
+		binary.BigEndian.PutUint16(header[10:], ^checksum(0, header))
+	} else {
+		header := packet[:ipv6HeaderLength]
+		header[0] = 0x60
+		binary.BigEndian.PutUint16(header[4:], uint16(transportLength))
+		header[6] = protocol
+		header[7] = 64
+		sourceBytes := sourceAddr.As16()
+		destinationBytes := destinationAddr.As16()
+		copy(header[8:], sourceBytes[:])
+		copy(header[24:], destinationBytes[:])
+	}
+	transport := packet[ipHeaderLength:]
+	binary.BigEndian.PutUint16(transport[0:], source.Port())
+	binary.BigEndian.PutUint16(transport[2:], destination.Port())
+	var checksumOffset int
+	if protocol == protocolTCP {
+		binary.BigEndian.PutUint32(transport[4:], segment.sequence)
+		binary.BigEndian.PutUint32(transport[8:], segment.ack)
+		transport[12] = tcpHeaderLength / 4 << 4
+		transport[13] = segment.flags
+		binary.BigEndian.PutUint16(transport[14:], 0xFFFF)
+		checksumOffset = 16
+	} else {
+		binary.BigEndian.PutUint16(transport[4:], uint16(transportLength))
+		checksumOffset = 6
+	}
+	copy(transport[transportHeaderLength:], payload)
+	sum := pseudoHeaderChecksum(sourceAddr, destinationAddr, protocol, transportLength)
+	transportChecksum := ^checksum(sum, transport)
+	if protocol == protocolUDP && transportChecksum == 0 {
+		transportChecksum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(transport[checksumOffset:], transportChecksum)
+	return packet
+}
+
+func pseudoHeaderChecksum(source netip.Addr, destination netip.Addr, protocol uint8, length int) uint32 {
+	sum := uint32(checksum(0, source.AsSlice()))
+	sum = uint32(checksum(sum, destination.AsSlice()))
+	sum += uint32(protocol)
+	sum += uint32(length) >> 16
+	sum += uint32(length) & 0xFFFF
+	return sum
+}
+
+// checksum returns the folded ones' complement sum of data added to initial.
+func checksum(initial uint32, data []byte) uint16 {
+	sum := initial
+	for len(data) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(data))
+		data = data[2:]
+	}
+	if len(data) == 1 {
+		sum += uint32(data[0]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return uint16(sum)
+}
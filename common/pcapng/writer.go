@@ -0,0 +1,64 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	blockTypeSectionHeader      = 0x0A0D0D0A
+	blockTypeInterfaceDesc      = 0x00000001
+	blockTypeEnhancedPacket     = 0x00000006
+	byteOrderMagic              = 0x1A2B3C4D
+	linkTypeRaw                 = 101
+	enhancedPacketHeaderLength  = 28
+	enhancedPacketTrailerLength = 4
+)
+
+// Writer writes packets in the pcapng format with a single raw IP interface.
+// For the format specification, see https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+type Writer struct {
+	writer io.Writer
+}
+
+func NewWriter(writer io.Writer) (*Writer, error) {
+	var header [48]byte
+	// section header block
+	binary.LittleEndian.PutUint32(header[0:], blockTypeSectionHeader)
+	binary.LittleEndian.PutUint32(header[4:], 28)
+	binary.LittleEndian.PutUint32(header[8:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(header[12:], 1)
+	binary.LittleEndian.PutUint16(header[14:], 0)
+	binary.LittleEndian.PutUint64(header[16:], 0xFFFFFFFFFFFFFFFF)
+	binary.LittleEndian.PutUint32(header[24:], 28)
+	// interface description block
+	binary.LittleEndian.PutUint32(header[28:], blockTypeInterfaceDesc)
+	binary.LittleEndian.PutUint32(header[32:], 20)
+	binary.LittleEndian.PutUint16(header[36:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(header[40:], 0)
+	binary.LittleEndian.PutUint32(header[44:], 20)
+	_, err := writer.Write(header[:])
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{writer: writer}, nil
+}
+
+func (w *Writer) WritePacket(timestamp time.Time, packet []byte) error {
+	padding := (4 - len(packet)%4) % 4
+	blockLength := enhancedPacketHeaderLength + len(packet) + padding + enhancedPacketTrailerLength
+	block := make([]byte, blockLength)
+	micros := uint64(timestamp.UnixMicro())
+	binary.LittleEndian.PutUint32(block[0:], blockTypeEnhancedPacket)
+	binary.LittleEndian.PutUint32(block[4:], uint32(blockLength))
+	binary.LittleEndian.PutUint32(block[8:], 0)
+	binary.LittleEndian.PutUint32(block[12:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(block[16:], uint32(micros))
+	binary.LittleEndian.PutUint32(block[20:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(block[24:], uint32(len(packet)))
+	copy(block[enhancedPacketHeaderLength:], packet)
+	binary.LittleEndian.PutUint32(block[blockLength-4:], uint32(blockLength))
+	_, err := w.writer.Write(block)
+	return err
+}
@@ -0,0 +1,38 @@
+package portmapping
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strings"
+
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+func defaultGateway() (netip.Addr, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gateway, err := hex.DecodeString(fields[2])
+		if err != nil || len(gateway) != 4 {
+			continue
+		}
+		var addr [4]byte
+		binary.LittleEndian.PutUint32(addr[:], binary.BigEndian.Uint32(gateway))
+		if addr == [4]byte{} {
+			continue
+		}
+		return netip.AddrFrom4(addr), nil
+	}
+	return netip.Addr{}, E.New("no IPv4 default route")
+}
@@ -0,0 +1,40 @@
+package portmapping
+
+import (
+	"sync"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common"
+)
+
+var _ adapter.PortMappingManager = (*Manager)(nil)
+
+type Manager struct {
+	access   sync.Mutex
+	mappings []adapter.PortMapping
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+func (m *Manager) Register(mapping adapter.PortMapping) {
+	m.access.Lock()
+	defer m.access.Unlock()
+	m.mappings = append(m.mappings, mapping)
+}
+
+func (m *Manager) Unregister(mapping adapter.PortMapping) {
+	m.access.Lock()
+	defer m.access.Unlock()
+	m.mappings = common.Filter(m.mappings, func(it adapter.PortMapping) bool {
+		return it != mapping
+	})
+}
+
+func (m *Manager) Mappings() []adapter.PortMappingStatus {
+	m.access.Lock()
+	mappings := append([]adapter.PortMapping(nil), m.mappings...)
+	m.access.Unlock()
+	return common.Map(mappings, adapter.PortMapping.Status)
+}
@@ -0,0 +1,295 @@
+package portmapping
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/service"
+)
+
+const (
+	defaultLifetime    = 2 * time.Hour
+	permanentRenewal   = 30 * time.Minute
+	minRetryDelay      = 30 * time.Second
+	maxRetryDelay      = 10 * time.Minute
+	requestTimeout     = 10 * time.Second
+	defaultPMPPort     = 5351
+	defaultSSDPPort    = 1900
+	defaultDescription = "sing-box"
+)
+
+var defaultProtocols = []string{C.PortMappingProtocolPCP, C.PortMappingProtocolNATPMP, C.PortMappingProtocolUPnP}
+
+type client interface {
+	protocol() string
+	gateway() netip.Addr
+	addMapping(ctx context.Context, network string, internal netip.AddrPort, externalPort uint16, lifetime time.Duration) (mapping, error)
+	deleteMapping(ctx context.Context, network string, internal netip.AddrPort, current mapping) error
+}
+
+type mapping struct {
+	external netip.AddrPort
+	lifetime time.Duration
+}
+
+var _ adapter.PortMapping = (*Mapper)(nil)
+
+// Mapper keeps a port mapping for a listening socket on the gateway alive,
+// trying the configured protocols in order until one of them succeeds.
+type Mapper struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	logger      logger.ContextLogger
+	manager     adapter.PortMappingManager
+	network     string
+	listen      netip.AddrPort
+	protocols   []string
+	gatewayAddr netip.Addr
+	external    uint16
+	lifetime    time.Duration
+	description string
+	done        chan struct{}
+
+	pmpPort     uint16
+	ssdpAddress netip.AddrPort
+
+	access  sync.Mutex
+	client  client
+	current mapping
+	status  adapter.PortMappingStatus
+}
+
+func New(ctx context.Context, logger logger.ContextLogger, network string, listen netip.AddrPort, options option.PortMappingOptions) (*Mapper, error) {
+	listen = netip.AddrPortFrom(listen.Addr().Unmap(), listen.Port())
+	if listen.Addr().IsLoopback() {
+		return nil, E.New("port mapping requires a non-loopback listen address")
+	}
+	if listen.Addr().Is6() && !listen.Addr().IsUnspecified() {
+		return nil, E.New("port mapping requires an IPv4 listen address")
+	}
+	if listen.Port() == 0 {
+		return nil, E.New("port mapping requires a listen port")
+	}
+	switch network {
+	case N.NetworkTCP, N.NetworkUDP:
+	default:
+		return nil, E.Extend(N.ErrUnknownNetwork, network)
+	}
+	protocols := []string(options.Protocols)
+	if len(protocols) == 0 {
+		protocols = defaultProtocols
+	}
+	for _, protocol := range protocols {
+		switch protocol {
+		case C.PortMappingProtocolPCP, C.PortMappingProtocolNATPMP, C.PortMappingProtocolUPnP:
+		default:
+			return nil, E.New("unknown port mapping protocol: ", protocol)
+		}
+	}
+	lifetime := time.Duration(options.Lifetime)
+	if lifetime == 0 {
+		lifetime = defaultLifetime
+	}
+	description := options.Description
+	if description == "" {
+		description = defaultDescription
+	}
+	externalPort := options.ExternalPort
+	if externalPort == 0 {
+		externalPort = listen.Port()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Mapper{
+		ctx:         ctx,
+		cancel:      cancel,
+		logger:      logger,
+		manager:     service.FromContext[adapter.PortMappingManager](ctx),
+		network:     network,
+		listen:      listen,
+		protocols:   protocols,
+		gatewayAddr: options.Gateway.Build(netip.Addr{}),
+		external:    externalPort,
+		lifetime:    lifetime,
+		description: description,
+		done:        make(chan struct{}),
+		pmpPort:     defaultPMPPort,
+		ssdpAddress: netip.AddrPortFrom(netip.AddrFrom4([4]byte{239, 255, 255, 250}), defaultSSDPPort),
+		status: adapter.PortMappingStatus{
+			Network:         network,
+			InternalAddress: listen,
+		},
+	}, nil
+}
+
+func (m *Mapper) Start() {
+	if m.manager != nil {
+		m.manager.Register(m)
+	}
+	go m.loopRefresh()
+}
+
+func (m *Mapper) Close() error {
+	m.cancel()
+	<-m.done
+	if m.manager != nil {
+		m.manager.Unregister(m)
+	}
+	m.access.Lock()
+	currentClient, current := m.client, m.current
+	m.access.Unlock()
+	if currentClient == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	err := currentClient.deleteMapping(ctx, m.network, m.internalAddress(currentClient.gateway()), current)
+	if err != nil {
+		return E.Cause(err, "remove ", currentClient.protocol(), " port mapping")
+	}
+	m.logger.Info("removed ", currentClient.protocol(), " port mapping for ", m.network, " ", current.external)
+	return nil
+}
+
+func (m *Mapper) Status() adapter.PortMappingStatus {
+	m.access.Lock()
+	defer m.access.Unlock()
+	return m.status
+}
+
+func (m *Mapper) loopRefresh() {
+	defer close(m.done)
+	retryDelay := minRetryDelay
+	for {
+		var wait time.Duration
+		renewAfter, err := m.refresh()
+		if err != nil {
+			m.logger.Error(E.Cause(err, "port mapping for ", m.network, " ", m.listen))
+			m.access.Lock()
+			m.status.Error = err.Error()
+			m.access.Unlock()
+			wait = retryDelay
+			retryDelay = min(retryDelay*2, maxRetryDelay)
+		} else {
+			wait = renewAfter
+			retryDelay = minRetryDelay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-m.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (m *Mapper) refresh() (time.Duration, error) {
+	m.access.Lock()
+	currentClient := m.client
+	m.access.Unlock()
+	if currentClient != nil {
+		renewAfter, err := m.addMapping(currentClient)
+		if err == nil {
+			return renewAfter, nil
+		}
+		m.logger.Debug(E.Cause(err, "renew ", currentClient.protocol(), " port mapping"))
+	}
+	var errors []error
+	for _, protocol := range m.protocols {
+		newClient, err := m.newClient(protocol)
+		if err == nil {
+			var renewAfter time.Duration
+			renewAfter, err = m.addMapping(newClient)
+			if err == nil {
+				return renewAfter, nil
+			}
+		}
+		errors = append(errors, E.Cause(err, protocol))
+	}
+	m.access.Lock()
+	m.client = nil
+	m.access.Unlock()
+	return 0, E.Errors(errors...)
+}
+
+func (m *Mapper) newClient(protocol string) (client, error) {
+	if protocol == C.PortMappingProtocolUPnP {
+		ctx, cancel := context.WithTimeout(m.ctx, requestTimeout)
+		defer cancel()
+		return discoverUPnP(ctx, m.ssdpAddress, m.gatewayAddr, m.description)
+	}
+	gatewayAddr := m.gatewayAddr
+	if !gatewayAddr.IsValid() {
+		var err error
+		gatewayAddr, err = defaultGateway()
+		if err != nil {
+			return nil, E.Cause(err, "find gateway, set gateway manually")
+		}
+	}
+	gatewayAddrPort := netip.AddrPortFrom(gatewayAddr, m.pmpPort)
+	if protocol == C.PortMappingProtocolPCP {
+		return newPCPClient(gatewayAddrPort), nil
+	}
+	return &natPMPClient{gatewayAddr: gatewayAddrPort}, nil
+}
+
+func (m *Mapper) addMapping(currentClient client) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(m.ctx, requestTimeout)
+	defer cancel()
+	internal := m.internalAddress(currentClient.gateway())
+	if !internal.Addr().IsValid() {
+		return 0, E.New("unknown local address to gateway ", currentClient.gateway())
+	}
+	newMapping, err := currentClient.addMapping(ctx, m.network, internal, m.external, m.lifetime)
+	if err != nil {
+		return 0, err
+	}
+	m.access.Lock()
+	changed := m.client != currentClient || m.current.external != newMapping.external
+	m.client = currentClient
+	m.current = newMapping
+	m.status.Protocol = currentClient.protocol()
+	m.status.Gateway = currentClient.gateway()
+	m.status.ExternalAddress = newMapping.external
+	m.status.Error = ""
+	if newMapping.lifetime > 0 {
+		m.status.Expires = time.Now().Add(newMapping.lifetime)
+	} else {
+		m.status.Expires = time.Time{}
+	}
+	m.access.Unlock()
+	if changed {
+		m.logger.Info("mapped ", m.network, " ", internal, " to external address ", newMapping.external, " via ", currentClient.protocol())
+	} else {
+		m.logger.Debug("renewed ", currentClient.protocol(), " port mapping for ", m.network, " ", newMapping.external)
+	}
+	if newMapping.lifetime <= 0 {
+		return permanentRenewal, nil
+	}
+	return newMapping.lifetime / 2, nil
+}
+
+// internalAddress returns the listen address, or the local address used to
+// reach the gateway when listening on all addresses.
+func (m *Mapper) internalAddress(gateway netip.Addr) netip.AddrPort {
+	if !m.listen.Addr().IsUnspecified() {
+		return m.listen
+	}
+	conn, err := net.DialUDP("udp4", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(gateway, m.pmpPort)))
+	if err != nil {
+		return netip.AddrPortFrom(netip.Addr{}, m.listen.Port())
+	}
+	defer conn.Close()
+	localAddr := common.Must1(netip.ParseAddrPort(conn.LocalAddr().String()))
+	return netip.AddrPortFrom(localAddr.Addr().Unmap(), m.listen.Port())
+}
@@ -0,0 +1,293 @@
+package portmapping
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json/badoption"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testExternalAddr = netip.MustParseAddr("203.0.113.7")
+
+type fakeGateway struct {
+	conn      *net.UDPConn
+	natPMP    bool
+	access    sync.Mutex
+	lifetimes []uint32
+}
+
+func newFakeGateway(t *testing.T, natPMP bool) *fakeGateway {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	gateway := &fakeGateway{conn: conn, natPMP: natPMP}
+	go gateway.loop()
+	return gateway
+}
+
+func (g *fakeGateway) port() uint16 {
+	return uint16(g.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func (g *fakeGateway) requests() []uint32 {
+	g.access.Lock()
+	defer g.access.Unlock()
+	return append([]uint32(nil), g.lifetimes...)
+}
+
+func (g *fakeGateway) loop() {
+	buffer := make([]byte, 1100)
+	for {
+		n, source, err := g.conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			return
+		}
+		response := g.handle(buffer[:n])
+		if response != nil {
+			g.conn.WriteToUDPAddrPort(response, source)
+		}
+	}
+}
+
+func (g *fakeGateway) handle(request []byte) []byte {
+	if request[0] == pcpVersion {
+		if g.natPMP {
+			response := make([]byte, 8)
+			response[1] = natPMPResponseFlag | request[1]
+			binary.BigEndian.PutUint16(response[2:], 1)
+			return response
+		}
+		if len(request) != pcpHeaderLength+pcpMapLength || request[1] != pcpOpMap {
+			return nil
+		}
+		lifetime := binary.BigEndian.Uint32(request[4:8])
+		g.record(lifetime)
+		response := make([]byte, pcpHeaderLength+pcpMapLength)
+		response[0] = pcpVersion
+		response[1] = pcpResponseFlag | pcpOpMap
+		binary.BigEndian.PutUint32(response[4:], lifetime)
+		payload := response[pcpHeaderLength:]
+		copy(payload, request[pcpHeaderLength:pcpHeaderLength+20])
+		binary.BigEndian.PutUint16(payload[18:], binary.BigEndian.Uint16(request[pcpHeaderLength+18:])+1)
+		externalAddr := netip.AddrFrom16(testExternalAddr.As16()).As16()
+		copy(payload[20:], externalAddr[:])
+		return response
+	}
+	if !g.natPMP {
+		return nil
+	}
+	switch request[1] {
+	case natPMPOpExternalAddr:
+		response := make([]byte, 12)
+		response[1] = natPMPResponseFlag
+		externalAddr := testExternalAddr.As4()
+		copy(response[8:], externalAddr[:])
+		return response
+	case natPMPOpMapUDP, natPMPOpMapTCP:
+		lifetime := binary.BigEndian.Uint32(request[8:12])
+		g.record(lifetime)
+		response := make([]byte, 16)
+		response[1] = natPMPResponseFlag | request[1]
+		copy(response[8:10], request[4:6])
+		binary.BigEndian.PutUint16(response[10:], binary.BigEndian.Uint16(request[6:8])+1)
+		binary.BigEndian.PutUint32(response[12:], lifetime)
+		return response
+	}
+	return nil
+}
+
+func (g *fakeGateway) record(lifetime uint32) {
+	g.access.Lock()
+	defer g.access.Unlock()
+	g.lifetimes = append(g.lifetimes, lifetime)
+}
+
+func newTestMapper(t *testing.T, network string, protocols []string) *Mapper {
+	mapper, err := New(context.Background(), log.NewNOPFactory().Logger(), network, netip.MustParseAddrPort("0.0.0.0:4000"), option.PortMappingOptions{
+		Enabled:   true,
+		Protocols: protocols,
+		Gateway:   (*badoption.Addr)(common.Ptr(netip.AddrFrom4([4]byte{127, 0, 0, 1}))),
+		Lifetime:  badoption.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+	return mapper
+}
+
+func waitMapped(t *testing.T, mapper *Mapper) {
+	require.Eventually(t, func() bool {
+		return mapper.Status().ExternalAddress.IsValid()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMapperPCP(t *testing.T) {
+	t.Parallel()
+	gateway := newFakeGateway(t, false)
+	mapper := newTestMapper(t, N.NetworkUDP, nil)
+	mapper.pmpPort = gateway.port()
+	mapper.Start()
+	waitMapped(t, mapper)
+	status := mapper.Status()
+	require.Equal(t, C.PortMappingProtocolPCP, status.Protocol)
+	require.Equal(t, netip.AddrPortFrom(testExternalAddr, 4001), status.ExternalAddress)
+	require.WithinDuration(t, time.Now().Add(time.Hour), status.Expires, time.Minute)
+	require.Empty(t, status.Error)
+	require.NoError(t, mapper.Close())
+	require.Equal(t, []uint32{3600, 0}, gateway.requests())
+}
+
+func TestMapperNATPMP(t *testing.T) {
+	t.Parallel()
+	gateway := newFakeGateway(t, true)
+	mapper := newTestMapper(t, N.NetworkTCP, nil)
+	mapper.pmpPort = gateway.port()
+	mapper.Start()
+	waitMapped(t, mapper)
+	status := mapper.Status()
+	require.Equal(t, C.PortMappingProtocolNATPMP, status.Protocol)
+	require.Equal(t, netip.AddrPortFrom(testExternalAddr, 4001), status.ExternalAddress)
+	require.NoError(t, mapper.Close())
+	require.Equal(t, []uint32{3600, 0}, gateway.requests())
+}
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+type fakeIGD struct {
+	access  sync.Mutex
+	actions []string
+}
+
+func (d *fakeIGD) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/rootDesc.xml":
+		io.WriteString(w, testDescription)
+		return
+	case "/ctl/IPConn":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	soapAction := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	serviceType, action, _ := strings.Cut(soapAction, "#")
+	if serviceType != "urn:schemas-upnp-org:service:WANIPConnection:1" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	arguments := parseSOAPValues(body)
+	d.access.Lock()
+	switch action {
+	case "AddPortMapping":
+		d.actions = append(d.actions, fmt.Sprint(action, " ", arguments["NewProtocol"], " ", arguments["NewExternalPort"], " ", arguments["NewInternalClient"], ":", arguments["NewInternalPort"], " ", arguments["NewLeaseDuration"]))
+	case "DeletePortMapping":
+		d.actions = append(d.actions, fmt.Sprint(action, " ", arguments["NewProtocol"], " ", arguments["NewExternalPort"]))
+	}
+	d.access.Unlock()
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	if action == "AddPortMapping" && arguments["NewLeaseDuration"] != "0" {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>725</errorCode><errorDescription>OnlyPermanentLeasesSupported</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+		return
+	}
+	io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:`+action+`Response xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`)
+	if action == "GetExternalIPAddress" {
+		io.WriteString(w, "<NewExternalIPAddress>"+testExternalAddr.String()+"</NewExternalIPAddress>")
+	}
+	io.WriteString(w, `</u:`+action+`Response></s:Body></s:Envelope>`)
+}
+
+func TestMapperUPnP(t *testing.T) {
+	t.Parallel()
+	igd := &fakeIGD{}
+	server := httptest.NewServer(igd)
+	t.Cleanup(server.Close)
+	ssdpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { ssdpConn.Close() })
+	go func() {
+		buffer := make([]byte, 2048)
+		for {
+			n, source, err := ssdpConn.ReadFromUDPAddrPort(buffer)
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(string(buffer[:n]), "M-SEARCH * HTTP/1.1\r\n") {
+				continue
+			}
+			ssdpConn.WriteToUDPAddrPort([]byte("HTTP/1.1 200 OK\r\n"+
+				"CACHE-CONTROL: max-age=120\r\n"+
+				"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n"+
+				"LOCATION: "+server.URL+"/rootDesc.xml\r\n\r\n"), source)
+		}
+	}()
+	mapper, err := New(context.Background(), log.NewNOPFactory().Logger(), N.NetworkTCP, netip.MustParseAddrPort("0.0.0.0:4000"), option.PortMappingOptions{
+		Enabled:      true,
+		Protocols:    []string{C.PortMappingProtocolUPnP},
+		ExternalPort: 4100,
+	})
+	require.NoError(t, err)
+	mapper.ssdpAddress = netip.MustParseAddrPort(ssdpConn.LocalAddr().String())
+	mapper.Start()
+	waitMapped(t, mapper)
+	status := mapper.Status()
+	require.Equal(t, C.PortMappingProtocolUPnP, status.Protocol)
+	require.Equal(t, netip.AddrFrom4([4]byte{127, 0, 0, 1}), status.Gateway)
+	require.Equal(t, netip.AddrPortFrom(testExternalAddr, 4100), status.ExternalAddress)
+	require.True(t, status.Expires.IsZero())
+	require.NoError(t, mapper.Close())
+	igd.access.Lock()
+	defer igd.access.Unlock()
+	require.Equal(t, []string{
+		"AddPortMapping TCP 4100 127.0.0.1:4000 7200",
+		"AddPortMapping TCP 4100 127.0.0.1:4000 0",
+		"DeletePortMapping TCP 4100",
+	}, igd.actions)
+}
+
+func TestNewMapperValidation(t *testing.T) {
+	t.Parallel()
+	logger := log.NewNOPFactory().Logger()
+	_, err := New(context.Background(), logger, N.NetworkTCP, netip.MustParseAddrPort("127.0.0.1:4000"), option.PortMappingOptions{Enabled: true})
+	require.Error(t, err)
+	_, err = New(context.Background(), logger, N.NetworkTCP, netip.MustParseAddrPort("[2001:db8::1]:4000"), option.PortMappingOptions{Enabled: true})
+	require.Error(t, err)
+	_, err = New(context.Background(), logger, N.NetworkTCP, netip.MustParseAddrPort("0.0.0.0:4000"), option.PortMappingOptions{Enabled: true, Protocols: []string{"igd"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package portmapping
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const (
+	natPMPVersion         = 0
+	natPMPOpExternalAddr  = 0
+	natPMPOpMapUDP        = 1
+	natPMPOpMapTCP        = 2
+	natPMPResponseFlag    = 0x80
+	natPMPInitialInterval = 250 * time.Millisecond
+	natPMPMaxAttempts     = 4
+)
+
+type natPMPClient struct {
+	gatewayAddr netip.AddrPort
+}
+
+func (c *natPMPClient) protocol() string {
+	return C.PortMappingProtocolNATPMP
+}
+
+func (c *natPMPClient) gateway() netip.Addr {
+	return c.gatewayAddr.Addr()
+}
+
+func (c *natPMPClient) addMapping(ctx context.Context, network string, internal netip.AddrPort, externalPort uint16, lifetime time.Duration) (mapping, error) {
+	response, err := exchangeUDP(ctx, c.gatewayAddr, []byte{natPMPVersion, natPMPOpExternalAddr}, func(response []byte) (bool, error) {
+		return checkNATPMPResponse(response, natPMPOpExternalAddr, 12)
+	})
+	if err != nil {
+		return mapping{}, E.Cause(err, "request external address")
+	}
+	externalAddr := netip.AddrFrom4([4]byte(response[8:12]))
+	response, err = c.requestMapping(ctx, network, internal.Port(), externalPort, lifetime)
+	if err != nil {
+		return mapping{}, err
+	}
+	return mapping{
+		external: netip.AddrPortFrom(externalAddr, binary.BigEndian.Uint16(response[10:12])),
+		lifetime: time.Duration(binary.BigEndian.Uint32(response[12:16])) * time.Second,
+	}, nil
+}
+
+func (c *natPMPClient) deleteMapping(ctx context.Context, network string, internal netip.AddrPort, current mapping) error {
+	_, err := c.requestMapping(ctx, network, internal.Port(), 0, 0)
+	return err
+}
+
+func (c *natPMPClient) requestMapping(ctx context.Context, network string, internalPort uint16, externalPort uint16, lifetime time.Duration) ([]byte, error) {
+	opcode := byte(natPMPOpMapUDP)
+	if network == N.NetworkTCP {
+		opcode = natPMPOpMapTCP
+	}
+	request := make([]byte, 12)
+	request[0] = natPMPVersion
+	request[1] = opcode
+	binary.BigEndian.PutUint16(request[4:], internalPort)
+	binary.BigEndian.PutUint16(request[6:], externalPort)
+	binary.BigEndian.PutUint32(request[8:], uint32(lifetime/time.Second))
+	return exchangeUDP(ctx, c.gatewayAddr, request, func(response []byte) (bool, error) {
+		matched, err := checkNATPMPResponse(response, opcode, 16)
+		if !matched || err != nil {
+			return matched, err
+		}
+		return binary.BigEndian.Uint16(response[8:10]) == internalPort, nil
+	})
+}
+
+func checkNATPMPResponse(response []byte, opcode byte, length int) (bool, error) {
+	if len(response) < 4 || response[1] != natPMPResponseFlag|opcode {
+		return false, nil
+	}
+	if response[0] != natPMPVersion {
+		return true, E.New("unsupported NAT-PMP version ", response[0])
+	}
+	resultCode := binary.BigEndian.Uint16(response[2:4])
+	if resultCode != 0 {
+		return true, E.New("NAT-PMP error: ", natPMPResultString(resultCode))
+	}
+	if len(response) < length {
+		return true, E.New("short NAT-PMP response")
+	}
+	return true, nil
+}
+
+func natPMPResultString(code uint16) string {
+	switch code {
+	case 1:
+		return "unsupported version"
+	case 2:
+		return "not authorized"
+	case 3:
+		return "network failure"
+	case 4:
+		return "out of resources"
+	case 5:
+		return "unsupported opcode"
+	default:
+		return E.New("result code ", code).Error()
+	}
+}
+
+// exchangeUDP sends the request with the RFC 6886 retransmission schedule
+// until check reports a matching response.
+func exchangeUDP(ctx context.Context, server netip.AddrPort, request []byte, check func(response []byte) (bool, error)) ([]byte, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(server))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	buffer := make([]byte, 1100)
+	interval := natPMPInitialInterval
+	for attempt := 0; attempt < natPMPMaxAttempts; attempt++ {
+		_, err = conn.Write(request)
+		if err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(interval)
+		if ctxDeadline, loaded := ctx.Deadline(); loaded && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		for {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			err = conn.SetReadDeadline(deadline)
+			if err != nil {
+				return nil, err
+			}
+			var n int
+			n, err = conn.Read(buffer)
+			if err != nil {
+				if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			matched, checkErr := check(buffer[:n])
+			if checkErr != nil {
+				return nil, checkErr
+			}
+			if matched {
+				return append([]byte(nil), buffer[:n]...), nil
+			}
+		}
+		interval *= 2
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, E.New("no response from ", server)
+}
@@ -0,0 +1,129 @@
+package portmapping
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const (
+	pcpVersion      = 2
+	pcpOpMap        = 1
+	pcpResponseFlag = 0x80
+	pcpHeaderLength = 24
+	pcpMapLength    = 36
+	pcpProtocolTCP  = 6
+	pcpProtocolUDP  = 17
+)
+
+type pcpClient struct {
+	gatewayAddr netip.AddrPort
+	nonce       [12]byte
+}
+
+func newPCPClient(gatewayAddr netip.AddrPort) *pcpClient {
+	client := &pcpClient{gatewayAddr: gatewayAddr}
+	rand.Read(client.nonce[:])
+	return client
+}
+
+func (c *pcpClient) protocol() string {
+	return C.PortMappingProtocolPCP
+}
+
+func (c *pcpClient) gateway() netip.Addr {
+	return c.gatewayAddr.Addr()
+}
+
+func (c *pcpClient) addMapping(ctx context.Context, network string, internal netip.AddrPort, externalPort uint16, lifetime time.Duration) (mapping, error) {
+	return c.requestMapping(ctx, network, internal, externalPort, netip.IPv4Unspecified(), lifetime)
+}
+
+func (c *pcpClient) deleteMapping(ctx context.Context, network string, internal netip.AddrPort, current mapping) error {
+	_, err := c.requestMapping(ctx, network, internal, current.external.Port(), current.external.Addr(), 0)
+	return err
+}
+
+func (c *pcpClient) requestMapping(ctx context.Context, network string, internal netip.AddrPort, externalPort uint16, externalAddr netip.Addr, lifetime time.Duration) (mapping, error) {
+	protocol := byte(pcpProtocolUDP)
+	if network == N.NetworkTCP {
+		protocol = pcpProtocolTCP
+	}
+	request := make([]byte, pcpHeaderLength+pcpMapLength)
+	request[0] = pcpVersion
+	request[1] = pcpOpMap
+	binary.BigEndian.PutUint32(request[4:], uint32(lifetime/time.Second))
+	clientAddr := netip.AddrFrom16(internal.Addr().As16()).As16()
+	copy(request[8:24], clientAddr[:])
+	payload := request[pcpHeaderLength:]
+	copy(payload[0:12], c.nonce[:])
+	payload[12] = protocol
+	binary.BigEndian.PutUint16(payload[16:], internal.Port())
+	binary.BigEndian.PutUint16(payload[18:], externalPort)
+	suggestedAddr := externalAddr.As16()
+	copy(payload[20:36], suggestedAddr[:])
+	response, err := exchangeUDP(ctx, c.gatewayAddr, request, func(response []byte) (bool, error) {
+		if len(response) < 4 || response[1] != pcpResponseFlag|pcpOpMap {
+			return false, nil
+		}
+		if response[0] != pcpVersion {
+			return true, E.New("unsupported PCP version ", response[0])
+		}
+		if response[3] != 0 {
+			return true, E.New("PCP error: ", pcpResultString(response[3]))
+		}
+		if len(response) < pcpHeaderLength+pcpMapLength {
+			return true, E.New("short PCP response")
+		}
+		return bytes.Equal(response[pcpHeaderLength:pcpHeaderLength+12], c.nonce[:]), nil
+	})
+	if err != nil {
+		return mapping{}, err
+	}
+	responsePayload := response[pcpHeaderLength:]
+	assignedAddr := netip.AddrFrom16([16]byte(responsePayload[20:36])).Unmap()
+	return mapping{
+		external: netip.AddrPortFrom(assignedAddr, binary.BigEndian.Uint16(responsePayload[18:20])),
+		lifetime: time.Duration(binary.BigEndian.Uint32(response[4:8])) * time.Second,
+	}, nil
+}
+
+func pcpResultString(code byte) string {
+	switch code {
+	case 1:
+		return "unsupported version"
+	case 2:
+		return "not authorized"
+	case 3:
+		return "malformed request"
+	case 4:
+		return "unsupported opcode"
+	case 5:
+		return "unsupported option"
+	case 6:
+		return "malformed option"
+	case 7:
+		return "network failure"
+	case 8:
+		return "no resources"
+	case 9:
+		return "unsupported protocol"
+	case 10:
+		return "user exceeded quota"
+	case 11:
+		return "cannot provide external"
+	case 12:
+		return "address mismatch"
+	case 13:
+		return "excessive remote peers"
+	default:
+		return E.New("result code ", code).Error()
+	}
+}
@@ -0,0 +1,355 @@
+package portmapping
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const (
+	upnpErrorOnlyPermanentLeases = 725
+	upnpDiscoverTimeout          = 2 * time.Second
+	upnpMaxDescriptionSize       = 1 << 20
+)
+
+var upnpSearchTargets = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+}
+
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+type upnpClient struct {
+	httpClient  *http.Client
+	controlURL  string
+	serviceType string
+	gatewayAddr netip.Addr
+	description string
+}
+
+type upnpError struct {
+	code        int
+	description string
+}
+
+func (e *upnpError) Error() string {
+	return "UPnP error " + strconv.Itoa(e.code) + ": " + e.description
+}
+
+type upnpRoot struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+type upnpDevice struct {
+	DeviceType string        `xml:"deviceType"`
+	Services   []upnpService `xml:"serviceList>service"`
+	Devices    []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+func (d *upnpDevice) findService(serviceType string) *upnpService {
+	for i := range d.Services {
+		if d.Services[i].ServiceType == serviceType {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		service := d.Devices[i].findService(serviceType)
+		if service != nil {
+			return service
+		}
+	}
+	return nil
+}
+
+func discoverUPnP(ctx context.Context, ssdpAddress netip.AddrPort, gatewayAddr netip.Addr, description string) (*upnpClient, error) {
+	locations, err := searchSSDP(ctx, ssdpAddress, gatewayAddr)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{Timeout: requestTimeout}
+	var errors []error
+	for _, location := range locations {
+		client, err := newUPnPClient(ctx, httpClient, location, description)
+		if err != nil {
+			errors = append(errors, E.Cause(err, location))
+			continue
+		}
+		return client, nil
+	}
+	if len(errors) == 0 {
+		return nil, E.New("no internet gateway device found")
+	}
+	return nil, E.Errors(errors...)
+}
+
+func searchSSDP(ctx context.Context, ssdpAddress netip.AddrPort, gatewayAddr netip.Addr) ([]string, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	destination := net.UDPAddrFromAddrPort(ssdpAddress)
+	for _, searchTarget := range upnpSearchTargets {
+		request := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddress.String() + "\r\n" +
+			"ST: " + searchTarget + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n\r\n"
+		_, err = conn.WriteToUDP([]byte(request), destination)
+		if err != nil {
+			return nil, E.Cause(err, "send SSDP search")
+		}
+	}
+	deadline := time.Now().Add(upnpDiscoverTimeout)
+	if ctxDeadline, loaded := ctx.Deadline(); loaded && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+	var locations []string
+	buffer := make([]byte, 2048)
+	for {
+		n, source, err := conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		if gatewayAddr.IsValid() && source.Addr().Unmap() != gatewayAddr {
+			continue
+		}
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buffer[:n])), nil)
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+		location := response.Header.Get("Location")
+		if location == "" || common.Contains(locations, location) {
+			continue
+		}
+		locations = append(locations, location)
+		// the first valid answer is almost always the gateway
+		if len(locations) == 1 {
+			err = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(locations) == 0 {
+		return nil, E.New("no SSDP response")
+	}
+	return locations, nil
+}
+
+func newUPnPClient(ctx context.Context, httpClient *http.Client, location string, description string) (*upnpClient, error) {
+	locationURL, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	gatewayAddr, err := netip.ParseAddr(locationURL.Hostname())
+	if err != nil {
+		return nil, E.New("invalid device location: ", location)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, E.New("fetch device description: ", response.Status)
+	}
+	var root upnpRoot
+	err = xml.NewDecoder(io.LimitReader(response.Body, upnpMaxDescriptionSize)).Decode(&root)
+	if err != nil {
+		return nil, E.Cause(err, "decode device description")
+	}
+	baseURL := locationURL
+	if root.URLBase != "" {
+		baseURL, err = url.Parse(root.URLBase)
+		if err != nil {
+			return nil, E.Cause(err, "invalid URLBase")
+		}
+	}
+	for _, serviceType := range upnpServiceTypes {
+		service := root.Device.findService(serviceType)
+		if service == nil {
+			continue
+		}
+		controlURL, err := baseURL.Parse(service.ControlURL)
+		if err != nil {
+			return nil, E.Cause(err, "invalid control URL")
+		}
+		return &upnpClient{
+			httpClient:  httpClient,
+			controlURL:  controlURL.String(),
+			serviceType: serviceType,
+			gatewayAddr: gatewayAddr.Unmap(),
+			description: description,
+		}, nil
+	}
+	return nil, E.New("missing WAN connection service")
+}
+
+func (c *upnpClient) protocol() string {
+	return C.PortMappingProtocolUPnP
+}
+
+func (c *upnpClient) gateway() netip.Addr {
+	return c.gatewayAddr
+}
+
+func (c *upnpClient) addMapping(ctx context.Context, network string, internal netip.AddrPort, externalPort uint16, lifetime time.Duration) (mapping, error) {
+	if externalPort == 0 {
+		externalPort = internal.Port()
+	}
+	err := c.addPortMapping(ctx, network, internal, externalPort, lifetime)
+	var upnpErr *upnpError
+	if errors.As(err, &upnpErr) && upnpErr.code == upnpErrorOnlyPermanentLeases {
+		lifetime = 0
+		err = c.addPortMapping(ctx, network, internal, externalPort, lifetime)
+	}
+	if err != nil {
+		return mapping{}, E.Cause(err, "AddPortMapping")
+	}
+	result, err := c.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return mapping{}, E.Cause(err, "GetExternalIPAddress")
+	}
+	externalAddr, err := netip.ParseAddr(result["NewExternalIPAddress"])
+	if err != nil {
+		return mapping{}, E.New("invalid external address: ", result["NewExternalIPAddress"])
+	}
+	return mapping{
+		external: netip.AddrPortFrom(externalAddr, externalPort),
+		lifetime: lifetime,
+	}, nil
+}
+
+func (c *upnpClient) addPortMapping(ctx context.Context, network string, internal netip.AddrPort, externalPort uint16, lifetime time.Duration) error {
+	_, err := c.call(ctx, "AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(externalPort))},
+		{"NewProtocol", upnpProtocol(network)},
+		{"NewInternalPort", strconv.Itoa(int(internal.Port()))},
+		{"NewInternalClient", internal.Addr().String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", c.description},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	})
+	return err
+}
+
+func (c *upnpClient) deleteMapping(ctx context.Context, network string, internal netip.AddrPort, current mapping) error {
+	_, err := c.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(current.external.Port()))},
+		{"NewProtocol", upnpProtocol(network)},
+	})
+	if err != nil {
+		return E.Cause(err, "DeletePortMapping")
+	}
+	return nil
+}
+
+func (c *upnpClient) call(ctx context.Context, action string, arguments [][2]string) (map[string]string, error) {
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?>` + "\r\n")
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	body.WriteString(`<u:` + action + ` xmlns:u="` + c.serviceType + `">`)
+	for _, argument := range arguments {
+		body.WriteString("<" + argument[0] + ">" + html.EscapeString(argument[1]) + "</" + argument[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.controlURL, strings.NewReader(body.String()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	request.Header.Set("SOAPAction", `"`+c.serviceType+"#"+action+`"`)
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(response.Body, upnpMaxDescriptionSize))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		fault := parseSOAPValues(content)
+		code, _ := strconv.Atoi(fault["errorCode"])
+		if code != 0 {
+			return nil, &upnpError{code: code, description: fault["errorDescription"]}
+		}
+		return nil, E.New("unexpected response: ", response.Status)
+	}
+	return parseSOAPValues(content), nil
+}
+
+// parseSOAPValues collects the text content of all leaf elements by local name,
+// which covers both action responses and UPnPError faults.
+func parseSOAPValues(content []byte) map[string]string {
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	var name string
+	var text []byte
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return values
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			name = element.Name.Local
+			text = text[:0]
+		case xml.CharData:
+			text = append(text, element...)
+		case xml.EndElement:
+			if name == element.Name.Local {
+				values[name] = strings.TrimSpace(string(text))
+			}
+			name = ""
+		}
+	}
+}
+
+func upnpProtocol(network string) string {
+	if network == N.NetworkTCP {
+		return "TCP"
+	}
+	return "UDP"
+}
@@ -0,0 +1,49 @@
+package proxyproto
+
+import (
+	std_bufio "bufio"
+	"errors"
+	"net"
+
+	"github.com/sagernet/sing/common/buf"
+	"github.com/sagernet/sing/common/bufio"
+	M "github.com/sagernet/sing/common/metadata"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Metadata is the connection information read from a PROXY protocol header.
+type Metadata struct {
+	Source      M.Socksaddr
+	Destination M.Socksaddr
+	Info
+}
+
+// ReadConn reads a PROXY protocol header from conn.
+//
+// The returned conn must be used in place of conn, since data after the header may have been buffered.
+// The returned metadata is nil for LOCAL headers, or if acceptNoHeader is set and no header is present.
+func ReadConn(conn net.Conn, acceptNoHeader bool) (net.Conn, *Metadata, error) {
+	reader := std_bufio.NewReader(conn)
+	header, err := proxyproto.Read(reader)
+	if err != nil && !(acceptNoHeader && errors.Is(err, proxyproto.ErrNoProxyProtocol)) {
+		return nil, nil, err
+	}
+	if reader.Buffered() > 0 {
+		cached, _ := reader.Peek(reader.Buffered())
+		conn = bufio.NewCachedConn(conn, buf.As(cached))
+	}
+	if header == nil || header.Command != proxyproto.PROXY {
+		return conn, nil, nil
+	}
+	metadata := &Metadata{
+		Source:      M.SocksaddrFromNet(header.SourceAddr).Unwrap(),
+		Destination: M.SocksaddrFromNet(header.DestinationAddr).Unwrap(),
+	}
+	tlvs, err := header.TLVs()
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata.loadTLVs(tlvs)
+	return conn, metadata, nil
+}
@@ -0,0 +1,63 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConn(t *testing.T) {
+	t.Parallel()
+	info := Info{
+		User:       "sekai",
+		Inbound:    "vless-in",
+		ServerName: "example.org",
+	}
+	header, err := Header(2, N.NetworkTCP, M.ParseSocksaddr("1.2.3.4:1000"), M.ParseSocksaddr("5.6.7.8:2000"), info)
+	require.NoError(t, err)
+	conn := readTestConn(t, append(header, "hello"...), false, &Metadata{
+		Source:      M.ParseSocksaddr("1.2.3.4:1000"),
+		Destination: M.ParseSocksaddr("5.6.7.8:2000"),
+		Info:        info,
+	})
+	content, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+}
+
+func TestReadConnNoHeader(t *testing.T) {
+	t.Parallel()
+	conn := readTestConn(t, []byte("hello"), true, nil)
+	content, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	go func() {
+		clientConn.Write([]byte("hello"))
+		clientConn.Close()
+	}()
+	_, _, err = ReadConn(serverConn, false)
+	require.Error(t, err)
+}
+
+func readTestConn(t *testing.T, content []byte, acceptNoHeader bool, expected *Metadata) net.Conn {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+	})
+	go func() {
+		clientConn.Write(content)
+		clientConn.Close()
+	}()
+	conn, metadata, err := ReadConn(serverConn, acceptNoHeader)
+	require.NoError(t, err)
+	require.Equal(t, expected, metadata)
+	return conn
+}
@@ -0,0 +1,118 @@
+package proxyproto
+
+import (
+	"net"
+	"net/netip"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/pires/go-proxyproto"
+)
+
+const (
+	TLVTypeServerName = proxyproto.PP2_TYPE_AUTHORITY
+	TLVTypeUser       = proxyproto.PP2_TYPE_MIN_CUSTOM
+	TLVTypeInbound    = proxyproto.PP2_TYPE_MIN_CUSTOM + 1
+)
+
+// Info is the connection metadata carried in PROXY protocol v2 TLVs.
+type Info struct {
+	User       string
+	Inbound    string
+	ServerName string
+}
+
+func (i Info) tlvs() []proxyproto.TLV {
+	var tlvs []proxyproto.TLV
+	if i.ServerName != "" {
+		tlvs = append(tlvs, proxyproto.TLV{Type: TLVTypeServerName, Value: []byte(i.ServerName)})
+	}
+	if i.User != "" {
+		tlvs = append(tlvs, proxyproto.TLV{Type: TLVTypeUser, Value: []byte(i.User)})
+	}
+	if i.Inbound != "" {
+		tlvs = append(tlvs, proxyproto.TLV{Type: TLVTypeInbound, Value: []byte(i.Inbound)})
+	}
+	return tlvs
+}
+
+func (i *Info) loadTLVs(tlvs []proxyproto.TLV) {
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case TLVTypeServerName:
+			i.ServerName = string(tlv.Value)
+		case TLVTypeUser:
+			i.User = string(tlv.Value)
+		case TLVTypeInbound:
+			i.Inbound = string(tlv.Value)
+		}
+	}
+}
+
+// Header encodes a PROXY protocol header describing a connection from source to destination.
+//
+// A LOCAL header is returned if either address is not an IP address.
+// info is only encoded in version 2.
+func Header(version uint8, network string, source M.Socksaddr, destination M.Socksaddr, info Info) ([]byte, error) {
+	header, err := newHeader(version, network, source, destination)
+	if err != nil {
+		return nil, err
+	}
+	if version == 2 {
+		err = header.SetTLVs(info.tlvs())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return header.Format()
+}
+
+func newHeader(version uint8, network string, source M.Socksaddr, destination M.Socksaddr) (*proxyproto.Header, error) {
+	if version != 1 && version != 2 {
+		return nil, E.New("unknown PROXY protocol version: ", version)
+	}
+	network = N.NetworkName(network)
+	if network == N.NetworkUDP && version == 1 {
+		return nil, E.New("PROXY protocol v1 does not support UDP")
+	}
+	header := &proxyproto.Header{
+		Version:           version,
+		Command:           proxyproto.LOCAL,
+		TransportProtocol: proxyproto.UNSPEC,
+	}
+	source = source.Unwrap()
+	destination = destination.Unwrap()
+	if !source.IsIP() || !destination.IsIP() {
+		return header, nil
+	}
+	sourceAddr, destinationAddr := source.Addr, destination.Addr
+	isIPv4 := sourceAddr.Is4() && destinationAddr.Is4()
+	if !isIPv4 {
+		sourceAddr = netip.AddrFrom16(sourceAddr.As16())
+		destinationAddr = netip.AddrFrom16(destinationAddr.As16())
+	}
+	header.Command = proxyproto.PROXY
+	switch network {
+	case N.NetworkTCP:
+		if isIPv4 {
+			header.TransportProtocol = proxyproto.TCPv4
+		} else {
+			header.TransportProtocol = proxyproto.TCPv6
+		}
+		header.SourceAddr = &net.TCPAddr{IP: sourceAddr.AsSlice(), Port: int(source.Port)}
+		header.DestinationAddr = &net.TCPAddr{IP: destinationAddr.AsSlice(), Port: int(destination.Port)}
+	case N.NetworkUDP:
+		if isIPv4 {
+			header.TransportProtocol = proxyproto.UDPv4
+		} else {
+			header.TransportProtocol = proxyproto.UDPv6
+		}
+		header.SourceAddr = &net.UDPAddr{IP: sourceAddr.AsSlice(), Port: int(source.Port)}
+		header.DestinationAddr = &net.UDPAddr{IP: destinationAddr.AsSlice(), Port: int(destination.Port)}
+	default:
+		return nil, E.New("unsupported network: ", network)
+	}
+	return header, nil
+}
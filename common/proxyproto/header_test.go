@@ -0,0 +1,65 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeader(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range []struct {
+		name        string
+		version     uint8
+		network     string
+		source      string
+		destination string
+		protocol    proxyproto.AddressFamilyAndProtocol
+	}{
+		{"v1 tcp4", 1, N.NetworkTCP, "1.2.3.4:1000", "5.6.7.8:2000", proxyproto.TCPv4},
+		{"v1 tcp6", 1, N.NetworkTCP, "[2001:db8::1]:1000", "[2001:db8::2]:2000", proxyproto.TCPv6},
+		{"v2 tcp4", 2, N.NetworkTCP, "1.2.3.4:1000", "5.6.7.8:2000", proxyproto.TCPv4},
+		{"v2 udp4", 2, N.NetworkUDP, "1.2.3.4:1000", "5.6.7.8:2000", proxyproto.UDPv4},
+		{"v2 udp6", 2, N.NetworkUDP, "[2001:db8::1]:1000", "[2001:db8::2]:2000", proxyproto.UDPv6},
+		{"v2 mixed", 2, N.NetworkTCP, "1.2.3.4:1000", "[2001:db8::2]:2000", proxyproto.TCPv6},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := Header(testCase.version, testCase.network, M.ParseSocksaddr(testCase.source), M.ParseSocksaddr(testCase.destination), Info{})
+			require.NoError(t, err)
+			header, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(content)))
+			require.NoError(t, err)
+			require.Equal(t, testCase.version, header.Version)
+			require.Equal(t, proxyproto.PROXY, header.Command)
+			require.Equal(t, testCase.protocol, header.TransportProtocol)
+			sourceAddr, destinationAddr, loaded := header.IPs()
+			require.True(t, loaded)
+			require.True(t, sourceAddr.Equal(net.IP(M.ParseSocksaddr(testCase.source).Addr.AsSlice())))
+			require.True(t, destinationAddr.Equal(net.IP(M.ParseSocksaddr(testCase.destination).Addr.AsSlice())))
+		})
+	}
+}
+
+func TestHeaderLocal(t *testing.T) {
+	t.Parallel()
+	content, err := Header(2, N.NetworkTCP, M.ParseSocksaddr("example.org:80"), M.ParseSocksaddr("1.2.3.4:80"), Info{})
+	require.NoError(t, err)
+	header, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(content)))
+	require.NoError(t, err)
+	require.Equal(t, proxyproto.LOCAL, header.Command)
+}
+
+func TestHeaderInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := Header(1, N.NetworkUDP, M.ParseSocksaddr("1.2.3.4:1000"), M.ParseSocksaddr("5.6.7.8:2000"), Info{})
+	require.Error(t, err)
+	_, err = Header(3, N.NetworkTCP, M.ParseSocksaddr("1.2.3.4:1000"), M.ParseSocksaddr("5.6.7.8:2000"), Info{})
+	require.Error(t, err)
+}
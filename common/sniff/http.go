@@ -23,6 +23,7 @@ func HTTPHost(_ context.Context, metadata *adapter.InboundContext, reader io.Rea
 		}
 	}
 	metadata.Protocol = C.ProtocolHTTP
+	metadata.HTTPRequest = adapter.NewHTTPRequest(request)
 	metadata.Domain = M.ParseSocksaddr(request.Host).AddrString()
 	return nil
 }
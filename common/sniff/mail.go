@@ -0,0 +1,132 @@
+package sniff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+)
+
+const mailMaxCommandLineLength = 512
+
+var (
+	smtpCommands = []string{"EHLO", "HELO", "LHLO", "STARTTLS"}
+	imapCommands = []string{"CAPABILITY", "LOGIN", "AUTHENTICATE", "STARTTLS", "ID", "NOOP"}
+	pop3Commands = []string{"CAPA", "USER", "APOP", "AUTH", "STLS"}
+)
+
+// SMTP detects if the stream is a SMTP connection by the first client command.
+// Since SMTP is a server-first protocol, this only works when the server greeting has been sent by another party.
+func SMTP(_ context.Context, metadata *adapter.InboundContext, reader io.Reader) error {
+	line, complete, err := readMailCommandLine(reader)
+	if err != nil {
+		return err
+	}
+	err = matchMailCommand(line, complete, smtpCommands)
+	if err != nil {
+		return err
+	}
+	metadata.Protocol = C.ProtocolSMTP
+	return nil
+}
+
+// IMAP detects if the stream is an IMAP connection by the first tagged client command.
+func IMAP(_ context.Context, metadata *adapter.InboundContext, reader io.Reader) error {
+	line, complete, err := readMailCommandLine(reader)
+	if err != nil {
+		return err
+	}
+	tagIndex := bytes.IndexByte(line, ' ')
+	tag := line
+	if tagIndex >= 0 {
+		tag = line[:tagIndex]
+	}
+	if !isIMAPTag(tag) {
+		return os.ErrInvalid
+	}
+	if tagIndex < 0 {
+		if complete {
+			return os.ErrInvalid
+		}
+		return ErrNeedMoreData
+	}
+	err = matchMailCommand(line[tagIndex+1:], complete, imapCommands)
+	if err != nil {
+		return err
+	}
+	metadata.Protocol = C.ProtocolIMAP
+	return nil
+}
+
+// POP3 detects if the stream is a POP3 connection by the first client command.
+func POP3(_ context.Context, metadata *adapter.InboundContext, reader io.Reader) error {
+	line, complete, err := readMailCommandLine(reader)
+	if err != nil {
+		return err
+	}
+	err = matchMailCommand(line, complete, pop3Commands)
+	if err != nil {
+		return err
+	}
+	metadata.Protocol = C.ProtocolPOP3
+	return nil
+}
+
+func readMailCommandLine(reader io.Reader) (line []byte, complete bool, err error) {
+	buffer := make([]byte, mailMaxCommandLineLength)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	buffer = buffer[:n]
+	lineEnd := bytes.Index(buffer, []byte("\r\n"))
+	if lineEnd < 0 {
+		if n == mailMaxCommandLineLength {
+			return nil, false, os.ErrInvalid
+		}
+		return buffer, false, nil
+	}
+	return buffer[:lineEnd], true, nil
+}
+
+func matchMailCommand(line []byte, complete bool, commands []string) error {
+	for _, command := range commands {
+		if len(line) < len(command) {
+			if !complete && strings.EqualFold(string(line), command[:len(line)]) {
+				return ErrNeedMoreData
+			}
+			continue
+		}
+		if !strings.EqualFold(string(line[:len(command)]), command) {
+			continue
+		}
+		if len(line) > len(command) && line[len(command)] != ' ' {
+			continue
+		}
+		if !complete {
+			return ErrNeedMoreData
+		}
+		return nil
+	}
+	return os.ErrInvalid
+}
+
+func isIMAPTag(tag []byte) bool {
+	if len(tag) == 0 || len(tag) > 32 {
+		return false
+	}
+	for _, c := range tag {
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+		switch c {
+		case '(', ')', '{', '%', '*', '"', '\\', '+':
+			return false
+		}
+	}
+	return true
+}
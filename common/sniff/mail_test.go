@@ -0,0 +1,58 @@
+package sniff_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/sniff"
+	C "github.com/sagernet/sing-box/constant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffSMTP(t *testing.T) {
+	t.Parallel()
+	var metadata adapter.InboundContext
+	err := sniff.SMTP(context.TODO(), &metadata, strings.NewReader("EHLO mail.example.org\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolSMTP, metadata.Protocol)
+
+	err = sniff.SMTP(context.TODO(), &metadata, strings.NewReader("EHL"))
+	require.ErrorIs(t, err, sniff.ErrNeedMoreData)
+
+	err = sniff.SMTP(context.TODO(), &metadata, strings.NewReader("GET / HTTP/1.1\r\n"))
+	require.NotEmpty(t, err)
+	require.NotErrorIs(t, err, sniff.ErrNeedMoreData)
+}
+
+func TestSniffIMAP(t *testing.T) {
+	t.Parallel()
+	var metadata adapter.InboundContext
+	err := sniff.IMAP(context.TODO(), &metadata, strings.NewReader("a001 CAPABILITY\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolIMAP, metadata.Protocol)
+
+	err = sniff.IMAP(context.TODO(), &metadata, strings.NewReader("a001 LOG"))
+	require.ErrorIs(t, err, sniff.ErrNeedMoreData)
+
+	err = sniff.IMAP(context.TODO(), &metadata, strings.NewReader("* OK IMAP4rev1 ready\r\n"))
+	require.NotEmpty(t, err)
+	require.NotErrorIs(t, err, sniff.ErrNeedMoreData)
+}
+
+func TestSniffPOP3(t *testing.T) {
+	t.Parallel()
+	var metadata adapter.InboundContext
+	err := sniff.POP3(context.TODO(), &metadata, strings.NewReader("USER alice\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolPOP3, metadata.Protocol)
+
+	err = sniff.POP3(context.TODO(), &metadata, strings.NewReader("CAPA"))
+	require.ErrorIs(t, err, sniff.ErrNeedMoreData)
+
+	err = sniff.POP3(context.TODO(), &metadata, strings.NewReader("USERNAME\r\n"))
+	require.NotEmpty(t, err)
+	require.NotErrorIs(t, err, sniff.ErrNeedMoreData)
+}
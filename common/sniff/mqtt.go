@@ -0,0 +1,90 @@
+package sniff
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const mqttPacketTypeConnect = 0x10
+
+// MQTT detects if the stream is a MQTT connection starting with a CONNECT packet.
+// For the MQTT protocol specification, see https://docs.oasis-open.org/mqtt/mqtt/v5.0/mqtt-v5.0.html
+func MQTT(_ context.Context, metadata *adapter.InboundContext, reader io.Reader) error {
+	var packetType uint8
+	err := binary.Read(reader, binary.BigEndian, &packetType)
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	if packetType != mqttPacketTypeConnect {
+		return os.ErrInvalid
+	}
+	var remainingLength uint32
+	for i := 0; ; i++ {
+		if i == 4 {
+			return os.ErrInvalid
+		}
+		var encodedByte uint8
+		err = binary.Read(reader, binary.BigEndian, &encodedByte)
+		if err != nil {
+			return E.Cause1(ErrNeedMoreData, err)
+		}
+		remainingLength |= uint32(encodedByte&0x7f) << (7 * i)
+		if encodedByte&0x80 == 0 {
+			break
+		}
+	}
+	var protocolNameLength uint16
+	err = binary.Read(reader, binary.BigEndian, &protocolNameLength)
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	var minLevel, maxLevel uint8
+	var protocolName string
+	switch protocolNameLength {
+	case 4:
+		protocolName = "MQTT"
+		minLevel, maxLevel = 4, 5
+	case 6:
+		protocolName = "MQIsdp"
+		minLevel, maxLevel = 3, 3
+	default:
+		return os.ErrInvalid
+	}
+	// protocol name, protocol level, connect flags and keep alive
+	if remainingLength < uint32(protocolNameLength)+6 {
+		return os.ErrInvalid
+	}
+	name := make([]byte, protocolNameLength)
+	n, err := io.ReadFull(reader, name)
+	if string(name[:n]) != protocolName[:n] {
+		return os.ErrInvalid
+	}
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	var protocolLevel uint8
+	err = binary.Read(reader, binary.BigEndian, &protocolLevel)
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	if protocolLevel < minLevel || protocolLevel > maxLevel {
+		return os.ErrInvalid
+	}
+	var connectFlags uint8
+	err = binary.Read(reader, binary.BigEndian, &connectFlags)
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	// the reserved flag must be zero
+	if connectFlags&0x01 != 0 {
+		return os.ErrInvalid
+	}
+	metadata.Protocol = C.ProtocolMQTT
+	return nil
+}
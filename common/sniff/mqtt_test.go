@@ -0,0 +1,52 @@
+package sniff_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/sniff"
+	C "github.com/sagernet/sing-box/constant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffMQTT(t *testing.T) {
+	t.Parallel()
+	for _, pktHex := range []string{
+		// MQTT 3.1.1
+		"101000044d5154540402003c0004746573740000",
+		// MQTT 5.0
+		"101100044d5154540502003c000004746573740000",
+		// MQTT 3.1
+		"101200064d514973647003020000000474657374",
+	} {
+		pkt, err := hex.DecodeString(pktHex)
+		require.NoError(t, err)
+		var metadata adapter.InboundContext
+		err = sniff.MQTT(context.TODO(), &metadata, bytes.NewReader(pkt))
+		require.NoError(t, err, pktHex)
+		require.Equal(t, C.ProtocolMQTT, metadata.Protocol)
+	}
+}
+
+func TestSniffIncompleteMQTT(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("101000044d51")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.MQTT(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.ErrorIs(t, err, sniff.ErrNeedMoreData)
+}
+
+func TestSniffNotMQTT(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("101000044d5151540402003c000474657374")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.MQTT(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.NotEmpty(t, err)
+	require.NotErrorIs(t, err, sniff.ErrNeedMoreData)
+}
@@ -0,0 +1,61 @@
+package sniff
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const mtprotoObfuscated2HeaderSize = 64
+
+// MTProto detects if the stream is a Telegram MTProto connection using the obfuscated2 transport.
+// For the transport specification, see https://core.telegram.org/mtproto/mtproto-transports#transport-obfuscation
+func MTProto(_ context.Context, metadata *adapter.InboundContext, reader io.Reader) error {
+	var header [mtprotoObfuscated2HeaderSize]byte
+	n, err := io.ReadFull(reader, header[:])
+	if n > 0 && !isMTProtoObfuscated2Prefix(header[:n]) {
+		return os.ErrInvalid
+	}
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	block, err := aes.NewCipher(header[8:40])
+	if err != nil {
+		return err
+	}
+	var decrypted [mtprotoObfuscated2HeaderSize]byte
+	cipher.NewCTR(block, header[40:56]).XORKeyStream(decrypted[:], header[:])
+	switch binary.BigEndian.Uint32(decrypted[56:60]) {
+	case 0xefefefef, 0xeeeeeeee, 0xdddddddd:
+	default:
+		return os.ErrInvalid
+	}
+	metadata.Protocol = C.ProtocolMTProto
+	return nil
+}
+
+// isMTProtoObfuscated2Prefix checks the restrictions applied by clients when generating the random header,
+// which make it distinguishable from the other transports.
+func isMTProtoObfuscated2Prefix(prefix []byte) bool {
+	if prefix[0] == 0xef {
+		return false
+	}
+	if len(prefix) < 4 {
+		return true
+	}
+	switch string(prefix[:4]) {
+	case "HEAD", "POST", "GET ", "OPTI", "\xee\xee\xee\xee", "\xdd\xdd\xdd\xdd", "\x16\x03\x01\x02":
+		return false
+	}
+	if len(prefix) < 8 {
+		return true
+	}
+	return binary.BigEndian.Uint32(prefix[4:8]) != 0
+}
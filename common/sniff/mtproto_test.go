@@ -0,0 +1,43 @@
+package sniff_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/sniff"
+	C "github.com/sagernet/sing-box/constant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffMTProto(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("0b30557a9fc4e90e33587da2c7ec11365b80a5caef14395e83a8cdf2173c6186abd0f51a3f6489aed3f81d42678cb1d6fb20456a8fb4d9feee2da500b7dc0126")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.MTProto(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolMTProto, metadata.Protocol)
+}
+
+func TestSniffIncompleteMTProto(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("0b30557a9fc4e90e33587da2c7ec1136")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.MTProto(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.ErrorIs(t, err, sniff.ErrNeedMoreData)
+}
+
+func TestSniffNotMTProto(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("0b30557a9fc4e90e33587da2c7ec11365b80a5caef14395e83a8cdf2173c6186abd0f51a3f6489aed3f81d42678cb1d6fb20456a8fb4d9feee2da5ffb7dc0126")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.MTProto(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.NotEmpty(t, err)
+	require.NotErrorIs(t, err, sniff.ErrNeedMoreData)
+}
@@ -0,0 +1,106 @@
+package sniff
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const (
+	openVPNHardResetClientV1 = 1
+	openVPNHardResetClientV2 = 7
+	openVPNHardResetClientV3 = 10
+
+	openVPNMinResetSize = 14
+	openVPNMaxResetSize = 1600
+)
+
+// OpenVPN detects if the stream is an OpenVPN TCP connection starting with a client hard reset.
+func OpenVPN(_ context.Context, metadata *adapter.InboundContext, reader io.Reader) error {
+	var length uint16
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	if length < openVPNMinResetSize || length > openVPNMaxResetSize {
+		return os.ErrInvalid
+	}
+	var opcode uint8
+	err = binary.Read(reader, binary.BigEndian, &opcode)
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	if !isOpenVPNHardResetClient(opcode) {
+		return os.ErrInvalid
+	}
+	packet := make([]byte, length)
+	packet[0] = opcode
+	_, err = io.ReadFull(reader, packet[1:])
+	if err != nil {
+		return E.Cause1(ErrNeedMoreData, err)
+	}
+	if !isOpenVPNHardReset(packet) {
+		return os.ErrInvalid
+	}
+	metadata.Protocol = C.ProtocolOpenVPN
+	return nil
+}
+
+// OpenVPNPacket detects if the packet is an OpenVPN UDP client hard reset.
+func OpenVPNPacket(_ context.Context, metadata *adapter.InboundContext, packet []byte) error {
+	if len(packet) < openVPNMinResetSize || len(packet) > openVPNMaxResetSize {
+		return os.ErrInvalid
+	}
+	if !isOpenVPNHardResetClient(packet[0]) || !isOpenVPNHardReset(packet) {
+		return os.ErrInvalid
+	}
+	metadata.Protocol = C.ProtocolOpenVPN
+	return nil
+}
+
+func isOpenVPNHardResetClient(opcode uint8) bool {
+	// the key id of a hard reset is always zero
+	if opcode&0x07 != 0 {
+		return false
+	}
+	switch opcode >> 3 {
+	case openVPNHardResetClientV1, openVPNHardResetClientV2, openVPNHardResetClientV3:
+		return true
+	default:
+		return false
+	}
+}
+
+func isOpenVPNHardReset(packet []byte) bool {
+	// opcode (1 byte) and session id (8 bytes)
+	if binary.BigEndian.Uint64(packet[1:9]) == 0 {
+		return false
+	}
+	payload := packet[9:]
+	// no control channel protection: empty ack array and message packet id 0
+	if len(payload) >= 5 && payload[0] == 0 && binary.BigEndian.Uint32(payload[1:5]) == 0 {
+		return true
+	}
+	// tls-auth: hmac, replay packet id 1 and net time, then empty ack array and message packet id 0
+	for _, hmacSize := range []int{20, 32, 64} {
+		if len(payload) < hmacSize+13 {
+			break
+		}
+		if binary.BigEndian.Uint32(payload[hmacSize:]) == 1 &&
+			binary.BigEndian.Uint32(payload[hmacSize+4:]) != 0 &&
+			payload[hmacSize+8] == 0 &&
+			binary.BigEndian.Uint32(payload[hmacSize+9:]) == 0 {
+			return true
+		}
+	}
+	// tls-crypt: replay packet id 1 and net time, then a 32 bytes authentication tag
+	if len(payload) >= 40 && binary.BigEndian.Uint32(payload[:4]) == 1 && binary.BigEndian.Uint32(payload[4:8]) != 0 {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package sniff_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/sniff"
+	C "github.com/sagernet/sing-box/constant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffOpenVPN(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("000e38a1b2c3d4e5f60718000000000000")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.OpenVPN(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolOpenVPN, metadata.Protocol)
+}
+
+func TestSniffIncompleteOpenVPN(t *testing.T) {
+	t.Parallel()
+	pkt, err := hex.DecodeString("000e38a1b2c3")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.OpenVPN(context.TODO(), &metadata, bytes.NewReader(pkt))
+	require.ErrorIs(t, err, sniff.ErrNeedMoreData)
+}
+
+func TestSniffOpenVPNPacket(t *testing.T) {
+	t.Parallel()
+	for _, packetHex := range []string{
+		// no control channel protection
+		"38a1b2c3d4e5f6071800000000000000",
+		// tls-auth with HMAC-SHA1
+		"38a1b2c3d4e5f60718" + "0102030405060708090a0b0c0d0e0f1011121314" + "00000001" + "66a1b2c3" + "00" + "00000000",
+		// tls-crypt
+		"38a1b2c3d4e5f60718" + "00000001" + "66a1b2c3" + "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebf" + "c0c1c2c3c4c5",
+	} {
+		packet, err := hex.DecodeString(packetHex)
+		require.NoError(t, err)
+		var metadata adapter.InboundContext
+		err = sniff.OpenVPNPacket(context.Background(), &metadata, packet)
+		require.NoError(t, err, packetHex)
+		require.Equal(t, C.ProtocolOpenVPN, metadata.Protocol)
+	}
+}
+
+func TestSniffNotOpenVPNPacket(t *testing.T) {
+	t.Parallel()
+	packet, err := hex.DecodeString("39a1b2c3d4e5f6071800000000000000")
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.OpenVPNPacket(context.Background(), &metadata, packet)
+	require.ErrorIs(t, err, os.ErrInvalid)
+
+	packet, err = hex.DecodeString("38a1b2c3d4e5f60718ffffffffffffffffffffffffffffff")
+	require.NoError(t, err)
+	err = sniff.OpenVPNPacket(context.Background(), &metadata, packet)
+	require.ErrorIs(t, err, os.ErrInvalid)
+}
@@ -0,0 +1,34 @@
+package sniff
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+)
+
+const (
+	wireGuardMessageTypeHandshakeInitiation = 1
+	wireGuardHandshakeInitiationSize        = 148
+)
+
+// WireGuard detects if the packet is a WireGuard handshake initiation.
+// For the WireGuard protocol specification, see https://www.wireguard.com/protocol/
+func WireGuard(_ context.Context, metadata *adapter.InboundContext, packet []byte) error {
+	if len(packet) != wireGuardHandshakeInitiationSize {
+		return os.ErrInvalid
+	}
+	// message type, the three reserved bytes that follow are not checked
+	// as some peers (e.g. WARP) put client identifiers in them
+	if packet[0] != wireGuardMessageTypeHandshakeInitiation {
+		return os.ErrInvalid
+	}
+	// sender index must not be zero
+	if binary.LittleEndian.Uint32(packet[4:8]) == 0 {
+		return os.ErrInvalid
+	}
+	metadata.Protocol = C.ProtocolWireGuard
+	return nil
+}
@@ -0,0 +1,46 @@
+package sniff_test
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/sniff"
+	C "github.com/sagernet/sing-box/constant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffWireGuard(t *testing.T) {
+	t.Parallel()
+	packet, err := hex.DecodeString("01000000" + "6b0d1f3a" + strings.Repeat("5a", 140))
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.WireGuard(context.Background(), &metadata, packet)
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolWireGuard, metadata.Protocol)
+
+	// reserved bytes set by the peer
+	packet[1], packet[2], packet[3] = 0x12, 0x34, 0x56
+	metadata = adapter.InboundContext{}
+	err = sniff.WireGuard(context.Background(), &metadata, packet)
+	require.NoError(t, err)
+	require.Equal(t, C.ProtocolWireGuard, metadata.Protocol)
+}
+
+func TestSniffNotWireGuard(t *testing.T) {
+	t.Parallel()
+	packet, err := hex.DecodeString("04000000" + "6b0d1f3a" + strings.Repeat("5a", 140))
+	require.NoError(t, err)
+	var metadata adapter.InboundContext
+	err = sniff.WireGuard(context.Background(), &metadata, packet)
+	require.ErrorIs(t, err, os.ErrInvalid)
+
+	packet, err = hex.DecodeString("01000000" + "6b0d1f3a" + strings.Repeat("5a", 100))
+	require.NoError(t, err)
+	err = sniff.WireGuard(context.Background(), &metadata, packet)
+	require.ErrorIs(t, err, os.ErrInvalid)
+}
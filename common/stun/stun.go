@@ -387,6 +387,21 @@ func roundTrip(conn net.PacketConn, addr net.Addr, txID TransactionID, attrs []s
 	}
 }
 
+// Binding sends a binding request over conn and returns the mapped address
+// reported by the server, the read deadline of conn is reset afterwards.
+func Binding(conn net.PacketConn, server net.Addr) (netip.AddrPort, error) {
+	defer conn.SetReadDeadline(time.Time{})
+	resp, _, err := roundTrip(conn, server, newTransactionID(), nil, defaultRTO)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	externalAddr, ok := resp.externalAddr()
+	if !ok {
+		return netip.AddrPort{}, E.New("no mapped address in response")
+	}
+	return externalAddr, nil
+}
+
 func Run(options Options) (*Result, error) {
 	ctx := options.Context
 	if ctx == nil {
@@ -57,7 +57,13 @@ func parseECHClientConfig(ctx context.Context, clientConfig ECHCapableConfig, op
 
 func parseECHServerConfig(ctx context.Context, options option.InboundTLSOptions, tlsConfig *tls.Config, echKeyPath *string) error {
 	var echKey []byte
-	if len(options.ECH.Key) > 0 {
+	if options.ECH.KeyManager != "" {
+		if len(options.ECH.Key) > 0 || options.ECH.KeyPath != "" {
+			return E.New("ECH key_manager is mutually exclusive with key and key_path")
+		}
+		// keys are loaded from the key manager on start
+		return nil
+	} else if len(options.ECH.Key) > 0 {
 		echKey = []byte(strings.Join(options.ECH.Key, "\n"))
 	} else if options.ECH.KeyPath != "" {
 		content, err := os.ReadFile(options.ECH.KeyPath)
@@ -94,6 +100,34 @@ func (c *STDServerConfig) setECHServerConfig(echKey []byte) error {
 	return nil
 }
 
+func (c *STDServerConfig) startECHKeyManager() error {
+	if c.serviceManager == nil {
+		return E.New("missing service manager in context")
+	}
+	rawService, loaded := c.serviceManager.Get(c.echKeyManagerTag)
+	if !loaded {
+		return E.New("ECH key manager not found: ", c.echKeyManagerTag)
+	}
+	keyManager, isKeyManager := rawService.(adapter.ECHKeyManager)
+	if !isKeyManager {
+		return E.New("service/", rawService.Type(), "[", c.echKeyManagerTag, "] is not an ECH key manager")
+	}
+	err := c.setECHServerConfig(keyManager.ECHKeys())
+	if err != nil {
+		return E.Cause(err, "load ECH keys from ", c.echKeyManagerTag)
+	}
+	c.echKeyManager = keyManager
+	c.echKeysCallback = keyManager.RegisterCallback(func(echKeys []byte) {
+		err := c.setECHServerConfig(echKeys)
+		if err != nil {
+			c.logger.Error(E.Cause(err, "reload ECH keys"))
+			return
+		}
+		c.logger.Info("reloaded ECH keys")
+	})
+	return nil
+}
+
 func parseECHKeys(echKey []byte) ([]tls.EncryptedClientHelloKey, error) {
 	block, _ := pem.Decode(echKey)
 	if block == nil || block.Type != "ECH KEYS" {
@@ -15,11 +15,7 @@ type ECHCapableConfig interface {
 }
 
 func ECHKeygenDefault(publicName string) (configPem string, keyPem string, err error) {
-	echKey, err := ecdh.X25519().GenerateKey(rand.Reader)
-	if err != nil {
-		return
-	}
-	echConfig, err := marshalECHConfig(0, echKey.PublicKey().Bytes(), publicName, 0)
+	privateKey, echConfig, err := ECHKeygen(0, publicName)
 	if err != nil {
 		return
 	}
@@ -33,7 +29,7 @@ func ECHKeygenDefault(publicName string) (configPem string, keyPem string, err e
 	}
 	keyBuilder := cryptobyte.NewBuilder(nil)
 	keyBuilder.AddUint16LengthPrefixed(func(builder *cryptobyte.Builder) {
-		builder.AddBytes(echKey.Bytes())
+		builder.AddBytes(privateKey)
 	})
 	keyBuilder.AddUint16LengthPrefixed(func(builder *cryptobyte.Builder) {
 		builder.AddBytes(echConfig)
@@ -47,6 +43,20 @@ func ECHKeygenDefault(publicName string) (configPem string, keyPem string, err e
 	return
 }
 
+// ECHKeygen generates a X25519 ECH private key and the matching ECHConfig with the given config id.
+func ECHKeygen(configID uint8, publicName string) (privateKey []byte, echConfig []byte, err error) {
+	echKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	echConfig, err = marshalECHConfig(configID, echKey.PublicKey().Bytes(), publicName, 0)
+	if err != nil {
+		return
+	}
+	privateKey = echKey.Bytes()
+	return
+}
+
 func marshalECHConfig(id uint8, pubKey []byte, publicName string, maxNameLen uint8) ([]byte, error) {
 	const extensionEncryptedClientHello = 0xfe0d
 	const DHKEM_X25519_HKDF_SHA256 = 0x0020
@@ -0,0 +1,254 @@
+package tls
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/certificate"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/domain"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/ntp"
+	"github.com/sagernet/sing/contrab/freelru"
+	"github.com/sagernet/sing/contrab/maphash"
+	"github.com/sagernet/sing/service/filemanager"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	localCADefaultDataDirectory = "local_ca"
+	localCADefaultName          = "sing-box Local CA"
+	localCADefaultValidity      = 7 * 24 * time.Hour
+	localCARootValidity         = 10 * 365 * 24 * time.Hour
+	localCACacheSize            = 1024
+)
+
+func RegisterLocalCACertificateProvider(registry *certificate.Registry) {
+	certificate.Register[option.LocalCACertificateProviderOptions](registry, C.TypeLocalCA, NewLocalCACertificateProvider)
+}
+
+var _ adapter.CertificateProviderService = (*LocalCACertificateProvider)(nil)
+
+// LocalCACertificateProvider issues certificates for requested server names on demand,
+// signed by a root certificate authority that is loaded or created on start.
+type LocalCACertificateProvider struct {
+	certificate.Adapter
+	ctx             context.Context
+	logger          log.ContextLogger
+	timeFunc        func() time.Time
+	name            string
+	certificate     []byte
+	key             []byte
+	certificatePath string
+	keyPath         string
+	generate        bool
+	validity        time.Duration
+	allowedNames    *domain.Matcher
+
+	access        sync.Mutex
+	caCertificate *x509.Certificate
+	caKey         crypto.Signer
+	cache         freelru.Cache[string, *tls.Certificate]
+	issueGroup    singleflight.Group
+}
+
+func NewLocalCACertificateProvider(ctx context.Context, logger log.ContextLogger, tag string, options option.LocalCACertificateProviderOptions) (adapter.CertificateProviderService, error) {
+	validity := time.Duration(options.Validity)
+	if validity < 0 {
+		return nil, E.New("invalid validity: ", options.Validity)
+	} else if validity == 0 {
+		validity = localCADefaultValidity
+	}
+	name := options.Name
+	if name == "" {
+		name = localCADefaultName
+	}
+	provider := &LocalCACertificateProvider{
+		Adapter:         certificate.NewAdapter(C.TypeLocalCA, tag),
+		ctx:             ctx,
+		logger:          logger,
+		name:            name,
+		certificatePath: options.CertificatePath,
+		keyPath:         options.KeyPath,
+		validity:        validity,
+		cache:           common.Must1(freelru.New[string, *tls.Certificate](localCACacheSize, maphash.NewHasher[string]().Hash32)),
+	}
+	if len(options.Domain) > 0 || len(options.DomainSuffix) > 0 {
+		if slices.Contains(options.Domain, "") || slices.Contains(options.DomainSuffix, "") {
+			return nil, E.New("empty domain is not allowed")
+		}
+		provider.allowedNames = domain.NewMatcher(common.Map(options.Domain, strings.ToLower), common.Map(options.DomainSuffix, strings.ToLower), false)
+	}
+	if len(options.Certificate) > 0 {
+		provider.certificate = []byte(strings.Join(options.Certificate, "\n"))
+	}
+	if len(options.Key) > 0 {
+		provider.key = []byte(strings.Join(options.Key, "\n"))
+	}
+	hasCertificate := provider.certificate != nil || provider.certificatePath != ""
+	hasKey := provider.key != nil || provider.keyPath != ""
+	if hasCertificate != hasKey {
+		return nil, E.New("certificate and key of the local CA must be provided together")
+	}
+	if !hasCertificate {
+		dataDirectory := options.DataDirectory
+		if dataDirectory == "" {
+			dataDirectory = localCADefaultDataDirectory
+		}
+		dataDirectory = filemanager.BasePath(ctx, os.ExpandEnv(dataDirectory))
+		provider.certificatePath = filepath.Join(dataDirectory, "ca.pem")
+		provider.keyPath = filepath.Join(dataDirectory, "ca.key")
+		provider.generate = true
+	}
+	return provider, nil
+}
+
+func (p *LocalCACertificateProvider) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	p.timeFunc = ntp.TimeFuncFromContext(p.ctx)
+	if p.timeFunc == nil {
+		p.timeFunc = time.Now
+	}
+	certificatePem, keyPem, err := p.loadOrGenerate()
+	if err != nil {
+		return err
+	}
+	keyPair, err := tls.X509KeyPair(certificatePem, keyPem)
+	if err != nil {
+		return E.Cause(err, "parse local CA")
+	}
+	caCertificate := keyPair.Leaf
+	if caCertificate == nil {
+		caCertificate, err = x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return E.Cause(err, "parse local CA")
+		}
+	}
+	if !caCertificate.IsCA {
+		return E.New("local CA certificate is not a certificate authority")
+	}
+	if !p.timeFunc().Before(caCertificate.NotAfter) {
+		return E.New("local CA certificate expired at ", caCertificate.NotAfter.Format(time.RFC3339))
+	}
+	caKey, isSigner := keyPair.PrivateKey.(crypto.Signer)
+	if !isSigner {
+		return E.New("unsupported local CA private key")
+	}
+	p.access.Lock()
+	p.caCertificate = caCertificate
+	p.caKey = caKey
+	p.access.Unlock()
+	return nil
+}
+
+func (p *LocalCACertificateProvider) loadOrGenerate() (certificatePem []byte, keyPem []byte, err error) {
+	certificatePem = p.certificate
+	if certificatePem == nil {
+		certificatePem, err = os.ReadFile(p.certificatePath)
+		if err != nil && !(p.generate && os.IsNotExist(err)) {
+			return nil, nil, E.Cause(err, "read local CA certificate")
+		}
+	}
+	keyPem = p.key
+	if keyPem == nil {
+		keyPem, err = os.ReadFile(p.keyPath)
+		if err != nil && !(p.generate && os.IsNotExist(err)) {
+			return nil, nil, E.Cause(err, "read local CA key")
+		}
+	}
+	if certificatePem != nil && keyPem != nil {
+		return certificatePem, keyPem, nil
+	} else if certificatePem != nil || keyPem != nil {
+		return nil, nil, E.New("incomplete local CA in ", filepath.Dir(p.certificatePath))
+	}
+	keyPem, certificatePem, err = GenerateCA(p.timeFunc, p.name, p.timeFunc().Add(localCARootValidity))
+	if err != nil {
+		return nil, nil, E.Cause(err, "generate local CA")
+	}
+	err = filemanager.MkdirAll(p.ctx, filepath.Dir(p.certificatePath), 0o755)
+	if err != nil {
+		return nil, nil, E.Cause(err, "create local CA directory")
+	}
+	err = filemanager.WriteFile(p.ctx, p.keyPath, keyPem, 0o600)
+	if err != nil {
+		return nil, nil, E.Cause(err, "save local CA key")
+	}
+	err = filemanager.WriteFile(p.ctx, p.certificatePath, certificatePem, 0o644)
+	if err != nil {
+		return nil, nil, E.Cause(err, "save local CA certificate")
+	}
+	p.logger.Info("generated local CA, root certificate saved to ", p.certificatePath)
+	return certificatePem, keyPem, nil
+}
+
+func (p *LocalCACertificateProvider) Close() error {
+	return nil
+}
+
+func (p *LocalCACertificateProvider) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	serverName := strings.ToLower(hello.ServerName)
+	if serverName == "" && hello.Conn != nil {
+		// clients connecting by IP address do not send SNI
+		localAddr := M.SocksaddrFromNet(hello.Conn.LocalAddr()).Unwrap()
+		if localAddr.IsIP() {
+			serverName = localAddr.Addr.String()
+		}
+	}
+	if serverName == "" {
+		return nil, E.New("missing server name")
+	}
+	if p.allowedNames != nil && !p.allowedNames.Match(serverName) {
+		return nil, E.New("server name not allowed: ", serverName)
+	}
+	p.access.Lock()
+	caCertificate, caKey := p.caCertificate, p.caKey
+	cachedCertificate, loaded := p.cache.Get(serverName)
+	p.access.Unlock()
+	if caCertificate == nil {
+		return nil, E.New("local CA is unavailable")
+	}
+	now := p.timeFunc()
+	if loaded {
+		// renew when less than a third of the lifetime remains
+		leaf := cachedCertificate.Leaf
+		if now.Before(leaf.NotAfter.Add(-leaf.NotAfter.Sub(leaf.NotBefore) / 3)) {
+			return cachedCertificate, nil
+		}
+	}
+	// sign outside the lock, concurrent handshakes for the same name share one issuance
+	issuedCertificate, err, _ := p.issueGroup.Do(serverName, func() (any, error) {
+		expire := now.Add(p.validity)
+		if expire.After(caCertificate.NotAfter) {
+			expire = caCertificate.NotAfter
+		}
+		certificate, err := IssueCertificate(caCertificate, caKey, p.timeFunc, serverName, expire)
+		if err != nil {
+			return nil, E.Cause(err, "issue certificate for ", serverName)
+		}
+		p.access.Lock()
+		p.cache.Add(serverName, certificate)
+		p.access.Unlock()
+		p.logger.Debug("issued certificate for ", serverName, ", expires at ", expire.Format(time.RFC3339))
+		return certificate, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issuedCertificate.(*tls.Certificate), nil
+}
@@ -0,0 +1,173 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startTestLocalCA(t *testing.T, options option.LocalCACertificateProviderOptions) *LocalCACertificateProvider {
+	provider, err := NewLocalCACertificateProvider(context.Background(), log.NewNOPFactory().Logger(), "local-ca", options)
+	require.NoError(t, err)
+	require.NoError(t, provider.Start(adapter.StartStateStart))
+	return provider.(*LocalCACertificateProvider)
+}
+
+func TestLocalCA(t *testing.T) {
+	t.Parallel()
+	dataDirectory := t.TempDir()
+	provider := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		DataDirectory: dataDirectory,
+	})
+	rootPem, err := os.ReadFile(filepath.Join(dataDirectory, "ca.pem"))
+	require.NoError(t, err)
+	rootPool := x509.NewCertPool()
+	require.True(t, rootPool.AppendCertsFromPEM(rootPem))
+
+	certificate, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	require.NoError(t, err)
+	_, err = certificate.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "www.example.org",
+		Roots:   rootPool,
+	})
+	require.NoError(t, err)
+	cachedCertificate, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "WWW.example.org"})
+	require.NoError(t, err)
+	require.Same(t, certificate, cachedCertificate)
+
+	// the root CA is loaded from the data directory on restart
+	reloaded := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		DataDirectory: dataDirectory,
+	})
+	reloadedCertificate, err := reloaded.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	require.NoError(t, err)
+	_, err = reloadedCertificate.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "www.example.org",
+		Roots:   rootPool,
+	})
+	require.NoError(t, err)
+}
+
+func TestLocalCARenew(t *testing.T) {
+	t.Parallel()
+	provider := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		DataDirectory: t.TempDir(),
+	})
+	certificate, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	require.NoError(t, err)
+	provider.timeFunc = func() time.Time {
+		return time.Now().Add(localCADefaultValidity / 2)
+	}
+	cachedCertificate, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	require.NoError(t, err)
+	require.Same(t, certificate, cachedCertificate)
+	provider.timeFunc = func() time.Time {
+		return time.Now().Add(localCADefaultValidity * 3 / 4)
+	}
+	renewedCertificate, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	require.NoError(t, err)
+	require.NotSame(t, certificate, renewedCertificate)
+	require.True(t, renewedCertificate.Leaf.NotAfter.After(certificate.Leaf.NotAfter))
+}
+
+func TestLocalCAIPAddress(t *testing.T) {
+	t.Parallel()
+	provider := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		DataDirectory: t.TempDir(),
+	})
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	certificate, err := provider.GetCertificate(&tls.ClientHelloInfo{Conn: &localAddrConn{serverConn, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}}})
+	require.NoError(t, err)
+	require.Len(t, certificate.Leaf.IPAddresses, 1)
+	require.True(t, certificate.Leaf.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)))
+}
+
+func TestLocalCAProvidedRoot(t *testing.T) {
+	t.Parallel()
+	keyPem, certificatePem, err := GenerateCA(time.Now, "Test CA", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	provider := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		Certificate: []string{string(certificatePem)},
+		Key:         []string{string(keyPem)},
+	})
+	rootPool := x509.NewCertPool()
+	require.True(t, rootPool.AppendCertsFromPEM(certificatePem))
+	certificate, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	require.NoError(t, err)
+	// leaf certificates never outlive the root
+	require.False(t, certificate.Leaf.NotAfter.After(time.Now().Add(time.Hour)))
+	_, err = certificate.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "example.org",
+		Roots:   rootPool,
+	})
+	require.NoError(t, err)
+
+	_, err = NewLocalCACertificateProvider(context.Background(), log.NewNOPFactory().Logger(), "", option.LocalCACertificateProviderOptions{
+		Certificate: []string{string(certificatePem)},
+	})
+	require.Error(t, err)
+}
+
+func TestLocalCAAllowedNames(t *testing.T) {
+	t.Parallel()
+	provider := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		DataDirectory: t.TempDir(),
+		Domain:        []string{"Example.org", "127.0.0.1"},
+		DomainSuffix:  []string{".internal.example.org"},
+	})
+	for _, serverName := range []string{"example.org", "www.internal.example.org"} {
+		_, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err, serverName)
+	}
+	for _, serverName := range []string{"www.example.org", "internal.example.org", "example.com"} {
+		_, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.Error(t, err, serverName)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	_, err := provider.GetCertificate(&tls.ClientHelloInfo{Conn: &localAddrConn{serverConn, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}}})
+	require.NoError(t, err)
+	_, err = provider.GetCertificate(&tls.ClientHelloInfo{Conn: &localAddrConn{serverConn, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 443}}})
+	require.Error(t, err)
+}
+
+func TestLocalCAConcurrentIssue(t *testing.T) {
+	t.Parallel()
+	provider := startTestLocalCA(t, option.LocalCACertificateProviderOptions{
+		DataDirectory: t.TempDir(),
+	})
+	const count = 16
+	errors := make(chan error, count)
+	for range count {
+		go func() {
+			_, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+			errors <- err
+		}()
+	}
+	for range count {
+		require.NoError(t, <-errors)
+	}
+}
+
+type localAddrConn struct {
+	net.Conn
+	localAddr net.Addr
+}
+
+func (c *localAddrConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
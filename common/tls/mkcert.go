@@ -1,6 +1,9 @@
 package tls
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -8,6 +11,8 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"math/big"
+	"net"
+	"net/netip"
 	"time"
 )
 
@@ -63,3 +68,79 @@ func GenerateCertificate(parent *x509.Certificate, parentKey any, timeFunc func(
 	privateKeyPem = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})
 	return
 }
+
+// GenerateCA generates a self-signed ECDSA P-256 certificate authority.
+func GenerateCA(timeFunc func() time.Time, commonName string, expire time.Time) (privateKeyPem []byte, publicKeyPem []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		NotBefore:             timeFunc().Add(time.Hour * -1),
+		NotAfter:              expire,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+	}
+	publicDer, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return
+	}
+	privateDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return
+	}
+	publicKeyPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: publicDer})
+	privateKeyPem = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})
+	return
+}
+
+// IssueCertificate issues an ECDSA P-256 certificate for serverName, which may be an IP address, signed by parent.
+func IssueCertificate(parent *x509.Certificate, parentKey crypto.Signer, timeFunc func() time.Time, serverName string, expire time.Time) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		NotBefore:             timeFunc().Add(time.Hour * -1),
+		NotAfter:              expire,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		Subject: pkix.Name{
+			CommonName: serverName,
+		},
+	}
+	if address, parseErr := netip.ParseAddr(serverName); parseErr == nil {
+		template.IPAddresses = []net.IP{address.AsSlice()}
+	} else {
+		template.DNSNames = []string{serverName}
+	}
+	publicDer, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(publicDer)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{publicDer},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/sagernet/sing/common"
 	E "github.com/sagernet/sing/common/exceptions"
 	"github.com/sagernet/sing/common/ntp"
+	"github.com/sagernet/sing/common/x/list"
 	"github.com/sagernet/sing/service"
 )
 
@@ -102,6 +103,10 @@ type STDServerConfig struct {
 	keyPath               string
 	clientCertificatePath []string
 	echKeyPath            string
+	echKeyManagerTag      string
+	serviceManager        adapter.ServiceManager
+	echKeyManager         adapter.ECHKeyManager
+	echKeysCallback       *list.Element[adapter.ECHKeysUpdateCallback]
 	watcher               *fswatch.Watcher
 }
 
@@ -184,6 +189,12 @@ func (c *STDServerConfig) Clone() Config {
 }
 
 func (c *STDServerConfig) Start() error {
+	if c.echKeyManagerTag != "" {
+		err := c.startECHKeyManager()
+		if err != nil {
+			return err
+		}
+	}
 	if c.certificateProvider != nil {
 		err := c.certificateProvider.Start()
 		if err != nil {
@@ -321,6 +332,9 @@ func (c *STDServerConfig) certificateUpdated(path string) error {
 }
 
 func (c *STDServerConfig) Close() error {
+	if c.echKeysCallback != nil {
+		c.echKeyManager.UnregisterCallback(c.echKeysCallback)
+	}
 	return common.Close(c.certificateProvider, c.acmeService, common.PtrOrNil(c.watcher))
 }
 
@@ -480,8 +494,12 @@ func NewSTDServer(ctx context.Context, logger log.ContextLogger, options option.
 			return nil, E.New("missing client_certificate, client_certificate_path or client_certificate_public_key_sha256 for client authentication")
 		}
 	}
-	var echKeyPath string
+	var (
+		echKeyPath       string
+		echKeyManagerTag string
+	)
 	if options.ECH != nil && options.ECH.Enabled {
+		echKeyManagerTag = options.ECH.KeyManager
 		err = parseECHServerConfig(ctx, options, tlsConfig, &echKeyPath)
 		if err != nil {
 			return nil, err
@@ -505,6 +523,8 @@ func NewSTDServer(ctx context.Context, logger log.ContextLogger, options option.
 		clientCertificatePath: options.ClientCertificatePath,
 		keyPath:               options.KeyPath,
 		echKeyPath:            echKeyPath,
+		echKeyManagerTag:      echKeyManagerTag,
+		serviceManager:        service.FromContext[adapter.ServiceManager](ctx),
 	}
 	serverConfig.config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
 		serverConfig.access.RLock()
@@ -3,6 +3,7 @@ package tls
 import (
 	"time"
 
+	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing/common/ntp"
 )
 
@@ -20,6 +21,13 @@ func (w *TimeServiceWrapper) TimeFunc() func() time.Time {
 	}
 }
 
+func (w *TimeServiceWrapper) SyncStatus() adapter.TimeSyncStatus {
+	if statusProvider, isProvider := w.TimeService.(adapter.TimeSyncStatusProvider); isProvider {
+		return statusProvider.SyncStatus()
+	}
+	return adapter.TimeSyncStatus{}
+}
+
 func (w *TimeServiceWrapper) Upstream() any {
 	return w.TimeService
 }
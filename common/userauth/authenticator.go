@@ -0,0 +1,98 @@
+package userauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/auth"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/contrab/freelru"
+	"github.com/sagernet/sing/contrab/maphash"
+)
+
+const defaultCacheTTL = time.Minute
+
+// Authenticator verifies username and password pairs against static users
+// and an external user backend.
+type Authenticator interface {
+	Start() error
+	Close() error
+	Verify(ctx context.Context, username string, password string) (bool, error)
+}
+
+type cacheKey = [sha256.Size]byte
+
+var _ Authenticator = (*cachedAuthenticator)(nil)
+
+type cachedAuthenticator struct {
+	static  *auth.Authenticator
+	backend Authenticator
+	cache   *freelru.SyncedLRU[cacheKey, bool]
+}
+
+func New(ctx context.Context, logger log.ContextLogger, tag string, users []auth.User, options option.UserBackendOptions) (Authenticator, error) {
+	cacheTTL := time.Duration(options.CacheTTL)
+	if cacheTTL == 0 {
+		cacheTTL = defaultCacheTTL
+	}
+	authenticator := &cachedAuthenticator{
+		static: auth.NewAuthenticator(users),
+		cache:  common.Must1(freelru.NewSynced[cacheKey, bool](1024, maphash.NewHasher[cacheKey]().Hash32)),
+	}
+	authenticator.cache.SetLifetime(cacheTTL)
+	var err error
+	switch options.Type {
+	case C.UserBackendTypeHTPasswd:
+		authenticator.backend, err = newHTPasswdBackend(ctx, logger, options, authenticator.cache.Purge)
+	case C.UserBackendTypeHTTP:
+		authenticator.backend, err = newHTTPBackend(ctx, logger, tag, options)
+	case "":
+		err = E.New("missing user backend type")
+	default:
+		err = E.New("unknown user backend type: ", options.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+func (a *cachedAuthenticator) Start() error {
+	return a.backend.Start()
+}
+
+func (a *cachedAuthenticator) Close() error {
+	return a.backend.Close()
+}
+
+func (a *cachedAuthenticator) Verify(ctx context.Context, username string, password string) (bool, error) {
+	if a.static != nil && a.static.Verify(username, password) {
+		return true, nil
+	}
+	key := credentialKey(username, password)
+	if allowed, loaded := a.cache.Get(key); loaded {
+		return allowed, nil
+	}
+	allowed, err := a.backend.Verify(ctx, username, password)
+	if err != nil {
+		return false, err
+	}
+	a.cache.Add(key, allowed)
+	return allowed, nil
+}
+
+func credentialKey(username string, password string) cacheKey {
+	hash := sha256.New()
+	binary.Write(hash, binary.BigEndian, uint32(len(username)))
+	hash.Write([]byte(username))
+	hash.Write([]byte(password))
+	var key cacheKey
+	hash.Sum(key[:0])
+	return key
+}
@@ -0,0 +1,108 @@
+package userauth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/json"
+	"github.com/sagernet/sing/service"
+)
+
+const defaultCallbackTimeout = 5 * time.Second
+
+var _ Authenticator = (*httpBackend)(nil)
+
+// httpBackend asks an HTTP endpoint whether a username and password pair is allowed.
+type httpBackend struct {
+	tag       string
+	url       string
+	headers   http.Header
+	timeout   time.Duration
+	transport adapter.HTTPTransport
+	client    *http.Client
+}
+
+type callbackRequest struct {
+	Inbound  string `json:"inbound"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// callbackResponse only carries the decision, user attributes returned by the
+// backend are not passed into the connection metadata.
+type callbackResponse struct {
+	Allow bool `json:"allow"`
+}
+
+func newHTTPBackend(ctx context.Context, logger log.ContextLogger, tag string, options option.UserBackendOptions) (*httpBackend, error) {
+	if options.URL == "" {
+		return nil, E.New("missing user backend url")
+	}
+	timeout := time.Duration(options.Timeout)
+	if timeout == 0 {
+		timeout = defaultCallbackTimeout
+	}
+	transport, err := service.FromContext[adapter.HTTPClientManager](ctx).ResolveTransport(ctx, logger, common.PtrValueOrDefault(options.HTTPClient))
+	if err != nil {
+		return nil, E.Cause(err, "create user backend http client")
+	}
+	return &httpBackend{
+		tag:       tag,
+		url:       options.URL,
+		headers:   options.Headers.Build(),
+		timeout:   timeout,
+		transport: transport,
+		client:    &http.Client{Transport: transport},
+	}, nil
+}
+
+func (b *httpBackend) Start() error {
+	return nil
+}
+
+func (b *httpBackend) Close() error {
+	b.transport.CloseIdleConnections()
+	return nil
+}
+
+func (b *httpBackend) Verify(ctx context.Context, username string, password string) (bool, error) {
+	content, err := json.Marshal(callbackRequest{
+		Inbound:  b.tag,
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(content))
+	if err != nil {
+		return false, err
+	}
+	for key, values := range b.headers {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := b.client.Do(request)
+	if err != nil {
+		return false, E.Cause(err, "request user backend")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, E.New("user backend: unexpected status: ", response.Status)
+	}
+	var result callbackResponse
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return false, E.Cause(err, "decode user backend response")
+	}
+	return result.Allow, nil
+}
@@ -0,0 +1,146 @@
+package userauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sagernet/fswatch"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/service/filemanager"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ Authenticator = (*htpasswdBackend)(nil)
+
+// htpasswdBackend verifies users against an Apache htpasswd file, the file
+// is reloaded whenever it changes.
+type htpasswdBackend struct {
+	logger   log.ContextLogger
+	path     string
+	onUpdate func()
+	access   sync.RWMutex
+	users    map[string]string
+	watcher  *fswatch.Watcher
+}
+
+func newHTPasswdBackend(ctx context.Context, logger log.ContextLogger, options option.UserBackendOptions, onUpdate func()) (*htpasswdBackend, error) {
+	if options.Path == "" {
+		return nil, E.New("missing htpasswd path")
+	}
+	filePath, _ := filepath.Abs(filemanager.BasePath(ctx, options.Path))
+	backend := &htpasswdBackend{
+		logger:   logger,
+		path:     filePath,
+		onUpdate: onUpdate,
+	}
+	err := backend.reload()
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fswatch.NewWatcher(fswatch.Options{
+		Path: []string{filePath},
+		Callback: func(path string) {
+			uErr := backend.reload()
+			if uErr != nil {
+				logger.Error(E.Cause(uErr, "reload htpasswd file"))
+			} else {
+				logger.Info("htpasswd file reloaded")
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	backend.watcher = watcher
+	return backend, nil
+}
+
+func (b *htpasswdBackend) Start() error {
+	err := b.watcher.Start()
+	if err != nil {
+		b.logger.Error(E.Cause(err, "watch htpasswd file"))
+	}
+	return nil
+}
+
+func (b *htpasswdBackend) Close() error {
+	return b.watcher.Close()
+}
+
+func (b *htpasswdBackend) reload() error {
+	content, err := os.ReadFile(b.path)
+	if err != nil {
+		return err
+	}
+	users, err := parseHTPasswd(content)
+	if err != nil {
+		return E.Cause(err, "parse htpasswd file")
+	}
+	b.access.Lock()
+	b.users = users
+	b.access.Unlock()
+	if b.onUpdate != nil {
+		b.onUpdate()
+	}
+	return nil
+}
+
+func (b *htpasswdBackend) Verify(ctx context.Context, username string, password string) (bool, error) {
+	b.access.RLock()
+	hash, loaded := b.users[username]
+	b.access.RUnlock()
+	if !loaded {
+		return false, nil
+	}
+	return verifyHTPasswdHash(hash, password)
+}
+
+func parseHTPasswd(content []byte) (map[string]string, error) {
+	users := make(map[string]string)
+	for index, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		username, hash, found := strings.Cut(string(line), ":")
+		if !found || username == "" || hash == "" {
+			return nil, E.New("line ", index+1, ": invalid entry")
+		}
+		if !isSupportedHTPasswdHash(hash) {
+			return nil, E.New("line ", index+1, ": unsupported password hash for user ", username)
+		}
+		users[username] = hash
+	}
+	return users, nil
+}
+
+func isSupportedHTPasswdHash(hash string) bool {
+	return strings.HasPrefix(hash, "{SHA}") ||
+		strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+func verifyHTPasswdHash(hash string, password string) (bool, error) {
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1, nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,61 @@
+package userauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/auth"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHTPasswd(t *testing.T) {
+	t.Parallel()
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	htpasswdPath := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# comment\n" +
+		"sekai:" + string(bcryptHash) + "\n" +
+		"\n" +
+		"nya:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"
+	require.NoError(t, os.WriteFile(htpasswdPath, []byte(content), 0o644))
+	authenticator, err := New(context.Background(), log.NewNOPFactory().Logger(), "test", []auth.User{{Username: "static", Password: "static"}}, option.UserBackendOptions{
+		Type: "htpasswd",
+		Path: htpasswdPath,
+	})
+	require.NoError(t, err)
+	for _, testCase := range []struct {
+		username string
+		password string
+		allowed  bool
+	}{
+		{"sekai", "password", true},
+		{"sekai", "wrong", false},
+		{"nya", "password", true},
+		{"nya", "", false},
+		{"static", "static", true},
+		{"unknown", "password", false},
+	} {
+		allowed, err := authenticator.Verify(context.Background(), testCase.username, testCase.password)
+		require.NoError(t, err)
+		require.Equal(t, testCase.allowed, allowed, testCase.username+":"+testCase.password)
+	}
+	require.NoError(t, os.WriteFile(htpasswdPath, []byte("nya:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o644))
+	require.NoError(t, authenticator.(*cachedAuthenticator).backend.(*htpasswdBackend).reload())
+	allowed, err := authenticator.Verify(context.Background(), "sekai", "password")
+	require.NoError(t, err)
+	require.False(t, allowed)
+}
+
+func TestHTPasswdInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := parseHTPasswd([]byte("sekai:$apr1$salt$hash\n"))
+	require.Error(t, err)
+	_, err = parseHTPasswd([]byte("sekai\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package userauth
+
+import (
+	std_bufio "bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/sagernet/sing/common/auth"
+	"github.com/sagernet/sing/common/buf"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	sHttp "github.com/sagernet/sing/protocol/http"
+)
+
+// HandleHTTPConnection verifies the first request of the connection with authenticator,
+// then replays it to http.HandleConnectionEx, which requires the same credentials
+// for the following requests on the connection.
+func HandleHTTPConnection(
+	ctx context.Context,
+	conn net.Conn,
+	reader *std_bufio.Reader,
+	authenticator Authenticator,
+	handler N.TCPConnectionHandlerEx,
+	source M.Socksaddr,
+	onClose N.CloseHandlerFunc,
+) error {
+	var recorded bytes.Buffer
+	request, err := sHttp.ReadRequest(std_bufio.NewReader(io.TeeReader(reader, &recorded)))
+	if err != nil {
+		return E.Cause(err, "read http request")
+	}
+	username, password, loaded := sHttp.ParseBasicAuth(request.Header.Get("Proxy-Authorization"))
+	var allowed bool
+	if loaded {
+		allowed, err = authenticator.Verify(ctx, username, password)
+	}
+	if !allowed {
+		response := &http.Response{
+			StatusCode: http.StatusProxyAuthRequired,
+			Status:     http.StatusText(http.StatusProxyAuthRequired),
+			Proto:      request.Proto,
+			ProtoMajor: request.ProtoMajor,
+			ProtoMinor: request.ProtoMinor,
+			Header: http.Header{
+				"Proxy-Authenticate": []string{`Basic realm="sing-box" charset="UTF-8"`},
+			},
+		}
+		wErr := response.Write(conn)
+		if err != nil {
+			return E.Cause(err, "http: verify user ", username)
+		} else if wErr != nil {
+			return wErr
+		} else if loaded {
+			return E.New("http: authentication failed, username=", username)
+		} else {
+			return E.New("http: authentication failed, no Proxy-Authorization header")
+		}
+	}
+	if reader.Buffered() > 0 {
+		remaining, _ := reader.Peek(reader.Buffered())
+		recorded.Write(remaining)
+	}
+	cachedConn := bufio.NewCachedConn(conn, buf.As(recorded.Bytes()))
+	connAuthenticator := auth.NewAuthenticator([]auth.User{{Username: username, Password: password}})
+	return sHttp.HandleConnectionEx(ctx, cachedConn, std_bufio.NewReader(cachedConn), connAuthenticator, handler, source, onClose)
+}
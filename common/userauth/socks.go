@@ -0,0 +1,131 @@
+package userauth
+
+import (
+	std_bufio "bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/auth"
+	"github.com/sagernet/sing/common/buf"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/protocol/socks"
+	"github.com/sagernet/sing/protocol/socks/socks4"
+	"github.com/sagernet/sing/protocol/socks/socks5"
+)
+
+// HandleSOCKSConnection verifies the SOCKS5 username and password with authenticator,
+// then replays the handshake to socks.HandleConnectionEx with the verified user.
+//
+// SOCKS4 is rejected since it carries no password to verify.
+func HandleSOCKSConnection(
+	ctx context.Context, conn net.Conn, reader *std_bufio.Reader,
+	authenticator Authenticator,
+	handler socks.HandlerEx,
+	packetListener socks.PacketListener,
+	udpTimeout time.Duration,
+	source M.Socksaddr,
+	onClose N.CloseHandlerFunc,
+) error {
+	var recorded bytes.Buffer
+	recordReader := std_bufio.NewReader(io.TeeReader(reader, &recorded))
+	version, err := recordReader.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch version {
+	case socks4.Version:
+		err = socks4.WriteResponse(conn, socks4.Response{
+			ReplyCode: socks4.ReplyCodeRejectedOrFailed,
+		})
+		if err != nil {
+			return err
+		}
+		return E.New("socks4: not supported with user backend")
+	case socks5.Version:
+	default:
+		return os.ErrInvalid
+	}
+	authRequest, err := socks5.ReadAuthRequest0(recordReader)
+	if err != nil {
+		return err
+	}
+	if !common.Contains(authRequest.Methods, socks5.AuthTypeUsernamePassword) {
+		err = socks5.WriteAuthResponse(conn, socks5.AuthResponse{
+			Method: socks5.AuthTypeNoAcceptedMethods,
+		})
+		if err != nil {
+			return err
+		}
+		return E.New("socks5: no accepted authentication methods")
+	}
+	// the client waits for the method selection before sending its credentials
+	err = socks5.WriteAuthResponse(conn, socks5.AuthResponse{
+		Method: socks5.AuthTypeUsernamePassword,
+	})
+	if err != nil {
+		return err
+	}
+	passwordRequest, err := socks5.ReadUsernamePasswordAuthRequest(recordReader)
+	if err != nil {
+		return err
+	}
+	allowed, err := authenticator.Verify(ctx, passwordRequest.Username, passwordRequest.Password)
+	if err != nil || !allowed {
+		wErr := socks5.WriteUsernamePasswordAuthResponse(conn, socks5.UsernamePasswordAuthResponse{
+			Status: socks5.UsernamePasswordStatusFailure,
+		})
+		if err != nil {
+			return E.Cause(err, "socks5: verify user ", passwordRequest.Username)
+		} else if wErr != nil {
+			return wErr
+		}
+		return E.New("socks5: authentication failed, username=", passwordRequest.Username)
+	}
+	if reader.Buffered() > 0 {
+		remaining, _ := reader.Peek(reader.Buffered())
+		recorded.Write(remaining)
+	}
+	cachedConn := bufio.NewCachedConn(&skipWriteConn{Conn: conn, skip: 2}, buf.As(recorded.Bytes()))
+	connAuthenticator := auth.NewAuthenticator([]auth.User{{Username: passwordRequest.Username, Password: passwordRequest.Password}})
+	return socks.HandleConnectionEx(ctx, cachedConn, std_bufio.NewReader(cachedConn), connAuthenticator, handler, packetListener, udpTimeout, source, onClose)
+}
+
+// skipWriteConn drops the method selection that socks.HandleConnectionEx writes again
+// when the handshake is replayed.
+type skipWriteConn struct {
+	net.Conn
+	skip int
+}
+
+func (c *skipWriteConn) Write(p []byte) (n int, err error) {
+	if c.skip > 0 {
+		skipped := min(c.skip, len(p))
+		c.skip -= skipped
+		if skipped == len(p) {
+			return len(p), nil
+		}
+		n, err = c.Conn.Write(p[skipped:])
+		return n + skipped, err
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *skipWriteConn) Upstream() any {
+	return c.Conn
+}
+
+func (c *skipWriteConn) WriterReplaceable() bool {
+	return c.skip == 0
+}
+
+func (c *skipWriteConn) ReaderReplaceable() bool {
+	return true
+}
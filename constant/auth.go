@@ -0,0 +1,6 @@
+package constant
+
+const (
+	UserBackendTypeHTPasswd = "htpasswd"
+	UserBackendTypeHTTP     = "http"
+)
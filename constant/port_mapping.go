@@ -0,0 +1,7 @@
+package constant
+
+const (
+	PortMappingProtocolPCP    = "pcp"
+	PortMappingProtocolNATPMP = "natpmp"
+	PortMappingProtocolUPnP   = "upnp"
+)
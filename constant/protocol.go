@@ -11,6 +11,13 @@ const (
 	ProtocolSSH        = "ssh"
 	ProtocolRDP        = "rdp"
 	ProtocolNTP        = "ntp"
+	ProtocolWireGuard  = "wireguard"
+	ProtocolOpenVPN    = "openvpn"
+	ProtocolMQTT       = "mqtt"
+	ProtocolSMTP       = "smtp"
+	ProtocolIMAP       = "imap"
+	ProtocolPOP3       = "pop3"
+	ProtocolMTProto    = "mtproto"
 )
 
 const (
@@ -24,17 +24,28 @@ const (
 	TypeVLESS              = "vless"
 	TypeTUIC               = "tuic"
 	TypeHysteria2          = "hysteria2"
+	TypeMASQUE             = "masque"
+	TypeSnell              = "snell"
+	TypeHTTPReverse        = "http-reverse"
+	TypeForward            = "forward"
+	TypeReverse            = "reverse"
 	TypeTailscale          = "tailscale"
 	TypeCloudflared        = "cloudflared"
 	TypeDERP               = "derp"
+	TypeTailscaleControl   = "tailscale-control"
 	TypeResolved           = "resolved"
 	TypeSSMAPI             = "ssm-api"
 	TypeCCM                = "ccm"
 	TypeOCM                = "ocm"
 	TypeOOMKiller          = "oom-killer"
+	TypeDHCPServer         = "dhcp-server"
+	TypeNTPServer          = "ntp-server"
+	TypeSTUN               = "stun"
+	TypeECHKeyManager      = "ech-key-manager"
 	TypeHysteriaRealm      = "hysteria-realm"
 	TypeACME               = "acme"
 	TypeCloudflareOriginCA = "cloudflare-origin-ca"
+	TypeLocalCA            = "local-ca"
 )
 
 const (
@@ -90,6 +101,16 @@ func ProxyDisplayName(proxyType string) string {
 		return "Hysteria2"
 	case TypeAnyTLS:
 		return "AnyTLS"
+	case TypeMASQUE:
+		return "MASQUE"
+	case TypeSnell:
+		return "Snell"
+	case TypeHTTPReverse:
+		return "HTTP Reverse"
+	case TypeForward:
+		return "Forward"
+	case TypeReverse:
+		return "Reverse"
 	case TypeTailscale:
 		return "Tailscale"
 	case TypeCloudflared:
@@ -39,6 +39,9 @@ const (
 	RuleActionTypeSniff        = "sniff"
 	RuleActionTypeResolve      = "resolve"
 	RuleActionTypePredefined   = "predefined"
+	RuleActionTypeHTTPReject   = "http-reject"
+	RuleActionTypeHTTPRedirect = "http-redirect"
+	RuleActionTypeHTTPRewrite  = "http-rewrite"
 )
 
 const (
@@ -33,6 +33,7 @@ var (
 		string(bucketRuleSet),
 		string(bucketRDRC),
 		string(bucketDNSCache),
+		string(bucketDHCPLease),
 	}
 
 	cacheIDDefault = []byte("default")
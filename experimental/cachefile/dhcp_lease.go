@@ -0,0 +1,128 @@
+package cachefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/sagernet/bbolt"
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/varbin"
+)
+
+var bucketDHCPLease = []byte("dhcp_lease")
+
+func (c *CacheFile) LoadDHCPLeases(tag string) []adapter.DHCPLease {
+	var leases []adapter.DHCPLease
+	c.view(func(t *bbolt.Tx) error {
+		bucket := c.bucket(t, bucketDHCPLease)
+		if bucket == nil {
+			return nil
+		}
+		content := bucket.Get([]byte(tag))
+		if len(content) == 0 {
+			return nil
+		}
+		var err error
+		leases, err = decodeDHCPLeases(content)
+		if err != nil {
+			c.logger.Warn(E.Cause(err, "decode dhcp leases of ", tag))
+		}
+		return nil
+	})
+	now := time.Now()
+	return common.Filter(leases, func(it adapter.DHCPLease) bool {
+		return it.Expiry.After(now)
+	})
+}
+
+func (c *CacheFile) StoreDHCPLeases(tag string, leases []adapter.DHCPLease) error {
+	content, err := encodeDHCPLeases(leases)
+	if err != nil {
+		return err
+	}
+	return c.batch(func(t *bbolt.Tx) error {
+		bucket, err := c.createBucket(t, bucketDHCPLease)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(tag), content)
+	})
+}
+
+func encodeDHCPLeases(leases []adapter.DHCPLease) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte(1)
+	_, err := varbin.WriteUvarint(&buffer, uint64(len(leases)))
+	if err != nil {
+		return nil, err
+	}
+	for _, lease := range leases {
+		for _, field := range [][]byte{lease.Address.AsSlice(), lease.MACAddress, []byte(lease.Hostname)} {
+			_, err = varbin.WriteUvarint(&buffer, uint64(len(field)))
+			if err != nil {
+				return nil, err
+			}
+			buffer.Write(field)
+		}
+		err = binary.Write(&buffer, binary.BigEndian, lease.Expiry.Unix())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+func decodeDHCPLeases(content []byte) ([]adapter.DHCPLease, error) {
+	reader := bytes.NewReader(content)
+	version, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, E.New("unknown version: ", version)
+	}
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	var leases []adapter.DHCPLease
+	for range count {
+		var fields [3][]byte
+		for index := range fields {
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, err
+			}
+			if length > uint64(reader.Len()) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			fields[index] = make([]byte, length)
+			_, err = io.ReadFull(reader, fields[index])
+			if err != nil {
+				return nil, err
+			}
+		}
+		var expiry int64
+		err = binary.Read(reader, binary.BigEndian, &expiry)
+		if err != nil {
+			return nil, err
+		}
+		address, ok := netip.AddrFromSlice(fields[0])
+		if !ok {
+			return nil, E.New("invalid address")
+		}
+		leases = append(leases, adapter.DHCPLease{
+			Address:    address,
+			MACAddress: net.HardwareAddr(fields[1]),
+			Hostname:   string(fields[2]),
+			Expiry:     time.Unix(expiry, 0),
+		})
+	}
+	return leases, nil
+}
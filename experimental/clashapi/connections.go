@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/pcapng"
 	"github.com/sagernet/sing-box/experimental/clashapi/trafficontrol"
+	"github.com/sagernet/sing/common"
 	"github.com/sagernet/sing/common/json"
 	"github.com/sagernet/ws"
 	"github.com/sagernet/ws/wsutil"
@@ -18,11 +20,13 @@ import (
 	"github.com/gofrs/uuid/v5"
 )
 
-func connectionRouter(ctx context.Context, network adapter.NetworkManager, trafficManager *trafficontrol.Manager) http.Handler {
+func connectionRouter(ctx context.Context, network adapter.NetworkManager, trafficManager *trafficontrol.Manager, captureDirectory string) http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", getConnections(ctx, trafficManager))
 	r.Delete("/", closeAllConnections(network, trafficManager))
 	r.Delete("/{id}", closeConnection(trafficManager))
+	r.Post("/{id}/capture", startCapture(trafficManager, captureDirectory))
+	r.Delete("/{id}/capture", stopCapture(trafficManager, captureDirectory))
 	return r
 }
 
@@ -106,3 +110,62 @@ func closeAllConnections(network adapter.NetworkManager, trafficManager *traffic
 		render.NoContent(w, r)
 	}
 }
+
+func findCapturer(trafficManager *trafficontrol.Manager, captureDirectory string, w http.ResponseWriter, r *http.Request) (pcapng.Capturer, bool) {
+	if captureDirectory == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("capture is not enabled, set `capture_directory` in Clash API options"))
+		return nil, false
+	}
+	tracker := trafficManager.Connection(uuid.FromStringOrNil(chi.URLParam(r, "id")))
+	if tracker == nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return nil, false
+	}
+	// the nearest pcapng wrapper is the one installed by the Clash API,
+	// a capture route action may install another one further upstream
+	if conn, loaded := common.Cast[*pcapng.Conn](tracker); loaded {
+		return conn, true
+	}
+	if packetConn, loaded := common.Cast[*pcapng.PacketConn](tracker); loaded {
+		return packetConn, true
+	}
+	render.Status(r, http.StatusBadRequest)
+	render.JSON(w, r, newError("capture is not available for this connection"))
+	return nil, false
+}
+
+func startCapture(trafficManager *trafficontrol.Manager, captureDirectory string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		capturer, loaded := findCapturer(trafficManager, captureDirectory, w, r)
+		if !loaded {
+			return
+		}
+		path, err := capturer.StartCapture(captureDirectory)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, newError(err.Error()))
+			return
+		}
+		render.JSON(w, r, render.M{
+			"path": path,
+		})
+	}
+}
+
+func stopCapture(trafficManager *trafficontrol.Manager, captureDirectory string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		capturer, loaded := findCapturer(trafficManager, captureDirectory, w, r)
+		if !loaded {
+			return
+		}
+		err := capturer.StopCapture()
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, newError(err.Error()))
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
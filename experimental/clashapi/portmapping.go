@@ -0,0 +1,48 @@
+package clashapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/service"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func portMappingRouter(ctx context.Context) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getPortMappings(service.FromContext[adapter.PortMappingManager](ctx)))
+	return r
+}
+
+func getPortMappings(manager adapter.PortMappingManager) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mappings []adapter.PortMappingStatus
+		if manager != nil {
+			mappings = manager.Mappings()
+		}
+		render.JSON(w, r, render.M{
+			"mappings": common.Map(mappings, func(it adapter.PortMappingStatus) render.M {
+				mapping := render.M{
+					"network":  it.Network,
+					"internal": it.InternalAddress.String(),
+				}
+				if it.Protocol != "" {
+					mapping["protocol"] = it.Protocol
+					mapping["gateway"] = it.Gateway.String()
+					mapping["external"] = it.ExternalAddress.String()
+				}
+				if !it.Expires.IsZero() {
+					mapping["expires"] = it.Expires
+				}
+				if it.Error != "" {
+					mapping["error"] = it.Error
+				}
+				return mapping
+			}),
+		})
+	}
+}
@@ -80,6 +80,9 @@ func proxyInfo(server *Server, detour adapter.Outbound) *badjson.JSONObject {
 		info.Put("now", group.Now())
 		info.Put("all", group.All())
 	}
+	if portal, isPortal := detour.(adapter.ReversePortal); isPortal {
+		info.Put("bridges", portal.Bridges())
+	}
 	return &info
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/sagernet/sing-box/dns/transport/quic"
 	"github.com/sagernet/sing-box/protocol/hysteria"
 	"github.com/sagernet/sing-box/protocol/hysteria2"
+	"github.com/sagernet/sing-box/protocol/masque"
 	_ "github.com/sagernet/sing-box/protocol/naive/quic"
 	"github.com/sagernet/sing-box/protocol/tuic"
 	_ "github.com/sagernet/sing-box/transport/v2rayquic"
@@ -19,12 +20,14 @@ func registerQUICInbounds(registry *inbound.Registry) {
 	hysteria.RegisterInbound(registry)
 	tuic.RegisterInbound(registry)
 	hysteria2.RegisterInbound(registry)
+	masque.RegisterInbound(registry)
 }
 
 func registerQUICOutbounds(registry *outbound.Registry) {
 	hysteria.RegisterOutbound(registry)
 	tuic.RegisterOutbound(registry)
 	hysteria2.RegisterOutbound(registry)
+	masque.RegisterOutbound(registry)
 }
 
 func registerQUICTransports(registry *dns.TransportRegistry) {
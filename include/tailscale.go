@@ -9,6 +9,7 @@ import (
 	"github.com/sagernet/sing-box/dns"
 	"github.com/sagernet/sing-box/protocol/tailscale"
 	"github.com/sagernet/sing-box/service/derp"
+	"github.com/sagernet/sing-box/service/tailscalecontrol"
 )
 
 func registerTailscaleEndpoint(registry *endpoint.Registry) {
@@ -26,3 +27,7 @@ func registerTailscaleCertificateProvider(registry *certificate.Registry) {
 func registerDERPService(registry *service.Registry) {
 	derp.Register(registry)
 }
+
+func registerTailscaleControlService(registry *service.Registry) {
+	tailscalecontrol.RegisterService(registry)
+}
@@ -39,3 +39,9 @@ func registerDERPService(registry *service.Registry) {
 		return nil, E.New(`DERP is not included in this build, rebuild with -tags with_tailscale`)
 	})
 }
+
+func registerTailscaleControlService(registry *service.Registry) {
+	service.Register[option.TailscaleControlServiceOptions](registry, C.TypeTailscaleControl, func(ctx context.Context, logger log.ContextLogger, tag string, options option.TailscaleControlServiceOptions) (adapter.Service, error) {
+		return nil, E.New(`Tailscale is not included in this build, rebuild with -tags with_tailscale`)
+	})
+}
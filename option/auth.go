@@ -0,0 +1,13 @@
+package option
+
+import "github.com/sagernet/sing/common/json/badoption"
+
+type UserBackendOptions struct {
+	Type       string               `json:"type"`
+	Path       string               `json:"path,omitempty"`
+	URL        string               `json:"url,omitempty"`
+	Headers    badoption.HTTPHeader `json:"headers,omitempty"`
+	Timeout    badoption.Duration   `json:"timeout,omitempty"`
+	HTTPClient *HTTPClientOptions   `json:"http_client,omitempty"`
+	CacheTTL   badoption.Duration   `json:"cache_ttl,omitempty"`
+}
@@ -0,0 +1,34 @@
+package option
+
+import (
+	"net/netip"
+
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type DHCPServerServiceOptions struct {
+	Interface           string                                `json:"interface"`
+	Address             *badoption.Prefix                     `json:"address,omitempty"`
+	RangeStart          *badoption.Addr                       `json:"range_start,omitempty"`
+	RangeEnd            *badoption.Addr                       `json:"range_end,omitempty"`
+	LeaseTime           badoption.Duration                    `json:"lease_time,omitempty"`
+	Router              *badoption.Addr                       `json:"router,omitempty"`
+	DNS                 badoption.Listable[netip.Addr]        `json:"dns,omitempty"`
+	Domain              string                                `json:"domain,omitempty"`
+	StaticLeases        []DHCPStaticLease                     `json:"static_leases,omitempty"`
+	RouterAdvertisement *DHCPServerRouterAdvertisementOptions `json:"router_advertisement,omitempty"`
+}
+
+type DHCPStaticLease struct {
+	MACAddress string         `json:"mac_address"`
+	Address    badoption.Addr `json:"address"`
+	Hostname   string         `json:"hostname,omitempty"`
+}
+
+type DHCPServerRouterAdvertisementOptions struct {
+	Enabled        bool                             `json:"enabled,omitempty"`
+	Prefix         badoption.Listable[netip.Prefix] `json:"prefix,omitempty"`
+	DNS            badoption.Listable[netip.Addr]   `json:"dns,omitempty"`
+	Interval       badoption.Duration               `json:"interval,omitempty"`
+	RouterLifetime badoption.Duration               `json:"router_lifetime,omitempty"`
+}
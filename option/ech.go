@@ -0,0 +1,20 @@
+package option
+
+import "github.com/sagernet/sing/common/json/badoption"
+
+type ECHKeyManagerServiceOptions struct {
+	ListenOptions
+	InboundTLSOptionsContainer
+	PublicName       string                   `json:"public_name,omitempty"`
+	DataDirectory    string                   `json:"data_directory,omitempty"`
+	RotationInterval badoption.Duration       `json:"rotation_interval,omitempty"`
+	DNS              *ECHKeyManagerDNSOptions `json:"dns,omitempty"`
+}
+
+type ECHKeyManagerDNSOptions struct {
+	Domain     badoption.Listable[string]         `json:"domain,omitempty"`
+	Zone       string                             `json:"zone,omitempty"`
+	ALPN       badoption.Listable[string]         `json:"alpn,omitempty"`
+	Provider   *ACMEProviderDNS01ChallengeOptions `json:"provider,omitempty"`
+	HTTPClient *HTTPClientOptions                 `json:"http_client,omitempty"`
+}
@@ -0,0 +1,26 @@
+package option
+
+import "github.com/sagernet/sing/common/json/badoption"
+
+type ForwardInboundOptions struct {
+	ListenOptions
+	Network           NetworkList                `json:"network,omitempty"`
+	Forwards          []ForwardOptions           `json:"forwards"`
+	HealthCheck       *ForwardHealthCheckOptions `json:"health_check,omitempty"`
+	SendProxyProtocol uint8                      `json:"send_proxy_protocol,omitempty"`
+}
+
+type ForwardOptions struct {
+	ListenPorts  badoption.Listable[string]  `json:"listen_ports"`
+	Destinations []ForwardDestinationOptions `json:"destinations"`
+}
+
+type ForwardDestinationOptions struct {
+	ServerOptions
+	Weight uint32 `json:"weight,omitempty"`
+}
+
+type ForwardHealthCheckOptions struct {
+	Interval badoption.Duration `json:"interval,omitempty"`
+	Timeout  badoption.Duration `json:"timeout,omitempty"`
+}
@@ -0,0 +1,20 @@
+package option
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sagernet/sing/common/json"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardInboundProxyProtocolUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	var options ForwardInboundOptions
+	err := json.UnmarshalContext(context.Background(), []byte(`{"proxy_protocol":true,"send_proxy_protocol":2}`), &options)
+	require.NoError(t, err)
+	require.True(t, options.ProxyProtocol)
+	require.Equal(t, uint8(2), options.SendProxyProtocol)
+}
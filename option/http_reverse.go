@@ -0,0 +1,19 @@
+package option
+
+import "github.com/sagernet/sing/common/json/badoption"
+
+type HTTPReverseInboundOptions struct {
+	ListenOptions
+	InboundTLSOptionsContainer
+	Routes []HTTPReverseRouteOptions `json:"routes,omitempty"`
+}
+
+type HTTPReverseRouteOptions struct {
+	Host        badoption.Listable[string] `json:"host,omitempty"`
+	Path        badoption.Listable[string] `json:"path,omitempty"`
+	URL         string                     `json:"url,omitempty"`
+	RewriteHost bool                       `json:"rewrite_host,omitempty"`
+	StripPath   bool                       `json:"strip_path,omitempty"`
+	Inbound     string                     `json:"inbound,omitempty"`
+	DialerOptions
+}
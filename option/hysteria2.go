@@ -12,11 +12,12 @@ import (
 
 type Hysteria2InboundOptions struct {
 	ListenOptions
-	UpMbps                int             `json:"up_mbps,omitempty"`
-	DownMbps              int             `json:"down_mbps,omitempty"`
-	Obfs                  *Hysteria2Obfs  `json:"obfs,omitempty"`
-	Users                 []Hysteria2User `json:"users,omitempty"`
-	IgnoreClientBandwidth bool            `json:"ignore_client_bandwidth,omitempty"`
+	ListenPorts           badoption.Listable[string] `json:"listen_ports,omitempty"`
+	UpMbps                int                        `json:"up_mbps,omitempty"`
+	DownMbps              int                        `json:"down_mbps,omitempty"`
+	Obfs                  *Hysteria2Obfs             `json:"obfs,omitempty"`
+	Users                 []Hysteria2User            `json:"users,omitempty"`
+	IgnoreClientBandwidth bool                       `json:"ignore_client_bandwidth,omitempty"`
 	InboundTLSOptionsContainer
 	QUICOptions
 	Masquerade  *Hysteria2Masquerade   `json:"masquerade,omitempty"`
@@ -0,0 +1,15 @@
+package option
+
+import "github.com/sagernet/sing/common/json/badoption"
+
+type LocalCACertificateProviderOptions struct {
+	DataDirectory   string                     `json:"data_directory,omitempty"`
+	Name            string                     `json:"name,omitempty"`
+	Certificate     badoption.Listable[string] `json:"certificate,omitempty"`
+	CertificatePath string                     `json:"certificate_path,omitempty"`
+	Key             badoption.Listable[string] `json:"key,omitempty"`
+	KeyPath         string                     `json:"key_path,omitempty"`
+	Validity        badoption.Duration         `json:"validity,omitempty"`
+	Domain          badoption.Listable[string] `json:"domain,omitempty"`
+	DomainSuffix    badoption.Listable[string] `json:"domain_suffix,omitempty"`
+}
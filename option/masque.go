@@ -0,0 +1,34 @@
+package option
+
+import (
+	"net/netip"
+
+	"github.com/sagernet/sing/common/auth"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type MASQUEInboundOptions struct {
+	ListenOptions
+	Users      []auth.User                      `json:"users,omitempty"`
+	Template   string                           `json:"template,omitempty"`
+	IPTemplate string                           `json:"ip_template,omitempty"`
+	IPAddress  badoption.Listable[netip.Prefix] `json:"ip_address,omitempty"`
+	MTU        uint32                           `json:"mtu,omitempty"`
+	InboundTLSOptionsContainer
+	QUICOptions
+}
+
+type MASQUEOutboundOptions struct {
+	DialerOptions
+	ServerOptions
+	Username   string               `json:"username,omitempty"`
+	Password   string               `json:"password,omitempty"`
+	Mode       string               `json:"mode,omitempty"`
+	Template   string               `json:"template,omitempty"`
+	IPTemplate string               `json:"ip_template,omitempty"`
+	MTU        uint32               `json:"mtu,omitempty"`
+	Headers    badoption.HTTPHeader `json:"headers,omitempty"`
+	Network    NetworkList          `json:"network,omitempty"`
+	OutboundTLSOptionsContainer
+	QUICOptions
+}
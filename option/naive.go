@@ -18,9 +18,10 @@ const (
 
 type NaiveInboundOptions struct {
 	ListenOptions
-	Users                 []auth.User `json:"users,omitempty"`
-	Network               NetworkList `json:"network,omitempty"`
-	QUICCongestionControl string      `json:"quic_congestion_control,omitempty"`
+	Users                 []auth.User         `json:"users,omitempty"`
+	UserBackend           *UserBackendOptions `json:"user_backend,omitempty"`
+	Network               NetworkList         `json:"network,omitempty"`
+	QUICCongestionControl string              `json:"quic_congestion_control,omitempty"`
 	InboundTLSOptionsContainer
 }
 
@@ -9,3 +9,14 @@ type NTPOptions struct {
 	ServerOptions
 	DialerOptions
 }
+
+type NTPServerServiceOptions struct {
+	ListenOptions
+	Stratum   uint8                      `json:"stratum,omitempty"`
+	RateLimit *NTPServerRateLimitOptions `json:"rate_limit,omitempty"`
+}
+
+type NTPServerRateLimitOptions struct {
+	Interval badoption.Duration `json:"interval,omitempty"`
+	Burst    int                `json:"burst,omitempty"`
+}
@@ -7,14 +7,19 @@ import (
 type OCMServiceOptions struct {
 	ListenOptions
 	InboundTLSOptionsContainer
-	CredentialPath string               `json:"credential_path,omitempty"`
-	Users          []OCMUser            `json:"users,omitempty"`
-	Headers        badoption.HTTPHeader `json:"headers,omitempty"`
-	Detour         string               `json:"detour,omitempty"`
-	UsagesPath     string               `json:"usages_path,omitempty"`
+	CredentialPath  string                     `json:"credential_path,omitempty"`
+	CredentialPaths badoption.Listable[string] `json:"credential_paths,omitempty"`
+	Users           []OCMUser                  `json:"users,omitempty"`
+	Headers         badoption.HTTPHeader       `json:"headers,omitempty"`
+	Detour          string                     `json:"detour,omitempty"`
+	UsagesPath      string                     `json:"usages_path,omitempty"`
 }
 
 type OCMUser struct {
-	Name  string `json:"name,omitempty"`
-	Token string `json:"token,omitempty"`
+	Name              string                     `json:"name,omitempty"`
+	Token             string                     `json:"token,omitempty"`
+	AllowedModels     badoption.Listable[string] `json:"allowed_models,omitempty"`
+	WeeklyBudget      float64                    `json:"weekly_budget,omitempty"`
+	MonthlyBudget     float64                    `json:"monthly_budget,omitempty"`
+	RequestsPerMinute int                        `json:"requests_per_minute,omitempty"`
 }
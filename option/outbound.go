@@ -87,6 +87,7 @@ type DialerOptions struct {
 	NetworkType          badoption.Listable[InterfaceType] `json:"network_type,omitempty"`
 	FallbackNetworkType  badoption.Listable[InterfaceType] `json:"fallback_network_type,omitempty"`
 	FallbackDelay        badoption.Duration                `json:"fallback_delay,omitempty"`
+	ProxyProtocol        uint8                             `json:"proxy_protocol,omitempty"`
 
 	// Deprecated: migrated to domain resolver
 	DomainStrategy DomainStrategy `json:"domain_strategy,omitempty"`
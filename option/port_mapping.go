@@ -0,0 +1,12 @@
+package option
+
+import "github.com/sagernet/sing/common/json/badoption"
+
+type PortMappingOptions struct {
+	Enabled      bool                       `json:"enabled,omitempty"`
+	Protocols    badoption.Listable[string] `json:"protocols,omitempty"`
+	Gateway      *badoption.Addr            `json:"gateway,omitempty"`
+	ExternalPort uint16                     `json:"external_port,omitempty"`
+	Lifetime     badoption.Duration         `json:"lifetime,omitempty"`
+	Description  string                     `json:"description,omitempty"`
+}
@@ -0,0 +1,15 @@
+package option
+
+type ReverseEndpointOptions struct {
+	DialerOptions
+	Mode     string        `json:"mode"`
+	Domain   string        `json:"domain"`
+	Name     string        `json:"name,omitempty"`
+	Password string        `json:"password,omitempty"`
+	Users    []ReverseUser `json:"users,omitempty"`
+}
+
+type ReverseUser struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
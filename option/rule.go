@@ -72,6 +72,13 @@ type RawDefaultRule struct {
 	AuthUser                 badoption.Listable[string]                                                  `json:"auth_user,omitempty"`
 	Protocol                 badoption.Listable[string]                                                  `json:"protocol,omitempty"`
 	Client                   badoption.Listable[string]                                                  `json:"client,omitempty"`
+	HTTPMethod               badoption.Listable[string]                                                  `json:"http_method,omitempty"`
+	HTTPPath                 badoption.Listable[string]                                                  `json:"http_path,omitempty"`
+	HTTPPathRegex            badoption.Listable[string]                                                  `json:"http_path_regex,omitempty"`
+	HTTPHeader               *badjson.TypedMap[string, badoption.Listable[string]]                       `json:"http_header,omitempty"`
+	ProxyProtocolUser        badoption.Listable[string]                                                  `json:"proxy_protocol_user,omitempty"`
+	ProxyProtocolInbound     badoption.Listable[string]                                                  `json:"proxy_protocol_inbound,omitempty"`
+	ProxyProtocolServerName  badoption.Listable[string]                                                  `json:"proxy_protocol_server_name,omitempty"`
 	Domain                   badoption.Listable[string]                                                  `json:"domain,omitempty"`
 	DomainSuffix             badoption.Listable[string]                                                  `json:"domain_suffix,omitempty"`
 	DomainKeyword            badoption.Listable[string]                                                  `json:"domain_keyword,omitempty"`
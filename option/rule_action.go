@@ -3,6 +3,7 @@ package option
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/netip"
 	"time"
 
@@ -22,6 +23,9 @@ type _RuleAction struct {
 	RejectOptions       RejectActionOptions       `json:"-"`
 	SniffOptions        RouteActionSniff          `json:"-"`
 	ResolveOptions      RouteActionResolve        `json:"-"`
+	HTTPRejectOptions   RouteActionHTTPReject     `json:"-"`
+	HTTPRedirectOptions RouteActionHTTPRedirect   `json:"-"`
+	HTTPRewriteOptions  RouteActionHTTPRewrite    `json:"-"`
 }
 
 type RuleAction _RuleAction
@@ -49,6 +53,12 @@ func (r RuleAction) MarshalJSON() ([]byte, error) {
 		v = r.SniffOptions
 	case C.RuleActionTypeResolve:
 		v = r.ResolveOptions
+	case C.RuleActionTypeHTTPReject:
+		v = r.HTTPRejectOptions
+	case C.RuleActionTypeHTTPRedirect:
+		v = r.HTTPRedirectOptions
+	case C.RuleActionTypeHTTPRewrite:
+		v = r.HTTPRewriteOptions
 	default:
 		return nil, E.New("unknown rule action: " + r.Action)
 	}
@@ -82,6 +92,12 @@ func (r *RuleAction) UnmarshalJSON(data []byte) error {
 		v = &r.SniffOptions
 	case C.RuleActionTypeResolve:
 		v = &r.ResolveOptions
+	case C.RuleActionTypeHTTPReject:
+		v = &r.HTTPRejectOptions
+	case C.RuleActionTypeHTTPRedirect:
+		v = &r.HTTPRedirectOptions
+	case C.RuleActionTypeHTTPRewrite:
+		v = &r.HTTPRewriteOptions
 	default:
 		return E.New("unknown rule action: " + r.Action)
 	}
@@ -184,6 +200,8 @@ type RawRouteOptionsActionOptions struct {
 	TLSRecordFragment        bool               `json:"tls_record_fragment,omitempty"`
 	TLSSpoof                 string             `json:"tls_spoof,omitempty"`
 	TLSSpoofMethod           string             `json:"tls_spoof_method,omitempty"`
+
+	Capture string `json:"capture,omitempty"`
 }
 
 type RouteOptionsActionOptions RawRouteOptionsActionOptions
@@ -342,3 +360,53 @@ type DNSRouteActionPredefined struct {
 	Ns     badoption.Listable[DNSRecordOptions] `json:"ns,omitempty"`
 	Extra  badoption.Listable[DNSRecordOptions] `json:"extra,omitempty"`
 }
+
+type _RouteActionHTTPReject struct {
+	StatusCode int    `json:"status_code,omitempty"`
+	Body       string `json:"body,omitempty"`
+}
+
+type RouteActionHTTPReject _RouteActionHTTPReject
+
+func (r *RouteActionHTTPReject) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*_RouteActionHTTPReject)(r))
+	if err != nil {
+		return err
+	}
+	if r.StatusCode == 0 {
+		r.StatusCode = http.StatusForbidden
+	} else if r.StatusCode < 100 || r.StatusCode > 599 {
+		return E.New("invalid status code: ", r.StatusCode)
+	}
+	return nil
+}
+
+type _RouteActionHTTPRedirect struct {
+	Location   string `json:"location,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+type RouteActionHTTPRedirect _RouteActionHTTPRedirect
+
+func (r *RouteActionHTTPRedirect) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*_RouteActionHTTPRedirect)(r))
+	if err != nil {
+		return err
+	}
+	if r.Location == "" {
+		return E.New("missing location")
+	}
+	switch r.StatusCode {
+	case 0:
+		r.StatusCode = http.StatusFound
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return E.New("invalid redirect status code: ", r.StatusCode)
+	}
+	return nil
+}
+
+type RouteActionHTTPRewrite struct {
+	SetHeader    *badjson.TypedMap[string, string] `json:"set_header,omitempty"`
+	RemoveHeader badoption.Listable[string]        `json:"remove_header,omitempty"`
+}
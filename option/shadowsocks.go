@@ -9,6 +9,7 @@ type ShadowsocksInboundOptions struct {
 	Destinations []ShadowsocksDestination `json:"destinations,omitempty"`
 	Multiplex    *InboundMultiplexOptions `json:"multiplex,omitempty"`
 	Managed      bool                     `json:"managed,omitempty"`
+	Relay        bool                     `json:"relay,omitempty"`
 }
 
 type ShadowsocksUser struct {
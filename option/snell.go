@@ -0,0 +1,23 @@
+package option
+
+type SnellInboundOptions struct {
+	ListenOptions
+	PSK     string            `json:"psk"`
+	Version int               `json:"version,omitempty"`
+	Obfs    *SnellObfsOptions `json:"obfs,omitempty"`
+}
+
+type SnellOutboundOptions struct {
+	DialerOptions
+	ServerOptions
+	PSK     string            `json:"psk"`
+	Version int               `json:"version,omitempty"`
+	Obfs    *SnellObfsOptions `json:"obfs,omitempty"`
+	Reuse   *bool             `json:"reuse,omitempty"`
+	Network NetworkList       `json:"network,omitempty"`
+}
+
+type SnellObfsOptions struct {
+	Type string `json:"type,omitempty"`
+	Host string `json:"host,omitempty"`
+}
@@ -17,3 +17,21 @@ type SSHOutboundOptions struct {
 	MAC                  badoption.Listable[string] `json:"mac,omitempty"`
 	KexAlgorithm         badoption.Listable[string] `json:"kex_algorithm,omitempty"`
 }
+
+type SSHInboundOptions struct {
+	ListenOptions
+	Users         []SSHUser                  `json:"users,omitempty"`
+	HostKey       badoption.Listable[string] `json:"host_key,omitempty"`
+	HostKeyPath   string                     `json:"host_key_path,omitempty"`
+	ServerVersion string                     `json:"server_version,omitempty"`
+	Cipher        badoption.Listable[string] `json:"cipher,omitempty"`
+	MAC           badoption.Listable[string] `json:"mac,omitempty"`
+	KexAlgorithm  badoption.Listable[string] `json:"kex_algorithm,omitempty"`
+}
+
+type SSHUser struct {
+	Name               string                     `json:"name,omitempty"`
+	Password           string                     `json:"password,omitempty"`
+	AuthorizedKeys     badoption.Listable[string] `json:"authorized_keys,omitempty"`
+	AuthorizedKeysPath string                     `json:"authorized_keys_path,omitempty"`
+}
@@ -0,0 +1,27 @@
+package option
+
+import (
+	"net/netip"
+
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+type STUNServiceOptions struct {
+	ListenOptions
+	TURN *TURNServerOptions `json:"turn,omitempty"`
+}
+
+type TURNServerOptions struct {
+	Enabled         bool                             `json:"enabled,omitempty"`
+	Realm           string                           `json:"realm,omitempty"`
+	Users           []TURNUser                       `json:"users,omitempty"`
+	Detour          string                           `json:"detour,omitempty"`
+	RelayAddress    *badoption.Addr                  `json:"relay_address,omitempty"`
+	RelaySTUNServer string                           `json:"relay_stun_server,omitempty"`
+	AllowedPeers    badoption.Listable[netip.Prefix] `json:"allowed_peers,omitempty"`
+}
+
+type TURNUser struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
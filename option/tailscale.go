@@ -26,11 +26,27 @@ type TailscaleEndpointOptions struct {
 	AdvertiseExitNode          bool                       `json:"advertise_exit_node,omitempty"`
 	AdvertiseTags              badoption.Listable[string] `json:"advertise_tags,omitempty"`
 	RelayServerPort            *uint16                    `json:"relay_server_port,omitempty"`
+	PortMapping                *PortMappingOptions        `json:"port_mapping,omitempty"`
 	RelayServerStaticEndpoints []netip.AddrPort           `json:"relay_server_static_endpoints,omitempty"`
 	SystemInterface            bool                       `json:"system_interface,omitempty"`
 	SystemInterfaceName        string                     `json:"system_interface_name,omitempty"`
 	SystemInterfaceMTU         uint32                     `json:"system_interface_mtu,omitempty"`
 	UDPTimeout                 UDPTimeoutCompat           `json:"udp_timeout,omitempty"`
+	Serve                      []TailscaleServeOptions    `json:"serve,omitempty"`
+}
+
+type TailscaleServeOptions struct {
+	Port   uint16                      `json:"port"`
+	TLS    bool                        `json:"tls,omitempty"`
+	Funnel bool                        `json:"funnel,omitempty"`
+	HTTP   []TailscaleServeHTTPOptions `json:"http,omitempty"`
+	ServerOptions
+}
+
+type TailscaleServeHTTPOptions struct {
+	Path        string `json:"path,omitempty"`
+	URL         string `json:"url"`
+	RewriteHost bool   `json:"rewrite_host,omitempty"`
 }
 
 type TailscaleDNSServerOptions struct {
@@ -43,6 +59,24 @@ type TailscaleCertificateProviderOptions struct {
 	Endpoint string `json:"endpoint,omitempty"`
 }
 
+type TailscaleControlServiceOptions struct {
+	ListenOptions
+	InboundTLSOptionsContainer
+	StatePath  string                        `json:"state_path,omitempty"`
+	AuthKeys   badoption.Listable[string]    `json:"auth_keys,omitempty"`
+	Inet4Range *badoption.Prefix             `json:"inet4_range,omitempty"`
+	Inet6Range *badoption.Prefix             `json:"inet6_range,omitempty"`
+	BaseDomain string                        `json:"base_domain,omitempty"`
+	DERP       []TailscaleControlDERPOptions `json:"derp,omitempty"`
+}
+
+type TailscaleControlDERPOptions struct {
+	Service  string `json:"service"`
+	HostName string `json:"host_name,omitempty"`
+	Port     uint16 `json:"port,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
 type DERPServiceOptions struct {
 	ListenOptions
 	InboundTLSOptionsContainer
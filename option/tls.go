@@ -213,9 +213,10 @@ type InboundRealityHandshakeOptions struct {
 }
 
 type InboundECHOptions struct {
-	Enabled bool                       `json:"enabled,omitempty"`
-	Key     badoption.Listable[string] `json:"key,omitempty"`
-	KeyPath string                     `json:"key_path,omitempty"`
+	Enabled    bool                       `json:"enabled,omitempty"`
+	Key        badoption.Listable[string] `json:"key,omitempty"`
+	KeyPath    string                     `json:"key_path,omitempty"`
+	KeyManager string                     `json:"key_manager,omitempty"`
 
 	// Deprecated: not supported by stdlib
 	PQSignatureSchemesEnabled bool `json:"pq_signature_schemes_enabled,omitempty"`
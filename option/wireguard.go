@@ -7,15 +7,17 @@ import (
 )
 
 type WireGuardEndpointOptions struct {
-	System     bool                             `json:"system,omitempty"`
-	Name       string                           `json:"name,omitempty"`
-	MTU        uint32                           `json:"mtu,omitempty"`
-	Address    badoption.Listable[netip.Prefix] `json:"address"`
-	PrivateKey string                           `json:"private_key"`
-	ListenPort uint16                           `json:"listen_port,omitempty"`
-	Peers      []WireGuardPeer                  `json:"peers,omitempty"`
-	UDPTimeout badoption.Duration               `json:"udp_timeout,omitempty"`
-	Workers    int                              `json:"workers,omitempty"`
+	System      bool                             `json:"system,omitempty"`
+	Name        string                           `json:"name,omitempty"`
+	MTU         uint32                           `json:"mtu,omitempty"`
+	Address     badoption.Listable[netip.Prefix] `json:"address"`
+	PrivateKey  string                           `json:"private_key"`
+	ListenPort  uint16                           `json:"listen_port,omitempty"`
+	PortMapping *PortMappingOptions              `json:"port_mapping,omitempty"`
+	Peers       []WireGuardPeer                  `json:"peers,omitempty"`
+	UDPTimeout  badoption.Duration               `json:"udp_timeout,omitempty"`
+	Workers     int                              `json:"workers,omitempty"`
+	Amnezia     *WireGuardAmneziaOptions         `json:"amnezia,omitempty"`
 	DialerOptions
 }
 
@@ -27,4 +29,17 @@ type WireGuardPeer struct {
 	AllowedIPs                  badoption.Listable[netip.Prefix] `json:"allowed_ips,omitempty"`
 	PersistentKeepaliveInterval uint16                           `json:"persistent_keepalive_interval,omitempty"`
 	Reserved                    []uint8                          `json:"reserved,omitempty"`
+	Amnezia                     *WireGuardAmneziaOptions         `json:"amnezia,omitempty"`
+}
+
+type WireGuardAmneziaOptions struct {
+	JunkPacketCount              int    `json:"junk_packet_count,omitempty"`
+	JunkPacketMinSize            int    `json:"junk_packet_min_size,omitempty"`
+	JunkPacketMaxSize            int    `json:"junk_packet_max_size,omitempty"`
+	InitPacketJunkSize           int    `json:"init_packet_junk_size,omitempty"`
+	ResponsePacketJunkSize       int    `json:"response_packet_junk_size,omitempty"`
+	InitPacketMagicHeader        uint32 `json:"init_packet_magic_header,omitempty"`
+	ResponsePacketMagicHeader    uint32 `json:"response_packet_magic_header,omitempty"`
+	CookieReplyPacketMagicHeader uint32 `json:"cookie_reply_packet_magic_header,omitempty"`
+	TransportPacketMagicHeader   uint32 `json:"transport_packet_magic_header,omitempty"`
 }
@@ -0,0 +1,287 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/inbound"
+	"github.com/sagernet/sing-box/common/dialer"
+	"github.com/sagernet/sing-box/common/listener"
+	"github.com/sagernet/sing-box/common/proxyproto"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/buf"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/udpnat2"
+)
+
+func RegisterInbound(registry *inbound.Registry) {
+	inbound.Register[option.ForwardInboundOptions](registry, C.TypeForward, NewInbound)
+}
+
+type Inbound struct {
+	inbound.Adapter
+	ctx               context.Context
+	cancel            context.CancelFunc
+	router            adapter.ConnectionRouterEx
+	logger            log.ContextLogger
+	network           []string
+	sendProxyProtocol uint8
+	ports             []*portForward
+	pools             []*destinationPool
+	healthCheck       *healthChecker
+}
+
+func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.ForwardInboundOptions) (adapter.Inbound, error) {
+	if len(options.Forwards) == 0 {
+		return nil, E.New("missing forwards")
+	}
+	if options.ListenPort != 0 {
+		return nil, E.New("`listen_port` is not supported, use `listen_ports` in forwards instead")
+	}
+	network := options.Network.Build()
+	if options.SendProxyProtocol != 0 {
+		if options.SendProxyProtocol > 2 {
+			return nil, E.New("unknown PROXY protocol version: ", options.SendProxyProtocol)
+		}
+		if options.SendProxyProtocol == 1 && common.Contains(network, N.NetworkUDP) {
+			return nil, E.New("PROXY protocol v1 does not support UDP, set `network` to `tcp`")
+		}
+	}
+	if options.HealthCheck != nil && !common.Contains(network, N.NetworkTCP) {
+		return nil, E.New("`health_check` connects to destinations over TCP, set `network` to include `tcp`")
+	}
+	options.UDPFragmentDefault = true
+	var udpTimeout time.Duration
+	if options.UDPTimeout != 0 {
+		udpTimeout = time.Duration(options.UDPTimeout)
+	} else {
+		udpTimeout = C.UDPTimeout
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	inbound := &Inbound{
+		Adapter:           inbound.NewAdapter(C.TypeForward, tag),
+		ctx:               ctx,
+		cancel:            cancel,
+		router:            router,
+		logger:            logger,
+		network:           network,
+		sendProxyProtocol: options.SendProxyProtocol,
+	}
+	listenPorts := make(map[uint16]bool)
+	for i, forwardOptions := range options.Forwards {
+		pool, err := newDestinationPool(forwardOptions.Destinations)
+		if err != nil {
+			return nil, E.Cause(err, "parse forwards[", i, "]")
+		}
+		if len(forwardOptions.ListenPorts) == 0 {
+			return nil, E.New("parse forwards[", i, "]: missing listen_ports")
+		}
+		for _, portRangeString := range forwardOptions.ListenPorts {
+			start, end, err := parsePortRange(portRangeString)
+			if err != nil {
+				return nil, E.Cause(err, "parse forwards[", i, "]")
+			}
+			if pool.healthCheckPort == 0 {
+				pool.healthCheckPort = start
+			}
+			for port := uint32(start); port <= uint32(end); port++ {
+				if listenPorts[uint16(port)] {
+					return nil, E.New("parse forwards[", i, "]: duplicate listen port: ", port)
+				}
+				listenPorts[uint16(port)] = true
+				if len(listenPorts) > listener.MaxListenPorts {
+					return nil, E.New("parse forwards[", i, "]: too many listen ports, at most ", listener.MaxListenPorts, " are supported")
+				}
+				offset := uint16(port - uint32(start))
+				for _, destination := range pool.destinations {
+					if destination.address.Port != 0 && uint32(destination.address.Port)+uint32(offset) > 65535 {
+						return nil, E.New("parse forwards[", i, "]: destination port out of range for listen port ", port, ": ", destination.address)
+					}
+				}
+				listenOptions := options.ListenOptions
+				listenOptions.ListenPort = uint16(port)
+				forward := &portForward{
+					inbound: inbound,
+					port:    uint16(port),
+					offset:  offset,
+					pool:    pool,
+				}
+				forward.udpNat = udpnat.New(forward, forward.preparePacketConnection, udpTimeout, false)
+				forward.listener = listener.New(listener.Options{
+					Context:           ctx,
+					Logger:            logger,
+					Network:           network,
+					Listen:            listenOptions,
+					ConnectionHandler: forward,
+					PacketHandler:     forward,
+				})
+				inbound.ports = append(inbound.ports, forward)
+			}
+		}
+		inbound.pools = append(inbound.pools, pool)
+	}
+	if options.HealthCheck != nil {
+		healthCheckDialer, err := dialer.NewWithOptions(dialer.Options{
+			Context:         ctx,
+			Options:         option.DialerOptions{},
+			RemoteIsDomain:  true,
+			DefaultOutbound: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		inbound.healthCheck = newHealthChecker(ctx, logger, healthCheckDialer, inbound.pools, *options.HealthCheck)
+	}
+	return inbound, nil
+}
+
+func (h *Inbound) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	for _, forward := range h.ports {
+		err := forward.listener.Start()
+		if err != nil {
+			return E.Cause(err, "listen port ", forward.port)
+		}
+	}
+	if h.healthCheck != nil {
+		go h.healthCheck.loop()
+	}
+	return nil
+}
+
+func (h *Inbound) Close() error {
+	h.cancel()
+	var err error
+	for _, forward := range h.ports {
+		err = E.Append(err, forward.listener.Close(), func(err error) error {
+			return E.Cause(err, "close port ", forward.port)
+		})
+	}
+	return err
+}
+
+type portForward struct {
+	inbound  *Inbound
+	port     uint16
+	offset   uint16
+	pool     *destinationPool
+	listener *listener.Listener
+	udpNat   *udpnat.Service
+}
+
+func (f *portForward) destination() M.Socksaddr {
+	destination := f.pool.pick().address
+	if destination.Port == 0 {
+		destination.Port = f.port
+	} else {
+		destination.Port += f.offset
+	}
+	return destination
+}
+
+func (f *portForward) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	metadata.Inbound = f.inbound.Tag()
+	metadata.InboundType = f.inbound.Type()
+	metadata.Destination = f.destination()
+	f.inbound.logger.InfoContext(ctx, "inbound connection to ", metadata.Destination)
+	if f.inbound.sendProxyProtocol != 0 {
+		header, err := proxyproto.Header(f.inbound.sendProxyProtocol, N.NetworkTCP, metadata.Source, metadata.OriginDestination, proxyproto.Info{})
+		if err != nil {
+			N.CloseOnHandshakeFailure(conn, onClose, err)
+			f.inbound.logger.ErrorContext(ctx, E.Cause(err, "create PROXY protocol header"))
+			return
+		}
+		conn = bufio.NewCachedConn(conn, buf.As(header))
+	}
+	f.inbound.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (f *portForward) NewPacket(buffer *buf.Buffer, source M.Socksaddr) {
+	f.udpNat.NewPacket([][]byte{buffer.Bytes()}, source, f.listener.UDPAddr(), nil)
+}
+
+func (f *portForward) NewPacketConnectionEx(ctx context.Context, conn N.PacketConn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	f.inbound.logger.InfoContext(ctx, "inbound packet connection from ", source)
+	var metadata adapter.InboundContext
+	metadata.Inbound = f.inbound.Tag()
+	metadata.InboundType = f.inbound.Type()
+	//nolint:staticcheck
+	metadata.InboundDetour = f.listener.ListenOptions().Detour
+	metadata.Source = source
+	metadata.OriginDestination = f.listener.UDPAddr()
+	metadata.Destination = f.destination()
+	f.inbound.logger.InfoContext(ctx, "inbound packet connection to ", metadata.Destination)
+	conn = bufio.NewDestinationNATPacketConn(bufio.NewNetPacketConn(conn), metadata.OriginDestination, metadata.Destination)
+	if f.inbound.sendProxyProtocol != 0 {
+		header, err := proxyproto.Header(f.inbound.sendProxyProtocol, N.NetworkUDP, source, metadata.OriginDestination, proxyproto.Info{})
+		if err != nil {
+			N.CloseOnHandshakeFailure(conn, onClose, err)
+			f.inbound.logger.ErrorContext(ctx, E.Cause(err, "create PROXY protocol header"))
+			return
+		}
+		conn = &proxyProtocolPacketConn{PacketConn: conn, header: header}
+	}
+	f.inbound.router.RoutePacketConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (f *portForward) preparePacketConnection(source M.Socksaddr, destination M.Socksaddr, userData any) (bool, context.Context, N.PacketWriter, N.CloseHandlerFunc) {
+	return true, log.ContextWithNewID(f.inbound.ctx), &forwardPacketWriter{f.listener.PacketWriter(), source}, nil
+}
+
+type forwardPacketWriter struct {
+	writer N.PacketWriter
+	source M.Socksaddr
+}
+
+func (w *forwardPacketWriter) WritePacket(buffer *buf.Buffer, addr M.Socksaddr) error {
+	return w.writer.WritePacket(buffer, w.source)
+}
+
+// proxyProtocolPacketConn prepends the PROXY protocol header to every datagram from the client.
+type proxyProtocolPacketConn struct {
+	N.PacketConn
+	header []byte
+}
+
+func (c *proxyProtocolPacketConn) ReadPacket(buffer *buf.Buffer) (M.Socksaddr, error) {
+	if buffer.IsEmpty() && buffer.FreeLen() > len(c.header) {
+		buffer.Advance(len(c.header))
+	}
+	destination, err := c.PacketConn.ReadPacket(buffer)
+	if err != nil {
+		return destination, err
+	}
+	if buffer.Start() < len(c.header) {
+		return destination, E.New("insufficient buffer for PROXY protocol header")
+	}
+	copy(buffer.ExtendHeader(len(c.header)), c.header)
+	return destination, nil
+}
+
+func parsePortRange(portRange string) (start uint16, end uint16, err error) {
+	startString, endString, isRange := strings.Cut(portRange, ":")
+	startValue, err := strconv.ParseUint(startString, 10, 16)
+	if err != nil || startValue == 0 {
+		return 0, 0, E.New("bad port range: ", portRange)
+	}
+	endValue := startValue
+	if isRange {
+		endValue, err = strconv.ParseUint(endString, 10, 16)
+		if err != nil || endValue < startValue {
+			return 0, 0, E.New("bad port range: ", portRange)
+		}
+	}
+	return uint16(startValue), uint16(endValue), nil
+}
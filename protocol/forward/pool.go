@@ -0,0 +1,152 @@
+package forward
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+type destinationPool struct {
+	destinations    []*destination
+	healthCheckPort uint16
+}
+
+type destination struct {
+	address   M.Socksaddr
+	weight    uint32
+	unhealthy atomic.Bool
+}
+
+func newDestinationPool(options []option.ForwardDestinationOptions) (*destinationPool, error) {
+	if len(options) == 0 {
+		return nil, E.New("missing destinations")
+	}
+	pool := &destinationPool{}
+	for i, destinationOptions := range options {
+		address := destinationOptions.ServerOptions.Build()
+		if !address.IsValid() {
+			return nil, E.New("destinations[", i, "]: missing server")
+		}
+		weight := destinationOptions.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		pool.destinations = append(pool.destinations, &destination{
+			address: address,
+			weight:  weight,
+		})
+	}
+	return pool, nil
+}
+
+// pick selects a destination by weight among healthy ones, or among all destinations if none is healthy.
+func (p *destinationPool) pick() *destination {
+	if len(p.destinations) == 1 {
+		return p.destinations[0]
+	}
+	var totalWeight uint64
+	for _, it := range p.destinations {
+		if !it.unhealthy.Load() {
+			totalWeight += uint64(it.weight)
+		}
+	}
+	allUnhealthy := totalWeight == 0
+	if allUnhealthy {
+		for _, it := range p.destinations {
+			totalWeight += uint64(it.weight)
+		}
+	}
+	n := rand.Uint64N(totalWeight)
+	for _, it := range p.destinations {
+		if !allUnhealthy && it.unhealthy.Load() {
+			continue
+		}
+		if n < uint64(it.weight) {
+			return it
+		}
+		n -= uint64(it.weight)
+	}
+	return p.destinations[len(p.destinations)-1]
+}
+
+type healthChecker struct {
+	ctx      context.Context
+	logger   log.ContextLogger
+	dialer   N.Dialer
+	pools    []*destinationPool
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func newHealthChecker(ctx context.Context, logger log.ContextLogger, dialer N.Dialer, pools []*destinationPool, options option.ForwardHealthCheckOptions) *healthChecker {
+	interval := time.Duration(options.Interval)
+	if interval == 0 {
+		interval = C.DefaultURLTestInterval
+	}
+	timeout := time.Duration(options.Timeout)
+	if timeout == 0 {
+		timeout = C.TCPConnectTimeout
+	}
+	return &healthChecker{
+		ctx:      ctx,
+		logger:   logger,
+		dialer:   dialer,
+		pools:    pools,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+func (c *healthChecker) loop() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.checkOnce()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *healthChecker) checkOnce() {
+	for _, pool := range c.pools {
+		if len(pool.destinations) == 1 {
+			continue
+		}
+		for _, it := range pool.destinations {
+			go c.check(pool, it)
+		}
+	}
+}
+
+func (c *healthChecker) check(pool *destinationPool, it *destination) {
+	address := it.address
+	if address.Port == 0 {
+		address.Port = pool.healthCheckPort
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	conn, err := c.dialer.DialContext(ctx, N.NetworkTCP, address)
+	if err == nil {
+		conn.Close()
+	}
+	if c.ctx.Err() != nil {
+		return
+	}
+	wasUnhealthy := it.unhealthy.Swap(err != nil)
+	if err != nil && !wasUnhealthy {
+		c.logger.Warn("destination ", address, " is unhealthy: ", err)
+	} else if err == nil && wasUnhealthy {
+		c.logger.Info("destination ", address, " is healthy again")
+	}
+}
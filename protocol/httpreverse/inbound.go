@@ -0,0 +1,273 @@
+package httpreverse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/inbound"
+	"github.com/sagernet/sing-box/common/dialer"
+	"github.com/sagernet/sing-box/common/listener"
+	"github.com/sagernet/sing-box/common/tls"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	aTLS "github.com/sagernet/sing/common/tls"
+	"github.com/sagernet/sing/service"
+
+	"golang.org/x/net/http2"
+)
+
+func RegisterInbound(registry *inbound.Registry) {
+	inbound.Register[option.HTTPReverseInboundOptions](registry, C.TypeHTTPReverse, NewInbound)
+}
+
+type Inbound struct {
+	inbound.Adapter
+	ctx        context.Context
+	logger     logger.ContextLogger
+	listener   *listener.Listener
+	tlsConfig  tls.ServerConfig
+	routes     []*route
+	httpServer *http.Server
+}
+
+func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.HTTPReverseInboundOptions) (adapter.Inbound, error) {
+	if len(options.Routes) == 0 {
+		return nil, E.New("missing routes")
+	}
+	inbound := &Inbound{
+		Adapter: inbound.NewAdapter(C.TypeHTTPReverse, tag),
+		ctx:     ctx,
+		logger:  logger,
+		listener: listener.New(listener.Options{
+			Context: ctx,
+			Logger:  logger,
+			Network: []string{N.NetworkTCP},
+			Listen:  options.ListenOptions,
+		}),
+	}
+	for i, routeOptions := range options.Routes {
+		route, err := newRoute(ctx, logger, routeOptions)
+		if err != nil {
+			return nil, E.Cause(err, "parse route[", i, "]")
+		}
+		inbound.routes = append(inbound.routes, route)
+	}
+	if options.TLS != nil {
+		tlsConfig, err := tls.NewServer(ctx, logger, common.PtrValueOrDefault(options.TLS))
+		if err != nil {
+			return nil, err
+		}
+		inbound.tlsConfig = tlsConfig
+	}
+	return inbound, nil
+}
+
+func (h *Inbound) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	inboundManager := service.FromContext[adapter.InboundManager](h.ctx)
+	for i, route := range h.routes {
+		if route.inbound == "" {
+			continue
+		}
+		rawInbound, loaded := inboundManager.Get(route.inbound)
+		if !loaded {
+			return E.New("route[", i, "]: inbound not found: ", route.inbound)
+		}
+		injectable, isInjectable := rawInbound.(adapter.HTTPInjectableInbound)
+		if !isInjectable {
+			return E.New("route[", i, "]: inbound is not HTTP injectable: ", route.inbound)
+		}
+		handler := injectable.HTTPHandler()
+		if handler == nil {
+			return E.New("route[", i, "]: inbound has no HTTP based transport: ", route.inbound)
+		}
+		route.handler = handler
+	}
+	if h.tlsConfig != nil {
+		err := h.tlsConfig.Start()
+		if err != nil {
+			return E.Cause(err, "create TLS config")
+		}
+	}
+	tcpListener, err := h.listener.ListenTCP()
+	if err != nil {
+		return err
+	}
+	h.httpServer = &http.Server{
+		Handler: h,
+		BaseContext: func(net.Listener) context.Context {
+			return h.ctx
+		},
+	}
+	go func() {
+		listener := net.Listener(tcpListener)
+		if h.tlsConfig != nil {
+			if len(h.tlsConfig.NextProtos()) == 0 {
+				h.tlsConfig.SetNextProtos([]string{http2.NextProtoTLS, "http/1.1"})
+			}
+			listener = aTLS.NewListener(tcpListener, h.tlsConfig)
+		}
+		sErr := h.httpServer.Serve(listener)
+		if sErr != nil && !errors.Is(sErr, http.ErrServerClosed) && !E.IsClosedOrCanceled(sErr) {
+			h.logger.Error("http server serve error: ", sErr)
+		}
+	}()
+	return nil
+}
+
+func (h *Inbound) Close() error {
+	return common.Close(
+		h.listener,
+		common.PtrOrNil(h.httpServer),
+		h.tlsConfig,
+	)
+}
+
+func (h *Inbound) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	ctx := log.ContextWithNewID(request.Context())
+	request = request.WithContext(ctx)
+	host := strings.ToLower(M.ParseSocksaddr(request.Host).AddrString())
+	for _, route := range h.routes {
+		mountPoint, matched := route.match(host, request.URL.Path)
+		if !matched {
+			continue
+		}
+		if route.inbound != "" {
+			h.logger.DebugContext(ctx, "inbound request from ", request.RemoteAddr, " for ", request.Host, request.URL.Path, " falls through to inbound/", route.inbound)
+		} else {
+			h.logger.InfoContext(ctx, "inbound request from ", request.RemoteAddr, " for ", request.Host, request.URL.Path, " to ", route.target)
+		}
+		if route.stripPath {
+			request.URL.Path = stripPath(mountPoint, request.URL.Path)
+			request.URL.RawPath = ""
+		}
+		route.handler.ServeHTTP(writer, request)
+		return
+	}
+	h.logger.DebugContext(ctx, "no route for ", request.Host, request.URL.Path, " from ", request.RemoteAddr)
+	http.NotFound(writer, request)
+}
+
+type route struct {
+	hosts     []string
+	paths     []string
+	stripPath bool
+	target    *url.URL
+	inbound   string
+	handler   http.Handler
+}
+
+func newRoute(ctx context.Context, logger logger.ContextLogger, options option.HTTPReverseRouteOptions) (*route, error) {
+	route := &route{
+		stripPath: options.StripPath,
+		inbound:   options.Inbound,
+	}
+	for _, host := range options.Host {
+		route.hosts = append(route.hosts, strings.ToLower(host))
+	}
+	for _, path := range options.Path {
+		if !strings.HasPrefix(path, "/") {
+			return nil, E.New("invalid path: ", path)
+		}
+		route.paths = append(route.paths, path)
+	}
+	if options.Inbound != "" {
+		if options.URL != "" {
+			return nil, E.New("`url` and `inbound` are mutually exclusive")
+		}
+		return route, nil
+	}
+	if options.URL == "" {
+		return nil, E.New("missing url or inbound")
+	}
+	targetURL, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, E.Cause(err, "parse url")
+	}
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		return nil, E.New("unsupported url scheme: ", targetURL.Scheme)
+	}
+	route.target = targetURL
+	routeDialer, err := dialer.NewWithOptions(dialer.Options{
+		Context:        ctx,
+		Options:        options.DialerOptions,
+		RemoteIsDomain: M.ParseSocksaddr(targetURL.Hostname()).IsDomain(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	rewriteHost := options.RewriteHost
+	route.handler = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(targetURL)
+			if !rewriteHost {
+				r.Out.Host = r.In.Host
+			}
+			r.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return routeDialer.DialContext(ctx, network, M.ParseSocksaddr(address))
+			},
+			ForceAttemptHTTP2: true,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.ErrorContext(r.Context(), E.Cause(err, "proxy request to ", targetURL))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return route, nil
+}
+
+func (r *route) match(host string, path string) (string, bool) {
+	if len(r.hosts) > 0 && !common.Any(r.hosts, func(pattern string) bool {
+		return matchHost(pattern, host)
+	}) {
+		return "", false
+	}
+	if len(r.paths) == 0 {
+		return "/", true
+	}
+	for _, mountPoint := range r.paths {
+		if matchPath(mountPoint, path) {
+			return mountPoint, true
+		}
+	}
+	return "", false
+}
+
+// matchHost reports whether host equals pattern, or is a subdomain of it if pattern starts with `*.`.
+func matchHost(pattern string, host string) bool {
+	if suffix, isWildcard := strings.CutPrefix(pattern, "*"); isWildcard {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// matchPath reports whether path is mountPoint itself or below it.
+func matchPath(mountPoint string, path string) bool {
+	mountPoint = strings.TrimSuffix(mountPoint, "/")
+	return mountPoint == "" || path == mountPoint || strings.HasPrefix(path, mountPoint+"/")
+}
+
+func stripPath(mountPoint string, path string) string {
+	path = path[len(strings.TrimSuffix(mountPoint, "/")):]
+	if path == "" {
+		return "/"
+	}
+	return path
+}
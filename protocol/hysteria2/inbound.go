@@ -40,6 +40,7 @@ type Inbound struct {
 	tlsConfig    tls.ServerConfig
 	service      *hysteria2.Service[int]
 	userNameList []string
+	listenPorts  []uint16
 }
 
 func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.Hysteria2InboundOptions) (adapter.Inbound, error) {
@@ -51,6 +52,19 @@ func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLo
 	if err != nil {
 		return nil, err
 	}
+	var listenPorts []uint16
+	if len(options.ListenPorts) > 0 {
+		listenPorts, err = hysteria.ParsePorts(options.ListenPorts)
+		if err != nil {
+			return nil, err
+		}
+		if options.ListenPort != 0 && !common.Contains(listenPorts, options.ListenPort) {
+			listenPorts = append([]uint16{options.ListenPort}, listenPorts...)
+		}
+		if len(listenPorts) > listener.MaxListenPorts {
+			return nil, E.New("too many listen ports, at most ", listener.MaxListenPorts, " are supported")
+		}
+	}
 	var salamanderPassword string
 	if options.Obfs != nil {
 		if options.Obfs.Password == "" {
@@ -109,7 +123,8 @@ func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLo
 			Logger:  logger,
 			Listen:  options.ListenOptions,
 		}),
-		tlsConfig: tlsConfig,
+		tlsConfig:   tlsConfig,
+		listenPorts: listenPorts,
 	}
 	var udpTimeout time.Duration
 	if options.UDPTimeout != 0 {
@@ -242,7 +257,15 @@ func (h *Inbound) Start(stage adapter.StartStage) error {
 			return err
 		}
 	}
-	packetConn, err := h.listener.ListenUDP()
+	var (
+		packetConn net.PacketConn
+		err        error
+	)
+	if len(h.listenPorts) > 0 {
+		packetConn, err = h.listener.ListenUDPPorts(h.listenPorts)
+	} else {
+		packetConn, err = h.listener.ListenUDP()
+	}
 	if err != nil {
 		return err
 	}
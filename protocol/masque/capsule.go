@@ -0,0 +1,152 @@
+package masque
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/netip"
+
+	"github.com/sagernet/quic-go/http3"
+	"github.com/sagernet/quic-go/quicvarint"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+// RFC 9484 4.7: capsules exchanged on a CONNECT-IP request stream
+const (
+	capsuleTypeAddressAssign      http3.CapsuleType = 0x01
+	capsuleTypeAddressRequest     http3.CapsuleType = 0x02
+	capsuleTypeRouteAdvertisement http3.CapsuleType = 0x03
+
+	maxCapsuleLength = 64 * 1024
+)
+
+type assignedAddress struct {
+	requestID uint64
+	prefix    netip.Prefix
+}
+
+type ipAddressRange struct {
+	start      netip.Addr
+	end        netip.Addr
+	ipProtocol uint8
+}
+
+func writeCapsule(writer io.Writer, capsuleType http3.CapsuleType, value []byte) error {
+	var buffer bytes.Buffer
+	err := http3.WriteCapsule(&buffer, capsuleType, value)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(buffer.Bytes())
+	return err
+}
+
+func readCapsule(reader *bufio.Reader) (http3.CapsuleType, []byte, error) {
+	capsuleType, valueReader, err := http3.ParseCapsule(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	value, err := io.ReadAll(io.LimitReader(valueReader, maxCapsuleLength+1))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(value) > maxCapsuleLength {
+		return 0, nil, E.New("capsule too large")
+	}
+	return capsuleType, value, nil
+}
+
+// appendAddresses encodes the value of ADDRESS_ASSIGN and ADDRESS_REQUEST capsules.
+func appendAddresses(b []byte, addresses []assignedAddress) []byte {
+	for _, address := range addresses {
+		b = quicvarint.Append(b, address.requestID)
+		b = append(b, ipVersion(address.prefix.Addr()))
+		b = append(b, address.prefix.Addr().AsSlice()...)
+		b = append(b, uint8(address.prefix.Bits()))
+	}
+	return b
+}
+
+func parseAddresses(value []byte) ([]assignedAddress, error) {
+	var addresses []assignedAddress
+	for len(value) > 0 {
+		requestID, n, err := quicvarint.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		value = value[n:]
+		address, rest, err := parseAddress(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) < 1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		prefix, err := address.Prefix(int(rest[0]))
+		if err != nil || prefix.Bits() != int(rest[0]) {
+			return nil, E.New("invalid prefix length ", rest[0], " for ", address)
+		}
+		addresses = append(addresses, assignedAddress{requestID, prefix})
+		value = rest[1:]
+	}
+	return addresses, nil
+}
+
+func appendRouteAdvertisement(b []byte, ranges []ipAddressRange) []byte {
+	for _, addressRange := range ranges {
+		b = append(b, ipVersion(addressRange.start))
+		b = append(b, addressRange.start.AsSlice()...)
+		b = append(b, addressRange.end.AsSlice()...)
+		b = append(b, addressRange.ipProtocol)
+	}
+	return b
+}
+
+func parseAddress(value []byte) (netip.Addr, []byte, error) {
+	if len(value) < 1 {
+		return netip.Addr{}, nil, io.ErrUnexpectedEOF
+	}
+	var addressLength int
+	switch value[0] {
+	case 4:
+		addressLength = 4
+	case 6:
+		addressLength = 16
+	default:
+		return netip.Addr{}, nil, E.New("unknown IP version: ", value[0])
+	}
+	value = value[1:]
+	if len(value) < addressLength {
+		return netip.Addr{}, nil, io.ErrUnexpectedEOF
+	}
+	address, _ := netip.AddrFromSlice(value[:addressLength])
+	return address, value[addressLength:], nil
+}
+
+func ipVersion(address netip.Addr) uint8 {
+	if address.Is4() {
+		return 4
+	}
+	return 6
+}
+
+// packetSource returns the source address of an IPv4 or IPv6 packet.
+func packetSource(packet []byte) (netip.Addr, bool) {
+	if len(packet) < 1 {
+		return netip.Addr{}, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < 20 {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom4([4]byte(packet[12:16])), true
+	case 6:
+		if len(packet) < 40 {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom16([16]byte(packet[8:24])), true
+	default:
+		return netip.Addr{}, false
+	}
+}
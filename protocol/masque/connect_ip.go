@@ -0,0 +1,300 @@
+package masque
+
+import (
+	std_bufio "bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sagernet/quic-go"
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/route/rule"
+	"github.com/sagernet/sing-box/transport/wireguard"
+	"github.com/sagernet/sing-tun"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const DefaultIPMTU = 1280
+
+type ipStream interface {
+	httpStream
+	SendDatagram(b []byte) error
+	ReceiveDatagram(ctx context.Context) ([]byte, error)
+}
+
+// ipSession moves the IP packets of a CONNECT-IP request between
+// HTTP datagrams and a userspace network stack.
+type ipSession struct {
+	ctx            context.Context
+	cancel         context.CancelCauseFunc
+	stream         ipStream
+	device         wireguard.Device
+	mtu            uint32
+	allowedSources []netip.Prefix
+	closeOnce      sync.Once
+}
+
+func newIPSession(ctx context.Context, stream ipStream, device wireguard.Device, mtu uint32, allowedSources []netip.Prefix) *ipSession {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &ipSession{
+		ctx:            ctx,
+		cancel:         cancel,
+		stream:         stream,
+		device:         device,
+		mtu:            mtu,
+		allowedSources: allowedSources,
+	}
+}
+
+func (s *ipSession) Start() {
+	go s.loopOutgoing()
+	go s.loopIncoming()
+}
+
+func (s *ipSession) loopOutgoing() {
+	buffers := [][]byte{make([]byte, s.mtu)}
+	sizes := make([]int, 1)
+	for {
+		_, err := s.device.Read(buffers, sizes, 0)
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+		err = s.stream.SendDatagram(encodeDatagram(buffers[0][:sizes[0]]))
+		if err != nil && !errors.Is(err, &quic.DatagramTooLargeError{}) {
+			s.closeWithError(err)
+			return
+		}
+	}
+}
+
+func (s *ipSession) loopIncoming() {
+	for {
+		datagram, err := s.stream.ReceiveDatagram(s.ctx)
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+		packet, loaded := decodeDatagram(datagram)
+		if !loaded {
+			continue
+		}
+		source, loaded := packetSource(packet)
+		if !loaded {
+			continue
+		}
+		if s.allowedSources != nil && !prefixesContains(s.allowedSources, source) {
+			// RFC 9484 4.7.1: drop packets from addresses that were not assigned to the peer
+			continue
+		}
+		s.device.Write([][]byte{packet}, 0)
+	}
+}
+
+func (s *ipSession) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.cancel(err)
+		closeStream(s.stream)
+		s.device.Close()
+	})
+}
+
+func (s *ipSession) Close() error {
+	s.closeWithError(net.ErrClosed)
+	return nil
+}
+
+func prefixesContains(prefixes []netip.Prefix, address netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+var _ tun.Handler = (*ipHandler)(nil)
+
+// ipHandler routes the connections a CONNECT-IP client opens through the server side stack.
+type ipHandler struct {
+	inbound  *Inbound
+	metadata adapter.InboundContext
+}
+
+func (h *ipHandler) PrepareConnection(network string, source M.Socksaddr, destination M.Socksaddr, routeContext tun.DirectRouteContext, timeout time.Duration) (tun.DirectRouteDestination, error) {
+	metadata := h.metadata
+	if !destination.IsIPv6() {
+		metadata.IPVersion = 4
+	} else {
+		metadata.IPVersion = 6
+	}
+	metadata.Network = network
+	metadata.Destination = destination
+	routeDestination, err := h.inbound.router.PreMatch(metadata, routeContext, timeout, false)
+	if err != nil {
+		switch {
+		case rule.IsBypassed(err):
+			err = nil
+		case rule.IsRejected(err):
+			h.inbound.logger.Trace("reject ", network, " connection from ", source.AddrString(), " to ", destination.AddrString())
+		default:
+			if network == N.NetworkICMP {
+				h.inbound.logger.Warn(E.Cause(err, "link ", network, " connection from ", source.AddrString(), " to ", destination.AddrString()))
+			}
+		}
+	}
+	return routeDestination, err
+}
+
+func (h *ipHandler) NewConnectionEx(ctx context.Context, conn net.Conn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	metadata := h.metadata
+	metadata.Destination = destination
+	if metadata.User != "" {
+		h.inbound.logger.InfoContext(ctx, "[", metadata.User, "] inbound connection to ", destination)
+	} else {
+		h.inbound.logger.InfoContext(ctx, "inbound connection to ", destination)
+	}
+	h.inbound.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (h *ipHandler) NewPacketConnectionEx(ctx context.Context, conn N.PacketConn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	metadata := h.metadata
+	metadata.Destination = destination
+	if metadata.User != "" {
+		h.inbound.logger.InfoContext(ctx, "[", metadata.User, "] inbound packet connection to ", destination)
+	} else {
+		h.inbound.logger.InfoContext(ctx, "inbound packet connection to ", destination)
+	}
+	h.inbound.router.RoutePacketConnectionEx(ctx, conn, metadata, onClose)
+}
+
+// ipDevice returns the client side stack of the CONNECT-IP session, opening the session on demand.
+func (h *Outbound) ipDevice() (wireguard.Device, error) {
+	h.ipAccess.Lock()
+	defer h.ipAccess.Unlock()
+	if h.ipSession != nil && h.ipSession.ctx.Err() == nil {
+		return h.ipSession.device, nil
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, C.TCPTimeout)
+	defer cancel()
+	stream, err := h.openStream(ctx, &http.Request{
+		Method: http.MethodConnect,
+		Proto:  protocolConnectIP,
+		Host:   h.serverAddr.String(),
+		URL: &url.URL{
+			Scheme: "https",
+			Host:   h.serverAddr.String(),
+			Opaque: expandIPTemplate(h.ipTemplate),
+		},
+		Header: h.capsuleHeaders(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	reader := std_bufio.NewReader(stream)
+	stream.SetReadDeadline(time.Now().Add(C.TCPTimeout))
+	var addresses []netip.Prefix
+	for len(addresses) == 0 {
+		capsuleType, value, err := readCapsule(reader)
+		if err != nil {
+			closeStream(stream)
+			return nil, E.Cause(err, "read CONNECT-IP address assignment")
+		}
+		if capsuleType != capsuleTypeAddressAssign {
+			// routes are not installed, the stack sends everything it is asked to
+			continue
+		}
+		assigned, err := parseAddresses(value)
+		if err != nil {
+			closeStream(stream)
+			return nil, E.Cause(err, "parse CONNECT-IP address assignment")
+		}
+		for _, address := range assigned {
+			addresses = append(addresses, address.prefix)
+		}
+	}
+	stream.SetReadDeadline(time.Time{})
+	device, err := wireguard.NewDevice(wireguard.DeviceOptions{
+		Context: h.ctx,
+		Logger:  h.logger,
+		MTU:     h.mtu,
+		Address: addresses,
+	})
+	if err != nil {
+		closeStream(stream)
+		return nil, err
+	}
+	err = device.Start()
+	if err != nil {
+		device.Close()
+		closeStream(stream)
+		return nil, err
+	}
+	session := newIPSession(h.ctx, stream, device, h.mtu, nil)
+	session.Start()
+	go func() {
+		// later assignments and route advertisements are not applied
+		for {
+			_, _, err := readCapsule(reader)
+			if err != nil {
+				session.closeWithError(err)
+				return
+			}
+		}
+	}()
+	h.ipSession = session
+	return device, nil
+}
+
+func (h *Outbound) dialIP(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	switch N.NetworkName(network) {
+	case N.NetworkTCP:
+		h.logger.InfoContext(ctx, "outbound connection to ", destination)
+	case N.NetworkUDP:
+		h.logger.InfoContext(ctx, "outbound packet connection to ", destination)
+	default:
+		return nil, E.Extend(N.ErrUnknownNetwork, network)
+	}
+	device, err := h.ipDevice()
+	if err != nil {
+		return nil, err
+	}
+	if destination.IsDomain() {
+		destinationAddresses, err := h.dnsRouter.Lookup(ctx, destination.Fqdn, adapter.DNSQueryOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return N.DialSerial(ctx, device, network, destination, destinationAddresses)
+	} else if !destination.Addr.IsValid() {
+		return nil, E.New("invalid destination: ", destination)
+	}
+	return device.DialContext(ctx, network, destination)
+}
+
+func (h *Outbound) listenPacketIP(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	device, err := h.ipDevice()
+	if err != nil {
+		return nil, err
+	}
+	if destination.IsDomain() {
+		destinationAddresses, err := h.dnsRouter.Lookup(ctx, destination.Fqdn, adapter.DNSQueryOptions{})
+		if err != nil {
+			return nil, err
+		}
+		packetConn, destinationAddress, err := N.ListenSerial(ctx, device, destination, destinationAddresses)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewNATPacketConn(bufio.NewPacketConn(packetConn), M.SocksaddrFrom(destinationAddress, destination.Port), destination), nil
+	}
+	return device.ListenPacket(ctx, destination)
+}
@@ -0,0 +1,382 @@
+package masque
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/sagernet/quic-go"
+	"github.com/sagernet/quic-go/http3"
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/inbound"
+	"github.com/sagernet/sing-box/common/listener"
+	"github.com/sagernet/sing-box/common/tls"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/wireguard"
+	qtls "github.com/sagernet/sing-quic"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/auth"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	sHttp "github.com/sagernet/sing/protocol/http"
+)
+
+func RegisterInbound(registry *inbound.Registry) {
+	inbound.Register[option.MASQUEInboundOptions](registry, C.TypeMASQUE, NewInbound)
+}
+
+type Inbound struct {
+	inbound.Adapter
+	router        adapter.Router
+	logger        logger.ContextLogger
+	listener      *listener.Listener
+	tlsConfig     tls.ServerConfig
+	quicConfig    *quic.Config
+	authenticator *auth.Authenticator
+	template      *templateMatcher
+	ipTemplate    *templateMatcher
+	ipAddress     []netip.Prefix
+	mtu           uint32
+	h3Server      *http3.Server
+}
+
+func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.MASQUEInboundOptions) (adapter.Inbound, error) {
+	if options.TLS == nil || !options.TLS.Enabled {
+		return nil, C.ErrTLSRequired
+	}
+	tlsConfig, err := tls.NewServer(ctx, logger, common.PtrValueOrDefault(options.TLS))
+	if err != nil {
+		return nil, err
+	}
+	template := options.Template
+	if template == "" {
+		template = DefaultTemplate
+	}
+	templateMatcher, err := newTemplateMatcher(template, templateHost, templatePort)
+	if err != nil {
+		return nil, E.Cause(err, "parse template")
+	}
+	ipTemplate := options.IPTemplate
+	if ipTemplate == "" {
+		ipTemplate = DefaultIPTemplate
+	}
+	ipTemplateMatcher, err := newTemplateMatcher(ipTemplate, templateTarget, templateIPProto)
+	if err != nil {
+		return nil, E.Cause(err, "parse ip_template")
+	}
+	ipAddress := options.IPAddress
+	if len(ipAddress) == 0 {
+		ipAddress = []netip.Prefix{
+			netip.MustParsePrefix("172.19.0.2/32"),
+			netip.MustParsePrefix("fdfe:dcba:9876::2/128"),
+		}
+	}
+	mtu := options.MTU
+	if mtu == 0 {
+		mtu = DefaultIPMTU
+	}
+	inbound := &Inbound{
+		Adapter: inbound.NewAdapter(C.TypeMASQUE, tag),
+		router:  router,
+		logger:  logger,
+		listener: listener.New(listener.Options{
+			Context: ctx,
+			Logger:  logger,
+			Listen:  options.ListenOptions,
+		}),
+		tlsConfig:     tlsConfig,
+		quicConfig:    newQUICConfig(options.QUICOptions),
+		authenticator: auth.NewAuthenticator(options.Users),
+		template:      templateMatcher,
+		ipTemplate:    ipTemplateMatcher,
+		ipAddress:     ipAddress,
+		mtu:           mtu,
+	}
+	inbound.h3Server = &http3.Server{
+		Handler:         inbound,
+		EnableDatagrams: true,
+		IdleTimeout:     inbound.quicConfig.MaxIdleTimeout,
+		ConnContext: func(ctx context.Context, conn *quic.Conn) context.Context {
+			return log.ContextWithNewID(ctx)
+		},
+	}
+	return inbound, nil
+}
+
+func (h *Inbound) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	err := h.tlsConfig.Start()
+	if err != nil {
+		return err
+	}
+	err = qtls.ConfigureHTTP3(h.tlsConfig)
+	if err != nil {
+		return err
+	}
+	udpConn, err := h.listener.ListenUDP()
+	if err != nil {
+		return err
+	}
+	quicListener, err := qtls.ListenEarly(udpConn, h.tlsConfig, h.quicConfig)
+	if err != nil {
+		udpConn.Close()
+		return err
+	}
+	go func() {
+		sErr := h.h3Server.ServeListener(quicListener)
+		udpConn.Close()
+		if sErr != nil && !E.IsClosedOrCanceled(sErr) && sErr != http.ErrServerClosed {
+			h.logger.Error("http3 server closed: ", sErr)
+		}
+	}()
+	return nil
+}
+
+func (h *Inbound) Close() error {
+	return common.Close(
+		h.listener,
+		h.h3Server,
+		h.tlsConfig,
+	)
+}
+
+func (h *Inbound) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	if request.Method != http.MethodConnect {
+		writer.WriteHeader(http.StatusNotFound)
+		h.badRequest(ctx, request, E.New("not CONNECT request"))
+		return
+	}
+	var userName string
+	if h.authenticator != nil {
+		var password string
+		var authOk bool
+		userName, password, authOk = sHttp.ParseBasicAuth(request.Header.Get("Proxy-Authorization"))
+		if authOk {
+			authOk = h.authenticator.Verify(userName, password)
+		}
+		if !authOk {
+			writer.WriteHeader(http.StatusProxyAuthRequired)
+			h.badRequest(ctx, request, E.New("authorization failed"))
+			return
+		}
+	}
+	localAddr, _ := ctx.Value(http.LocalAddrContextKey).(net.Addr)
+	var metadata adapter.InboundContext
+	metadata.Inbound = h.Tag()
+	metadata.InboundType = h.Type()
+	//nolint:staticcheck
+	metadata.InboundDetour = h.listener.ListenOptions().Detour
+	//nolint:staticcheck
+	metadata.Source = sHttp.SourceAddress(request)
+	metadata.User = userName
+	switch request.Proto {
+	case protocolConnectUDP:
+		destination, loaded := h.template.MatchUDP(request.URL.RequestURI())
+		if !loaded {
+			writer.WriteHeader(http.StatusBadRequest)
+			h.badRequest(ctx, request, E.New("invalid CONNECT-UDP target: ", request.URL.RequestURI()))
+			return
+		}
+		metadata.Destination = destination
+		writer.Header().Set("Capsule-Protocol", "?1")
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		stream := writer.(http3.HTTPStreamer).HTTPStream()
+		conn := newServerPacketConn(ctx, stream, destination, localAddr)
+		go func() {
+			// the request stream only carries capsules, its end terminates the session
+			io.Copy(io.Discard, stream)
+			conn.Close()
+		}()
+		h.newPacketConnection(ctx, conn, metadata)
+	case protocolConnectIP:
+		h.newIPConnection(ctx, writer, request, metadata)
+	case "HTTP/3.0":
+		destination := M.ParseSocksaddr(request.Host).Unwrap()
+		if !destination.IsValid() || destination.Port == 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			h.badRequest(ctx, request, E.New("invalid CONNECT target: ", request.Host))
+			return
+		}
+		metadata.Destination = destination
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		stream := writer.(http3.HTTPStreamer).HTTPStream()
+		h.newConnection(ctx, &streamConn{
+			httpStream: stream,
+			localAddr:  localAddr,
+			remoteAddr: metadata.Source,
+		}, metadata)
+	default:
+		writer.WriteHeader(http.StatusNotImplemented)
+		h.badRequest(ctx, request, E.New("unknown CONNECT protocol: ", request.Proto))
+	}
+}
+
+func (h *Inbound) newConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext) {
+	if metadata.User != "" {
+		h.logger.InfoContext(ctx, "[", metadata.User, "] inbound connection to ", metadata.Destination)
+	} else {
+		h.logger.InfoContext(ctx, "inbound connection to ", metadata.Destination)
+	}
+	done := make(chan struct{})
+	h.router.RouteConnectionEx(ctx, conn, metadata, N.OnceClose(func(it error) {
+		close(done)
+	}))
+	<-done
+}
+
+func (h *Inbound) newPacketConnection(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext) {
+	if metadata.User != "" {
+		h.logger.InfoContext(ctx, "[", metadata.User, "] inbound packet connection to ", metadata.Destination)
+	} else {
+		h.logger.InfoContext(ctx, "inbound packet connection to ", metadata.Destination)
+	}
+	done := make(chan struct{})
+	h.router.RoutePacketConnectionEx(ctx, conn, metadata, N.OnceClose(func(it error) {
+		close(done)
+	}))
+	<-done
+}
+
+func (h *Inbound) newIPConnection(ctx context.Context, writer http.ResponseWriter, request *http.Request, metadata adapter.InboundContext) {
+	values, loaded := h.ipTemplate.Match(request.URL.RequestURI())
+	if !loaded {
+		writer.WriteHeader(http.StatusBadRequest)
+		h.badRequest(ctx, request, E.New("invalid CONNECT-IP target: ", request.URL.RequestURI()))
+		return
+	}
+	if values[0] != "*" || values[1] != "*" {
+		// scoped requests would need the routes and the forwarded traffic to be filtered
+		writer.WriteHeader(http.StatusNotImplemented)
+		h.badRequest(ctx, request, E.New("scoped CONNECT-IP request is not supported: ", request.URL.RequestURI()))
+		return
+	}
+	device, err := wireguard.NewDevice(wireguard.DeviceOptions{
+		Context:    ctx,
+		Logger:     h.logger,
+		Handler:    &ipHandler{inbound: h, metadata: metadata},
+		UDPTimeout: C.UDPTimeout,
+		MTU:        h.mtu,
+	})
+	if err != nil {
+		writer.WriteHeader(http.StatusNotImplemented)
+		h.badRequest(ctx, request, E.Cause(err, "create CONNECT-IP stack"))
+		return
+	}
+	err = device.Start()
+	if err != nil {
+		device.Close()
+		writer.WriteHeader(http.StatusInternalServerError)
+		h.badRequest(ctx, request, E.Cause(err, "start CONNECT-IP stack"))
+		return
+	}
+	writer.Header().Set("Capsule-Protocol", "?1")
+	writer.WriteHeader(http.StatusOK)
+	writer.(http.Flusher).Flush()
+	stream := writer.(http3.HTTPStreamer).HTTPStream()
+	session := newIPSession(ctx, stream, device, h.mtu, h.ipAddress)
+	if metadata.User != "" {
+		h.logger.InfoContext(ctx, "[", metadata.User, "] inbound CONNECT-IP session from ", metadata.Source)
+	} else {
+		h.logger.InfoContext(ctx, "inbound CONNECT-IP session from ", metadata.Source)
+	}
+	err = h.advertiseIP(stream)
+	if err != nil {
+		session.Close()
+		h.logger.ErrorContext(ctx, E.Cause(err, "write CONNECT-IP capsules"))
+		return
+	}
+	session.Start()
+	reader := bufio.NewReader(stream)
+	for {
+		var (
+			capsuleType http3.CapsuleType
+			value       []byte
+		)
+		capsuleType, value, err = readCapsule(reader)
+		if err != nil {
+			break
+		}
+		if capsuleType != capsuleTypeAddressRequest {
+			// RFC 9297 3.2: unknown capsule types are skipped
+			continue
+		}
+		var requests []assignedAddress
+		requests, err = parseAddresses(value)
+		if err != nil {
+			break
+		}
+		err = writeCapsule(stream, capsuleTypeAddressAssign, appendAddresses(nil, h.assignAddresses(requests)))
+		if err != nil {
+			break
+		}
+	}
+	session.closeWithError(err)
+	if !E.IsClosedOrCanceled(err) && !errors.Is(err, io.EOF) {
+		h.logger.ErrorContext(ctx, E.Cause(err, "CONNECT-IP session"))
+	}
+}
+
+// advertiseIP assigns the configured addresses and advertises routes to everything
+// in the assigned address families, since the session is a full tunnel.
+func (h *Inbound) advertiseIP(stream io.Writer) error {
+	addresses := make([]assignedAddress, 0, len(h.ipAddress))
+	var ranges []ipAddressRange
+	var hasIPv4, hasIPv6 bool
+	for _, prefix := range h.ipAddress {
+		addresses = append(addresses, assignedAddress{prefix: prefix})
+		if prefix.Addr().Is4() {
+			hasIPv4 = true
+		} else {
+			hasIPv6 = true
+		}
+	}
+	if hasIPv4 {
+		ranges = append(ranges, ipAddressRange{
+			start: netip.IPv4Unspecified(),
+			end:   netip.MustParseAddr("255.255.255.255"),
+		})
+	}
+	if hasIPv6 {
+		ranges = append(ranges, ipAddressRange{
+			start: netip.IPv6Unspecified(),
+			end:   netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"),
+		})
+	}
+	err := writeCapsule(stream, capsuleTypeAddressAssign, appendAddresses(nil, addresses))
+	if err != nil {
+		return err
+	}
+	return writeCapsule(stream, capsuleTypeRouteAdvertisement, appendRouteAdvertisement(nil, ranges))
+}
+
+// assignAddresses answers ADDRESS_REQUEST with the configured address of the requested family.
+// Requests for a family without a configured address are left unanswered.
+func (h *Inbound) assignAddresses(requests []assignedAddress) []assignedAddress {
+	var addresses []assignedAddress
+	for _, addressRequest := range requests {
+		for _, prefix := range h.ipAddress {
+			if prefix.Addr().Is4() == addressRequest.prefix.Addr().Is4() {
+				addresses = append(addresses, assignedAddress{addressRequest.requestID, prefix})
+				break
+			}
+		}
+	}
+	return addresses
+}
+
+func (h *Inbound) badRequest(ctx context.Context, request *http.Request, err error) {
+	h.logger.ErrorContext(ctx, E.Cause(err, "process connection from ", request.RemoteAddr))
+}
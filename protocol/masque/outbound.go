@@ -0,0 +1,321 @@
+package masque
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sagernet/quic-go"
+	"github.com/sagernet/quic-go/http3"
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/outbound"
+	"github.com/sagernet/sing-box/common/dialer"
+	"github.com/sagernet/sing-box/common/tls"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	qtls "github.com/sagernet/sing-quic"
+	"github.com/sagernet/sing-tun"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/service"
+)
+
+func RegisterOutbound(registry *outbound.Registry) {
+	outbound.Register[option.MASQUEOutboundOptions](registry, C.TypeMASQUE, NewOutbound)
+}
+
+var _ adapter.InterfaceUpdateListener = (*Outbound)(nil)
+
+type Outbound struct {
+	outbound.Adapter
+	ctx         context.Context
+	logger      logger.ContextLogger
+	dialer      N.Dialer
+	serverAddr  M.Socksaddr
+	tlsConfig   tls.Config
+	quicConfig  *quic.Config
+	h3Transport *http3.Transport
+	template    string
+	headers     http.Header
+	connAccess  sync.Mutex
+	quicConn    *quic.Conn
+	clientConn  *http3.ClientConn
+	connectIP   bool
+	ipTemplate  string
+	mtu         uint32
+	dnsRouter   adapter.DNSRouter
+	ipAccess    sync.Mutex
+	ipSession   *ipSession
+}
+
+func NewOutbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.MASQUEOutboundOptions) (adapter.Outbound, error) {
+	if options.TLS == nil || !options.TLS.Enabled {
+		return nil, C.ErrTLSRequired
+	}
+	tlsConfig, err := tls.NewClient(ctx, logger, options.Server, common.PtrValueOrDefault(options.TLS))
+	if err != nil {
+		return nil, err
+	}
+	if len(tlsConfig.NextProtos()) == 0 {
+		tlsConfig.SetNextProtos([]string{http3.NextProtoH3})
+	}
+	template := options.Template
+	if template == "" {
+		template = DefaultTemplate
+	}
+	err = validateTemplate(template, templateHost, templatePort)
+	if err != nil {
+		return nil, E.Cause(err, "parse template")
+	}
+	var connectIP bool
+	switch options.Mode {
+	case "", protocolConnectUDP:
+	case protocolConnectIP:
+		if !tun.WithGVisor {
+			return nil, E.New("CONNECT-IP mode requires gVisor, rebuild with -tags with_gvisor")
+		}
+		connectIP = true
+	default:
+		return nil, E.New("unknown mode: ", options.Mode)
+	}
+	ipTemplate := options.IPTemplate
+	if ipTemplate == "" {
+		ipTemplate = DefaultIPTemplate
+	}
+	err = validateTemplate(ipTemplate, templateTarget, templateIPProto)
+	if err != nil {
+		return nil, E.Cause(err, "parse ip_template")
+	}
+	mtu := options.MTU
+	if mtu == 0 {
+		mtu = DefaultIPMTU
+	}
+	outboundDialer, err := dialer.New(ctx, options.DialerOptions, options.ServerIsDomain())
+	if err != nil {
+		return nil, err
+	}
+	headers := options.Headers.Build()
+	if options.Username != "" {
+		headers.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(options.Username+":"+options.Password)))
+	}
+	quicConfig := newQUICConfig(options.QUICOptions)
+	return &Outbound{
+		Adapter:    outbound.NewAdapterWithDialerOptions(C.TypeMASQUE, tag, options.Network.Build(), options.DialerOptions),
+		ctx:        ctx,
+		logger:     logger,
+		dialer:     outboundDialer,
+		serverAddr: options.ServerOptions.Build(),
+		tlsConfig:  tlsConfig,
+		quicConfig: quicConfig,
+		h3Transport: &http3.Transport{
+			EnableDatagrams: true,
+			QUICConfig:      quicConfig,
+		},
+		template:   template,
+		headers:    headers,
+		connectIP:  connectIP,
+		ipTemplate: ipTemplate,
+		mtu:        mtu,
+		dnsRouter:  service.FromContext[adapter.DNSRouter](ctx),
+	}, nil
+}
+
+func newQUICConfig(options option.QUICOptions) *quic.Config {
+	quicConfig := &quic.Config{
+		InitialStreamReceiveWindow:     options.StreamReceiveWindow.Value(),
+		MaxStreamReceiveWindow:         options.StreamReceiveWindow.Value(),
+		InitialConnectionReceiveWindow: options.ConnectionReceiveWindow.Value(),
+		MaxConnectionReceiveWindow:     options.ConnectionReceiveWindow.Value(),
+		KeepAlivePeriod:                time.Duration(options.KeepAlivePeriod),
+		MaxIdleTimeout:                 time.Duration(options.IdleTimeout),
+		DisablePathMTUDiscovery:        options.DisablePathMTUDiscovery,
+		EnableDatagrams:                true,
+		Allow0RTT:                      true,
+	}
+	if options.InitialPacketSize > 0 {
+		quicConfig.InitialPacketSize = uint16(options.InitialPacketSize)
+	} else {
+		// leave room for a 1280 bytes CONNECT-IP packet in a datagram before path MTU discovery
+		quicConfig.InitialPacketSize = 1350
+	}
+	if options.MaxConcurrentStreams > 0 {
+		quicConfig.MaxIncomingStreams = int64(options.MaxConcurrentStreams)
+	} else {
+		quicConfig.MaxIncomingStreams = 1 << 60
+	}
+	return quicConfig
+}
+
+func (h *Outbound) connect(ctx context.Context) (*http3.ClientConn, error) {
+	h.connAccess.Lock()
+	defer h.connAccess.Unlock()
+	if h.quicConn != nil && h.quicConn.Context().Err() == nil {
+		return h.clientConn, nil
+	}
+	conn, err := h.dialer.DialContext(ctx, N.NetworkUDP, h.serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	quicConn, err := qtls.DialEarly(ctx, bufio.NewUnbindPacketConn(conn), conn.RemoteAddr(), h.tlsConfig, h.quicConfig)
+	if err != nil {
+		conn.Close()
+		return nil, E.Cause(err, "connect to masque server")
+	}
+	clientConn := h.h3Transport.NewClientConn(quicConn)
+	go func() {
+		<-quicConn.Context().Done()
+		conn.Close()
+	}()
+	h.quicConn = quicConn
+	h.clientConn = clientConn
+	return clientConn, nil
+}
+
+func (h *Outbound) openStream(ctx context.Context, request *http.Request) (*http3.RequestStream, error) {
+	clientConn, err := h.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-clientConn.ReceivedSettings():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	settings := clientConn.Settings()
+	if request.Proto != "" {
+		if !settings.EnableExtendedConnect {
+			return nil, E.New("masque server didn't enable extended CONNECT")
+		}
+		if !settings.EnableDatagrams {
+			return nil, E.New("masque server didn't enable HTTP datagrams")
+		}
+	}
+	stream, err := clientConn.OpenRequestStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = stream.SendRequestHeader(request)
+	if err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	response, err := stream.ReadResponse()
+	if err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, E.New("unexpected response status: ", response.Status)
+	}
+	return stream, nil
+}
+
+func (h *Outbound) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	ctx, metadata := adapter.ExtendContext(ctx)
+	metadata.Outbound = h.Tag()
+	metadata.Destination = destination
+	if h.connectIP {
+		return h.dialIP(ctx, network, destination)
+	}
+	switch N.NetworkName(network) {
+	case N.NetworkTCP:
+		h.logger.InfoContext(ctx, "outbound connection to ", destination)
+		stream, err := h.openStream(ctx, &http.Request{
+			Method: http.MethodConnect,
+			Host:   destination.String(),
+			URL:    &url.URL{Host: destination.String()},
+			Header: h.headers.Clone(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &streamConn{
+			httpStream: stream,
+			localAddr:  M.Socksaddr{},
+			remoteAddr: destination,
+		}, nil
+	case N.NetworkUDP:
+		h.logger.InfoContext(ctx, "outbound packet connection to ", destination)
+		packetConn, err := h.listenPacket(ctx, destination)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewBindPacketConn(packetConn, destination), nil
+	default:
+		return nil, E.Extend(N.ErrUnknownNetwork, network)
+	}
+}
+
+func (h *Outbound) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	ctx, metadata := adapter.ExtendContext(ctx)
+	metadata.Outbound = h.Tag()
+	metadata.Destination = destination
+	h.logger.InfoContext(ctx, "outbound packet connection to ", destination)
+	if h.connectIP {
+		return h.listenPacketIP(ctx, destination)
+	}
+	return h.listenPacket(ctx, destination)
+}
+
+func (h *Outbound) listenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	conn := newClientPacketConn(h.ctx, M.Socksaddr{}, func(destination M.Socksaddr) (datagramStream, error) {
+		return h.openStream(h.ctx, &http.Request{
+			Method: http.MethodConnect,
+			Proto:  protocolConnectUDP,
+			Host:   h.serverAddr.String(),
+			URL: &url.URL{
+				Scheme: "https",
+				Host:   h.serverAddr.String(),
+				Opaque: expandTemplate(h.template, destination),
+			},
+			Header: h.capsuleHeaders(),
+		})
+	})
+	// open the first session eagerly to surface connection errors to the router
+	_, err := conn.session(destination)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (h *Outbound) capsuleHeaders() http.Header {
+	headers := h.headers.Clone()
+	headers.Set("Capsule-Protocol", "?1")
+	return headers
+}
+
+func (h *Outbound) InterfaceUpdated() {
+	h.ipAccess.Lock()
+	if h.ipSession != nil {
+		h.ipSession.Close()
+		h.ipSession = nil
+	}
+	h.ipAccess.Unlock()
+	h.connAccess.Lock()
+	defer h.connAccess.Unlock()
+	if h.quicConn != nil {
+		h.quicConn.CloseWithError(0, "")
+		h.quicConn = nil
+		h.clientConn = nil
+	}
+}
+
+func (h *Outbound) Close() error {
+	h.InterfaceUpdated()
+	return common.Close(h.tlsConfig)
+}
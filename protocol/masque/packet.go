@@ -0,0 +1,214 @@
+package masque
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sagernet/quic-go"
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/pipe"
+)
+
+var _ N.NetPacketConn = (*packetConn)(nil)
+
+type datagramStream interface {
+	io.Closer
+	CancelRead(quic.StreamErrorCode)
+	SendDatagram(b []byte) error
+	ReceiveDatagram(ctx context.Context) ([]byte, error)
+}
+
+type packetConn struct {
+	ctx          context.Context
+	cancel       context.CancelCauseFunc
+	localAddr    net.Addr
+	openSession  func(destination M.Socksaddr) (datagramStream, error)
+	access       sync.Mutex
+	sessions     map[M.Socksaddr]datagramStream
+	fixedSession datagramStream
+	data         chan packet
+	readDeadline pipe.Deadline
+}
+
+type packet struct {
+	destination M.Socksaddr
+	payload     []byte
+}
+
+// newServerPacketConn serves a single CONNECT-UDP request, where every
+// datagram belongs to the target named in the request.
+func newServerPacketConn(ctx context.Context, stream datagramStream, destination M.Socksaddr, localAddr net.Addr) *packetConn {
+	conn := newPacketConn(ctx, localAddr)
+	conn.fixedSession = stream
+	go conn.loopSession(stream, destination)
+	return conn
+}
+
+// newClientPacketConn opens one CONNECT-UDP request per destination on demand.
+func newClientPacketConn(ctx context.Context, localAddr net.Addr, openSession func(destination M.Socksaddr) (datagramStream, error)) *packetConn {
+	conn := newPacketConn(ctx, localAddr)
+	conn.openSession = openSession
+	conn.sessions = make(map[M.Socksaddr]datagramStream)
+	return conn
+}
+
+func newPacketConn(ctx context.Context, localAddr net.Addr) *packetConn {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &packetConn{
+		ctx:          ctx,
+		cancel:       cancel,
+		localAddr:    localAddr,
+		data:         make(chan packet, 64),
+		readDeadline: pipe.MakeDeadline(),
+	}
+}
+
+func (c *packetConn) loopSession(stream datagramStream, destination M.Socksaddr) {
+	for {
+		datagram, err := stream.ReceiveDatagram(c.ctx)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+		payload, loaded := decodeDatagram(datagram)
+		if !loaded {
+			continue
+		}
+		select {
+		case c.data <- packet{destination: destination, payload: payload}:
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+func (c *packetConn) session(destination M.Socksaddr) (datagramStream, error) {
+	if c.fixedSession != nil {
+		return c.fixedSession, nil
+	}
+	c.access.Lock()
+	defer c.access.Unlock()
+	if c.ctx.Err() != nil {
+		return nil, context.Cause(c.ctx)
+	}
+	stream, loaded := c.sessions[destination]
+	if loaded {
+		return stream, nil
+	}
+	stream, err := c.openSession(destination)
+	if err != nil {
+		return nil, err
+	}
+	c.sessions[destination] = stream
+	go c.loopSession(stream, destination)
+	return stream, nil
+}
+
+func (c *packetConn) ReadPacket(buffer *buf.Buffer) (destination M.Socksaddr, err error) {
+	select {
+	case p := <-c.data:
+		_, err = buffer.Write(p.payload)
+		return p.destination, err
+	case <-c.ctx.Done():
+		return M.Socksaddr{}, net.ErrClosed
+	case <-c.readDeadline.Wait():
+		return M.Socksaddr{}, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *packetConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	select {
+	case pkt := <-c.data:
+		n = copy(p, pkt.payload)
+		if pkt.destination.IsFqdn() {
+			addr = pkt.destination
+		} else {
+			addr = pkt.destination.UDPAddr()
+		}
+		return
+	case <-c.ctx.Done():
+		return 0, nil, net.ErrClosed
+	case <-c.readDeadline.Wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *packetConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	defer buffer.Release()
+	stream, err := c.session(destination)
+	if err != nil {
+		return err
+	}
+	return sendDatagram(stream, buffer.Bytes())
+}
+
+func (c *packetConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	stream, err := c.session(M.SocksaddrFromNet(addr))
+	if err != nil {
+		return
+	}
+	err = sendDatagram(stream, p)
+	if err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+func sendDatagram(stream datagramStream, payload []byte) error {
+	err := stream.SendDatagram(encodeDatagram(payload))
+	if errors.Is(err, &quic.DatagramTooLargeError{}) {
+		// RFC 9298 5: proxies drop UDP payloads that do not fit
+		return nil
+	}
+	return err
+}
+
+func (c *packetConn) closeWithError(err error) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.cancel(err)
+	if c.fixedSession != nil {
+		closeStream(c.fixedSession)
+	}
+	for _, stream := range c.sessions {
+		closeStream(stream)
+	}
+}
+
+func closeStream(stream datagramStream) {
+	stream.CancelRead(0)
+	stream.Close()
+}
+
+func (c *packetConn) Close() error {
+	c.closeWithError(net.ErrClosed)
+	return nil
+}
+
+func (c *packetConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *packetConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *packetConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+func (c *packetConn) SetWriteDeadline(t time.Time) error {
+	return os.ErrInvalid
+}
@@ -0,0 +1,178 @@
+package masque
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sagernet/quic-go"
+	"github.com/sagernet/quic-go/quicvarint"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+const (
+	DefaultTemplate   = "/.well-known/masque/udp/{target_host}/{target_port}/"
+	DefaultIPTemplate = "/.well-known/masque/ip/{target}/{ipproto}/"
+
+	protocolConnectUDP = "connect-udp"
+	protocolConnectIP  = "connect-ip"
+
+	templateHost    = "{target_host}"
+	templatePort    = "{target_port}"
+	templateTarget  = "{target}"
+	templateIPProto = "{ipproto}"
+
+	// RFC 9298 4: UDP proxying payloads use context ID zero
+	contextIDZero = 0
+)
+
+func validateTemplate(template string, variables ...string) error {
+	if !strings.HasPrefix(template, "/") {
+		return E.New("template must be an absolute path")
+	}
+	for _, variable := range variables {
+		if strings.Count(template, variable) != 1 {
+			return E.New("template must contain ", strings.Join(variables, " and "), " exactly once")
+		}
+	}
+	return nil
+}
+
+func expandTemplate(template string, destination M.Socksaddr) string {
+	// RFC 9298 2: colons in IPv6 addresses must be percent-encoded
+	host := strings.ReplaceAll(url.PathEscape(destination.AddrString()), ":", "%3A")
+	return strings.NewReplacer(templateHost, host, templatePort, strconv.Itoa(int(destination.Port))).Replace(template)
+}
+
+// expandIPTemplate requests a full tunnel: any target and any IP protocol.
+func expandIPTemplate(template string) string {
+	return strings.NewReplacer(templateTarget, "*", templateIPProto, "*").Replace(template)
+}
+
+type templateMatcher struct {
+	regexp  *regexp.Regexp
+	indexes []int
+}
+
+func newTemplateMatcher(template string, variables ...string) (*templateMatcher, error) {
+	err := validateTemplate(template, variables...)
+	if err != nil {
+		return nil, err
+	}
+	matcher := &templateMatcher{
+		indexes: make([]int, len(variables)),
+	}
+	var expression strings.Builder
+	expression.WriteString("^")
+	for group := 1; ; group++ {
+		variableIndex := -1
+		variableAt := len(template)
+		for i, variable := range variables {
+			at := strings.Index(template, variable)
+			if at >= 0 && at < variableAt {
+				variableIndex, variableAt = i, at
+			}
+		}
+		if variableIndex < 0 {
+			expression.WriteString(regexp.QuoteMeta(template))
+			break
+		}
+		expression.WriteString(regexp.QuoteMeta(template[:variableAt]))
+		expression.WriteString("([^/?&#]+)")
+		matcher.indexes[variableIndex] = group
+		template = template[variableAt+len(variables[variableIndex]):]
+	}
+	expression.WriteString("$")
+	matcher.regexp, err = regexp.Compile(expression.String())
+	if err != nil {
+		return nil, err
+	}
+	return matcher, nil
+}
+
+// Match returns the unescaped values of the template variables, in the order they were passed to newTemplateMatcher.
+func (m *templateMatcher) Match(requestURI string) ([]string, bool) {
+	match := m.regexp.FindStringSubmatch(requestURI)
+	if match == nil {
+		return nil, false
+	}
+	values := make([]string, len(m.indexes))
+	for i, index := range m.indexes {
+		value, err := url.PathUnescape(match[index])
+		if err != nil {
+			return nil, false
+		}
+		values[i] = value
+	}
+	return values, true
+}
+
+func (m *templateMatcher) MatchUDP(requestURI string) (M.Socksaddr, bool) {
+	values, loaded := m.Match(requestURI)
+	if !loaded {
+		return M.Socksaddr{}, false
+	}
+	port, err := strconv.ParseUint(values[1], 10, 16)
+	if err != nil || port == 0 {
+		return M.Socksaddr{}, false
+	}
+	destination := M.ParseSocksaddrHostPort(values[0], uint16(port))
+	if !destination.IsValid() {
+		return M.Socksaddr{}, false
+	}
+	return destination, true
+}
+
+func encodeDatagram(payload []byte) []byte {
+	datagram := make([]byte, 0, quicvarint.Len(contextIDZero)+len(payload))
+	datagram = quicvarint.Append(datagram, contextIDZero)
+	return append(datagram, payload...)
+}
+
+func decodeDatagram(datagram []byte) ([]byte, bool) {
+	contextID, n, err := quicvarint.Parse(datagram)
+	if err != nil || contextID != contextIDZero {
+		return nil, false
+	}
+	return datagram[n:], true
+}
+
+type httpStream interface {
+	io.ReadWriteCloser
+	CancelRead(quic.StreamErrorCode)
+	SetDeadline(time.Time) error
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}
+
+type streamConn struct {
+	httpStream
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *streamConn) CloseWrite() error {
+	return c.httpStream.Close()
+}
+
+func (c *streamConn) Close() error {
+	c.httpStream.CancelRead(0)
+	return c.httpStream.Close()
+}
+
+func (c *streamConn) Upstream() any {
+	return c.httpStream
+}
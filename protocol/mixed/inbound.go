@@ -11,6 +11,7 @@ import (
 	"github.com/sagernet/sing-box/common/listener"
 	"github.com/sagernet/sing-box/common/tls"
 	"github.com/sagernet/sing-box/common/uot"
+	"github.com/sagernet/sing-box/common/userauth"
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/log"
 	"github.com/sagernet/sing-box/option"
@@ -36,6 +37,7 @@ type Inbound struct {
 	logger        log.ContextLogger
 	listener      *listener.Listener
 	authenticator *auth.Authenticator
+	userBackend   userauth.Authenticator
 	tlsConfig     tls.ServerConfig
 	udpTimeout    time.Duration
 }
@@ -66,6 +68,13 @@ func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLo
 		}
 		inbound.tlsConfig = tlsConfig
 	}
+	if options.UserBackend != nil {
+		userBackend, err := userauth.New(ctx, logger, tag, options.Users, *options.UserBackend)
+		if err != nil {
+			return nil, E.Cause(err, "create user backend")
+		}
+		inbound.userBackend = userBackend
+	}
 	inbound.listener = listener.New(listener.Options{
 		Context:           ctx,
 		Logger:            logger,
@@ -88,6 +97,12 @@ func (h *Inbound) Start(stage adapter.StartStage) error {
 			return E.Cause(err, "create TLS config")
 		}
 	}
+	if h.userBackend != nil {
+		err := h.userBackend.Start()
+		if err != nil {
+			return E.Cause(err, "start user backend")
+		}
+	}
 	return h.listener.Start()
 }
 
@@ -95,6 +110,7 @@ func (h *Inbound) Close() error {
 	return common.Close(
 		h.listener,
 		h.tlsConfig,
+		h.userBackend,
 	)
 }
 
@@ -125,8 +141,14 @@ func (h *Inbound) newConnection(ctx context.Context, conn net.Conn, metadata ada
 	}
 	switch headerBytes[0] {
 	case socks4.Version, socks5.Version:
+		if h.userBackend != nil {
+			return userauth.HandleSOCKSConnection(ctx, conn, reader, h.userBackend, adapter.NewUpstreamHandler(metadata, h.newUserConnection, h.streamUserPacketConnection), h.listener, h.udpTimeout, metadata.Source, onClose)
+		}
 		return socks.HandleConnectionEx(ctx, conn, reader, h.authenticator, adapter.NewUpstreamHandler(metadata, h.newUserConnection, h.streamUserPacketConnection), h.listener, h.udpTimeout, metadata.Source, onClose)
 	default:
+		if h.userBackend != nil {
+			return userauth.HandleHTTPConnection(ctx, conn, reader, h.userBackend, adapter.NewUpstreamHandler(metadata, h.newUserConnection, h.streamUserPacketConnection), metadata.Source, onClose)
+		}
 		return http.HandleConnectionEx(ctx, conn, reader, h.authenticator, adapter.NewUpstreamHandler(metadata, h.newUserConnection, h.streamUserPacketConnection), metadata.Source, onClose)
 	}
 }
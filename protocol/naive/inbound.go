@@ -12,6 +12,7 @@ import (
 	"github.com/sagernet/sing-box/common/listener"
 	"github.com/sagernet/sing-box/common/tls"
 	"github.com/sagernet/sing-box/common/uot"
+	"github.com/sagernet/sing-box/common/userauth"
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/log"
 	"github.com/sagernet/sing-box/option"
@@ -48,6 +49,7 @@ type Inbound struct {
 	network          []string
 	networkIsDefault bool
 	authenticator    *auth.Authenticator
+	userBackend      userauth.Authenticator
 	tlsConfig        tls.ServerConfig
 	httpServer       *http.Server
 	h3Server         io.Closer
@@ -73,7 +75,13 @@ func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLo
 			return nil, E.New("TLS is required for QUIC server")
 		}
 	}
-	if len(options.Users) == 0 {
+	if options.UserBackend != nil {
+		userBackend, err := userauth.New(ctx, logger, tag, options.Users, *options.UserBackend)
+		if err != nil {
+			return nil, E.Cause(err, "create user backend")
+		}
+		inbound.userBackend = userBackend
+	} else if len(options.Users) == 0 {
 		return nil, E.New("missing users")
 	}
 	if options.TLS != nil {
@@ -96,6 +104,12 @@ func (n *Inbound) Start(stage adapter.StartStage) error {
 			return E.Cause(err, "create TLS config")
 		}
 	}
+	if n.userBackend != nil {
+		err := n.userBackend.Start()
+		if err != nil {
+			return E.Cause(err, "start user backend")
+		}
+	}
 	if common.Contains(n.network, N.NetworkTCP) {
 		tcpListener, err := n.listener.ListenTCP()
 		if err != nil {
@@ -144,6 +158,7 @@ func (n *Inbound) Close() error {
 		common.PtrOrNil(n.httpServer),
 		n.h3Server,
 		n.tlsConfig,
+		n.userBackend,
 	)
 }
 
@@ -160,7 +175,17 @@ func (n *Inbound) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	}
 	userName, password, authOk := sHttp.ParseBasicAuth(request.Header.Get("Proxy-Authorization"))
 	if authOk {
-		authOk = n.authenticator.Verify(userName, password)
+		if n.userBackend != nil {
+			var err error
+			authOk, err = n.userBackend.Verify(ctx, userName, password)
+			if err != nil {
+				rejectHTTP(writer, http.StatusProxyAuthRequired)
+				n.badRequest(ctx, request, E.Cause(err, "verify user ", userName))
+				return
+			}
+		} else {
+			authOk = n.authenticator.Verify(userName, password)
+		}
 	}
 	if !authOk {
 		rejectHTTP(writer, http.StatusProxyAuthRequired)
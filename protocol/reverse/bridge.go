@@ -0,0 +1,168 @@
+package reverse
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/endpoint"
+	"github.com/sagernet/sing-box/common/dialer"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-mux"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+var _ mux.ServiceHandlerEx = (*Bridge)(nil)
+
+// Bridge dials the portal and serves the streams it opens to the local network.
+type Bridge struct {
+	endpoint.Adapter
+	ctx      context.Context
+	cancel   context.CancelFunc
+	router   adapter.ConnectionRouterEx
+	logger   logger.ContextLogger
+	dialer   N.Dialer
+	domain   string
+	name     string
+	password string
+	service  *mux.Service
+}
+
+func NewBridge(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.ReverseEndpointOptions) (*Bridge, error) {
+	if options.Detour == "" {
+		return nil, E.New("missing detour")
+	}
+	if options.Password == "" {
+		return nil, E.New("missing password")
+	}
+	if len(options.Users) > 0 {
+		return nil, E.New("`users` is not supported in bridge mode")
+	}
+	outboundDialer, err := dialer.New(ctx, options.DialerOptions, true)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	bridge := &Bridge{
+		Adapter:  endpoint.NewAdapterWithDialerOptions(C.TypeReverse, tag, []string{N.NetworkTCP, N.NetworkUDP}, options.DialerOptions),
+		ctx:      ctx,
+		cancel:   cancel,
+		router:   router,
+		logger:   logger,
+		dialer:   outboundDialer,
+		domain:   options.Domain,
+		name:     options.Name,
+		password: options.Password,
+	}
+	if bridge.name == "" {
+		bridge.name = tag
+	}
+	service, err := mux.NewService(mux.ServiceOptions{
+		NewStreamContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return log.ContextWithNewID(ctx)
+		},
+		Logger:    logger,
+		HandlerEx: bridge,
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	bridge.service = service
+	return bridge, nil
+}
+
+func (h *Bridge) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStatePostStart {
+		return nil
+	}
+	go h.loopConnect()
+	return nil
+}
+
+func (h *Bridge) Close() error {
+	h.cancel()
+	return nil
+}
+
+func (h *Bridge) loopConnect() {
+	delay := minReconnectDelay
+	for {
+		startedAt := time.Now()
+		err := h.connect()
+		if h.ctx.Err() != nil {
+			return
+		}
+		if time.Since(startedAt) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		if err != nil {
+			h.logger.Error(E.Cause(err, "connect to portal"), ", retrying in ", delay)
+		}
+		select {
+		case <-time.After(delay):
+		case <-h.ctx.Done():
+			return
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func (h *Bridge) connect() error {
+	conn, err := h.dialer.DialContext(h.ctx, N.NetworkTCP, M.Socksaddr{Fqdn: h.domain})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = writeRegistration(conn, h.name, h.password)
+	if err != nil {
+		return E.Cause(err, "write registration")
+	}
+	h.logger.Info("connected to portal")
+	//nolint:staticcheck
+	err = h.service.NewConnection(h.ctx, conn, M.Metadata{Destination: mux.Destination})
+	if err != nil && !E.IsClosedOrCanceled(err) {
+		return err
+	}
+	h.logger.Info("disconnected from portal")
+	return nil
+}
+
+func (h *Bridge) NewConnectionEx(ctx context.Context, conn net.Conn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	var metadata adapter.InboundContext
+	metadata.Inbound = h.Tag()
+	metadata.InboundType = h.Type()
+	metadata.Source = source
+	metadata.Destination = destination
+	h.logger.InfoContext(ctx, "inbound connection to ", destination)
+	h.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (h *Bridge) NewPacketConnectionEx(ctx context.Context, conn N.PacketConn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	var metadata adapter.InboundContext
+	metadata.Inbound = h.Tag()
+	metadata.InboundType = h.Type()
+	metadata.Source = source
+	metadata.Destination = destination
+	h.logger.InfoContext(ctx, "inbound packet connection to ", destination)
+	h.router.RoutePacketConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (h *Bridge) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	return nil, E.New("outbound connection is not supported by bridge")
+}
+
+func (h *Bridge) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	return nil, E.New("outbound connection is not supported by bridge")
+}
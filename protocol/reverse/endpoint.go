@@ -0,0 +1,37 @@
+package reverse
+
+import (
+	"context"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/endpoint"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const (
+	modeBridge = "bridge"
+	modePortal = "portal"
+)
+
+func RegisterEndpoint(registry *endpoint.Registry) {
+	endpoint.Register[option.ReverseEndpointOptions](registry, C.TypeReverse, NewEndpoint)
+}
+
+func NewEndpoint(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.ReverseEndpointOptions) (adapter.Endpoint, error) {
+	if options.Domain == "" {
+		return nil, E.New("missing domain")
+	}
+	switch options.Mode {
+	case modeBridge:
+		return NewBridge(ctx, router, logger, tag, options)
+	case modePortal:
+		return NewPortal(ctx, router, logger, tag, options)
+	case "":
+		return nil, E.New("missing mode")
+	default:
+		return nil, E.New("unknown mode: ", options.Mode)
+	}
+}
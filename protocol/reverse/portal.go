@@ -0,0 +1,311 @@
+package reverse
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/endpoint"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-mux"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/service"
+)
+
+var (
+	_ adapter.ReversePortal     = (*Portal)(nil)
+	_ adapter.ConnectionHandler = (*Portal)(nil)
+)
+
+// Portal accepts bridge registrations routed to its domain and sends
+// outbound connections back down the multiplex session of a bridge.
+type Portal struct {
+	endpoint.Adapter
+	ctx         context.Context
+	cancel      context.CancelFunc
+	logger      logger.ContextLogger
+	connection  adapter.ConnectionManager
+	domain      string
+	access      sync.Mutex
+	bridges     map[string]*portalBridge
+	bridgeNames []string
+	passwords   map[string]string
+	index       atomic.Uint32
+}
+
+func NewPortal(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.ReverseEndpointOptions) (*Portal, error) {
+	if options.Detour != "" {
+		return nil, E.New("`detour` is not supported in portal mode")
+	}
+	if options.Name != "" {
+		return nil, E.New("`name` is not supported in portal mode")
+	}
+	if options.Password != "" {
+		return nil, E.New("`password` is not supported in portal mode, use `users` instead")
+	}
+	if len(options.Users) == 0 {
+		return nil, E.New("missing users")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	portal := &Portal{
+		Adapter:    endpoint.NewAdapter(C.TypeReverse, tag, []string{N.NetworkTCP, N.NetworkUDP}, nil),
+		ctx:        ctx,
+		cancel:     cancel,
+		logger:     logger,
+		connection: service.FromContext[adapter.ConnectionManager](ctx),
+		domain:     options.Domain,
+		bridges:    make(map[string]*portalBridge),
+		passwords:  make(map[string]string),
+	}
+	for index, user := range options.Users {
+		if user.Name == "" {
+			cancel()
+			return nil, E.New("missing name for user[", index, "]")
+		}
+		if user.Password == "" {
+			cancel()
+			return nil, E.New("missing password for user[", index, "]")
+		}
+		if _, loaded := portal.passwords[user.Name]; loaded {
+			cancel()
+			return nil, E.New("duplicate user name: ", user.Name)
+		}
+		bridge, err := newPortalBridge(ctx, logger, user.Name)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		portal.passwords[user.Name] = user.Password
+		portal.bridges[user.Name] = bridge
+		portal.bridgeNames = append(portal.bridgeNames, user.Name)
+	}
+	return portal, nil
+}
+
+func (h *Portal) Start(stage adapter.StartStage) error {
+	return nil
+}
+
+func (h *Portal) Close() error {
+	h.cancel()
+	h.access.Lock()
+	defer h.access.Unlock()
+	var errs []error
+	for _, bridge := range h.bridges {
+		errs = append(errs, bridge.Close())
+	}
+	return E.Errors(errs...)
+}
+
+func (h *Portal) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	if metadata.Destination.Fqdn != h.domain {
+		h.connection.NewConnection(ctx, h, conn, metadata, onClose)
+		return
+	}
+	err := h.newBridgeConnection(ctx, conn, metadata, onClose)
+	if err != nil {
+		N.CloseOnHandshakeFailure(conn, onClose, err)
+		h.logger.ErrorContext(ctx, E.Cause(err, "process bridge connection from ", metadata.Source))
+	}
+}
+
+func (h *Portal) newBridgeConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) error {
+	err := conn.SetReadDeadline(time.Now().Add(C.TCPTimeout))
+	if err != nil {
+		return err
+	}
+	name, password, err := readRegistration(conn)
+	if err != nil {
+		return E.Cause(err, "read registration")
+	}
+	err = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	// bridges are fixed by the configured users, so the map never grows
+	expectedPassword, loaded := h.passwords[name]
+	if !loaded || subtle.ConstantTimeCompare([]byte(password), []byte(expectedPassword)) != 1 {
+		return E.New("authentication failed for bridge ", name)
+	}
+	err = h.bridges[name].offer(conn, onClose)
+	if err != nil {
+		return err
+	}
+	h.logger.InfoContext(ctx, "bridge ", name, " connected from ", metadata.Source)
+	return nil
+}
+
+func (h *Portal) selectBridge() (*portalBridge, error) {
+	h.access.Lock()
+	defer h.access.Unlock()
+	if len(h.bridgeNames) > 0 {
+		start := int(h.index.Add(1))
+		for i := range h.bridgeNames {
+			bridge := h.bridges[h.bridgeNames[(start+i)%len(h.bridgeNames)]]
+			if bridge.connections.Load() > 0 {
+				return bridge, nil
+			}
+		}
+	}
+	return nil, E.New("no bridge connected")
+}
+
+func (h *Portal) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	ctx, metadata := adapter.ExtendContext(ctx)
+	metadata.Outbound = h.Tag()
+	metadata.Destination = destination
+	bridge, err := h.selectBridge()
+	if err != nil {
+		return nil, err
+	}
+	switch N.NetworkName(network) {
+	case N.NetworkTCP:
+		h.logger.InfoContext(ctx, "outbound connection to ", destination, " via bridge ", bridge.name)
+	case N.NetworkUDP:
+		h.logger.InfoContext(ctx, "outbound packet connection to ", destination, " via bridge ", bridge.name)
+	}
+	return bridge.client.DialContext(ctx, network, destination)
+}
+
+func (h *Portal) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	ctx, metadata := adapter.ExtendContext(ctx)
+	metadata.Outbound = h.Tag()
+	metadata.Destination = destination
+	bridge, err := h.selectBridge()
+	if err != nil {
+		return nil, err
+	}
+	h.logger.InfoContext(ctx, "outbound packet connection to ", destination, " via bridge ", bridge.name)
+	return bridge.client.ListenPacket(ctx, destination)
+}
+
+func (h *Portal) Bridges() []adapter.ReverseBridgeStatus {
+	h.access.Lock()
+	defer h.access.Unlock()
+	return common.Map(h.bridgeNames, func(name string) adapter.ReverseBridgeStatus {
+		return h.bridges[name].status()
+	})
+}
+
+// portalBridge holds the registered connections of a single bridge, the
+// multiplex client takes a pending connection whenever it needs a new session.
+type portalBridge struct {
+	ctx         context.Context
+	name        string
+	client      *mux.Client
+	pending     chan *bridgeConn
+	connections atomic.Int32
+	connectedAt atomic.Pointer[time.Time]
+	upload      atomic.Int64
+	download    atomic.Int64
+}
+
+func newPortalBridge(ctx context.Context, logger logger.ContextLogger, name string) (*portalBridge, error) {
+	bridge := &portalBridge{
+		ctx:     ctx,
+		name:    name,
+		pending: make(chan *bridgeConn, 1),
+	}
+	client, err := mux.NewClient(mux.Options{
+		Dialer:         (*portalBridgeDialer)(bridge),
+		Logger:         logger,
+		MaxConnections: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bridge.client = client
+	return bridge, nil
+}
+
+// offer rejects the connection while the bridge still has a live one, a
+// reconnecting bridge is accepted once the portal sees its old session close.
+func (b *portalBridge) offer(conn net.Conn, onClose N.CloseHandlerFunc) error {
+	if !b.connections.CompareAndSwap(0, 1) {
+		return E.New("bridge ", b.name, " is already connected")
+	}
+	connectedAt := time.Now()
+	b.connectedAt.Store(&connectedAt)
+	b.pending <- &bridgeConn{
+		Conn:    bufio.NewInt64CounterConn(conn, []*atomic.Int64{&b.download}, []*atomic.Int64{&b.upload}),
+		bridge:  b,
+		onClose: onClose,
+	}
+	return nil
+}
+
+func (b *portalBridge) status() adapter.ReverseBridgeStatus {
+	status := adapter.ReverseBridgeStatus{
+		Name:        b.name,
+		Connections: int(b.connections.Load()),
+		Upload:      b.upload.Load(),
+		Download:    b.download.Load(),
+	}
+	connectedAt := b.connectedAt.Load()
+	if connectedAt != nil {
+		status.ConnectedAt = *connectedAt
+	}
+	return status
+}
+
+func (b *portalBridge) Close() error {
+	for {
+		select {
+		case conn := <-b.pending:
+			conn.Close()
+		default:
+			return b.client.Close()
+		}
+	}
+}
+
+type portalBridgeDialer portalBridge
+
+func (d *portalBridgeDialer) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	select {
+	case conn := <-d.pending:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, E.Cause(ctx.Err(), "wait for bridge ", d.name)
+	case <-d.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+func (d *portalBridgeDialer) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	return nil, E.New("packet connection is not supported")
+}
+
+type bridgeConn struct {
+	net.Conn
+	bridge    *portalBridge
+	onClose   N.CloseHandlerFunc
+	closeOnce sync.Once
+}
+
+func (c *bridgeConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.Conn.Close()
+		c.bridge.connections.Add(-1)
+		if c.onClose != nil {
+			c.onClose(nil)
+		}
+	})
+	return err
+}
+
+func (c *bridgeConn) Upstream() any {
+	return c.Conn
+}
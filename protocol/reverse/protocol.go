@@ -0,0 +1,63 @@
+package reverse
+
+import (
+	"io"
+
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const version0 = 0
+
+// The bridge sends a registration header before the multiplex session:
+//
+//	+---------+----------+------+--------------+----------+
+//	| version | name len | name | password len | password |
+//	+---------+----------+------+--------------+----------+
+//	|    1    |    1     | var  |      1       |   var    |
+//	+---------+----------+------+--------------+----------+
+func writeRegistration(writer io.Writer, name string, password string) error {
+	if len(name) > 255 {
+		return E.New("bridge name too long")
+	}
+	if len(password) > 255 {
+		return E.New("bridge password too long")
+	}
+	header := make([]byte, 0, 3+len(name)+len(password))
+	header = append(header, version0, byte(len(name)))
+	header = append(header, name...)
+	header = append(header, byte(len(password)))
+	header = append(header, password...)
+	_, err := writer.Write(header)
+	return err
+}
+
+func readRegistration(reader io.Reader) (name string, password string, err error) {
+	var header [2]byte
+	_, err = io.ReadFull(reader, header[:])
+	if err != nil {
+		return
+	}
+	if header[0] != version0 {
+		err = E.New("unknown version: ", header[0])
+		return
+	}
+	name, err = readString(reader, int(header[1]))
+	if err != nil {
+		return
+	}
+	_, err = io.ReadFull(reader, header[:1])
+	if err != nil {
+		return
+	}
+	password, err = readString(reader, int(header[0]))
+	return
+}
+
+func readString(reader io.Reader, length int) (string, error) {
+	content := make([]byte, length)
+	_, err := io.ReadFull(reader, content)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -25,7 +25,10 @@ import (
 	N "github.com/sagernet/sing/common/network"
 )
 
-var _ adapter.TCPInjectableInbound = (*RelayInbound)(nil)
+var (
+	_ adapter.TCPInjectableInbound  = (*RelayInbound)(nil)
+	_ adapter.ManagedSSMRelayServer = (*RelayInbound)(nil)
+)
 
 type RelayInbound struct {
 	inbound.Adapter
@@ -35,6 +38,7 @@ type RelayInbound struct {
 	listener     *listener.Listener
 	service      *shadowaead_2022.RelayService[int]
 	destinations []option.ShadowsocksDestination
+	tracker      adapter.SSMTracker
 }
 
 func newRelayInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.ShadowsocksInboundOptions) (*RelayInbound, error) {
@@ -97,6 +101,25 @@ func (h *RelayInbound) Close() error {
 	return h.listener.Close()
 }
 
+func (h *RelayInbound) SetTracker(tracker adapter.SSMTracker) {
+	h.tracker = tracker
+}
+
+func (h *RelayInbound) UpdateDestinations(destinations []string, uPSKs []string, servers []M.Socksaddr) error {
+	err := h.service.UpdateUsersWithPasswords(common.MapIndexed(destinations, func(index int, destination string) int {
+		return index
+	}), uPSKs, servers)
+	if err != nil {
+		return err
+	}
+	h.destinations = common.Map(destinations, func(destination string) option.ShadowsocksDestination {
+		return option.ShadowsocksDestination{
+			Name: destination,
+		}
+	})
+	return nil
+}
+
 //nolint:staticcheck
 func (h *RelayInbound) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
 	err := h.service.NewConnection(ctx, conn, adapter.UpstreamMetadata(metadata))
@@ -134,6 +157,9 @@ func (h *RelayInbound) newConnection(ctx context.Context, conn net.Conn, metadat
 	metadata.InboundType = h.Type()
 	//nolint:staticcheck
 	metadata.InboundDetour = h.listener.ListenOptions().Detour
+	if h.tracker != nil {
+		conn = h.tracker.TrackConnection(conn, metadata)
+	}
 	//nolint:staticcheck
 	return h.router.RouteConnection(ctx, conn, metadata)
 }
@@ -156,6 +182,9 @@ func (h *RelayInbound) newPacketConnection(ctx context.Context, conn N.PacketCon
 	metadata.InboundType = h.Type()
 	//nolint:staticcheck
 	metadata.InboundDetour = h.listener.ListenOptions().Detour
+	if h.tracker != nil {
+		conn = h.tracker.TrackPacketConnection(conn, metadata)
+	}
 	//nolint:staticcheck
 	return h.router.RoutePacketConnection(ctx, conn, metadata)
 }
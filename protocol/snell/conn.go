@@ -0,0 +1,260 @@
+package snell
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	N "github.com/sagernet/sing/common/network"
+)
+
+const drainTimeout = 5 * time.Second
+
+// session is a single request served on a chunkConn, when reused the
+// underlying connection survives the session if both sides sent a zero chunk.
+type session struct {
+	*chunkConn
+	reuse       bool
+	readEOF     atomic.Bool
+	writeEOF    atomic.Bool
+	broken      atomic.Bool
+	closeOnce   sync.Once
+	writeAccess sync.Mutex
+}
+
+func (s *session) read(b []byte) (int, error) {
+	if s.readEOF.Load() {
+		return 0, io.EOF
+	}
+	n, err := s.chunkConn.Read(b)
+	if err == errZeroChunk && s.reuse {
+		s.readEOF.Store(true)
+		return 0, io.EOF
+	} else if err != nil {
+		s.broken.Store(true)
+	}
+	return n, err
+}
+
+func (s *session) write(b []byte) (int, error) {
+	if s.writeEOF.Load() {
+		return 0, net.ErrClosed
+	}
+	n, err := s.chunkConn.Write(b)
+	if err != nil {
+		s.broken.Store(true)
+	}
+	return n, err
+}
+
+func (s *session) closeWrite() error {
+	if !s.reuse {
+		return N.CloseWrite(s.chunkConn.Conn)
+	}
+	if s.writeEOF.Swap(true) {
+		return nil
+	}
+	err := s.chunkConn.writeChunk(nil)
+	if err != nil {
+		s.broken.Store(true)
+	}
+	return err
+}
+
+// drain discards the remaining data of the session until the zero chunk.
+func (s *session) drain() error {
+	err := s.chunkConn.SetReadDeadline(time.Now().Add(drainTimeout))
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := s.chunkConn.readChunk()
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+	}
+	return s.chunkConn.SetReadDeadline(time.Time{})
+}
+
+func (s *session) reusable() bool {
+	return s.reuse && s.readEOF.Load() && s.writeEOF.Load() && !s.broken.Load()
+}
+
+func (s *session) SetDeadline(t time.Time) error {
+	return s.chunkConn.SetDeadline(t)
+}
+
+func (s *session) Upstream() any {
+	return s.chunkConn
+}
+
+var (
+	_ N.HandshakeFailure = (*serverConn)(nil)
+	_ N.HandshakeSuccess = (*serverConn)(nil)
+)
+
+type serverConn struct {
+	session
+	responseWritten bool
+	done            chan struct{}
+}
+
+func newServerConn(conn *chunkConn, reuse bool) *serverConn {
+	return &serverConn{
+		session: session{
+			chunkConn: conn,
+			reuse:     reuse,
+		},
+		done: make(chan struct{}),
+	}
+}
+
+func (c *serverConn) HandshakeSuccess() error {
+	c.writeAccess.Lock()
+	defer c.writeAccess.Unlock()
+	if c.responseWritten {
+		return nil
+	}
+	c.responseWritten = true
+	return c.chunkConn.writeChunk([]byte{responseTunnel})
+}
+
+func (c *serverConn) HandshakeFailure(err error) error {
+	c.writeAccess.Lock()
+	defer c.writeAccess.Unlock()
+	if c.responseWritten {
+		return nil
+	}
+	c.responseWritten = true
+	c.broken.Store(true)
+	return writeError(c.chunkConn, err)
+}
+
+func (c *serverConn) Read(b []byte) (int, error) {
+	return c.read(b)
+}
+
+func (c *serverConn) Write(b []byte) (int, error) {
+	err := c.HandshakeSuccess()
+	if err != nil {
+		return 0, err
+	}
+	return c.write(b)
+}
+
+func (c *serverConn) CloseWrite() error {
+	err := c.HandshakeSuccess()
+	if err != nil {
+		return err
+	}
+	return c.closeWrite()
+}
+
+func (c *serverConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if c.reuse && !c.broken.Load() {
+			if !c.writeEOF.Load() {
+				c.CloseWrite()
+			}
+			if !c.readEOF.Load() && !c.broken.Load() {
+				if c.drain() == nil {
+					c.readEOF.Store(true)
+				} else {
+					c.broken.Store(true)
+				}
+			}
+		}
+		if !c.reusable() {
+			err = c.chunkConn.Close()
+		}
+		close(c.done)
+	})
+	return err
+}
+
+type clientConn struct {
+	session
+	pool         *connPool
+	responseRead bool
+	readAccess   sync.Mutex
+}
+
+func newClientConn(conn *chunkConn, reuse bool, pool *connPool) *clientConn {
+	return &clientConn{
+		session: session{
+			chunkConn: conn,
+			reuse:     reuse,
+		},
+		pool: pool,
+	}
+}
+
+func (c *clientConn) readResponse() error {
+	if c.responseRead {
+		return nil
+	}
+	c.responseRead = true
+	err := readResponse(c.chunkConn)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return err
+}
+
+func (c *clientConn) Read(b []byte) (int, error) {
+	c.readAccess.Lock()
+	defer c.readAccess.Unlock()
+	err := c.readResponse()
+	if err != nil {
+		return 0, err
+	}
+	return c.read(b)
+}
+
+func (c *clientConn) Write(b []byte) (int, error) {
+	return c.write(b)
+}
+
+func (c *clientConn) CloseWrite() error {
+	return c.closeWrite()
+}
+
+func (c *clientConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if !c.reuse || c.broken.Load() {
+			err = c.chunkConn.Close()
+			return
+		}
+		if !c.writeEOF.Load() && c.closeWrite() != nil {
+			err = c.chunkConn.Close()
+			return
+		}
+		if c.readEOF.Load() {
+			c.pool.put(c.chunkConn)
+			return
+		}
+		go c.drainAndRelease()
+	})
+	return err
+}
+
+func (c *clientConn) drainAndRelease() {
+	c.readAccess.Lock()
+	defer c.readAccess.Unlock()
+	err := c.readResponse()
+	if err == nil {
+		err = c.drain()
+	}
+	if err != nil {
+		c.chunkConn.Close()
+		return
+	}
+	c.pool.put(c.chunkConn)
+}
@@ -0,0 +1,163 @@
+package snell
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/inbound"
+	"github.com/sagernet/sing-box/common/listener"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/simple-obfs"
+	E "github.com/sagernet/sing/common/exceptions"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// reuseIdleTimeout is longer than the client pool timeout so that idle
+// connections are always closed by the client first.
+const reuseIdleTimeout = 2 * poolIdleTimeout
+
+func RegisterInbound(registry *inbound.Registry) {
+	inbound.Register[option.SnellInboundOptions](registry, C.TypeSnell, NewInbound)
+}
+
+type Inbound struct {
+	inbound.Adapter
+	router   adapter.ConnectionRouterEx
+	logger   log.ContextLogger
+	listener *listener.Listener
+	psk      []byte
+	version  int
+	obfsType string
+}
+
+func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.SnellInboundOptions) (adapter.Inbound, error) {
+	if options.PSK == "" {
+		return nil, E.New("missing psk")
+	}
+	version, err := validateVersion(options.Version)
+	if err != nil {
+		return nil, err
+	}
+	obfsType, _, err := parseObfsOptions(options.Obfs)
+	if err != nil {
+		return nil, err
+	}
+	inbound := &Inbound{
+		Adapter:  inbound.NewAdapter(C.TypeSnell, tag),
+		router:   router,
+		logger:   logger,
+		psk:      []byte(options.PSK),
+		version:  version,
+		obfsType: obfsType,
+	}
+	inbound.listener = listener.New(listener.Options{
+		Context:           ctx,
+		Logger:            logger,
+		Network:           []string{N.NetworkTCP},
+		Listen:            options.ListenOptions,
+		ConnectionHandler: inbound,
+	})
+	return inbound, nil
+}
+
+func (h *Inbound) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	return h.listener.Start()
+}
+
+func (h *Inbound) Close() error {
+	return h.listener.Close()
+}
+
+func (h *Inbound) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	switch h.obfsType {
+	case "http":
+		conn = obfs.NewHTTPObfsServer(conn)
+	case "tls":
+		conn = obfs.NewTLSObfsServer(conn)
+	}
+	err := h.newConnection(ctx, newChunkConn(conn, h.version, h.psk), metadata)
+	if err != nil {
+		N.CloseOnHandshakeFailure(conn, onClose, err)
+		if E.IsClosedOrCanceled(err) {
+			h.logger.DebugContext(ctx, "connection closed: ", err)
+		} else {
+			h.logger.ErrorContext(ctx, E.Cause(err, "process connection from ", metadata.Source))
+		}
+		return
+	}
+	conn.Close()
+	if onClose != nil {
+		onClose(nil)
+	}
+}
+
+// newConnection serves requests on the connection until a session is not reusable.
+func (h *Inbound) newConnection(ctx context.Context, conn *chunkConn, metadata adapter.InboundContext) error {
+	metadata.Inbound = h.Tag()
+	metadata.InboundType = h.Type()
+	//nolint:staticcheck
+	metadata.InboundDetour = h.listener.ListenOptions().Detour
+	for first := true; ; first = false {
+		if first {
+			conn.SetReadDeadline(time.Now().Add(C.TCPTimeout))
+		} else {
+			conn.SetReadDeadline(time.Now().Add(reuseIdleTimeout))
+		}
+		request, err := readRequest(conn)
+		if err != nil {
+			if !first && E.IsClosedOrCanceled(err) {
+				return nil
+			}
+			return E.Cause(err, "read request")
+		}
+		conn.SetReadDeadline(time.Time{})
+		sessionContext := log.ContextWithNewID(ctx)
+		sessionMetadata := metadata
+		switch request.Command {
+		case commandPing:
+			err = conn.writeChunk([]byte{responsePong})
+			if err != nil {
+				return err
+			}
+		case commandConnect, commandConnectV2:
+			reuse := request.Command == commandConnectV2 && supportReuse(h.version)
+			sessionMetadata.Destination = request.Destination
+			h.logger.InfoContext(sessionContext, "inbound connection to ", sessionMetadata.Destination)
+			sessionConn := newServerConn(conn, reuse)
+			h.router.RouteConnectionEx(sessionContext, sessionConn, sessionMetadata, func(it error) {
+				sessionConn.Close()
+			})
+			<-sessionConn.done
+			if !sessionConn.reusable() {
+				return nil
+			}
+		case commandUDP:
+			if !supportUDP(h.version) {
+				err = writeError(conn, E.New("udp is not supported"))
+				if err != nil {
+					return err
+				}
+				return nil
+			}
+			packetConn := newServerPacketConn(conn)
+			destination, err := packetConn.readFirstPacket()
+			if err != nil {
+				return E.Cause(err, "read first packet")
+			}
+			sessionMetadata.Destination = destination
+			h.logger.InfoContext(sessionContext, "inbound packet connection to ", sessionMetadata.Destination)
+			h.router.RoutePacketConnectionEx(sessionContext, packetConn, sessionMetadata, func(it error) {
+				packetConn.Close()
+			})
+			<-packetConn.done
+			return nil
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package snell
+
+import (
+	"context"
+	"net"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/outbound"
+	"github.com/sagernet/sing-box/common/dialer"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/simple-obfs"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/bufio"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const defaultObfsHost = "bing.com"
+
+func RegisterOutbound(registry *outbound.Registry) {
+	outbound.Register[option.SnellOutboundOptions](registry, C.TypeSnell, NewOutbound)
+}
+
+type Outbound struct {
+	outbound.Adapter
+	logger     logger.ContextLogger
+	dialer     N.Dialer
+	serverAddr M.Socksaddr
+	psk        []byte
+	version    int
+	obfsType   string
+	obfsHost   string
+	reuse      bool
+	pool       *connPool
+}
+
+func NewOutbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.SnellOutboundOptions) (adapter.Outbound, error) {
+	if options.PSK == "" {
+		return nil, E.New("missing psk")
+	}
+	version, err := validateVersion(options.Version)
+	if err != nil {
+		return nil, err
+	}
+	obfsType, obfsHost, err := parseObfsOptions(options.Obfs)
+	if err != nil {
+		return nil, err
+	}
+	networkList := options.Network.Build()
+	if !supportUDP(version) {
+		if common.Contains(networkList, N.NetworkUDP) && options.Network != "" {
+			return nil, E.New("udp is not supported in snell version ", version)
+		}
+		networkList = []string{N.NetworkTCP}
+	}
+	reuse := common.PtrValueOrDefault(options.Reuse)
+	if reuse && !supportReuse(version) {
+		return nil, E.New("reuse is not supported in snell version ", version)
+	}
+	outboundDialer, err := dialer.New(ctx, options.DialerOptions, options.ServerIsDomain())
+	if err != nil {
+		return nil, err
+	}
+	if obfsHost == "" {
+		obfsHost = defaultObfsHost
+	}
+	return &Outbound{
+		Adapter:    outbound.NewAdapterWithDialerOptions(C.TypeSnell, tag, networkList, options.DialerOptions),
+		logger:     logger,
+		dialer:     outboundDialer,
+		serverAddr: options.ServerOptions.Build(),
+		psk:        []byte(options.PSK),
+		version:    version,
+		obfsType:   obfsType,
+		obfsHost:   obfsHost,
+		reuse:      reuse,
+		pool:       &connPool{},
+	}, nil
+}
+
+func parseObfsOptions(options *option.SnellObfsOptions) (obfsType string, obfsHost string, err error) {
+	if options == nil {
+		return
+	}
+	switch options.Type {
+	case "", "off":
+	case "http", "tls":
+		obfsType = options.Type
+	default:
+		err = E.New("unknown obfs type: ", options.Type)
+		return
+	}
+	obfsHost = options.Host
+	return
+}
+
+func (h *Outbound) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	ctx, metadata := adapter.ExtendContext(ctx)
+	metadata.Outbound = h.Tag()
+	metadata.Destination = destination
+	switch N.NetworkName(network) {
+	case N.NetworkTCP:
+		h.logger.InfoContext(ctx, "outbound connection to ", destination)
+		return h.dialConn(ctx, destination)
+	case N.NetworkUDP:
+		h.logger.InfoContext(ctx, "outbound packet connection to ", destination)
+		packetConn, err := h.dialPacketConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewBindPacketConn(packetConn, destination), nil
+	default:
+		return nil, E.Extend(N.ErrUnknownNetwork, network)
+	}
+}
+
+func (h *Outbound) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	ctx, metadata := adapter.ExtendContext(ctx)
+	metadata.Outbound = h.Tag()
+	metadata.Destination = destination
+	h.logger.InfoContext(ctx, "outbound packet connection to ", destination)
+	return h.dialPacketConn(ctx)
+}
+
+func (h *Outbound) dialConn(ctx context.Context, destination M.Socksaddr) (net.Conn, error) {
+	request := requestHeader{
+		Command:     commandConnect,
+		Destination: destination,
+	}
+	if h.reuse {
+		request.Command = commandConnectV2
+		for {
+			conn := h.pool.get()
+			if conn == nil {
+				break
+			}
+			err := writeRequest(conn, request)
+			if err == nil {
+				return newClientConn(conn, true, h.pool), nil
+			}
+			conn.Close()
+		}
+	}
+	conn, err := h.newChunkConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = writeRequest(conn, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newClientConn(conn, h.reuse, h.pool), nil
+}
+
+func (h *Outbound) dialPacketConn(ctx context.Context) (net.PacketConn, error) {
+	if !supportUDP(h.version) {
+		return nil, E.New("udp is not supported in snell version ", h.version)
+	}
+	conn, err := h.newChunkConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = writeRequest(conn, requestHeader{Command: commandUDP})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newClientPacketConn(conn), nil
+}
+
+func (h *Outbound) newChunkConn(ctx context.Context) (*chunkConn, error) {
+	conn, err := h.dialer.DialContext(ctx, N.NetworkTCP, h.serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	switch h.obfsType {
+	case "http":
+		conn = obfs.NewHTTPObfs(conn, h.obfsHost, F.ToString(h.serverAddr.Port))
+	case "tls":
+		conn = obfs.NewTLSObfs(conn, h.obfsHost)
+	}
+	return newChunkConn(conn, h.version, h.psk), nil
+}
+
+func (h *Outbound) InterfaceUpdated() {
+	h.pool.reset()
+}
+
+func (h *Outbound) Close() error {
+	return h.pool.Close()
+}
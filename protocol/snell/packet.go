@@ -0,0 +1,231 @@
+package snell
+
+import (
+	"net"
+	"sync"
+
+	"github.com/sagernet/sing/common/buf"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const maxPacketHeaderSize = 1 + 1 + 255 + 2
+
+var (
+	_ N.PacketConn    = (*serverPacketConn)(nil)
+	_ N.FrontHeadroom = (*serverPacketConn)(nil)
+)
+
+// serverPacketConn relays UDP packets over a snell session, every chunk is one packet.
+type serverPacketConn struct {
+	*chunkConn
+	responseOnce sync.Once
+	responseErr  error
+	cached       *buf.Buffer
+	cachedFrom   M.Socksaddr
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+func newServerPacketConn(conn *chunkConn) *serverPacketConn {
+	return &serverPacketConn{
+		chunkConn: conn,
+		done:      make(chan struct{}),
+	}
+}
+
+// readFirstPacket reads the first packet so that the initial destination is known before routing.
+func (c *serverPacketConn) readFirstPacket() (M.Socksaddr, error) {
+	buffer := buf.NewPacket()
+	destination, err := c.readPacket(buffer)
+	if err != nil {
+		buffer.Release()
+		return M.Socksaddr{}, err
+	}
+	c.cached = buffer
+	c.cachedFrom = destination
+	return destination, nil
+}
+
+func (c *serverPacketConn) readPacket(buffer *buf.Buffer) (M.Socksaddr, error) {
+	chunk, err := c.chunkConn.readChunk()
+	if err != nil {
+		return M.Socksaddr{}, err
+	}
+	if len(chunk) == 0 {
+		return M.Socksaddr{}, net.ErrClosed
+	}
+	destination, payload, err := readClientPacket(chunk)
+	if err != nil {
+		return M.Socksaddr{}, err
+	}
+	_, err = buffer.Write(payload)
+	if err != nil {
+		return M.Socksaddr{}, err
+	}
+	return destination, nil
+}
+
+func (c *serverPacketConn) ReadPacket(buffer *buf.Buffer) (M.Socksaddr, error) {
+	if c.cached != nil {
+		cached := c.cached
+		c.cached = nil
+		_, err := buffer.Write(cached.Bytes())
+		cached.Release()
+		if err != nil {
+			return M.Socksaddr{}, err
+		}
+		return c.cachedFrom, nil
+	}
+	return c.readPacket(buffer)
+}
+
+func (c *serverPacketConn) writeResponse() error {
+	c.responseOnce.Do(func() {
+		c.responseErr = c.chunkConn.writeChunk([]byte{responseTunnel})
+	})
+	return c.responseErr
+}
+
+func (c *serverPacketConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	defer buffer.Release()
+	err := c.writeResponse()
+	if err != nil {
+		return err
+	}
+	packet, copied := ensureHeadroom(buffer, maxPacketHeaderSize)
+	if copied {
+		defer packet.Release()
+	}
+	err = writeServerPacket(packet, destination)
+	if err != nil {
+		return err
+	}
+	if packet.Len() > maxPayloadSize {
+		return E.New("packet too large: ", packet.Len())
+	}
+	return c.chunkConn.writeChunk(packet.Bytes())
+}
+
+func (c *serverPacketConn) FrontHeadroom() int {
+	return maxPacketHeaderSize
+}
+
+func (c *serverPacketConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if c.cached != nil {
+			c.cached.Release()
+			c.cached = nil
+		}
+		err = c.chunkConn.Close()
+		close(c.done)
+	})
+	return err
+}
+
+func (c *serverPacketConn) Upstream() any {
+	return c.chunkConn
+}
+
+var (
+	_ N.NetPacketConn = (*clientPacketConn)(nil)
+	_ N.FrontHeadroom = (*clientPacketConn)(nil)
+)
+
+type clientPacketConn struct {
+	*chunkConn
+	responseAccess sync.Mutex
+	responseRead   bool
+}
+
+func newClientPacketConn(conn *chunkConn) *clientPacketConn {
+	return &clientPacketConn{chunkConn: conn}
+}
+
+func (c *clientPacketConn) ReadPacket(buffer *buf.Buffer) (M.Socksaddr, error) {
+	c.responseAccess.Lock()
+	if !c.responseRead {
+		c.responseRead = true
+		err := readResponse(c.chunkConn)
+		if err != nil {
+			c.responseAccess.Unlock()
+			return M.Socksaddr{}, err
+		}
+	}
+	c.responseAccess.Unlock()
+	chunk, err := c.chunkConn.readChunk()
+	if err != nil {
+		return M.Socksaddr{}, err
+	}
+	if len(chunk) == 0 {
+		return M.Socksaddr{}, net.ErrClosed
+	}
+	source, payload, err := readServerPacket(chunk)
+	if err != nil {
+		return M.Socksaddr{}, err
+	}
+	_, err = buffer.Write(payload)
+	if err != nil {
+		return M.Socksaddr{}, err
+	}
+	return source, nil
+}
+
+func (c *clientPacketConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	defer buffer.Release()
+	packet, copied := ensureHeadroom(buffer, clientPacketHeaderLen(destination))
+	if copied {
+		defer packet.Release()
+	}
+	writeClientPacket(packet, destination)
+	if packet.Len() > maxPayloadSize {
+		return E.New("packet too large: ", packet.Len())
+	}
+	return c.chunkConn.writeChunk(packet.Bytes())
+}
+
+func (c *clientPacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	buffer := buf.With(p)
+	destination, err := c.ReadPacket(buffer)
+	if err != nil {
+		return
+	}
+	n = buffer.Len()
+	if destination.IsFqdn() {
+		addr = destination
+	} else {
+		addr = destination.UDPAddr()
+	}
+	return
+}
+
+func (c *clientPacketConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	err = c.WritePacket(buf.As(p), M.SocksaddrFromNet(addr))
+	if err != nil {
+		return
+	}
+	n = len(p)
+	return
+}
+
+func (c *clientPacketConn) FrontHeadroom() int {
+	return maxPacketHeaderSize
+}
+
+func (c *clientPacketConn) Upstream() any {
+	return c.chunkConn
+}
+
+// ensureHeadroom returns a buffer with at least headroom bytes in front of the
+// payload, copying it into a new buffer if required.
+func ensureHeadroom(buffer *buf.Buffer, headroom int) (*buf.Buffer, bool) {
+	if buffer.Start() >= headroom {
+		return buffer, false
+	}
+	newBuffer := buf.NewSize(headroom + buffer.Len())
+	newBuffer.Resize(headroom, 0)
+	copy(newBuffer.Extend(buffer.Len()), buffer.Bytes())
+	return newBuffer, true
+}
@@ -0,0 +1,61 @@
+package snell
+
+import (
+	"sync"
+	"time"
+)
+
+const poolIdleTimeout = 30 * time.Second
+
+type idleConn struct {
+	conn     *chunkConn
+	idleTime time.Time
+}
+
+// connPool keeps connections of finished sessions for the next request.
+type connPool struct {
+	access sync.Mutex
+	conns  []idleConn
+	closed bool
+}
+
+func (p *connPool) get() *chunkConn {
+	p.access.Lock()
+	defer p.access.Unlock()
+	for len(p.conns) > 0 {
+		conn := p.conns[len(p.conns)-1]
+		p.conns = p.conns[:len(p.conns)-1]
+		if time.Since(conn.idleTime) < poolIdleTimeout {
+			return conn.conn
+		}
+		conn.conn.Close()
+	}
+	return nil
+}
+
+func (p *connPool) put(conn *chunkConn) {
+	p.access.Lock()
+	defer p.access.Unlock()
+	if p.closed {
+		conn.Close()
+		return
+	}
+	p.conns = append(p.conns, idleConn{conn, time.Now()})
+}
+
+func (p *connPool) reset() {
+	p.access.Lock()
+	defer p.access.Unlock()
+	for _, conn := range p.conns {
+		conn.conn.Close()
+	}
+	p.conns = nil
+}
+
+func (p *connPool) Close() error {
+	p.reset()
+	p.access.Lock()
+	p.closed = true
+	p.access.Unlock()
+	return nil
+}
@@ -0,0 +1,458 @@
+package snell
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/buf"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Versions 1 to 3 follow the publicly documented snell wire format.
+// The version 4 framing used by Surge is not public and is not implemented.
+const (
+	Version1 = 1
+	Version2 = 2
+	Version3 = 3
+
+	DefaultVersion = Version3
+)
+
+const (
+	protocolVersion byte = 1
+
+	commandPing      byte = 0
+	commandConnect   byte = 1
+	commandConnectV2 byte = 5
+	commandUDP       byte = 6
+
+	commandUDPForward byte = 1
+
+	responseTunnel byte = 0
+	responsePong   byte = 1
+	responseError  byte = 2
+)
+
+const (
+	saltSize       = 16
+	overhead       = 16
+	maxPayloadSize = 0x3FFF
+)
+
+var errZeroChunk = E.New("zero chunk")
+
+func newAEAD(version int, psk []byte, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey(psk, salt, 3, 8, 1, 32)
+	if version == Version1 {
+		return chacha20poly1305.New(key)
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func validateVersion(version int) (int, error) {
+	switch version {
+	case 0:
+		return DefaultVersion, nil
+	case Version1, Version2, Version3:
+		return version, nil
+	case 4:
+		return 0, E.New("snell version 4 is not supported")
+	default:
+		return 0, E.New("unknown snell version: ", version)
+	}
+}
+
+// supportReuse reports whether sessions end with a zero chunk and leave the
+// connection open for the next request.
+func supportReuse(version int) bool {
+	return version >= Version2
+}
+
+func supportUDP(version int) bool {
+	return version >= Version3
+}
+
+// chunkConn implements the shadowsocks AEAD like chunk stream used by snell,
+// a zero length chunk marks the end of a session since version 2.
+type chunkConn struct {
+	net.Conn
+	version     int
+	psk         []byte
+	readAEAD    cipher.AEAD
+	readNonce   []byte
+	readBuffer  []byte
+	cache       []byte
+	writeAccess sync.Mutex
+	writeAEAD   cipher.AEAD
+	writeNonce  []byte
+}
+
+func newChunkConn(conn net.Conn, version int, psk []byte) *chunkConn {
+	return &chunkConn{
+		Conn:       conn,
+		version:    version,
+		psk:        psk,
+		readBuffer: make([]byte, maxPayloadSize+overhead),
+	}
+}
+
+func (c *chunkConn) readChunk() ([]byte, error) {
+	if len(c.cache) > 0 {
+		chunk := c.cache
+		c.cache = nil
+		return chunk, nil
+	}
+	if c.readAEAD == nil {
+		salt := make([]byte, saltSize)
+		_, err := io.ReadFull(c.Conn, salt)
+		if err != nil {
+			return nil, err
+		}
+		c.readAEAD, err = newAEAD(c.version, c.psk, salt)
+		if err != nil {
+			return nil, err
+		}
+		c.readNonce = make([]byte, c.readAEAD.NonceSize())
+	}
+	lengthChunk := c.readBuffer[:2+overhead]
+	_, err := io.ReadFull(c.Conn, lengthChunk)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.readAEAD.Open(lengthChunk[:0], c.readNonce, lengthChunk, nil)
+	if err != nil {
+		return nil, E.Cause(err, "decrypt length")
+	}
+	increaseNonce(c.readNonce)
+	length := int(binary.BigEndian.Uint16(lengthChunk))
+	if length > maxPayloadSize {
+		return nil, E.New("invalid chunk length: ", length)
+	}
+	payloadChunk := c.readBuffer[:length+overhead]
+	_, err = io.ReadFull(c.Conn, payloadChunk)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.readAEAD.Open(payloadChunk[:0], c.readNonce, payloadChunk, nil)
+	if err != nil {
+		return nil, E.Cause(err, "decrypt payload")
+	}
+	increaseNonce(c.readNonce)
+	return payloadChunk[:length], nil
+}
+
+func (c *chunkConn) readByte() (byte, error) {
+	chunk, err := c.readChunk()
+	if err != nil {
+		return 0, err
+	}
+	if len(chunk) == 0 {
+		return 0, errZeroChunk
+	}
+	c.cache = chunk[1:]
+	return chunk[0], nil
+}
+
+func (c *chunkConn) readFull(b []byte) error {
+	for len(b) > 0 {
+		n, err := c.Read(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (c *chunkConn) Read(b []byte) (int, error) {
+	chunk, err := c.readChunk()
+	if err != nil {
+		return 0, err
+	}
+	if len(chunk) == 0 {
+		return 0, errZeroChunk
+	}
+	n := copy(b, chunk)
+	if n < len(chunk) {
+		c.cache = chunk[n:]
+	}
+	return n, nil
+}
+
+func (c *chunkConn) writeChunk(payload []byte) error {
+	c.writeAccess.Lock()
+	defer c.writeAccess.Unlock()
+	var saltLen int
+	if c.writeAEAD == nil {
+		saltLen = saltSize
+	}
+	buffer := buf.NewSize(saltLen + 2 + overhead + len(payload) + overhead)
+	defer buffer.Release()
+	if c.writeAEAD == nil {
+		salt := buffer.Extend(saltSize)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return err
+		}
+		c.writeAEAD, err = newAEAD(c.version, c.psk, salt)
+		if err != nil {
+			return err
+		}
+		c.writeNonce = make([]byte, c.writeAEAD.NonceSize())
+	}
+	lengthChunk := buffer.Extend(2 + overhead)
+	binary.BigEndian.PutUint16(lengthChunk, uint16(len(payload)))
+	c.writeAEAD.Seal(lengthChunk[:0], c.writeNonce, lengthChunk[:2], nil)
+	increaseNonce(c.writeNonce)
+	payloadChunk := buffer.Extend(len(payload) + overhead)
+	c.writeAEAD.Seal(payloadChunk[:0], c.writeNonce, payload, nil)
+	increaseNonce(c.writeNonce)
+	return common.Error(c.Conn.Write(buffer.Bytes()))
+}
+
+func (c *chunkConn) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		payload := b
+		if len(payload) > maxPayloadSize {
+			payload = payload[:maxPayloadSize]
+		}
+		err = c.writeChunk(payload)
+		if err != nil {
+			return
+		}
+		n += len(payload)
+		b = b[len(payload):]
+	}
+	return
+}
+
+func (c *chunkConn) Upstream() any {
+	return c.Conn
+}
+
+func increaseNonce(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
+
+type requestHeader struct {
+	Command     byte
+	ClientID    []byte
+	Destination M.Socksaddr
+}
+
+func writeRequest(conn *chunkConn, request requestHeader) error {
+	buffer := buf.NewSize(3 + len(request.ClientID) + 1 + 255 + 2)
+	defer buffer.Release()
+	common.Must(
+		buffer.WriteByte(protocolVersion),
+		buffer.WriteByte(request.Command),
+		buffer.WriteByte(byte(len(request.ClientID))),
+		common.Error(buffer.Write(request.ClientID)),
+	)
+	if request.Command != commandUDP && request.Command != commandPing {
+		host := request.Destination.AddrString()
+		if len(host) > 255 {
+			return E.New("destination too long: ", host)
+		}
+		common.Must(
+			buffer.WriteByte(byte(len(host))),
+			common.Error(buffer.WriteString(host)),
+			binary.Write(buffer, binary.BigEndian, request.Destination.Port),
+		)
+	}
+	return conn.writeChunk(buffer.Bytes())
+}
+
+func readRequest(conn *chunkConn) (request requestHeader, err error) {
+	version, err := conn.readByte()
+	if err != nil {
+		return
+	}
+	if version != protocolVersion {
+		err = E.New("unknown protocol version: ", version)
+		return
+	}
+	header := make([]byte, 2)
+	err = conn.readFull(header)
+	if err != nil {
+		return
+	}
+	request.Command = header[0]
+	if header[1] > 0 {
+		request.ClientID = make([]byte, header[1])
+		err = conn.readFull(request.ClientID)
+		if err != nil {
+			return
+		}
+	}
+	switch request.Command {
+	case commandPing, commandUDP:
+		return
+	case commandConnect, commandConnectV2:
+	default:
+		err = E.New("unknown command: ", request.Command)
+		return
+	}
+	hostLen := make([]byte, 1)
+	err = conn.readFull(hostLen)
+	if err != nil {
+		return
+	}
+	host := make([]byte, int(hostLen[0])+2)
+	err = conn.readFull(host)
+	if err != nil {
+		return
+	}
+	request.Destination = M.ParseSocksaddrHostPort(string(host[:hostLen[0]]), binary.BigEndian.Uint16(host[hostLen[0]:]))
+	if !request.Destination.IsValid() {
+		err = E.New("invalid destination: ", string(host[:hostLen[0]]))
+	}
+	return
+}
+
+// readResponse reads the response of a connect request.
+func readResponse(conn *chunkConn) error {
+	response, err := conn.readByte()
+	if err != nil {
+		return err
+	}
+	switch response {
+	case responseTunnel:
+		return nil
+	case responseError:
+		header := make([]byte, 2)
+		err = conn.readFull(header)
+		if err != nil {
+			return err
+		}
+		message := make([]byte, header[1])
+		err = conn.readFull(message)
+		if err != nil {
+			return err
+		}
+		return E.New("remote error ", header[0], ": ", string(message))
+	default:
+		return E.New("unexpected response: ", response)
+	}
+}
+
+func writeError(conn *chunkConn, err error) error {
+	message := err.Error()
+	if len(message) > 255 {
+		message = message[:255]
+	}
+	return conn.writeChunk(append([]byte{responseError, 0, byte(len(message))}, message...))
+}
+
+// UDP packets from client: command, host length or zero, [ip version, ip] or host, port, payload.
+func writeClientPacket(buffer *buf.Buffer, destination M.Socksaddr) {
+	header := buffer.ExtendHeader(clientPacketHeaderLen(destination))
+	header[0] = commandUDPForward
+	if destination.IsFqdn() {
+		header[1] = byte(len(destination.Fqdn))
+		copy(header[2:], destination.Fqdn)
+	} else {
+		header[1] = 0
+		addr := destination.Addr.Unmap()
+		if addr.Is4() {
+			header[2] = 4
+		} else {
+			header[2] = 6
+		}
+		copy(header[3:], addr.AsSlice())
+	}
+	binary.BigEndian.PutUint16(header[len(header)-2:], destination.Port)
+}
+
+func clientPacketHeaderLen(destination M.Socksaddr) int {
+	if destination.IsFqdn() {
+		return 1 + 1 + len(destination.Fqdn) + 2
+	}
+	return 1 + 1 + 1 + destination.Addr.Unmap().BitLen()/8 + 2
+}
+
+func readClientPacket(chunk []byte) (destination M.Socksaddr, payload []byte, err error) {
+	if len(chunk) < 2 || chunk[0] != commandUDPForward {
+		err = E.New("invalid udp packet")
+		return
+	}
+	hostLen := int(chunk[1])
+	chunk = chunk[2:]
+	if hostLen > 0 {
+		if len(chunk) < hostLen+2 {
+			err = E.New("invalid udp packet")
+			return
+		}
+		destination = M.ParseSocksaddrHostPort(string(chunk[:hostLen]), binary.BigEndian.Uint16(chunk[hostLen:]))
+		payload = chunk[hostLen+2:]
+		return
+	}
+	destination, payload, err = readIPAddress(chunk)
+	return
+}
+
+// UDP packets from server: ip version, ip, port, payload.
+func writeServerPacket(buffer *buf.Buffer, source M.Socksaddr) error {
+	if !source.IsIP() {
+		return E.New("invalid non-IP source: ", source)
+	}
+	addr := source.Addr.Unmap()
+	header := buffer.ExtendHeader(1 + addr.BitLen()/8 + 2)
+	if addr.Is4() {
+		header[0] = 4
+	} else {
+		header[0] = 6
+	}
+	copy(header[1:], addr.AsSlice())
+	binary.BigEndian.PutUint16(header[len(header)-2:], source.Port)
+	return nil
+}
+
+func readServerPacket(chunk []byte) (source M.Socksaddr, payload []byte, err error) {
+	return readIPAddress(chunk)
+}
+
+func readIPAddress(chunk []byte) (address M.Socksaddr, payload []byte, err error) {
+	if len(chunk) < 1 {
+		err = E.New("invalid udp packet")
+		return
+	}
+	var addrLen int
+	switch chunk[0] {
+	case 4:
+		addrLen = 4
+	case 6:
+		addrLen = 16
+	default:
+		err = E.New("unknown ip version: ", chunk[0])
+		return
+	}
+	if len(chunk) < 1+addrLen+2 {
+		err = E.New("invalid udp packet")
+		return
+	}
+	addr, _ := netip.AddrFromSlice(chunk[1 : 1+addrLen])
+	address = M.SocksaddrFrom(addr, binary.BigEndian.Uint16(chunk[1+addrLen:]))
+	payload = chunk[1+addrLen+2:]
+	return
+}
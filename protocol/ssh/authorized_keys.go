@@ -0,0 +1,202 @@
+package ssh
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// authorizedKey is a public key with the authorized_keys options that apply to direct-tcpip channels.
+// For the option format, see sshd(8) AUTHORIZED_KEYS FILE FORMAT.
+type authorizedKey struct {
+	publicKey        []byte
+	noPortForwarding bool
+	permitOpen       []permitOpen
+	from             []string
+	expiryTime       time.Time
+}
+
+type permitOpen struct {
+	host string
+	port uint16
+}
+
+type authorizedKeyExtraDataKey struct{}
+
+func parseAuthorizedKeys(content []byte) ([]*authorizedKey, error) {
+	var authorizedKeys []*authorizedKey
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		publicKey, comment, options, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, err
+		}
+		key := &authorizedKey{
+			publicKey: publicKey.Marshal(),
+		}
+		for _, keyOption := range options {
+			err = key.parseOption(keyOption)
+			if err != nil {
+				return nil, E.Cause(err, "key ", comment)
+			}
+		}
+		authorizedKeys = append(authorizedKeys, key)
+	}
+	return authorizedKeys, nil
+}
+
+func (k *authorizedKey) parseOption(keyOption string) error {
+	name, value, hasValue := strings.Cut(keyOption, "=")
+	if hasValue && strings.HasPrefix(value, "\"") {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return E.Cause(err, "invalid option: ", keyOption)
+		}
+		value = unquoted
+	}
+	switch strings.ToLower(name) {
+	case "restrict", "no-port-forwarding":
+		k.noPortForwarding = true
+	case "port-forwarding":
+		k.noPortForwarding = false
+	case "permitopen":
+		host, portString, err := net.SplitHostPort(value)
+		if err != nil {
+			return E.Cause(err, "invalid permitopen: ", value)
+		}
+		var port uint64
+		if portString != "*" {
+			port, err = strconv.ParseUint(portString, 10, 16)
+			if err != nil || port == 0 {
+				return E.New("invalid permitopen: ", value)
+			}
+		}
+		k.permitOpen = append(k.permitOpen, permitOpen{strings.ToLower(host), uint16(port)})
+	case "from":
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if strings.Contains(pattern, "/") {
+				_, err := netip.ParsePrefix(strings.TrimPrefix(pattern, "!"))
+				if err != nil {
+					return E.Cause(err, "invalid from: ", pattern)
+				}
+			}
+			if pattern != "" {
+				k.from = append(k.from, pattern)
+			}
+		}
+	case "expiry-time":
+		expiryTime, err := parseExpiryTime(value)
+		if err != nil {
+			return err
+		}
+		k.expiryTime = expiryTime
+	case "no-pty", "no-agent-forwarding", "no-x11-forwarding", "no-user-rc",
+		"pty", "agent-forwarding", "x11-forwarding", "user-rc",
+		"command", "environment", "tunnel", "no-touch-required":
+		// sessions, agent, X11 and tun forwarding are never offered
+	default:
+		return E.New("unsupported option: ", name)
+	}
+	return nil
+}
+
+// parseExpiryTime parses YYYYMMDD[HHMM[SS]] in local time, or UTC with a Z suffix.
+func parseExpiryTime(value string) (time.Time, error) {
+	location := time.Local
+	timeString := value
+	if strings.HasSuffix(timeString, "Z") {
+		location = time.UTC
+		timeString = timeString[:len(timeString)-1]
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(timeString) == len(layout) {
+			expiryTime, err := time.ParseInLocation(layout, timeString, location)
+			if err == nil {
+				return expiryTime, nil
+			}
+		}
+	}
+	return time.Time{}, E.New("invalid expiry-time: ", value)
+}
+
+// allowSource reports whether the from= patterns accept the client address.
+// Like sshd with the default UseDNS no, patterns are matched against the address only.
+func (k *authorizedKey) allowSource(source M.Socksaddr) bool {
+	if len(k.from) == 0 {
+		return true
+	}
+	address := source.Addr.Unmap()
+	addressString := address.String()
+	var matched bool
+	for _, pattern := range k.from {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		var patternMatched bool
+		if strings.Contains(pattern, "/") {
+			patternMatched = netip.MustParsePrefix(pattern).Contains(address)
+		} else {
+			patternMatched = matchWildcard(addressString, strings.ToLower(pattern))
+		}
+		if patternMatched {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// allowDestination reports whether the key may open a direct-tcpip channel to host and port.
+func (k *authorizedKey) allowDestination(host string, port uint32) bool {
+	if k.noPortForwarding {
+		return false
+	}
+	if len(k.permitOpen) == 0 {
+		return true
+	}
+	// permitopen does no pattern matching or name lookup
+	host = strings.ToLower(host)
+	for _, it := range k.permitOpen {
+		if it.host == host && (it.port == 0 || uint32(it.port) == port) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchWildcard(s string, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return len(s) == 0
+}
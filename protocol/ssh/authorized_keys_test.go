@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"testing"
+	"time"
+
+	M "github.com/sagernet/sing/common/metadata"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDDhp8GZOn4Zv5Vf5Gtl5rbfvn8bDQDa2p0v3m+9pWgr test"
+
+func parseTestKey(t *testing.T, options string) *authorizedKey {
+	keys, err := parseAuthorizedKeys([]byte(options + " " + testPublicKey))
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	return keys[0]
+}
+
+func TestAuthorizedKeyPortForwarding(t *testing.T) {
+	t.Parallel()
+	key := parseTestKey(t, "no-pty")
+	require.True(t, key.allowDestination("example.org", 443))
+
+	key = parseTestKey(t, "restrict")
+	require.False(t, key.allowDestination("example.org", 443))
+	key = parseTestKey(t, "no-port-forwarding")
+	require.False(t, key.allowDestination("example.org", 443))
+	key = parseTestKey(t, "restrict,port-forwarding")
+	require.True(t, key.allowDestination("example.org", 443))
+
+	key = parseTestKey(t, `permitopen="Example.org:443",permitopen="[::1]:*"`)
+	require.True(t, key.allowDestination("example.org", 443))
+	require.False(t, key.allowDestination("example.org", 80))
+	require.False(t, key.allowDestination("www.example.org", 443))
+	require.True(t, key.allowDestination("::1", 22))
+}
+
+func TestAuthorizedKeyFrom(t *testing.T) {
+	t.Parallel()
+	key := parseTestKey(t, `from="10.0.0.0/8,192.168.1.?,!10.0.0.1"`)
+	require.True(t, key.allowSource(M.ParseSocksaddr("10.1.2.3:22")))
+	require.True(t, key.allowSource(M.ParseSocksaddr("192.168.1.5:22")))
+	require.False(t, key.allowSource(M.ParseSocksaddr("192.168.1.50:22")))
+	require.False(t, key.allowSource(M.ParseSocksaddr("10.0.0.1:22")))
+	require.False(t, key.allowSource(M.ParseSocksaddr("[::ffff:172.16.0.1]:22")))
+	require.True(t, key.allowSource(M.ParseSocksaddr("[::ffff:10.0.0.2]:22")))
+}
+
+func TestAuthorizedKeyExpiryTime(t *testing.T) {
+	t.Parallel()
+	key := parseTestKey(t, `expiry-time="20200102Z"`)
+	require.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), key.expiryTime)
+	key = parseTestKey(t, `expiry-time="202001021504"`)
+	require.Equal(t, time.Date(2020, 1, 2, 15, 4, 0, 0, time.Local), key.expiryTime)
+}
+
+func TestAuthorizedKeyUnsupportedOption(t *testing.T) {
+	t.Parallel()
+	for _, options := range []string{"cert-authority", `principals="user"`, "verify-required", `permitopen="example.org"`, `from="10.0.0.0/33"`} {
+		_, err := parseAuthorizedKeys([]byte(options + " " + testPublicKey))
+		require.Error(t, err, options)
+	}
+}
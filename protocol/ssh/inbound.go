@@ -0,0 +1,307 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/inbound"
+	"github.com/sagernet/sing-box/common/listener"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func RegisterInbound(registry *inbound.Registry) {
+	inbound.Register[option.SSHInboundOptions](registry, C.TypeSSH, NewInbound)
+}
+
+type Inbound struct {
+	inbound.Adapter
+	ctx            context.Context
+	router         adapter.ConnectionRouterEx
+	logger         logger.ContextLogger
+	listener       *listener.Listener
+	config         *ssh.ServerConfig
+	passwords      map[string]string
+	authorizedKeys map[string][]*authorizedKey
+}
+
+func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.SSHInboundOptions) (adapter.Inbound, error) {
+	if len(options.Users) == 0 {
+		return nil, E.New("missing users")
+	}
+	inbound := &Inbound{
+		Adapter:        inbound.NewAdapter(C.TypeSSH, tag),
+		ctx:            ctx,
+		router:         router,
+		logger:         logger,
+		passwords:      make(map[string]string),
+		authorizedKeys: make(map[string][]*authorizedKey),
+	}
+	for index, user := range options.Users {
+		if user.Name == "" {
+			return nil, E.New("parse user[", index, "]: missing name")
+		}
+		if user.Password == "" && len(user.AuthorizedKeys) == 0 && user.AuthorizedKeysPath == "" {
+			return nil, E.New("parse user[", index, "]: missing password or authorized keys")
+		}
+		if user.Password != "" {
+			inbound.passwords[user.Name] = user.Password
+		}
+		var authorizedKeys []byte
+		if len(user.AuthorizedKeys) > 0 {
+			authorizedKeys = []byte(strings.Join(user.AuthorizedKeys, "\n"))
+		}
+		if user.AuthorizedKeysPath != "" {
+			content, err := os.ReadFile(os.ExpandEnv(user.AuthorizedKeysPath))
+			if err != nil {
+				return nil, E.Cause(err, "parse user[", index, "]: read authorized keys")
+			}
+			authorizedKeys = append(append(authorizedKeys, '\n'), content...)
+		}
+		userKeys, err := parseAuthorizedKeys(authorizedKeys)
+		if err != nil {
+			return nil, E.Cause(err, "parse user[", index, "]: parse authorized keys")
+		}
+		if len(userKeys) > 0 {
+			inbound.authorizedKeys[user.Name] = append(inbound.authorizedKeys[user.Name], userKeys...)
+		}
+	}
+	hostKey, err := loadHostKey(options)
+	if err != nil {
+		return nil, err
+	}
+	if hostKey == nil {
+		logger.Warn("host key not configured, using a temporary key")
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, E.Cause(err, "generate host key")
+		}
+		hostKey, err = ssh.NewSignerFromKey(privateKey)
+		if err != nil {
+			return nil, E.Cause(err, "generate host key")
+		}
+	}
+	config := &ssh.ServerConfig{
+		ServerVersion: options.ServerVersion,
+	}
+	if config.ServerVersion == "" {
+		config.ServerVersion = randomVersion()
+	}
+	if len(inbound.passwords) > 0 {
+		config.PasswordCallback = inbound.passwordCallback
+	}
+	if len(inbound.authorizedKeys) > 0 {
+		config.PublicKeyCallback = inbound.publicKeyCallback
+	}
+	if len(options.Cipher) > 0 {
+		config.Ciphers = options.Cipher
+	}
+	if len(options.MAC) > 0 {
+		config.MACs = options.MAC
+	}
+	if len(options.KexAlgorithm) > 0 {
+		config.KeyExchanges = options.KexAlgorithm
+	}
+	config.AddHostKey(hostKey)
+	inbound.config = config
+	inbound.listener = listener.New(listener.Options{
+		Context:           ctx,
+		Logger:            logger,
+		Network:           []string{N.NetworkTCP},
+		Listen:            options.ListenOptions,
+		ConnectionHandler: inbound,
+	})
+	return inbound, nil
+}
+
+func loadHostKey(options option.SSHInboundOptions) (ssh.Signer, error) {
+	var hostKey []byte
+	if len(options.HostKey) > 0 {
+		hostKey = []byte(strings.Join(options.HostKey, "\n"))
+	} else if options.HostKeyPath != "" {
+		var err error
+		hostKey, err = os.ReadFile(os.ExpandEnv(options.HostKeyPath))
+		if err != nil {
+			return nil, E.Cause(err, "read host key")
+		}
+	} else {
+		return nil, nil
+	}
+	signer, err := ssh.ParsePrivateKey(hostKey)
+	if err != nil {
+		return nil, E.Cause(err, "parse host key")
+	}
+	return signer, nil
+}
+
+func (h *Inbound) passwordCallback(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	expected, loaded := h.passwords[conn.User()]
+	if !loaded || subtle.ConstantTimeCompare([]byte(expected), password) != 1 {
+		return nil, E.New("password rejected for ", conn.User())
+	}
+	return nil, nil
+}
+
+func (h *Inbound) publicKeyCallback(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	publicKey := key.Marshal()
+	for _, authorizedKey := range h.authorizedKeys[conn.User()] {
+		if !bytes.Equal(authorizedKey.publicKey, publicKey) {
+			continue
+		}
+		// the first matching line applies, as in sshd
+		if !authorizedKey.expiryTime.IsZero() && time.Now().After(authorizedKey.expiryTime) {
+			return nil, E.New("public key expired for ", conn.User())
+		}
+		if !authorizedKey.allowSource(M.SocksaddrFromNet(conn.RemoteAddr())) {
+			return nil, E.New("public key not allowed from ", conn.RemoteAddr(), " for ", conn.User())
+		}
+		return &ssh.Permissions{
+			ExtraData: map[any]any{authorizedKeyExtraDataKey{}: authorizedKey},
+		}, nil
+	}
+	return nil, E.New("unknown public key for ", conn.User())
+}
+
+func (h *Inbound) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	return h.listener.Start()
+}
+
+func (h *Inbound) Close() error {
+	return h.listener.Close()
+}
+
+func (h *Inbound) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	conn.SetDeadline(time.Now().Add(C.TCPTimeout))
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, h.config)
+	if err != nil {
+		N.CloseOnHandshakeFailure(conn, onClose, err)
+		h.logger.ErrorContext(ctx, E.Cause(err, "process connection from ", metadata.Source))
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(requests)
+	var channelGroup sync.WaitGroup
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type: "+newChannel.ChannelType())
+			continue
+		}
+		channelGroup.Add(1)
+		go h.newChannel(ctx, serverConn, newChannel, metadata, N.OnceClose(func(it error) {
+			channelGroup.Done()
+		}))
+	}
+	serverConn.Close()
+	channelGroup.Wait()
+	if onClose != nil {
+		onClose(nil)
+	}
+}
+
+// RFC 4254 7.2
+type directTCPIPRequest struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+func (h *Inbound) newChannel(ctx context.Context, serverConn *ssh.ServerConn, newChannel ssh.NewChannel, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	var request directTCPIPRequest
+	err := ssh.Unmarshal(newChannel.ExtraData(), &request)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		h.logger.ErrorContext(ctx, E.Cause(err, "process channel from ", metadata.Source))
+		onClose(err)
+		return
+	}
+	destination := M.ParseSocksaddrHostPort(request.Host, uint16(request.Port))
+	if !destination.IsValid() || request.Port > 65535 {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid destination")
+		h.logger.ErrorContext(ctx, "process channel from ", metadata.Source, ": invalid destination ", request.Host, ":", request.Port)
+		onClose(os.ErrInvalid)
+		return
+	}
+	if serverConn.Permissions != nil {
+		authorizedKey, loaded := serverConn.Permissions.ExtraData[authorizedKeyExtraDataKey{}].(*authorizedKey)
+		if loaded && !authorizedKey.allowDestination(request.Host, request.Port) {
+			newChannel.Reject(ssh.Prohibited, "port forwarding not permitted")
+			h.logger.ErrorContext(ctx, "process channel from ", metadata.Source, ": [", serverConn.User(), "] port forwarding to ", destination, " not permitted by authorized key options")
+			onClose(os.ErrPermission)
+			return
+		}
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		h.logger.ErrorContext(ctx, E.Cause(err, "accept channel from ", metadata.Source))
+		onClose(err)
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	metadata.Inbound = h.Tag()
+	metadata.InboundType = h.Type()
+	//nolint:staticcheck
+	metadata.InboundDetour = h.listener.ListenOptions().Detour
+	metadata.User = serverConn.User()
+	metadata.Destination = destination
+	ctx = log.ContextWithNewID(ctx)
+	h.logger.InfoContext(ctx, "[", metadata.User, "] inbound connection to ", metadata.Destination)
+	h.router.RouteConnectionEx(ctx, &channelConn{
+		Channel:    channel,
+		localAddr:  serverConn.LocalAddr(),
+		remoteAddr: serverConn.RemoteAddr(),
+	}, metadata, onClose)
+}
+
+type channelConn struct {
+	ssh.Channel
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+func (c *channelConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *channelConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *channelConn) SetDeadline(t time.Time) error {
+	return os.ErrInvalid
+}
+
+func (c *channelConn) SetReadDeadline(t time.Time) error {
+	return os.ErrInvalid
+}
+
+func (c *channelConn) SetWriteDeadline(t time.Time) error {
+	return os.ErrInvalid
+}
+
+func (c *channelConn) NeedAdditionalReadDeadline() bool {
+	return true
+}
+
+func (c *channelConn) Upstream() any {
+	return c.Channel
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/adapter/endpoint"
 	"github.com/sagernet/sing-box/common/dialer"
+	"github.com/sagernet/sing-box/common/portmapping"
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/experimental/deprecated"
 	"github.com/sagernet/sing-box/log"
@@ -103,6 +104,8 @@ type Endpoint struct {
 	advertiseTags              []string
 	relayServerPort            *uint16
 	relayServerStaticEndpoints []netip.AddrPort
+	portMapper                 *portmapping.Mapper
+	serveHandlers              []*serveHandler
 
 	udpTimeout time.Duration
 
@@ -246,6 +249,32 @@ func NewEndpoint(ctx context.Context, router adapter.Router, logger log.ContextL
 		DNS:        &dnsConfigurtor{},
 		HTTPClient: controlHTTPClient,
 	}
+	var portMapper *portmapping.Mapper
+	if options.PortMapping != nil && options.PortMapping.Enabled {
+		if options.RelayServerPort == nil || *options.RelayServerPort == 0 {
+			return nil, E.New("`port_mapping` requires `relay_server_port`")
+		}
+		portMapper, err = portmapping.New(ctx, logger, N.NetworkUDP, netip.AddrPortFrom(netip.IPv4Unspecified(), *options.RelayServerPort), *options.PortMapping)
+		if err != nil {
+			return nil, E.Cause(err, "initialize port mapping")
+		}
+	}
+	if len(options.Serve) > 0 && options.SystemInterface {
+		return nil, E.New("`serve` is not supported with `system_interface`")
+	}
+	var serveHandlers []*serveHandler
+	servePorts := make(map[uint16]bool)
+	for i, serveOptions := range options.Serve {
+		if servePorts[serveOptions.Port] {
+			return nil, E.New("duplicate serve port: ", serveOptions.Port)
+		}
+		servePorts[serveOptions.Port] = true
+		handler, err := newServeHandler(ctx, router, logger, tag, serveOptions)
+		if err != nil {
+			return nil, E.Cause(err, "parse serve[", i, "]")
+		}
+		serveHandlers = append(serveHandlers, handler)
+	}
 	return &Endpoint{
 		Adapter:                    endpoint.NewAdapterWithDialerOptions(C.TypeTailscale, tag, []string{N.NetworkTCP, N.NetworkUDP, N.NetworkICMP}, controlHTTPClientOptions.DialerOptions),
 		ctx:                        ctx,
@@ -263,6 +292,8 @@ func NewEndpoint(ctx context.Context, router adapter.Router, logger log.ContextL
 		advertiseTags:              options.AdvertiseTags,
 		relayServerPort:            options.RelayServerPort,
 		relayServerStaticEndpoints: options.RelayServerStaticEndpoints,
+		portMapper:                 portMapper,
+		serveHandlers:              serveHandlers,
 		udpTimeout:                 udpTimeout,
 		systemInterface:            options.SystemInterface,
 		systemInterfaceName:        options.SystemInterfaceName,
@@ -429,7 +460,16 @@ func (t *Endpoint) postStart() error {
 		return E.Cause(err, "update prefs")
 	}
 	t.filter = localBackend.ExportFilter()
+	for _, handler := range t.serveHandlers {
+		err = handler.start(t.server)
+		if err != nil {
+			return err
+		}
+	}
 	go t.watchState()
+	if t.portMapper != nil {
+		t.portMapper.Start()
+	}
 	t.started.Store(true)
 	return nil
 }
@@ -495,8 +535,14 @@ func (t *Endpoint) watchState() {
 func (t *Endpoint) Close() error {
 	var err error
 	t.started.Store(false)
+	if t.portMapper != nil {
+		err = t.portMapper.Close()
+	}
+	for _, handler := range t.serveHandlers {
+		err = E.Errors(err, handler.Close())
+	}
 	if t.serverStarted {
-		err = common.Close(common.PtrOrNil(t.server))
+		err = E.Errors(err, common.Close(common.PtrOrNil(t.server)))
 		t.serverStarted = false
 	}
 	netmon.RegisterInterfaceGetter(nil)
@@ -0,0 +1,280 @@
+//go:build with_gvisor
+
+package tailscale
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/pipe"
+	"github.com/sagernet/tailscale/tsnet"
+)
+
+// serveHandler publishes a tailnet port, connections to the destination are
+// routed like other connections of the endpoint.
+type serveHandler struct {
+	ctx         context.Context
+	router      adapter.ConnectionRouterEx
+	logger      logger.ContextLogger
+	tag         string
+	port        uint16
+	tls         bool
+	funnel      bool
+	destination M.Socksaddr
+	httpHandler http.Handler
+
+	access     sync.Mutex
+	closed     bool
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+func newServeHandler(ctx context.Context, router adapter.ConnectionRouterEx, logger logger.ContextLogger, tag string, options option.TailscaleServeOptions) (*serveHandler, error) {
+	if options.Port == 0 {
+		return nil, E.New("missing port")
+	}
+	handler := &serveHandler{
+		ctx:    ctx,
+		router: router,
+		logger: logger,
+		tag:    tag,
+		port:   options.Port,
+		tls:    options.TLS || options.Funnel,
+		funnel: options.Funnel,
+	}
+	var routes serveHTTPRoutes
+	if len(options.HTTP) > 0 {
+		if options.Server != "" {
+			return nil, E.New("`server` and `http` are mutually exclusive")
+		}
+		for _, routeOptions := range options.HTTP {
+			path := routeOptions.Path
+			if path == "" {
+				path = "/"
+			} else if !strings.HasPrefix(path, "/") {
+				return nil, E.New("invalid HTTP path: ", path)
+			}
+			targetURL, err := url.Parse(routeOptions.URL)
+			if err != nil {
+				return nil, E.Cause(err, "parse HTTP URL")
+			}
+			if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+				return nil, E.New("unsupported HTTP URL scheme: ", targetURL.Scheme)
+			}
+			routes = append(routes, serveHTTPRoute{
+				path:        path,
+				target:      targetURL,
+				rewriteHost: routeOptions.RewriteHost,
+			})
+		}
+	} else {
+		handler.destination = options.ServerOptions.Build()
+		if !handler.destination.IsValid() {
+			return nil, E.New("missing server")
+		}
+	}
+	if len(routes) > 0 {
+		sort.SliceStable(routes, func(i, j int) bool {
+			return len(routes[i].path) > len(routes[j].path)
+		})
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return handler.routeConnection(log.ContextWithNewID(ctx), M.Socksaddr{}, M.ParseSocksaddr(address)), nil
+			},
+			ForceAttemptHTTP2: true,
+		}
+		for i := range routes {
+			route := &routes[i]
+			route.proxy = &httputil.ReverseProxy{
+				Rewrite: func(r *httputil.ProxyRequest) {
+					r.SetURL(route.target)
+					if !route.rewriteHost {
+						r.Out.Host = r.In.Host
+					}
+					r.SetXForwarded()
+				},
+				Transport: transport,
+				ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+					logger.ErrorContext(r.Context(), E.Cause(err, "proxy HTTP request to ", route.target))
+					w.WriteHeader(http.StatusBadGateway)
+				},
+			}
+		}
+		handler.httpHandler = routes
+	}
+	return handler, nil
+}
+
+func (h *serveHandler) start(server *tsnet.Server) error {
+	address := ":" + strconv.Itoa(int(h.port))
+	if h.funnel {
+		// ListenFunnel blocks until the node is logged in and running.
+		go func() {
+			listener, err := server.ListenFunnel("tcp", address)
+			if err != nil {
+				h.logger.Error(E.Cause(err, "listen funnel on port ", h.port))
+				return
+			}
+			h.serve(listener)
+		}()
+		return nil
+	}
+	listener, err := server.Listen("tcp", address)
+	if err != nil {
+		return E.Cause(err, "listen serve on port ", h.port)
+	}
+	if h.tls {
+		localClient, err := server.LocalClient()
+		if err != nil {
+			listener.Close()
+			return E.Cause(err, "initialize tailscale local client")
+		}
+		listener = tls.NewListener(listener, &tls.Config{
+			GetCertificate: localClient.GetCertificate,
+		})
+	}
+	h.serve(listener)
+	return nil
+}
+
+func (h *serveHandler) serve(listener net.Listener) {
+	h.access.Lock()
+	defer h.access.Unlock()
+	if h.closed {
+		listener.Close()
+		return
+	}
+	h.listener = listener
+	if h.httpHandler != nil {
+		h.httpServer = &http.Server{
+			Handler: h.httpHandler,
+			BaseContext: func(net.Listener) context.Context {
+				return h.ctx
+			},
+			ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+				return log.ContextWithNewID(ctx)
+			},
+		}
+		go func() {
+			err := h.httpServer.Serve(listener)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) && !E.IsClosedOrCanceled(err) {
+				h.logger.Error(E.Cause(err, "serve HTTP on port ", h.port))
+			}
+		}()
+	} else {
+		go h.loopTCP(listener)
+	}
+	h.logger.Info("serving on tailnet port ", h.port)
+}
+
+func (h *serveHandler) loopTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !E.IsClosedOrCanceled(err) {
+				h.logger.Error(E.Cause(err, "accept serve connection on port ", h.port))
+			}
+			return
+		}
+		go h.newConnection(conn)
+	}
+}
+
+func (h *serveHandler) newConnection(conn net.Conn) {
+	ctx := log.ContextWithNewID(h.ctx)
+	source := M.SocksaddrFromNet(conn.RemoteAddr()).Unwrap()
+	h.logger.InfoContext(ctx, "inbound serve connection from ", source, " on port ", h.port)
+	h.router.RouteConnectionEx(ctx, conn, h.newMetadata(source, h.destination), func(it error) {})
+}
+
+// routeConnection returns one end of a pipe whose other end is routed to destination.
+func (h *serveHandler) routeConnection(ctx context.Context, source M.Socksaddr, destination M.Socksaddr) net.Conn {
+	input, output := pipe.Pipe()
+	go h.router.RouteConnectionEx(ctx, output, h.newMetadata(source, destination), N.OnceClose(func(it error) {
+		input.Close()
+	}))
+	return input
+}
+
+func (h *serveHandler) newMetadata(source M.Socksaddr, destination M.Socksaddr) adapter.InboundContext {
+	return adapter.InboundContext{
+		Inbound:     h.tag,
+		InboundType: C.TypeTailscale,
+		Network:     N.NetworkTCP,
+		Source:      source,
+		Destination: destination,
+	}
+}
+
+func (h *serveHandler) Close() error {
+	h.access.Lock()
+	defer h.access.Unlock()
+	h.closed = true
+	var err error
+	if h.httpServer != nil {
+		err = h.httpServer.Close()
+	}
+	// the listener may not be tracked by the HTTP server yet
+	listenerErr := common.Close(h.listener)
+	if listenerErr != nil && !E.IsClosed(listenerErr) {
+		err = E.Errors(err, listenerErr)
+	}
+	return err
+}
+
+type serveHTTPRoute struct {
+	path        string
+	target      *url.URL
+	rewriteHost bool
+	proxy       *httputil.ReverseProxy
+}
+
+// serveHTTPRoutes is sorted by path length so that the most specific mount point wins.
+type serveHTTPRoutes []serveHTTPRoute
+
+func (r serveHTTPRoutes) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	for _, route := range r {
+		path, matched := stripServePath(route.path, request.URL.Path)
+		if !matched {
+			continue
+		}
+		request = request.Clone(request.Context())
+		request.URL.Path = path
+		request.URL.RawPath = ""
+		route.proxy.ServeHTTP(w, request)
+		return
+	}
+	http.NotFound(w, request)
+}
+
+func stripServePath(mountPoint string, path string) (string, bool) {
+	mountPoint = strings.TrimSuffix(mountPoint, "/")
+	if mountPoint == "" {
+		return path, true
+	}
+	if path == mountPoint {
+		return "/", true
+	}
+	if strings.HasPrefix(path, mountPoint+"/") {
+		return path[len(mountPoint):], true
+	}
+	return "", false
+}
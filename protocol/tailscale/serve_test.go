@@ -0,0 +1,137 @@
+//go:build with_gvisor
+
+package tailscale
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/bufio"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRouter struct {
+	metadata chan adapter.InboundContext
+}
+
+func (r *testRouter) RouteConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext) error {
+	return nil
+}
+
+func (r *testRouter) RoutePacketConnection(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext) error {
+	return nil
+}
+
+func (r *testRouter) RouteConnectionEx(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	r.metadata <- metadata
+	remoteConn, err := net.Dial("tcp", metadata.Destination.String())
+	if err != nil {
+		N.CloseOnHandshakeFailure(conn, onClose, err)
+		return
+	}
+	err = bufio.CopyConn(ctx, conn, remoteConn)
+	onClose(err)
+}
+
+func (r *testRouter) RoutePacketConnectionEx(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	onClose(net.ErrClosed)
+}
+
+func startTestServe(t *testing.T, options option.TailscaleServeOptions) (*testRouter, string) {
+	router := &testRouter{metadata: make(chan adapter.InboundContext, 1)}
+	options.Port = 80
+	handler, err := newServeHandler(context.Background(), router, log.NewNOPFactory().NewLogger("serve"), "ts-ep", options)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	handler.serve(listener)
+	t.Cleanup(func() { handler.Close() })
+	return router, listener.Addr().String()
+}
+
+func TestServeTCP(t *testing.T) {
+	t.Parallel()
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer upstream.Close()
+	go func() {
+		conn, aErr := upstream.Accept()
+		if aErr != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	upstreamAddr := upstream.Addr().(*net.TCPAddr)
+	router, address := startTestServe(t, option.TailscaleServeOptions{
+		ServerOptions: option.ServerOptions{
+			Server:     "127.0.0.1",
+			ServerPort: uint16(upstreamAddr.Port),
+		},
+	})
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	response := make([]byte, 4)
+	_, err = io.ReadFull(conn, response)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(response))
+
+	metadata := <-router.metadata
+	require.Equal(t, "ts-ep", metadata.Inbound)
+	require.Equal(t, C.TypeTailscale, metadata.InboundType)
+	require.Equal(t, upstreamAddr.String(), metadata.Destination.String())
+	require.Equal(t, conn.LocalAddr().String(), metadata.Source.String())
+}
+
+func TestServeHTTPPath(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.Path))
+	}))
+	defer upstream.Close()
+	router, address := startTestServe(t, option.TailscaleServeOptions{
+		HTTP: []option.TailscaleServeHTTPOptions{
+			{Path: "/api", URL: upstream.URL},
+		},
+	})
+	response, err := http.Get("http://" + address + "/api/status")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, address+"/status", string(content))
+	require.Equal(t, "ts-ep", (<-router.metadata).Inbound)
+
+	response, err = http.Get("http://" + address + "/other")
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestServeCloseBeforeServe(t *testing.T) {
+	t.Parallel()
+	handler, err := newServeHandler(context.Background(), &testRouter{}, log.NewNOPFactory().NewLogger("serve"), "ts-ep", option.TailscaleServeOptions{
+		Port: 80,
+		HTTP: []option.TailscaleServeHTTPOptions{{URL: "http://127.0.0.1"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, handler.Close())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	handler.serve(listener)
+	_, err = listener.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
@@ -3,6 +3,7 @@ package trojan
 import (
 	"context"
 	"net"
+	"net/http"
 	"os"
 
 	"github.com/sagernet/sing-box/adapter"
@@ -27,7 +28,10 @@ func RegisterInbound(registry *inbound.Registry) {
 	inbound.Register[option.TrojanInboundOptions](registry, C.TypeTrojan, NewInbound)
 }
 
-var _ adapter.TCPInjectableInbound = (*Inbound)(nil)
+var (
+	_ adapter.TCPInjectableInbound  = (*Inbound)(nil)
+	_ adapter.HTTPInjectableInbound = (*Inbound)(nil)
+)
 
 type Inbound struct {
 	inbound.Adapter
@@ -164,6 +168,11 @@ func (h *Inbound) Close() error {
 	)
 }
 
+func (h *Inbound) HTTPHandler() http.Handler {
+	handler, _ := h.transport.(http.Handler)
+	return handler
+}
+
 func (h *Inbound) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
 	if h.tlsConfig != nil && h.transport == nil {
 		tlsConn, err := tls.ServerHandshake(ctx, conn, h.tlsConfig)
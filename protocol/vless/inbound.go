@@ -3,6 +3,7 @@ package vless
 import (
 	"context"
 	"net"
+	"net/http"
 	"os"
 
 	"github.com/sagernet/sing-box/adapter"
@@ -31,7 +32,10 @@ func RegisterInbound(registry *inbound.Registry) {
 	inbound.Register[option.VLESSInboundOptions](registry, C.TypeVLESS, NewInbound)
 }
 
-var _ adapter.TCPInjectableInbound = (*Inbound)(nil)
+var (
+	_ adapter.TCPInjectableInbound  = (*Inbound)(nil)
+	_ adapter.HTTPInjectableInbound = (*Inbound)(nil)
+)
 
 type Inbound struct {
 	inbound.Adapter
@@ -46,6 +50,24 @@ type Inbound struct {
 }
 
 func NewInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.VLESSInboundOptions) (adapter.Inbound, error) {
+	for _, user := range options.Users {
+		switch user.Flow {
+		case "":
+		case vless.FlowVision:
+			if options.TLS == nil || !options.TLS.Enabled {
+				return nil, E.New(vless.FlowVision, " flow requires TLS")
+			}
+			if common.PtrValueOrDefault(options.Transport).Type != "" {
+				return nil, E.New(vless.FlowVision, " flow is not supported with v2ray transport")
+			}
+			// the direct copy reads raw records under the outer TLS layer, which the kernel owns with kTLS
+			if options.TLS.KernelTx || options.TLS.KernelRx {
+				return nil, E.New(vless.FlowVision, " flow is not supported with kTLS")
+			}
+		default:
+			return nil, E.New("unsupported flow: ", user.Flow)
+		}
+	}
 	inbound := &Inbound{
 		Adapter: inbound.NewAdapter(C.TypeVLESS, tag),
 		ctx:     ctx,
@@ -147,6 +169,11 @@ func (h *Inbound) Close() error {
 	)
 }
 
+func (h *Inbound) HTTPHandler() http.Handler {
+	handler, _ := h.transport.(http.Handler)
+	return handler
+}
+
 func (h *Inbound) NewConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
 	if h.tlsConfig != nil && h.transport == nil {
 		tlsConn, err := tls.ServerHandshake(ctx, conn, h.tlsConfig)
@@ -179,7 +206,7 @@ func (h *Inbound) newConnectionEx(ctx context.Context, conn net.Conn, metadata a
 		metadata.User = user
 	}
 	h.logger.InfoContext(ctx, "[", user, "] inbound connection to ", metadata.Destination)
-	h.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+	h.router.RouteConnectionEx(ctx, newVisionConn(conn), metadata, onClose)
 }
 
 func (h *Inbound) newPacketConnectionEx(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
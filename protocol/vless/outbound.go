@@ -42,6 +42,23 @@ type Outbound struct {
 }
 
 func NewOutbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.VLESSOutboundOptions) (adapter.Outbound, error) {
+	if options.Flow == vless.FlowVision {
+		if options.TLS == nil || !options.TLS.Enabled {
+			return nil, E.New(vless.FlowVision, " flow requires TLS")
+		}
+		if common.PtrValueOrDefault(options.Transport).Type != "" {
+			return nil, E.New(vless.FlowVision, " flow is not supported with v2ray transport")
+		}
+		// the direct copy reads raw records under the outer TLS layer, which the kernel owns with kTLS
+		if options.TLS.KernelTx || options.TLS.KernelRx {
+			return nil, E.New(vless.FlowVision, " flow is not supported with kTLS")
+		}
+		switch options.TLS.Engine {
+		case C.TLSEngineDefault, C.TLSEngineGo:
+		default:
+			return nil, E.New(vless.FlowVision, " flow is not supported with TLS engine: ", options.TLS.Engine)
+		}
+	}
 	outboundDialer, err := dialer.New(ctx, options.DialerOptions, options.ServerIsDomain())
 	if err != nil {
 		return nil, err
@@ -161,7 +178,11 @@ func (h *vlessDialer) DialContext(ctx context.Context, network string, destinati
 	switch N.NetworkName(network) {
 	case N.NetworkTCP:
 		h.logger.InfoContext(ctx, "outbound connection to ", destination)
-		return h.client.DialEarlyConn(conn, destination)
+		protocolConn, err := h.client.DialEarlyConn(conn, destination)
+		if err != nil {
+			return nil, err
+		}
+		return newVisionConn(protocolConn), nil
 	case N.NetworkUDP:
 		h.logger.InfoContext(ctx, "outbound packet connection to ", destination)
 		if h.xudp {
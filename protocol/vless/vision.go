@@ -0,0 +1,85 @@
+package vless
+
+import (
+	"net"
+	"reflect"
+	"unsafe"
+
+	"github.com/sagernet/sing-vmess/vless"
+	"github.com/sagernet/sing/common/buf"
+	N "github.com/sagernet/sing/common/network"
+)
+
+var (
+	_ N.EarlyReader        = (*visionConn)(nil)
+	_ N.EarlyWriter        = (*visionConn)(nil)
+	_ N.ReaderWithUpstream = (*visionConn)(nil)
+	_ N.WriterWithUpstream = (*visionConn)(nil)
+	_ N.WithUpstreamReader = (*visionConn)(nil)
+	_ N.WithUpstreamWriter = (*visionConn)(nil)
+)
+
+// visionConn hands the raw connection to the copy loop once Vision has switched
+// a direction to direct copy, so that it can be spliced like in Xray.
+//
+// The switch is done inside sing-vmess, so its state is read from the unexported
+// fields of the Vision conn. The fields are only touched by the goroutine that
+// reads or writes the direction they belong to.
+type visionConn struct {
+	*vless.VisionConn
+	netConn          net.Conn
+	directRead       *bool
+	directWrite      *bool
+	remainingBuffers *[]*buf.Buffer
+}
+
+func newVisionConn(conn net.Conn) net.Conn {
+	vision, isVision := conn.(*vless.VisionConn)
+	if !isVision {
+		return conn
+	}
+	value := reflect.ValueOf(vision).Elem()
+	netConn := value.FieldByName("netConn")
+	directRead := value.FieldByName("directRead")
+	directWrite := value.FieldByName("directWrite")
+	remainingBuffers := value.FieldByName("remainingBuffers")
+	if !netConn.IsValid() || netConn.Type() != reflect.TypeFor[net.Conn]() ||
+		!directRead.IsValid() || directRead.Kind() != reflect.Bool ||
+		!directWrite.IsValid() || directWrite.Kind() != reflect.Bool ||
+		!remainingBuffers.IsValid() || remainingBuffers.Type() != reflect.TypeFor[[]*buf.Buffer]() {
+		// unknown sing-vmess layout, keep copying in user space
+		return conn
+	}
+	return &visionConn{
+		VisionConn:       vision,
+		netConn:          *(*net.Conn)(unsafe.Pointer(netConn.UnsafeAddr())),
+		directRead:       (*bool)(unsafe.Pointer(directRead.UnsafeAddr())),
+		directWrite:      (*bool)(unsafe.Pointer(directWrite.UnsafeAddr())),
+		remainingBuffers: (*[]*buf.Buffer)(unsafe.Pointer(remainingBuffers.UnsafeAddr())),
+	}
+}
+
+func (c *visionConn) NeedHandshakeForRead() bool {
+	// data drained from the TLS conn at the switch is still returned by Read
+	return !*c.directRead || len(*c.remainingBuffers) > 0
+}
+
+func (c *visionConn) NeedHandshakeForWrite() bool {
+	return !*c.directWrite
+}
+
+func (c *visionConn) ReaderReplaceable() bool {
+	return !c.NeedHandshakeForRead()
+}
+
+func (c *visionConn) WriterReplaceable() bool {
+	return !c.NeedHandshakeForWrite()
+}
+
+func (c *visionConn) UpstreamReader() any {
+	return c.netConn
+}
+
+func (c *visionConn) UpstreamWriter() any {
+	return c.netConn
+}
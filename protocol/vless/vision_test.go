@@ -0,0 +1,35 @@
+package vless
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/sagernet/sing-vmess/vless"
+	"github.com/sagernet/sing/common/logger"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisionConnLayout(t *testing.T) {
+	t.Parallel()
+	rawConn, peerConn := net.Pipe()
+	defer rawConn.Close()
+	defer peerConn.Close()
+	tlsConn := tls.Client(rawConn, &tls.Config{})
+	vision, err := vless.NewVisionConn(tlsConn, tlsConn, [16]byte{}, logger.NOP())
+	require.NoError(t, err)
+	conn, isVisionConn := newVisionConn(vision).(*visionConn)
+	require.True(t, isVisionConn, "sing-vmess Vision conn layout changed")
+	require.Equal(t, rawConn, conn.netConn)
+	require.True(t, N.NeedHandshakeForRead(conn))
+	require.True(t, N.NeedHandshakeForWrite(conn))
+	require.Equal(t, N.UnwrapReader(conn), conn)
+	*conn.directRead = true
+	*conn.directWrite = true
+	require.False(t, N.NeedHandshakeForRead(conn))
+	require.False(t, N.NeedHandshakeForWrite(conn))
+	require.Equal(t, rawConn, N.UnwrapReader(conn))
+	require.Equal(t, rawConn, N.UnwrapWriter(conn))
+}
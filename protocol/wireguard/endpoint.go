@@ -10,6 +10,7 @@ import (
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/adapter/endpoint"
 	"github.com/sagernet/sing-box/common/dialer"
+	"github.com/sagernet/sing-box/common/portmapping"
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/log"
 	"github.com/sagernet/sing-box/option"
@@ -42,6 +43,7 @@ type Endpoint struct {
 	logger         logger.ContextLogger
 	localAddresses []netip.Prefix
 	endpoint       *wireguard.Endpoint
+	portMapper     *portmapping.Mapper
 	started        atomic.Bool
 }
 
@@ -57,6 +59,16 @@ func NewEndpoint(ctx context.Context, router adapter.Router, logger log.ContextL
 	if options.Detour != "" && options.ListenPort != 0 {
 		return nil, E.New("`listen_port` is conflict with `detour`")
 	}
+	if options.PortMapping != nil && options.PortMapping.Enabled {
+		if options.ListenPort == 0 {
+			return nil, E.New("`port_mapping` requires `listen_port`")
+		}
+		portMapper, err := portmapping.New(ctx, logger, N.NetworkUDP, netip.AddrPortFrom(netip.IPv4Unspecified(), options.ListenPort), *options.PortMapping)
+		if err != nil {
+			return nil, E.Cause(err, "initialize port mapping")
+		}
+		ep.portMapper = portMapper
+	}
 	outboundDialer, err := dialer.NewWithOptions(dialer.Options{
 		Context: ctx,
 		Options: options.DialerOptions,
@@ -106,9 +118,11 @@ func NewEndpoint(ctx context.Context, router adapter.Router, logger log.ContextL
 				AllowedIPs:                  it.AllowedIPs,
 				PersistentKeepaliveInterval: it.PersistentKeepaliveInterval,
 				Reserved:                    it.Reserved,
+				Amnezia:                     newAmneziaOptions(it.Amnezia),
 			}
 		}),
 		Workers: options.Workers,
+		Amnezia: newAmneziaOptions(options.Amnezia),
 	})
 	if err != nil {
 		return nil, err
@@ -117,6 +131,23 @@ func NewEndpoint(ctx context.Context, router adapter.Router, logger log.ContextL
 	return ep, nil
 }
 
+func newAmneziaOptions(options *option.WireGuardAmneziaOptions) *wireguard.AmneziaOptions {
+	if options == nil {
+		return nil
+	}
+	return &wireguard.AmneziaOptions{
+		JunkPacketCount:              options.JunkPacketCount,
+		JunkPacketMinSize:            options.JunkPacketMinSize,
+		JunkPacketMaxSize:            options.JunkPacketMaxSize,
+		InitPacketJunkSize:           options.InitPacketJunkSize,
+		ResponsePacketJunkSize:       options.ResponsePacketJunkSize,
+		InitPacketMagicHeader:        options.InitPacketMagicHeader,
+		ResponsePacketMagicHeader:    options.ResponsePacketMagicHeader,
+		CookieReplyPacketMagicHeader: options.CookieReplyPacketMagicHeader,
+		TransportPacketMagicHeader:   options.TransportPacketMagicHeader,
+	}
+}
+
 func (w *Endpoint) Start(stage adapter.StartStage) error {
 	switch stage {
 	case adapter.StartStateStart:
@@ -126,6 +157,9 @@ func (w *Endpoint) Start(stage adapter.StartStage) error {
 		if err != nil {
 			return err
 		}
+		if w.portMapper != nil {
+			w.portMapper.Start()
+		}
 		w.started.Store(true)
 	}
 	return nil
@@ -133,7 +167,11 @@ func (w *Endpoint) Start(stage adapter.StartStage) error {
 
 func (w *Endpoint) Close() error {
 	w.started.Store(false)
-	return w.endpoint.Close()
+	var err error
+	if w.portMapper != nil {
+		err = w.portMapper.Close()
+	}
+	return E.Errors(err, w.endpoint.Close())
 }
 
 func (w *Endpoint) PrepareConnection(network string, source M.Socksaddr, destination M.Socksaddr, routeContext tun.DirectRouteContext, timeout time.Duration) (tun.DirectRouteDestination, error) {
@@ -0,0 +1,131 @@
+package route
+
+import (
+	std_bufio "bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	R "github.com/sagernet/sing-box/route/rule"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/buf"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/x/collections"
+)
+
+func (r *Router) actionHTTPRespond(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, action adapter.RuleAction) error {
+	defer conn.Close()
+	if metadata.Protocol != C.ProtocolHTTP || metadata.HTTPRequest == nil {
+		return E.New(action.Type(), " is only available for sniffed HTTP connections")
+	}
+	response := &http.Response{
+		ProtoMajor: metadata.HTTPRequest.ProtoMajor,
+		ProtoMinor: metadata.HTTPRequest.ProtoMinor,
+		Header:     make(http.Header),
+		Close:      true,
+	}
+	var body string
+	switch action := action.(type) {
+	case *R.RuleActionHTTPReject:
+		response.StatusCode = action.StatusCode
+		body = action.Body
+	case *R.RuleActionHTTPRedirect:
+		response.StatusCode = action.StatusCode
+		response.Header.Set("Location", action.Location)
+	}
+	response.Body = io.NopCloser(strings.NewReader(body))
+	response.ContentLength = int64(len(body))
+	if body != "" {
+		response.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	r.logger.DebugContext(ctx, "respond HTTP ", response.StatusCode, " to ", metadata.HTTPRequest.Method, " ", metadata.HTTPRequest.URL.RequestURI())
+	err := response.Write(conn)
+	if err != nil {
+		return E.Cause(err, "write HTTP response")
+	}
+	return nil
+}
+
+func (r *Router) actionHTTPRewrite(ctx context.Context, metadata *adapter.InboundContext, action *R.RuleActionHTTPRewrite, buffers []*buf.Buffer) []*buf.Buffer {
+	if metadata.Protocol != C.ProtocolHTTP || len(buffers) == 0 {
+		r.logger.DebugContext(ctx, "http-rewrite skipped: not a sniffed HTTP connection")
+		return buffers
+	}
+	content, request, err := rewriteHTTPRequest(bytes.Join(common.Map(buffers, (*buf.Buffer).Bytes), nil), action)
+	if err != nil {
+		r.logger.DebugContext(ctx, "http-rewrite skipped: ", err)
+		return buffers
+	}
+	newBuffer := buf.NewSize(len(content))
+	common.Must1(newBuffer.Write(content))
+	buf.ReleaseMulti(buffers)
+	metadata.HTTPRequest = adapter.NewHTTPRequest(request)
+	return []*buf.Buffer{newBuffer}
+}
+
+// rewriteHTTPRequest edits the raw header lines instead of serializing the parsed request,
+// since net/http drops framing headers such as Transfer-Encoding while parsing.
+func rewriteHTTPRequest(content []byte, action *R.RuleActionHTTPRewrite) ([]byte, *http.Request, error) {
+	reader := std_bufio.NewReaderSize(bytes.NewReader(content), len(content))
+	_, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	headerLength := len(content) - reader.Buffered()
+	replacedHeaders := make(map[string]bool)
+	for _, name := range action.RemoveHeader {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if name == "Host" || isHTTPFramingHeader(name) {
+			continue
+		}
+		replacedHeaders[name] = true
+	}
+	var setHeader []collections.MapEntry[string, string]
+	for _, entry := range action.SetHeader {
+		name := textproto.CanonicalMIMEHeaderKey(entry.Key)
+		if isHTTPFramingHeader(name) {
+			continue
+		}
+		replacedHeaders[name] = true
+		setHeader = append(setHeader, entry)
+	}
+	lines := strings.SplitAfter(string(content[:headerLength]), "\n")
+	var header bytes.Buffer
+	header.WriteString(lines[0])
+	var skipLine bool
+	for _, line := range lines[1:] {
+		if strings.TrimRight(line, "\r\n") == "" {
+			break
+		}
+		// obsolete line folding continues the previous header
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := strings.Cut(line, ":")
+			skipLine = replacedHeaders[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))]
+		}
+		if !skipLine {
+			header.WriteString(line)
+		}
+	}
+	for _, entry := range setHeader {
+		header.WriteString(F.ToString(entry.Key, ": ", entry.Value, "\r\n"))
+	}
+	header.WriteString("\r\n")
+	header.Write(content[headerLength:])
+	request, err := http.ReadRequest(std_bufio.NewReaderSize(bytes.NewReader(header.Bytes()), header.Len()))
+	if err != nil {
+		return nil, nil, E.Cause(err, "parse rewritten request")
+	}
+	return header.Bytes(), request, nil
+}
+
+// isHTTPFramingHeader reports headers that delimit the request body and are never rewritten.
+func isHTTPFramingHeader(name string) bool {
+	return name == "Content-Length" || name == "Transfer-Encoding"
+}
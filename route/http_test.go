@@ -0,0 +1,55 @@
+package route
+
+import (
+	std_bufio "bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	R "github.com/sagernet/sing-box/route/rule"
+	"github.com/sagernet/sing/common/x/collections"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPRewriteChunked(t *testing.T) {
+	t.Parallel()
+	content := "POST /upload HTTP/1.1\r\n" +
+		"Host: example.org\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"X-Forwarded-For: 10.0.0.1\r\n" +
+		"User-Agent: curl/8.0\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+	rewritten, request, err := rewriteHTTPRequest([]byte(content), &R.RuleActionHTTPRewrite{
+		SetHeader: []collections.MapEntry[string, string]{
+			{Key: "user-agent", Value: "sing-box"},
+			{Key: "Transfer-Encoding", Value: "identity"},
+		},
+		RemoveHeader: []string{"x-forwarded-for", "Content-Length"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "sing-box", request.Header.Get("User-Agent"))
+	require.Empty(t, request.Header.Values("X-Forwarded-For"))
+
+	forwarded, err := http.ReadRequest(std_bufio.NewReader(bytes.NewReader(rewritten)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"chunked"}, forwarded.TransferEncoding)
+	require.Equal(t, "example.org", forwarded.Host)
+	body, err := io.ReadAll(forwarded.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(body))
+}
+
+func TestHTTPRewriteHost(t *testing.T) {
+	t.Parallel()
+	content := "GET / HTTP/1.1\r\nHost: example.org\r\nAccept: */*\r\n\r\n"
+	rewritten, request, err := rewriteHTTPRequest([]byte(content), &R.RuleActionHTTPRewrite{
+		SetHeader:    []collections.MapEntry[string, string]{{Key: "Host", Value: "example.com"}},
+		RemoveHeader: []string{"Host"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "example.com", request.Host)
+	require.Equal(t, "GET / HTTP/1.1\r\nAccept: */*\r\nHost: example.com\r\n\r\n", string(rewritten))
+}
@@ -28,6 +28,8 @@ var defaultLeaseFiles = []string{
 	"/var/lib/kea/kea-leases6.csv",
 }
 
+var _ adapter.NeighborLeaseUpdater = (*neighborResolver)(nil)
+
 type neighborResolver struct {
 	logger          logger.ContextLogger
 	leaseFiles      []string
@@ -36,6 +38,7 @@ type neighborResolver struct {
 	leaseIPToMAC    map[netip.Addr]net.HardwareAddr
 	ipToHostname    map[netip.Addr]string
 	macToHostname   map[string]string
+	serviceLeases   map[string][]adapter.NeighborEntry
 	watcher         *fswatch.Watcher
 	done            chan struct{}
 }
@@ -56,6 +59,7 @@ func newNeighborResolver(resolverLogger logger.ContextLogger, leaseFiles []strin
 		leaseIPToMAC:    make(map[netip.Addr]net.HardwareAddr),
 		ipToHostname:    make(map[netip.Addr]string),
 		macToHostname:   make(map[string]string),
+		serviceLeases:   make(map[string][]adapter.NeighborEntry),
 		done:            make(chan struct{}),
 	}, nil
 }
@@ -220,9 +224,29 @@ func (r *neighborResolver) subscribeNeighborUpdates() {
 	}
 }
 
+func (r *neighborResolver) UpdateLeases(source string, entries []adapter.NeighborEntry) {
+	r.access.Lock()
+	if len(entries) == 0 {
+		delete(r.serviceLeases, source)
+	} else {
+		r.serviceLeases[source] = entries
+	}
+	r.access.Unlock()
+	r.doReloadLeaseFiles()
+}
+
 func (r *neighborResolver) doReloadLeaseFiles() {
 	leaseIPToMAC, ipToHostname, macToHostname := ReloadLeaseFiles(r.leaseFiles)
 	r.access.Lock()
+	for _, entries := range r.serviceLeases {
+		for _, entry := range entries {
+			leaseIPToMAC[entry.Address] = entry.MACAddress
+			if entry.Hostname != "" {
+				ipToHostname[entry.Address] = entry.Hostname
+				macToHostname[entry.MACAddress.String()] = entry.Hostname
+			}
+		}
+	}
 	r.leaseIPToMAC = leaseIPToMAC
 	r.ipToHostname = ipToHostname
 	r.macToHostname = macToHostname
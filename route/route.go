@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/pcapng"
 	"github.com/sagernet/sing-box/common/sniff"
 	C "github.com/sagernet/sing-box/constant"
 	R "github.com/sagernet/sing-box/route/rule"
@@ -139,6 +140,10 @@ func (r *Router) routeConnection(ctx context.Context, conn net.Conn, metadata ad
 			}
 			N.CloseOnHandshakeFailure(conn, onClose, r.hijackDNSStream(ctx, conn, metadata))
 			return nil
+		case *R.RuleActionHTTPReject, *R.RuleActionHTTPRedirect:
+			buf.ReleaseMulti(buffers)
+			N.CloseOnHandshakeFailure(conn, onClose, r.actionHTTPRespond(ctx, conn, metadata, action))
+			return nil
 		}
 	}
 	if selectedRule == nil {
@@ -153,6 +158,16 @@ func (r *Router) routeConnection(ctx context.Context, conn net.Conn, metadata ad
 	for _, buffer := range buffers {
 		conn = bufio.NewCachedConn(conn, buffer)
 	}
+	if metadata.Capture != "" {
+		captureConn := pcapng.NewConn(conn, metadata)
+		capturePath, captureErr := captureConn.StartCapture(metadata.Capture)
+		if captureErr != nil {
+			r.logger.ErrorContext(ctx, E.Cause(captureErr, "start capture"))
+		} else {
+			r.logger.DebugContext(ctx, "capture started: ", capturePath)
+			conn = captureConn
+		}
+	}
 	for _, tracker := range r.trackers {
 		conn = tracker.RoutedConnection(ctx, conn, metadata, selectedRule, selectedOutbound)
 	}
@@ -267,6 +282,9 @@ func (r *Router) routePacketConnection(ctx context.Context, conn N.PacketConn, m
 			return action.Error(ctx)
 		case *R.RuleActionHijackDNS:
 			return r.hijackDNSPacket(ctx, conn, packetBuffers, metadata, onClose)
+		case *R.RuleActionHTTPReject, *R.RuleActionHTTPRedirect:
+			N.ReleaseMultiPacketBuffer(packetBuffers)
+			return E.New(action.Type(), " is not supported for UDP connections")
 		}
 	}
 	if selectedRule == nil || selectReturn {
@@ -281,6 +299,16 @@ func (r *Router) routePacketConnection(ctx context.Context, conn N.PacketConn, m
 		conn = bufio.NewCachedPacketConn(conn, buffer.Buffer, buffer.Destination)
 		N.PutPacketBuffer(buffer)
 	}
+	if metadata.Capture != "" {
+		captureConn := pcapng.NewPacketConn(conn, metadata)
+		capturePath, captureErr := captureConn.StartCapture(metadata.Capture)
+		if captureErr != nil {
+			r.logger.ErrorContext(ctx, E.Cause(captureErr, "start capture"))
+		} else {
+			r.logger.DebugContext(ctx, "capture started: ", capturePath)
+			conn = captureConn
+		}
+	}
 	for _, tracker := range r.trackers {
 		conn = tracker.RoutedPacketConnection(ctx, conn, metadata, selectedRule, selectedOutbound)
 	}
@@ -546,6 +574,9 @@ match:
 				metadata.TLSSpoof = routeOptions.TLSSpoof
 				metadata.TLSSpoofMethod = routeOptions.TLSSpoofMethod
 			}
+			if routeOptions.Capture != "" {
+				metadata.Capture = routeOptions.Capture
+			}
 		}
 		switch action := currentRule.Action().(type) {
 		case *R.RuleActionSniff:
@@ -570,11 +601,17 @@ match:
 			if fatalErr != nil {
 				return
 			}
+		case *R.RuleActionHTTPRewrite:
+			if !preMatch && inputConn != nil {
+				buffers = r.actionHTTPRewrite(ctx, metadata, action, buffers)
+			}
 		}
 		actionType := currentRule.Action().Type()
 		if actionType == C.RuleActionTypeRoute ||
 			actionType == C.RuleActionTypeReject ||
-			actionType == C.RuleActionTypeHijackDNS {
+			actionType == C.RuleActionTypeHijackDNS ||
+			actionType == C.RuleActionTypeHTTPReject ||
+			actionType == C.RuleActionTypeHTTPRedirect {
 			selectedRule = currentRule
 			selectedRuleIndex = currentRuleIndex
 			break match
@@ -621,6 +658,8 @@ func (r *Router) actionSniff(
 				sniff.BitTorrent,
 				sniff.SSH,
 				sniff.RDP,
+				sniff.MQTT,
+				sniff.OpenVPN,
 			}
 		}
 		sniffBuffer := buf.NewPacket()
@@ -678,6 +717,8 @@ func (r *Router) actionSniff(
 				sniff.UDPTracker,
 				sniff.DTLSRecord,
 				sniff.NTP,
+				sniff.WireGuard,
+				sniff.OpenVPNPacket,
 			}
 		}
 		var err error
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/netip"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -21,15 +22,22 @@ import (
 	"github.com/sagernet/sing/common/logger"
 	M "github.com/sagernet/sing/common/metadata"
 	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/x/collections"
+	"github.com/sagernet/sing/service/filemanager"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/http/httpguts"
 )
 
-func newRuleActionRouteOptions(options option.RawRouteOptionsActionOptions) (RuleActionRouteOptions, error) {
+func newRuleActionRouteOptions(ctx context.Context, options option.RawRouteOptionsActionOptions) (RuleActionRouteOptions, error) {
 	spoof, spoofMethod, err := tlsspoof.ParseOptions(options.TLSSpoof, options.TLSSpoofMethod)
 	if err != nil {
 		return RuleActionRouteOptions{}, err
 	}
+	var capture string
+	if options.Capture != "" {
+		capture = filemanager.BasePath(ctx, os.ExpandEnv(options.Capture))
+	}
 	return RuleActionRouteOptions{
 		OverrideAddress:           M.ParseSocksaddrHostPort(options.OverrideAddress, 0),
 		OverridePort:              options.OverridePort,
@@ -43,6 +51,7 @@ func newRuleActionRouteOptions(options option.RawRouteOptionsActionOptions) (Rul
 		TLSRecordFragment:         options.TLSRecordFragment,
 		TLSSpoof:                  spoof,
 		TLSSpoofMethod:            spoofMethod,
+		Capture:                   capture,
 	}, nil
 }
 
@@ -51,7 +60,7 @@ func NewRuleAction(ctx context.Context, logger logger.ContextLogger, action opti
 	case "":
 		return nil, nil
 	case C.RuleActionTypeRoute:
-		routeOptions, err := newRuleActionRouteOptions(action.RouteOptions.RawRouteOptionsActionOptions)
+		routeOptions, err := newRuleActionRouteOptions(ctx, action.RouteOptions.RawRouteOptionsActionOptions)
 		if err != nil {
 			return nil, err
 		}
@@ -60,13 +69,13 @@ func NewRuleAction(ctx context.Context, logger logger.ContextLogger, action opti
 			RuleActionRouteOptions: routeOptions,
 		}, nil
 	case C.RuleActionTypeRouteOptions:
-		routeOptions, err := newRuleActionRouteOptions(option.RawRouteOptionsActionOptions(action.RouteOptionsOptions))
+		routeOptions, err := newRuleActionRouteOptions(ctx, option.RawRouteOptionsActionOptions(action.RouteOptionsOptions))
 		if err != nil {
 			return nil, err
 		}
 		return &routeOptions, nil
 	case C.RuleActionTypeBypass:
-		routeOptions, err := newRuleActionRouteOptions(action.BypassOptions.RawRouteOptionsActionOptions)
+		routeOptions, err := newRuleActionRouteOptions(ctx, action.BypassOptions.RawRouteOptionsActionOptions)
 		if err != nil {
 			return nil, err
 		}
@@ -118,6 +127,36 @@ func NewRuleAction(ctx context.Context, logger logger.ContextLogger, action opti
 			RewriteTTL:             action.ResolveOptions.RewriteTTL,
 			ClientSubnet:           action.ResolveOptions.ClientSubnet.Build(netip.Prefix{}),
 		}, nil
+	case C.RuleActionTypeHTTPReject:
+		return &RuleActionHTTPReject{
+			StatusCode: action.HTTPRejectOptions.StatusCode,
+			Body:       action.HTTPRejectOptions.Body,
+		}, nil
+	case C.RuleActionTypeHTTPRedirect:
+		return &RuleActionHTTPRedirect{
+			Location:   action.HTTPRedirectOptions.Location,
+			StatusCode: action.HTTPRedirectOptions.StatusCode,
+		}, nil
+	case C.RuleActionTypeHTTPRewrite:
+		var setHeader []collections.MapEntry[string, string]
+		if action.HTTPRewriteOptions.SetHeader != nil {
+			setHeader = action.HTTPRewriteOptions.SetHeader.Entries()
+		}
+		if len(setHeader) == 0 && len(action.HTTPRewriteOptions.RemoveHeader) == 0 {
+			return nil, E.New("empty http-rewrite action")
+		}
+		for _, entry := range setHeader {
+			if !httpguts.ValidHeaderFieldName(entry.Key) {
+				return nil, E.New("invalid header name: ", entry.Key)
+			}
+			if !httpguts.ValidHeaderFieldValue(entry.Value) {
+				return nil, E.New("invalid value for header ", entry.Key)
+			}
+		}
+		return &RuleActionHTTPRewrite{
+			SetHeader:    setHeader,
+			RemoveHeader: action.HTTPRewriteOptions.RemoveHeader,
+		}, nil
 	default:
 		panic(F.ToString("unknown rule action: ", action.Action))
 	}
@@ -230,6 +269,7 @@ type RuleActionRouteOptions struct {
 	TLSRecordFragment         bool
 	TLSSpoof                  string
 	TLSSpoofMethod            tlsspoof.Method
+	Capture                   string
 }
 
 func (r *RuleActionRouteOptions) Type() string {
@@ -282,6 +322,9 @@ func (r *RuleActionRouteOptions) Descriptions() []string {
 		descriptions = append(descriptions, F.ToString("tls-spoof=", r.TLSSpoof))
 		descriptions = append(descriptions, F.ToString("tls-spoof-method=", r.TLSSpoofMethod.String()))
 	}
+	if r.Capture != "" {
+		descriptions = append(descriptions, "capture")
+	}
 	return descriptions
 }
 
@@ -482,6 +525,52 @@ func (r *RuleActionHijackDNS) String() string {
 	return "hijack-dns"
 }
 
+type RuleActionHTTPReject struct {
+	StatusCode int
+	Body       string
+}
+
+func (r *RuleActionHTTPReject) Type() string {
+	return C.RuleActionTypeHTTPReject
+}
+
+func (r *RuleActionHTTPReject) String() string {
+	return F.ToString("http-reject(", r.StatusCode, ")")
+}
+
+type RuleActionHTTPRedirect struct {
+	Location   string
+	StatusCode int
+}
+
+func (r *RuleActionHTTPRedirect) Type() string {
+	return C.RuleActionTypeHTTPRedirect
+}
+
+func (r *RuleActionHTTPRedirect) String() string {
+	return F.ToString("http-redirect(", r.StatusCode, ",", r.Location, ")")
+}
+
+type RuleActionHTTPRewrite struct {
+	SetHeader    []collections.MapEntry[string, string]
+	RemoveHeader []string
+}
+
+func (r *RuleActionHTTPRewrite) Type() string {
+	return C.RuleActionTypeHTTPRewrite
+}
+
+func (r *RuleActionHTTPRewrite) String() string {
+	var descriptions []string
+	for _, entry := range r.SetHeader {
+		descriptions = append(descriptions, F.ToString("set-header=", entry.Key))
+	}
+	for _, name := range r.RemoveHeader {
+		descriptions = append(descriptions, F.ToString("remove-header=", name))
+	}
+	return F.ToString("http-rewrite(", strings.Join(descriptions, ","), ")")
+}
+
 type RuleActionSniff struct {
 	SnifferNames   []string
 	StreamSniffers []sniff.StreamSniffer
@@ -521,6 +610,21 @@ func (r *RuleActionSniff) build() error {
 			r.StreamSniffers = append(r.StreamSniffers, sniff.RDP)
 		case C.ProtocolNTP:
 			r.PacketSniffers = append(r.PacketSniffers, sniff.NTP)
+		case C.ProtocolWireGuard:
+			r.PacketSniffers = append(r.PacketSniffers, sniff.WireGuard)
+		case C.ProtocolOpenVPN:
+			r.StreamSniffers = append(r.StreamSniffers, sniff.OpenVPN)
+			r.PacketSniffers = append(r.PacketSniffers, sniff.OpenVPNPacket)
+		case C.ProtocolMQTT:
+			r.StreamSniffers = append(r.StreamSniffers, sniff.MQTT)
+		case C.ProtocolSMTP:
+			r.StreamSniffers = append(r.StreamSniffers, sniff.SMTP)
+		case C.ProtocolIMAP:
+			r.StreamSniffers = append(r.StreamSniffers, sniff.IMAP)
+		case C.ProtocolPOP3:
+			r.StreamSniffers = append(r.StreamSniffers, sniff.POP3)
+		case C.ProtocolMTProto:
+			r.StreamSniffers = append(r.StreamSniffers, sniff.MTProto)
 		default:
 			return E.New("unknown sniffer: ", name)
 		}
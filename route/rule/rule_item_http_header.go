@@ -0,0 +1,71 @@
+package rule
+
+import (
+	"net/textproto"
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common/json/badjson"
+	"github.com/sagernet/sing/common/json/badoption"
+)
+
+var _ RuleItem = (*HTTPHeaderItem)(nil)
+
+type HTTPHeaderItem struct {
+	headers     map[string][]string
+	description string
+}
+
+func NewHTTPHeaderItem(headers *badjson.TypedMap[string, badoption.Listable[string]]) *HTTPHeaderItem {
+	headerMap := make(map[string][]string)
+	var descriptions []string
+	for _, entry := range headers.Entries() {
+		name := textproto.CanonicalMIMEHeaderKey(entry.Key)
+		headerMap[name] = append(headerMap[name], entry.Value...)
+		if len(entry.Value) == 0 {
+			descriptions = append(descriptions, name)
+		} else {
+			descriptions = append(descriptions, name+"="+strings.Join(entry.Value, ","))
+		}
+	}
+	description := "http_header="
+	if len(descriptions) == 1 {
+		description += descriptions[0]
+	} else {
+		description += "[" + strings.Join(descriptions, " ") + "]"
+	}
+	return &HTTPHeaderItem{headerMap, description}
+}
+
+func (r *HTTPHeaderItem) Match(metadata *adapter.InboundContext) bool {
+	if metadata.HTTPRequest == nil {
+		return false
+	}
+	for name, values := range r.headers {
+		if !matchHTTPHeader(metadata.HTTPRequest.Header.Values(name), values) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchHTTPHeader(requestValues []string, values []string) bool {
+	if len(requestValues) == 0 {
+		return false
+	}
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, requestValue := range requestValues {
+			if requestValue == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *HTTPHeaderItem) String() string {
+	return r.description
+}
@@ -0,0 +1,42 @@
+package rule
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	F "github.com/sagernet/sing/common/format"
+)
+
+var _ RuleItem = (*HTTPPathItem)(nil)
+
+type HTTPPathItem struct {
+	prefixes []string
+}
+
+func NewHTTPPathItem(prefixes []string) *HTTPPathItem {
+	return &HTTPPathItem{prefixes}
+}
+
+func (r *HTTPPathItem) Match(metadata *adapter.InboundContext) bool {
+	if metadata.HTTPRequest == nil {
+		return false
+	}
+	requestPath := metadata.HTTPRequest.URL.RequestURI()
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(requestPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *HTTPPathItem) String() string {
+	pLen := len(r.prefixes)
+	if pLen == 1 {
+		return F.ToString("http_path=", r.prefixes[0])
+	} else if pLen > 3 {
+		return F.ToString("http_path=[", strings.Join(r.prefixes[:3], " "), "...]")
+	} else {
+		return F.ToString("http_path=[", strings.Join(r.prefixes, " "), "]")
+	}
+}
@@ -0,0 +1,51 @@
+package rule
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common/json/badjson"
+	"github.com/sagernet/sing/common/json/badoption"
+	"github.com/sagernet/sing/protocol/http"
+
+	"github.com/stretchr/testify/require"
+)
+
+func httpRequestMetadata(t *testing.T, content string) *adapter.InboundContext {
+	t.Helper()
+	request, err := http.ReadRequest(bufio.NewReader(strings.NewReader(content)))
+	require.NoError(t, err)
+	return &adapter.InboundContext{HTTPRequest: adapter.NewHTTPRequest(request)}
+}
+
+func TestHTTPRuleItems(t *testing.T) {
+	t.Parallel()
+	metadata := httpRequestMetadata(t, "GET /ads/banner.js?id=1 HTTP/1.1\r\nHost: example.org\r\nUser-Agent: curl/8.0\r\nAccept: */*\r\n\r\n")
+
+	require.True(t, NewHTTPMethodItem([]string{"get"}).Match(metadata))
+	require.False(t, NewHTTPMethodItem([]string{"POST"}).Match(metadata))
+
+	require.True(t, NewHTTPPathItem([]string{"/ads/"}).Match(metadata))
+	require.False(t, NewHTTPPathItem([]string{"/api/"}).Match(metadata))
+
+	pathRegex, err := NewHTTPPathRegexItem([]string{`\.js\?id=\d+$`})
+	require.NoError(t, err)
+	require.True(t, pathRegex.Match(metadata))
+
+	headers := new(badjson.TypedMap[string, badoption.Listable[string]])
+	headers.Put("user-agent", badoption.Listable[string]{"curl/8.0"})
+	require.True(t, NewHTTPHeaderItem(headers).Match(metadata))
+	headers = new(badjson.TypedMap[string, badoption.Listable[string]])
+	headers.Put("X-Requested-With", nil)
+	require.False(t, NewHTTPHeaderItem(headers).Match(metadata))
+	headers = new(badjson.TypedMap[string, badoption.Listable[string]])
+	headers.Put("User-Agent", badoption.Listable[string]{"curl/8.0"})
+	headers.Put("Accept", nil)
+	require.True(t, NewHTTPHeaderItem(headers).Match(metadata))
+	headers.Put("X-Requested-With", nil)
+	require.False(t, NewHTTPHeaderItem(headers).Match(metadata))
+
+	require.False(t, NewHTTPMethodItem([]string{"GET"}).Match(&adapter.InboundContext{}))
+}
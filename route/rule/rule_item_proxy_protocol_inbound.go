@@ -0,0 +1,37 @@
+package rule
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	F "github.com/sagernet/sing/common/format"
+)
+
+var _ RuleItem = (*ProxyProtocolInboundItem)(nil)
+
+type ProxyProtocolInboundItem struct {
+	inbounds   []string
+	inboundMap map[string]bool
+}
+
+func NewProxyProtocolInboundItem(inbounds []string) *ProxyProtocolInboundItem {
+	inboundMap := make(map[string]bool)
+	for _, inbound := range inbounds {
+		inboundMap[inbound] = true
+	}
+	return &ProxyProtocolInboundItem{
+		inbounds:   inbounds,
+		inboundMap: inboundMap,
+	}
+}
+
+func (r *ProxyProtocolInboundItem) Match(metadata *adapter.InboundContext) bool {
+	return r.inboundMap[metadata.ProxyProtocolInbound]
+}
+
+func (r *ProxyProtocolInboundItem) String() string {
+	if len(r.inbounds) == 1 {
+		return F.ToString("proxy_protocol_inbound=", r.inbounds[0])
+	}
+	return F.ToString("proxy_protocol_inbound=[", strings.Join(r.inbounds, " "), "]")
+}
@@ -0,0 +1,37 @@
+package rule
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	F "github.com/sagernet/sing/common/format"
+)
+
+var _ RuleItem = (*ProxyProtocolServerNameItem)(nil)
+
+type ProxyProtocolServerNameItem struct {
+	serverNames   []string
+	serverNameMap map[string]bool
+}
+
+func NewProxyProtocolServerNameItem(serverNames []string) *ProxyProtocolServerNameItem {
+	serverNameMap := make(map[string]bool)
+	for _, serverName := range serverNames {
+		serverNameMap[serverName] = true
+	}
+	return &ProxyProtocolServerNameItem{
+		serverNames:   serverNames,
+		serverNameMap: serverNameMap,
+	}
+}
+
+func (r *ProxyProtocolServerNameItem) Match(metadata *adapter.InboundContext) bool {
+	return r.serverNameMap[metadata.ProxyProtocolServerName]
+}
+
+func (r *ProxyProtocolServerNameItem) String() string {
+	if len(r.serverNames) == 1 {
+		return F.ToString("proxy_protocol_server_name=", r.serverNames[0])
+	}
+	return F.ToString("proxy_protocol_server_name=[", strings.Join(r.serverNames, " "), "]")
+}
@@ -0,0 +1,37 @@
+package rule
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/adapter"
+	F "github.com/sagernet/sing/common/format"
+)
+
+var _ RuleItem = (*ProxyProtocolUserItem)(nil)
+
+type ProxyProtocolUserItem struct {
+	users   []string
+	userMap map[string]bool
+}
+
+func NewProxyProtocolUserItem(users []string) *ProxyProtocolUserItem {
+	userMap := make(map[string]bool)
+	for _, user := range users {
+		userMap[user] = true
+	}
+	return &ProxyProtocolUserItem{
+		users:   users,
+		userMap: userMap,
+	}
+}
+
+func (r *ProxyProtocolUserItem) Match(metadata *adapter.InboundContext) bool {
+	return r.userMap[metadata.ProxyProtocolUser]
+}
+
+func (r *ProxyProtocolUserItem) String() string {
+	if len(r.users) == 1 {
+		return F.ToString("proxy_protocol_user=", r.users[0])
+	}
+	return F.ToString("proxy_protocol_user=[", strings.Join(r.users, " "), "]")
+}
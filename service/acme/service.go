@@ -229,34 +229,43 @@ func newDNSSolver(dnsOptions *option.ACMEProviderDNS01ChallengeOptions, logger *
 			Logger:             logger.Named("dns_manager"),
 		},
 	}
+	dnsProvider, err := NewDNSProvider(dnsOptions, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	solver.DNSProvider = dnsProvider
+	return solver, nil
+}
+
+// NewDNSProvider creates the libdns provider configured by DNS01 challenge options.
+func NewDNSProvider(dnsOptions *option.ACMEProviderDNS01ChallengeOptions, httpClient *http.Client) (certmagic.DNSProvider, error) {
 	switch dnsOptions.Provider {
 	case C.DNSProviderAliDNS:
-		solver.DNSProvider = &alidns.Provider{
+		return &alidns.Provider{
 			CredentialInfo: alidns.CredentialInfo{
 				AccessKeyID:     dnsOptions.AliDNSOptions.AccessKeyID,
 				AccessKeySecret: dnsOptions.AliDNSOptions.AccessKeySecret,
 				RegionID:        dnsOptions.AliDNSOptions.RegionID,
 				SecurityToken:   dnsOptions.AliDNSOptions.SecurityToken,
 			},
-		}
+		}, nil
 	case C.DNSProviderCloudflare:
-		solver.DNSProvider = &cloudflare.Provider{
+		return &cloudflare.Provider{
 			APIToken:   dnsOptions.CloudflareOptions.APIToken,
 			ZoneToken:  dnsOptions.CloudflareOptions.ZoneToken,
 			HTTPClient: httpClient,
-		}
+		}, nil
 	case C.DNSProviderACMEDNS:
-		solver.DNSProvider = &acmeDNSProvider{
+		return &acmeDNSProvider{
 			username:   dnsOptions.ACMEDNSOptions.Username,
 			password:   dnsOptions.ACMEDNSOptions.Password,
 			subdomain:  dnsOptions.ACMEDNSOptions.Subdomain,
 			serverURL:  dnsOptions.ACMEDNSOptions.ServerURL,
 			httpClient: httpClient,
-		}
+		}, nil
 	default:
 		return nil, E.New("unsupported ACME DNS01 provider type: ", dnsOptions.Provider)
 	}
-	return solver, nil
 }
 
 func createZeroSSLExternalAccountBinding(ctx context.Context, acmeIssuer *certmagic.ACMEIssuer, account acme.Account, httpClient *http.Client) (*acme.EAB, acme.Account, error) {
@@ -1,3 +1,16 @@
 //go:build !with_acme
 
 package acme
+
+import (
+	"net/http"
+
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+
+	"github.com/caddyserver/certmagic"
+)
+
+func NewDNSProvider(dnsOptions *option.ACMEProviderDNS01ChallengeOptions, httpClient *http.Client) (certmagic.DNSProvider, error) {
+	return nil, E.New(`DNS providers are not included in this build, rebuild with -tags with_acme`)
+}
@@ -12,7 +12,6 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/sagernet/sing-box/adapter"
@@ -111,22 +110,29 @@ func extractWeeklyCycleHint(headers http.Header) *WeeklyCycleHint {
 
 type Service struct {
 	boxService.Adapter
-	ctx            context.Context
-	logger         log.ContextLogger
-	credentialPath string
-	credentials    *oauthCredentials
-	users          []option.CCMUser
-	httpClient     *http.Client
-	httpHeaders    http.Header
-	listener       *listener.Listener
-	tlsConfig      tls.ServerConfig
-	httpServer     *http.Server
-	userManager    *UserManager
-	accessMutex    sync.RWMutex
-	usageTracker   *AggregatedUsage
+	ctx          context.Context
+	logger       log.ContextLogger
+	credentials  *credentialPool
+	users        []option.CCMUser
+	baseURL      string
+	httpClient   *http.Client
+	httpHeaders  http.Header
+	listener     *listener.Listener
+	tlsConfig    tls.ServerConfig
+	httpServer   *http.Server
+	userManager  *UserManager
+	usageTracker *AggregatedUsage
 }
 
 func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.CCMServiceOptions) (adapter.Service, error) {
+	credentialPaths := []string{options.CredentialPath}
+	if len(options.CredentialPaths) > 0 {
+		if options.CredentialPath != "" {
+			return nil, E.New("`credential_path` and `credential_paths` are mutually exclusive")
+		}
+		credentialPaths = options.CredentialPaths
+	}
+
 	serviceDialer, err := dialer.NewWithOptions(dialer.Options{
 		Context: ctx,
 		Options: option.DialerOptions{
@@ -154,9 +160,10 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 	userManager := &UserManager{
 		tokenMap: make(map[string]string),
 	}
+	userManager.UpdateUsers(options.Users)
 
 	var usageTracker *AggregatedUsage
-	if options.UsagesPath != "" {
+	if options.UsagesPath != "" || userManager.hasBudget() {
 		usageTracker = &AggregatedUsage{
 			LastUpdated:  time.Now(),
 			Combinations: make([]CostCombination, 0),
@@ -166,13 +173,14 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 	}
 
 	service := &Service{
-		Adapter:        boxService.NewAdapter(C.TypeCCM, tag),
-		ctx:            ctx,
-		logger:         logger,
-		credentialPath: options.CredentialPath,
-		users:          options.Users,
-		httpClient:     httpClient,
-		httpHeaders:    options.Headers.Build(),
+		Adapter:     boxService.NewAdapter(C.TypeCCM, tag),
+		ctx:         ctx,
+		logger:      logger,
+		credentials: newCredentialPool(logger, httpClient, credentialPaths),
+		users:       options.Users,
+		baseURL:     claudeAPIBaseURL,
+		httpClient:  httpClient,
+		httpHeaders: options.Headers.Build(),
 		listener: listener.New(listener.Options{
 			Context: ctx,
 			Logger:  logger,
@@ -199,13 +207,10 @@ func (s *Service) Start(stage adapter.StartStage) error {
 		return nil
 	}
 
-	s.userManager.UpdateUsers(s.users)
-
-	credentials, err := platformReadCredentials(s.credentialPath)
+	err := s.credentials.Load()
 	if err != nil {
 		return E.Cause(err, "read credentials")
 	}
-	s.credentials = credentials
 
 	if s.usageTracker != nil {
 		err = s.usageTracker.Load()
@@ -248,35 +253,54 @@ func (s *Service) Start(stage adapter.StartStage) error {
 	return nil
 }
 
-func (s *Service) getAccessToken() (string, error) {
-	s.accessMutex.RLock()
-	if !s.credentials.needsRefresh() {
-		token := s.credentials.AccessToken
-		s.accessMutex.RUnlock()
-		return token, nil
-	}
-	s.accessMutex.RUnlock()
+type accessTokenError struct {
+	err error
+}
 
-	s.accessMutex.Lock()
-	defer s.accessMutex.Unlock()
+func (e *accessTokenError) Error() string {
+	return e.err.Error()
+}
 
-	if !s.credentials.needsRefresh() {
-		return s.credentials.AccessToken, nil
+func (s *Service) doUpstreamRequest(r *http.Request, credential *upstreamCredential, requestBody []byte) (*http.Response, error) {
+	accessToken, err := credential.getAccessToken(s.httpClient, s.logger)
+	if err != nil {
+		return nil, &accessTokenError{err}
 	}
 
-	newCredentials, err := refreshToken(s.httpClient, s.credentials)
+	proxyURL := s.baseURL + r.URL.RequestURI()
+	proxyRequest, err := http.NewRequestWithContext(r.Context(), r.Method, proxyURL, bytes.NewReader(requestBody))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	s.credentials = newCredentials
+	for key, values := range r.Header {
+		if !isHopByHopHeader(key) && key != "Authorization" {
+			proxyRequest.Header[key] = values
+		}
+	}
 
-	err = platformWriteCredentials(newCredentials, s.credentialPath)
-	if err != nil {
-		s.logger.Warn("persist refreshed token: ", err)
+	serviceOverridesAcceptEncoding := len(s.httpHeaders.Values("Accept-Encoding")) > 0
+	if s.usageTracker != nil && !serviceOverridesAcceptEncoding {
+		// Strip Accept-Encoding so Go Transport adds it automatically
+		// and transparently decompresses the response for correct usage counting.
+		proxyRequest.Header.Del("Accept-Encoding")
+	}
+
+	anthropicBetaHeader := proxyRequest.Header.Get("anthropic-beta")
+	if anthropicBetaHeader != "" {
+		proxyRequest.Header.Set("anthropic-beta", anthropicBetaOAuthValue+","+anthropicBetaHeader)
+	} else {
+		proxyRequest.Header.Set("anthropic-beta", anthropicBetaOAuthValue)
 	}
 
-	return newCredentials.AccessToken, nil
+	for key, values := range s.httpHeaders {
+		proxyRequest.Header.Del(key)
+		proxyRequest.Header[key] = values
+	}
+
+	proxyRequest.Header.Set("Authorization", "Bearer "+accessToken)
+
+	return s.httpClient.Do(proxyRequest)
 }
 
 func detectContextWindow(betaHeader string, totalInputTokens int64) int {
@@ -320,71 +344,67 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var requestModel string
-	var messagesCount int
-
-	if s.usageTracker != nil && r.Body != nil {
-		bodyBytes, err := io.ReadAll(r.Body)
-		if err == nil {
-			var request struct {
-				Model    string                   `json:"model"`
-				Messages []anthropic.MessageParam `json:"messages"`
-			}
-			err := json.Unmarshal(bodyBytes, &request)
-			if err == nil {
-				requestModel = request.Model
-				messagesCount = len(request.Messages)
-			}
-			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	var requestBody []byte
+	if r.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "invalid_request_error", "read request body: "+err.Error())
+			return
 		}
 	}
 
-	accessToken, err := s.getAccessToken()
-	if err != nil {
-		s.logger.Error("get access token: ", err)
-		writeJSONError(w, r, http.StatusUnauthorized, "authentication_error", "Authentication failed")
-		return
+	// the model is decoded on its own, so that a body the typed request
+	// cannot hold still has its model checked
+	var modelRequest struct {
+		Model string `json:"model"`
 	}
-
-	proxyURL := claudeAPIBaseURL + r.URL.RequestURI()
-	proxyRequest, err := http.NewRequestWithContext(r.Context(), r.Method, proxyURL, r.Body)
-	if err != nil {
-		s.logger.Error("create proxy request: ", err)
-		writeJSONError(w, r, http.StatusInternalServerError, "api_error", "Internal server error")
-		return
+	json.Unmarshal(requestBody, &modelRequest)
+	requestModel := modelRequest.Model
+	var messagesCount int
+	var request struct {
+		Messages []anthropic.MessageParam `json:"messages"`
 	}
-
-	for key, values := range r.Header {
-		if !isHopByHopHeader(key) && key != "Authorization" {
-			proxyRequest.Header[key] = values
-		}
+	if json.Unmarshal(requestBody, &request) == nil {
+		messagesCount = len(request.Messages)
 	}
 
-	serviceOverridesAcceptEncoding := len(s.httpHeaders.Values("Accept-Encoding")) > 0
-	if s.usageTracker != nil && !serviceOverridesAcceptEncoding {
-		// Strip Accept-Encoding so Go Transport adds it automatically
-		// and transparently decompresses the response for correct usage counting.
-		proxyRequest.Header.Del("Accept-Encoding")
-	}
-
-	anthropicBetaHeader := proxyRequest.Header.Get("anthropic-beta")
-	if anthropicBetaHeader != "" {
-		proxyRequest.Header.Set("anthropic-beta", anthropicBetaOAuthValue+","+anthropicBetaHeader)
-	} else {
-		proxyRequest.Header.Set("anthropic-beta", anthropicBetaOAuthValue)
-	}
-
-	for key, values := range s.httpHeaders {
-		proxyRequest.Header.Del(key)
-		proxyRequest.Header[key] = values
+	if username != "" {
+		limitErr := s.userManager.CheckRequest(username, requestModel, isModelEndpoint(r.Method, r.URL.Path), s.usageTracker, time.Now())
+		if limitErr != nil {
+			s.logger.Warn("rejected request from user ", username, ": ", limitErr)
+			writeJSONError(w, r, limitErr.statusCode, limitErr.errorType, limitErr.message)
+			return
+		}
 	}
 
-	proxyRequest.Header.Set("Authorization", "Bearer "+accessToken)
-
-	response, err := s.httpClient.Do(proxyRequest)
-	if err != nil {
-		writeJSONError(w, r, http.StatusBadGateway, "api_error", err.Error())
-		return
+	anthropicBetaHeader := r.Header.Get("anthropic-beta")
+	triedCredentials := make(map[*upstreamCredential]bool)
+	credential := s.credentials.Pick(triedCredentials)
+	var response *http.Response
+	for {
+		triedCredentials[credential] = true
+		var err error
+		response, err = s.doUpstreamRequest(r, credential, requestBody)
+		if err != nil {
+			var tokenErr *accessTokenError
+			if errors.As(err, &tokenErr) {
+				s.logger.Error("get access token: ", tokenErr.err)
+				writeJSONError(w, r, http.StatusUnauthorized, "authentication_error", "Authentication failed")
+			} else {
+				writeJSONError(w, r, http.StatusBadGateway, "api_error", err.Error())
+			}
+			return
+		}
+		if response.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		s.credentials.MarkRateLimited(credential, response.Header)
+		credential = s.credentials.Pick(triedCredentials)
+		if credential == nil {
+			break
+		}
+		response.Body.Close()
 	}
 	defer response.Body.Close()
 
@@ -0,0 +1,177 @@
+package ccm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockUpstream struct {
+	access        sync.Mutex
+	requests      map[string]int
+	limitedTokens map[string]bool
+}
+
+func (u *mockUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	u.access.Lock()
+	u.requests[token]++
+	limited := u.limitedTokens[token]
+	u.access.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if limited {
+		w.Header().Set("Retry-After", "30")
+		writeJSONError(w, r, http.StatusTooManyRequests, "rate_limit_error", "rate limited")
+		return
+	}
+	var request struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":    "msg_test",
+		"type":  "message",
+		"role":  "assistant",
+		"model": request.Model,
+		"usage": map[string]any{
+			"input_tokens":  1000,
+			"output_tokens": 100000,
+		},
+	})
+}
+
+func (u *mockUpstream) count(token string) int {
+	u.access.Lock()
+	defer u.access.Unlock()
+	return u.requests[token]
+}
+
+func newTestService(t *testing.T, users []option.CCMUser, tokens []string, limitedTokens ...string) (*Service, *mockUpstream) {
+	upstream := &mockUpstream{
+		requests:      make(map[string]int),
+		limitedTokens: make(map[string]bool),
+	}
+	for _, token := range limitedTokens {
+		upstream.limitedTokens[token] = true
+	}
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	var credentialPaths []string
+	for _, token := range tokens {
+		credentialPath := filepath.Join(t.TempDir(), ".credentials.json")
+		require.NoError(t, writeCredentialsToFile(&oauthCredentials{AccessToken: token, RefreshToken: "refresh"}, credentialPath))
+		credentialPaths = append(credentialPaths, credentialPath)
+	}
+	logger := log.NewNOPFactory().Logger()
+	service := &Service{
+		logger:       logger,
+		credentials:  newCredentialPool(logger, server.Client(), credentialPaths),
+		users:        users,
+		baseURL:      server.URL,
+		httpClient:   server.Client(),
+		httpHeaders:  make(http.Header),
+		userManager:  &UserManager{},
+		usageTracker: &AggregatedUsage{logger: logger},
+	}
+	service.userManager.UpdateUsers(users)
+	require.NoError(t, service.credentials.Load())
+	return service, upstream
+}
+
+func sendTestRequest(service *Service, token string, model string) *httptest.ResponseRecorder {
+	return sendTestRequestBody(service, token, `{"model":"`+model+`","messages":[]}`)
+}
+
+func sendTestRequestBody(service *Service, token string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	service.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCredentialFailover(t *testing.T) {
+	t.Parallel()
+	users := []option.CCMUser{{Name: "alice", Token: "alice-token"}}
+	service, upstream := newTestService(t, users, []string{"upstream-a", "upstream-b"}, "upstream-a")
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "alice-token", "claude-sonnet-4-5").Code)
+	require.Equal(t, 1, upstream.count("upstream-a"))
+	require.Equal(t, 1, upstream.count("upstream-b"))
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "alice-token", "claude-sonnet-4-5").Code)
+	require.Equal(t, 1, upstream.count("upstream-a"))
+	require.Equal(t, 2, upstream.count("upstream-b"))
+}
+
+func TestCredentialPoolExhausted(t *testing.T) {
+	t.Parallel()
+	service, upstream := newTestService(t, nil, []string{"upstream-a", "upstream-b"}, "upstream-a", "upstream-b")
+	response := sendTestRequest(service, "", "claude-sonnet-4-5")
+	require.Equal(t, http.StatusTooManyRequests, response.Code)
+	require.Equal(t, "30", response.Header().Get("Retry-After"))
+	require.Equal(t, 1, upstream.count("upstream-a"))
+	require.Equal(t, 1, upstream.count("upstream-b"))
+}
+
+func TestUserLimits(t *testing.T) {
+	t.Parallel()
+	users := []option.CCMUser{
+		{Name: "budget", Token: "budget-token", WeeklyBudget: 1},
+		{Name: "models", Token: "models-token", AllowedModels: []string{"claude-haiku-*"}},
+		{Name: "rate", Token: "rate-token", RequestsPerMinute: 2},
+	}
+	service, upstream := newTestService(t, users, []string{"upstream"})
+
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "budget-token", "claude-sonnet-4-5").Code)
+	weeklyCost, monthlyCost := service.usageTracker.UserSpend("budget", time.Now())
+	require.InDelta(t, 1.503, weeklyCost, 0.0001)
+	require.InDelta(t, 1.503, monthlyCost, 0.0001)
+	require.Equal(t, http.StatusTooManyRequests, sendTestRequest(service, "budget-token", "claude-sonnet-4-5").Code)
+
+	require.Equal(t, http.StatusForbidden, sendTestRequest(service, "models-token", "claude-sonnet-4-5").Code)
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "models-token", "claude-haiku-4-5").Code)
+	require.Equal(t, http.StatusForbidden, sendTestRequestBody(service, "models-token", `{"model":"claude-sonnet-4-5","messages":"hello"}`).Code)
+	require.Equal(t, http.StatusForbidden, sendTestRequestBody(service, "models-token", `{"model":["claude-haiku-4-5"]}`).Code)
+	require.Equal(t, http.StatusForbidden, sendTestRequestBody(service, "models-token", `not json`).Code)
+
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "rate-token", "claude-sonnet-4-5").Code)
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "rate-token", "claude-sonnet-4-5").Code)
+	require.Equal(t, http.StatusTooManyRequests, sendTestRequest(service, "rate-token", "claude-sonnet-4-5").Code)
+
+	require.Equal(t, 4, upstream.count("upstream"))
+}
+
+func TestUserSpendPersistence(t *testing.T) {
+	t.Parallel()
+	usagesPath := filepath.Join(t.TempDir(), "usages.json")
+	usageTracker := &AggregatedUsage{filePath: usagesPath}
+	observedAt := time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, usageTracker.AddUsageWithCycleHint("claude-sonnet-4-5", contextWindowStandard, 1, 0, 100000, 0, 0, 0, 0, "alice", observedAt, nil))
+	usageTracker.cancelPendingSave()
+	require.NoError(t, usageTracker.Save())
+	_, err := os.Stat(usagesPath)
+	require.NoError(t, err)
+
+	loadedTracker := &AggregatedUsage{filePath: usagesPath}
+	require.NoError(t, loadedTracker.Load())
+	weeklyCost, monthlyCost := loadedTracker.UserSpend("alice", observedAt)
+	require.InDelta(t, 1.5, weeklyCost, 0.0001)
+	require.InDelta(t, 1.5, monthlyCost, 0.0001)
+
+	weeklyCost, monthlyCost = loadedTracker.UserSpend("alice", time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC))
+	require.Zero(t, weeklyCost)
+	require.InDelta(t, 1.5, monthlyCost, 0.0001)
+	weeklyCost, monthlyCost = loadedTracker.UserSpend("alice", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC))
+	require.Zero(t, weeklyCost)
+	require.Zero(t, monthlyCost)
+}
@@ -33,8 +33,9 @@ type CostCombination struct {
 }
 
 type AggregatedUsage struct {
-	LastUpdated  time.Time         `json:"last_updated"`
-	Combinations []CostCombination `json:"combinations"`
+	LastUpdated  time.Time             `json:"last_updated"`
+	Combinations []CostCombination     `json:"combinations"`
+	UserSpends   map[string]*UserSpend `json:"user_spends,omitempty"`
 	mutex        sync.Mutex
 	filePath     string
 	logger       log.ContextLogger
@@ -75,6 +76,7 @@ type AggregatedUsageJSON struct {
 	LastUpdated  time.Time             `json:"last_updated"`
 	Costs        CostsSummaryJSON      `json:"costs"`
 	Combinations []CostCombinationJSON `json:"combinations"`
+	UserSpends   map[string]*UserSpend `json:"user_spends,omitempty"`
 }
 
 type WeeklyCycleHint struct {
@@ -318,6 +320,10 @@ func getPricing(model string, contextWindow int) ModelPricing {
 }
 
 func calculateCost(stats UsageStats, model string, contextWindow int) float64 {
+	return roundCost(calculateRawCost(stats, model, contextWindow))
+}
+
+func calculateRawCost(stats UsageStats, model string, contextWindow int) float64 {
 	pricing := getPricing(model, contextWindow)
 
 	cacheCreationCost := 0.0
@@ -329,12 +335,10 @@ func calculateCost(stats UsageStats, model string, contextWindow int) float64 {
 		cacheCreationCost = float64(stats.CacheCreationInputTokens) * pricing.CacheWritePrice5Minute
 	}
 
-	cost := (float64(stats.InputTokens)*pricing.InputPrice +
+	return (float64(stats.InputTokens)*pricing.InputPrice +
 		float64(stats.OutputTokens)*pricing.OutputPrice +
 		float64(stats.CacheReadInputTokens)*pricing.CacheReadPrice +
 		cacheCreationCost) / 1_000_000
-
-	return math.Round(cost*100) / 100
 }
 
 func roundCost(cost float64) float64 {
@@ -557,6 +561,14 @@ func (u *AggregatedUsage) ToJSON() *AggregatedUsageJSON {
 		result.Costs.ByUser[user] = roundCost(cost)
 	}
 
+	if len(u.UserSpends) > 0 {
+		result.UserSpends = make(map[string]*UserSpend, len(u.UserSpends))
+		for user, spend := range u.UserSpends {
+			spendCopy := *spend
+			result.UserSpends[user] = &spendCopy
+		}
+	}
+
 	return result
 }
 
@@ -566,7 +578,11 @@ func (u *AggregatedUsage) Load() error {
 
 	u.LastUpdated = time.Time{}
 	u.Combinations = nil
+	u.UserSpends = nil
 
+	if u.filePath == "" {
+		return nil
+	}
 	data, err := os.ReadFile(u.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -576,8 +592,9 @@ func (u *AggregatedUsage) Load() error {
 	}
 
 	var temp struct {
-		LastUpdated  time.Time         `json:"last_updated"`
-		Combinations []CostCombination `json:"combinations"`
+		LastUpdated  time.Time             `json:"last_updated"`
+		Combinations []CostCombination     `json:"combinations"`
+		UserSpends   map[string]*UserSpend `json:"user_spends"`
 	}
 
 	err = json.Unmarshal(data, &temp)
@@ -587,12 +604,16 @@ func (u *AggregatedUsage) Load() error {
 
 	u.LastUpdated = temp.LastUpdated
 	u.Combinations = temp.Combinations
+	u.UserSpends = temp.UserSpends
 	normalizeCombinations(u.Combinations)
 
 	return nil
 }
 
 func (u *AggregatedUsage) Save() error {
+	if u.filePath == "" {
+		return nil
+	}
 	jsonData := u.ToJSON()
 
 	data, err := json.MarshalIndent(jsonData, "", "  ")
@@ -652,6 +673,20 @@ func (u *AggregatedUsage) AddUsageWithCycleHint(
 
 	addUsageToCombinations(&u.Combinations, model, contextWindow, weekStartUnix, messagesCount, inputTokens, outputTokens, cacheReadTokens, cacheCreationTokens, cacheCreation5MinuteTokens, cacheCreation1HourTokens, user)
 
+	if user != "" {
+		if cacheCreationTokens == 0 {
+			cacheCreationTokens = cacheCreation5MinuteTokens + cacheCreation1HourTokens
+		}
+		u.addUserSpend(user, calculateRawCost(UsageStats{
+			InputTokens:                     inputTokens,
+			OutputTokens:                    outputTokens,
+			CacheReadInputTokens:            cacheReadTokens,
+			CacheCreationInputTokens:        cacheCreationTokens,
+			CacheCreation5MinuteInputTokens: cacheCreation5MinuteTokens,
+			CacheCreation1HourInputTokens:   cacheCreation1HourTokens,
+		}, model, contextWindow), observedAt)
+	}
+
 	go u.scheduleSave()
 
 	return nil
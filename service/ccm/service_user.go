@@ -1,7 +1,11 @@
 package ccm
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sagernet/sing-box/option"
 )
@@ -9,16 +13,46 @@ import (
 type UserManager struct {
 	accessMutex sync.RWMutex
 	tokenMap    map[string]string
+	userMap     map[string]*managedUser
+}
+
+type managedUser struct {
+	allowedModels     []string
+	weeklyBudget      float64
+	monthlyBudget     float64
+	requestsPerMinute int
+	rateMutex         sync.Mutex
+	rateTokens        float64
+	rateUpdated       time.Time
+}
+
+type userLimitError struct {
+	statusCode int
+	errorType  string
+	message    string
+}
+
+func (e *userLimitError) Error() string {
+	return e.message
 }
 
 func (m *UserManager) UpdateUsers(users []option.CCMUser) {
 	m.accessMutex.Lock()
 	defer m.accessMutex.Unlock()
 	tokenMap := make(map[string]string, len(users))
+	userMap := make(map[string]*managedUser, len(users))
 	for _, user := range users {
 		tokenMap[user.Token] = user.Name
+		userMap[user.Name] = &managedUser{
+			allowedModels:     user.AllowedModels,
+			weeklyBudget:      user.WeeklyBudget,
+			monthlyBudget:     user.MonthlyBudget,
+			requestsPerMinute: user.RequestsPerMinute,
+			rateTokens:        float64(user.RequestsPerMinute),
+		}
 	}
 	m.tokenMap = tokenMap
+	m.userMap = userMap
 }
 
 func (m *UserManager) Authenticate(token string) (string, bool) {
@@ -27,3 +61,84 @@ func (m *UserManager) Authenticate(token string) (string, bool) {
 	m.accessMutex.RUnlock()
 	return username, found
 }
+
+func (m *UserManager) hasBudget() bool {
+	m.accessMutex.RLock()
+	defer m.accessMutex.RUnlock()
+	for _, user := range m.userMap {
+		if user.weeklyBudget > 0 || user.monthlyBudget > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRequest enforces the allowed models, budgets and request rate of the
+// user before the request is forwarded. modelRequired is set for endpoints that
+// select a model, where a request without a readable model is rejected for users
+// with allowed models.
+func (m *UserManager) CheckRequest(username string, model string, modelRequired bool, usageTracker *AggregatedUsage, now time.Time) *userLimitError {
+	m.accessMutex.RLock()
+	user := m.userMap[username]
+	m.accessMutex.RUnlock()
+	if user == nil {
+		return nil
+	}
+	if model == "" {
+		if modelRequired && len(user.allowedModels) > 0 {
+			return &userLimitError{http.StatusForbidden, "permission_error", "request model could not be determined"}
+		}
+	} else if !user.allowsModel(model) {
+		return &userLimitError{http.StatusForbidden, "permission_error", "model " + model + " is not allowed"}
+	}
+	if usageTracker != nil && (user.weeklyBudget > 0 || user.monthlyBudget > 0) {
+		weeklyCost, monthlyCost := usageTracker.UserSpend(username, now)
+		if user.weeklyBudget > 0 && weeklyCost >= user.weeklyBudget {
+			return &userLimitError{http.StatusTooManyRequests, "rate_limit_error", fmt.Sprintf("weekly budget of $%.2f exceeded", user.weeklyBudget)}
+		}
+		if user.monthlyBudget > 0 && monthlyCost >= user.monthlyBudget {
+			return &userLimitError{http.StatusTooManyRequests, "rate_limit_error", fmt.Sprintf("monthly budget of $%.2f exceeded", user.monthlyBudget)}
+		}
+	}
+	if user.requestsPerMinute > 0 && !user.allowRequest(now) {
+		return &userLimitError{http.StatusTooManyRequests, "rate_limit_error", "request rate limit exceeded"}
+	}
+	return nil
+}
+
+// isModelEndpoint reports whether the request selects a model. Message batches
+// carry their models per request and are rejected for users with allowed models.
+func isModelEndpoint(method string, path string) bool {
+	return method == http.MethodPost && (strings.HasPrefix(path, "/v1/messages") || path == "/v1/complete")
+}
+
+func (u *managedUser) allowsModel(model string) bool {
+	if len(u.allowedModels) == 0 {
+		return true
+	}
+	for _, allowedModel := range u.allowedModels {
+		if prefix, isPrefix := strings.CutSuffix(allowedModel, "*"); isPrefix {
+			if strings.HasPrefix(model, prefix) {
+				return true
+			}
+		} else if model == allowedModel {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *managedUser) allowRequest(now time.Time) bool {
+	u.rateMutex.Lock()
+	defer u.rateMutex.Unlock()
+	capacity := float64(u.requestsPerMinute)
+	if !u.rateUpdated.IsZero() {
+		u.rateTokens = min(capacity, u.rateTokens+now.Sub(u.rateUpdated).Minutes()*capacity)
+	}
+	u.rateUpdated = now
+	if u.rateTokens < 1 {
+		return false
+	}
+	u.rateTokens--
+	return true
+}
@@ -43,6 +43,7 @@ import (
 	"github.com/sagernet/tailscale/net/netmon"
 	"github.com/sagernet/tailscale/net/stun"
 	"github.com/sagernet/tailscale/net/wsconn"
+	"github.com/sagernet/tailscale/tailcfg"
 	"github.com/sagernet/tailscale/tsweb"
 	"github.com/sagernet/tailscale/types/key"
 
@@ -71,6 +72,7 @@ type Service struct {
 	meshKey              string
 	meshKeyPath          string
 	meshWith             []*option.DERPMeshOptions
+	node                 tailcfg.DERPNode
 }
 
 func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.DERPServiceOptions) (adapter.Service, error) {
@@ -96,6 +98,11 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 		}
 	}
 
+	node := tailcfg.DERPNode{
+		HostName: options.TLS.ServerName,
+		DERPPort: int(options.ListenPort),
+		STUNPort: -1,
+	}
 	var stunListener *listener.Listener
 	if options.STUN != nil && options.STUN.Enabled {
 		if options.STUN.Listen == nil {
@@ -110,6 +117,7 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 			Network: []string{N.NetworkUDP},
 			Listen:  options.STUN.ListenOptions,
 		})
+		node.STUNPort = int(options.STUN.ListenPort)
 	}
 
 	return &Service{
@@ -131,6 +139,7 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 		meshKey:              options.MeshPSK,
 		meshKeyPath:          options.MeshPSKFile,
 		meshWith:             options.MeshWith,
+		node:                 node,
 	}, nil
 }
 
@@ -264,6 +273,11 @@ func (d *Service) Start(stage adapter.StartStage) error {
 	return nil
 }
 
+// DERPNode returns the DERP map entry advertised for this server, without region and name.
+func (d *Service) DERPNode() tailcfg.DERPNode {
+	return d.node
+}
+
 func checkMeshKey(meshKey string) error {
 	checkRegex, err := regexp.Compile(`^[0-9a-f]{64}$`)
 	if err != nil {
@@ -0,0 +1,142 @@
+//go:build linux
+
+package dhcpserver
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func (s *Service) loopDHCPv4() {
+	buffer := make([]byte, 1500)
+	for {
+		n, source, err := s.conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if !E.IsClosed(err) {
+				s.logger.Error(E.Cause(err, "read dhcp request"))
+			}
+			return
+		}
+		request, err := dhcpv4.FromBytes(buffer[:n])
+		if err != nil {
+			s.logger.Debug(E.Cause(err, "parse dhcp request from ", source))
+			continue
+		}
+		if request.OpCode != dhcpv4.OpcodeBootRequest {
+			continue
+		}
+		reply, err := s.handleDHCPv4(request)
+		if err != nil {
+			s.logger.Error(E.Cause(err, "handle dhcp ", request.MessageType(), " from ", request.ClientHWAddr))
+			continue
+		}
+		if reply == nil {
+			continue
+		}
+		_, err = s.conn.WriteToUDPAddrPort(reply.ToBytes(), replyDestination(request, reply))
+		if err != nil {
+			s.logger.Error(E.Cause(err, "write dhcp ", reply.MessageType(), " to ", request.ClientHWAddr))
+		}
+	}
+}
+
+func (s *Service) handleDHCPv4(request *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	now := time.Now()
+	mac := slices.Clone(request.ClientHWAddr)
+	switch request.MessageType() {
+	case dhcpv4.MessageTypeDiscover:
+		address, loaded := s.pool.offer(mac, addrFromIP(request.RequestedIPAddress()), now)
+		if !loaded {
+			return nil, E.New("address pool exhausted")
+		}
+		s.logger.Debug("offer ", address, " to ", mac)
+		return s.newReply(request, dhcpv4.MessageTypeOffer, address)
+	case dhcpv4.MessageTypeRequest:
+		serverID := request.ServerIdentifier()
+		if serverID != nil && addrFromIP(serverID) != s.serverAddress {
+			s.pool.cancelOffer(mac)
+			return nil, nil
+		}
+		address := addrFromIP(request.RequestedIPAddress())
+		if !address.IsValid() {
+			address = addrFromIP(request.ClientIPAddr)
+		}
+		lease, loaded := s.pool.request(mac, address, request.HostName(), now)
+		if !loaded {
+			s.logger.Debug("reject ", address, " for ", mac)
+			return dhcpv4.NewReplyFromRequest(request,
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeNak),
+				dhcpv4.WithOption(dhcpv4.OptServerIdentifier(s.serverAddress.AsSlice())),
+			)
+		}
+		if lease.Hostname != "" {
+			s.logger.Info("lease ", lease.Address, " to ", mac, " (", lease.Hostname, ")")
+		} else {
+			s.logger.Info("lease ", lease.Address, " to ", mac)
+		}
+		s.leasesUpdated()
+		return s.newReply(request, dhcpv4.MessageTypeAck, lease.Address)
+	case dhcpv4.MessageTypeRelease:
+		if s.pool.release(mac, addrFromIP(request.ClientIPAddr)) {
+			s.logger.Info("release ", request.ClientIPAddr, " from ", mac)
+			s.leasesUpdated()
+		}
+		return nil, nil
+	case dhcpv4.MessageTypeDecline:
+		address := addrFromIP(request.RequestedIPAddress())
+		if s.pool.decline(mac, address, now) {
+			s.logger.Warn("address ", address, " declined by ", mac)
+			s.leasesUpdated()
+		}
+		return nil, nil
+	case dhcpv4.MessageTypeInform:
+		return s.newReply(request, dhcpv4.MessageTypeAck, netip.Addr{})
+	default:
+		return nil, nil
+	}
+}
+
+func (s *Service) newReply(request *dhcpv4.DHCPv4, messageType dhcpv4.MessageType, address netip.Addr) (*dhcpv4.DHCPv4, error) {
+	modifiers := []dhcpv4.Modifier{
+		dhcpv4.WithMessageType(messageType),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(s.serverAddress.AsSlice())),
+		dhcpv4.WithOption(dhcpv4.OptSubnetMask(net.CIDRMask(s.prefix.Bits(), 32))),
+	}
+	if address.IsValid() {
+		modifiers = append(modifiers,
+			dhcpv4.WithYourIP(address.AsSlice()),
+			dhcpv4.WithOption(dhcpv4.OptIPAddressLeaseTime(s.leaseTime)),
+		)
+	}
+	if s.gateway.IsValid() {
+		modifiers = append(modifiers, dhcpv4.WithOption(dhcpv4.OptRouter(s.gateway.AsSlice())))
+	}
+	if len(s.dns) > 0 {
+		modifiers = append(modifiers, dhcpv4.WithOption(dhcpv4.OptDNS(s.dns...)))
+	}
+	if s.options.Domain != "" {
+		modifiers = append(modifiers, dhcpv4.WithOption(dhcpv4.OptDomainName(s.options.Domain)))
+	}
+	return dhcpv4.NewReplyFromRequest(request, modifiers...)
+}
+
+func replyDestination(request *dhcpv4.DHCPv4, reply *dhcpv4.DHCPv4) netip.AddrPort {
+	if gatewayAddress := addrFromIP(request.GatewayIPAddr); gatewayAddress.IsValid() && !gatewayAddress.IsUnspecified() {
+		return netip.AddrPortFrom(gatewayAddress, dhcpv4.ServerPort)
+	}
+	if clientAddress := addrFromIP(request.ClientIPAddr); reply.MessageType() != dhcpv4.MessageTypeNak && clientAddress.IsValid() && !clientAddress.IsUnspecified() {
+		return netip.AddrPortFrom(clientAddress, dhcpv4.ClientPort)
+	}
+	return netip.AddrPortFrom(netip.AddrFrom4([4]byte{255, 255, 255, 255}), dhcpv4.ClientPort)
+}
+
+func addrFromIP(ip net.IP) netip.Addr {
+	return M.AddrFromIP(ip).Unmap()
+}
@@ -0,0 +1,256 @@
+package dhcpserver
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+)
+
+const offerTimeout = time.Minute
+
+type lease struct {
+	address  netip.Addr
+	mac      net.HardwareAddr
+	hostname string
+	expiry   time.Time
+	bound    bool
+}
+
+// leasePool hands out addresses of a single IPv4 subnet, leases are keyed by
+// the client hardware address.
+type leasePool struct {
+	access      sync.Mutex
+	prefix      netip.Prefix
+	rangeStart  netip.Addr
+	rangeEnd    netip.Addr
+	reserved    map[netip.Addr]bool
+	leaseTime   time.Duration
+	static      map[string]adapter.DHCPLease
+	staticOwner map[netip.Addr]string
+	leases      map[string]*lease
+	addresses   map[netip.Addr]*lease
+	declined    map[netip.Addr]time.Time
+}
+
+func newLeasePool(prefix netip.Prefix, rangeStart netip.Addr, rangeEnd netip.Addr, reserved []netip.Addr, staticLeases []adapter.DHCPLease, leaseTime time.Duration) *leasePool {
+	pool := &leasePool{
+		prefix:      prefix.Masked(),
+		rangeStart:  rangeStart,
+		rangeEnd:    rangeEnd,
+		reserved:    make(map[netip.Addr]bool),
+		leaseTime:   leaseTime,
+		static:      make(map[string]adapter.DHCPLease),
+		staticOwner: make(map[netip.Addr]string),
+		leases:      make(map[string]*lease),
+		addresses:   make(map[netip.Addr]*lease),
+		declined:    make(map[netip.Addr]time.Time),
+	}
+	for _, address := range reserved {
+		pool.reserved[address] = true
+	}
+	for _, staticLease := range staticLeases {
+		pool.static[staticLease.MACAddress.String()] = staticLease
+		pool.staticOwner[staticLease.Address] = staticLease.MACAddress.String()
+	}
+	return pool
+}
+
+// restore loads bound leases saved by a previous run.
+func (p *leasePool) restore(leases []adapter.DHCPLease, now time.Time) {
+	p.access.Lock()
+	defer p.access.Unlock()
+	for _, saved := range leases {
+		if !saved.Expiry.After(now) || !p.available(saved.Address, saved.MACAddress.String(), now) {
+			continue
+		}
+		p.bind(saved.MACAddress, saved.Address, saved.Hostname, saved.Expiry, true)
+	}
+}
+
+// offer picks an address for a DHCPDISCOVER and holds it for offerTimeout.
+func (p *leasePool) offer(mac net.HardwareAddr, requested netip.Addr, now time.Time) (netip.Addr, bool) {
+	p.access.Lock()
+	defer p.access.Unlock()
+	key := mac.String()
+	if staticLease, loaded := p.static[key]; loaded {
+		return staticLease.Address, true
+	}
+	if current, loaded := p.leases[key]; loaded && p.available(current.address, key, now) {
+		if !current.bound {
+			current.expiry = now.Add(offerTimeout)
+		}
+		return current.address, true
+	}
+	address := requested
+	if !address.IsValid() || !p.inRange(address) || !p.available(address, key, now) {
+		address = netip.Addr{}
+		for candidate := p.rangeStart; candidate.IsValid() && candidate.Compare(p.rangeEnd) <= 0; candidate = candidate.Next() {
+			if p.available(candidate, key, now) {
+				address = candidate
+				break
+			}
+		}
+		if !address.IsValid() {
+			return netip.Addr{}, false
+		}
+	}
+	p.bind(mac, address, "", now.Add(offerTimeout), false)
+	return address, true
+}
+
+// request commits the address asked for in a DHCPREQUEST.
+func (p *leasePool) request(mac net.HardwareAddr, address netip.Addr, hostname string, now time.Time) (adapter.DHCPLease, bool) {
+	p.access.Lock()
+	defer p.access.Unlock()
+	key := mac.String()
+	if staticLease, loaded := p.static[key]; loaded {
+		if address != staticLease.Address {
+			return adapter.DHCPLease{}, false
+		}
+		if staticLease.Hostname != "" {
+			hostname = staticLease.Hostname
+		}
+	} else if !p.inRange(address) || !p.available(address, key, now) {
+		return adapter.DHCPLease{}, false
+	}
+	current := p.bind(mac, address, hostname, now.Add(p.leaseTime), true)
+	return current.export(), true
+}
+
+func (p *leasePool) cancelOffer(mac net.HardwareAddr) {
+	p.access.Lock()
+	defer p.access.Unlock()
+	current, loaded := p.leases[mac.String()]
+	if loaded && !current.bound {
+		p.remove(current)
+	}
+}
+
+func (p *leasePool) release(mac net.HardwareAddr, address netip.Addr) bool {
+	p.access.Lock()
+	defer p.access.Unlock()
+	current, loaded := p.leases[mac.String()]
+	if !loaded || current.address != address {
+		return false
+	}
+	p.remove(current)
+	return current.bound
+}
+
+func (p *leasePool) decline(mac net.HardwareAddr, address netip.Addr, now time.Time) bool {
+	p.access.Lock()
+	defer p.access.Unlock()
+	current, loaded := p.leases[mac.String()]
+	if !loaded || current.address != address {
+		return false
+	}
+	p.remove(current)
+	if _, isStatic := p.staticOwner[address]; !isStatic {
+		p.declined[address] = now.Add(p.leaseTime)
+	}
+	return current.bound
+}
+
+// purge drops expired leases and reports whether a bound lease was removed.
+func (p *leasePool) purge(now time.Time) bool {
+	p.access.Lock()
+	defer p.access.Unlock()
+	var removed bool
+	for _, current := range p.leases {
+		if !current.expiry.After(now) {
+			p.remove(current)
+			removed = removed || current.bound
+		}
+	}
+	for address, until := range p.declined {
+		if !until.After(now) {
+			delete(p.declined, address)
+		}
+	}
+	return removed
+}
+
+func (p *leasePool) entries(now time.Time) []adapter.DHCPLease {
+	p.access.Lock()
+	defer p.access.Unlock()
+	var entries []adapter.DHCPLease
+	for _, current := range p.leases {
+		if current.bound && current.expiry.After(now) {
+			entries = append(entries, current.export())
+		}
+	}
+	return entries
+}
+
+func (p *leasePool) inRange(address netip.Addr) bool {
+	return address.Compare(p.rangeStart) >= 0 && address.Compare(p.rangeEnd) <= 0
+}
+
+func (p *leasePool) available(address netip.Addr, key string, now time.Time) bool {
+	if !p.prefix.Contains(address) || p.reserved[address] {
+		return false
+	}
+	if owner, isStatic := p.staticOwner[address]; isStatic {
+		return owner == key
+	}
+	if until, isDeclined := p.declined[address]; isDeclined && until.After(now) {
+		return false
+	}
+	current, loaded := p.addresses[address]
+	return !loaded || current.mac.String() == key || !current.expiry.After(now)
+}
+
+func (p *leasePool) bind(mac net.HardwareAddr, address netip.Addr, hostname string, expiry time.Time, bound bool) *lease {
+	key := mac.String()
+	if current, loaded := p.leases[key]; loaded {
+		p.remove(current)
+	}
+	if current, loaded := p.addresses[address]; loaded {
+		p.remove(current)
+	}
+	current := &lease{
+		address:  address,
+		mac:      mac,
+		hostname: hostname,
+		expiry:   expiry,
+		bound:    bound,
+	}
+	p.leases[key] = current
+	p.addresses[address] = current
+	return current
+}
+
+func (p *leasePool) remove(current *lease) {
+	key := current.mac.String()
+	if p.leases[key] == current {
+		delete(p.leases, key)
+	}
+	if p.addresses[current.address] == current {
+		delete(p.addresses, current.address)
+	}
+}
+
+func (l *lease) export() adapter.DHCPLease {
+	return adapter.DHCPLease{
+		Address:    l.address,
+		MACAddress: l.mac,
+		Hostname:   l.hostname,
+		Expiry:     l.expiry,
+	}
+}
+
+// defaultRange covers the whole subnet except the network and broadcast addresses.
+func defaultRange(prefix netip.Prefix) (netip.Addr, netip.Addr) {
+	network := prefix.Masked().Addr()
+	broadcast := network.As4()
+	hostBits := 32 - prefix.Bits()
+	for index := 3; index >= 0 && hostBits > 0; index-- {
+		bits := min(hostBits, 8)
+		broadcast[index] |= byte(1<<bits - 1)
+		hostBits -= bits
+	}
+	return network.Next(), netip.AddrFrom4(broadcast).Prev()
+}
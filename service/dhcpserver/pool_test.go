@@ -0,0 +1,75 @@
+package dhcpserver
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeasePool(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	macA := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0a}
+	macB := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0b}
+	macStatic := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0c}
+	pool := newLeasePool(
+		netip.MustParsePrefix("192.168.9.1/24"),
+		netip.MustParseAddr("192.168.9.1"),
+		netip.MustParseAddr("192.168.9.3"),
+		[]netip.Addr{netip.MustParseAddr("192.168.9.1")},
+		[]adapter.DHCPLease{{Address: netip.MustParseAddr("192.168.9.3"), MACAddress: macStatic, Hostname: "static"}},
+		time.Hour,
+	)
+
+	address, ok := pool.offer(macA, netip.Addr{}, now)
+	require.True(t, ok)
+	require.Equal(t, netip.MustParseAddr("192.168.9.2"), address)
+	require.Empty(t, pool.entries(now))
+
+	_, ok = pool.offer(macB, netip.Addr{}, now)
+	require.False(t, ok, "range exhausted by offer, reserved and static addresses")
+
+	_, ok = pool.request(macB, address, "", now)
+	require.False(t, ok, "address offered to another client")
+
+	lease, ok := pool.request(macA, address, "laptop", now)
+	require.True(t, ok)
+	require.Equal(t, "laptop", lease.Hostname)
+	require.Len(t, pool.entries(now), 1)
+
+	staticAddress, ok := pool.offer(macStatic, netip.Addr{}, now)
+	require.True(t, ok)
+	require.Equal(t, netip.MustParseAddr("192.168.9.3"), staticAddress)
+	lease, ok = pool.request(macStatic, staticAddress, "", now)
+	require.True(t, ok)
+	require.Equal(t, "static", lease.Hostname)
+
+	require.True(t, pool.purge(now.Add(2*time.Hour)))
+	require.Empty(t, pool.entries(now.Add(2*time.Hour)))
+
+	restored := newLeasePool(pool.prefix, pool.rangeStart, pool.rangeEnd, nil, nil, time.Hour)
+	restored.restore([]adapter.DHCPLease{
+		{Address: netip.MustParseAddr("192.168.9.2"), MACAddress: macA, Expiry: now.Add(time.Hour)},
+		{Address: netip.MustParseAddr("192.168.9.3"), MACAddress: macB, Expiry: now.Add(-time.Minute)},
+	}, now)
+	entries := restored.entries(now)
+	require.Len(t, entries, 1)
+	require.Equal(t, macA, entries[0].MACAddress)
+
+	require.True(t, restored.decline(macA, netip.MustParseAddr("192.168.9.2"), now))
+	address, ok = restored.offer(macB, netip.Addr{}, now)
+	require.True(t, ok)
+	require.NotEqual(t, netip.MustParseAddr("192.168.9.2"), address)
+}
+
+func TestDefaultRange(t *testing.T) {
+	t.Parallel()
+	rangeStart, rangeEnd := defaultRange(netip.MustParsePrefix("10.0.0.1/22"))
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), rangeStart)
+	require.Equal(t, netip.MustParseAddr("10.0.3.254"), rangeEnd)
+}
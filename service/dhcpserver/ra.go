@@ -0,0 +1,195 @@
+//go:build linux
+
+package dhcpserver
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing/common/control"
+	E "github.com/sagernet/sing/common/exceptions"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	minSolicitedInterval = 3 * time.Second
+	prefixValidLifetime  = 24 * time.Hour
+	prefixPreferLifetime = 4 * time.Hour
+)
+
+// routerAdvertiser sends IPv6 router advertisements with prefix information
+// and RDNSS options, periodically and in response to router solicitations.
+type routerAdvertiser struct {
+	logger         log.ContextLogger
+	iface          *net.Interface
+	prefixes       []netip.Prefix
+	dns            []netip.Addr
+	domain         string
+	interval       time.Duration
+	routerLifetime time.Duration
+	conn           *ipv6.PacketConn
+	writeAccess    sync.Mutex
+	lastSolicited  time.Time
+	done           chan struct{}
+}
+
+func (a *routerAdvertiser) start(ctx context.Context) error {
+	listenConfig := net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			return control.Raw(conn, func(fd uintptr) error {
+				return unix.BindToDevice(int(fd), a.iface.Name)
+			})
+		},
+	}
+	packetConn, err := listenConfig.ListenPacket(ctx, "ip6:ipv6-icmp", "::")
+	if err != nil {
+		return E.Cause(err, "listen icmpv6")
+	}
+	conn := ipv6.NewPacketConn(packetConn)
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeRouterSolicitation)
+	err = E.Errors(
+		conn.SetHopLimit(255),
+		conn.SetMulticastHopLimit(255),
+		conn.SetMulticastInterface(a.iface),
+		conn.SetICMPFilter(&filter),
+		conn.JoinGroup(a.iface, &net.IPAddr{IP: net.IPv6linklocalallrouters}),
+	)
+	if err != nil {
+		conn.Close()
+		return E.Cause(err, "configure icmpv6 socket")
+	}
+	a.conn = conn
+	a.done = make(chan struct{})
+	go a.loopSend()
+	go a.loopSolicitation()
+	return nil
+}
+
+func (a *routerAdvertiser) close() error {
+	if a.conn == nil {
+		return nil
+	}
+	close(a.done)
+	err := a.send(0)
+	if err != nil {
+		a.logger.Debug(E.Cause(err, "send final router advertisement"))
+	}
+	return a.conn.Close()
+}
+
+func (a *routerAdvertiser) loopSend() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		err := a.send(a.routerLifetime)
+		if err != nil {
+			a.logger.Error(E.Cause(err, "send router advertisement"))
+		}
+		select {
+		case <-ticker.C:
+		case <-a.done:
+			return
+		}
+	}
+}
+
+func (a *routerAdvertiser) loopSolicitation() {
+	buffer := make([]byte, 1500)
+	for {
+		_, _, source, err := a.conn.ReadFrom(buffer)
+		if err != nil {
+			if !E.IsClosed(err) {
+				a.logger.Error(E.Cause(err, "read router solicitation"))
+			}
+			return
+		}
+		now := time.Now()
+		if now.Sub(a.lastSolicited) < minSolicitedInterval {
+			continue
+		}
+		a.lastSolicited = now
+		a.logger.Debug("router solicitation from ", source)
+		err = a.send(a.routerLifetime)
+		if err != nil {
+			a.logger.Error(E.Cause(err, "send router advertisement"))
+		}
+	}
+}
+
+func (a *routerAdvertiser) send(routerLifetime time.Duration) error {
+	message := icmp.Message{
+		Type: ipv6.ICMPTypeRouterAdvertisement,
+		Body: &icmp.RawBody{Data: a.buildAdvertisement(routerLifetime)},
+	}
+	content, err := message.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	a.writeAccess.Lock()
+	defer a.writeAccess.Unlock()
+	_, err = a.conn.WriteTo(content, nil, &net.IPAddr{IP: net.IPv6linklocalallnodes, Zone: a.iface.Name})
+	return err
+}
+
+// buildAdvertisement returns the router advertisement after the ICMPv6 header, see RFC 4861 and RFC 8106.
+func (a *routerAdvertiser) buildAdvertisement(routerLifetime time.Duration) []byte {
+	content := make([]byte, 12)
+	content[0] = 64
+	binary.BigEndian.PutUint16(content[2:], uint16(routerLifetime/time.Second))
+	if len(a.iface.HardwareAddr) == 6 {
+		content = append(content, 1, 1)
+		content = append(content, a.iface.HardwareAddr...)
+	}
+	for _, prefix := range a.prefixes {
+		option := make([]byte, 32)
+		option[0] = 3
+		option[1] = 4
+		option[2] = byte(prefix.Bits())
+		option[3] = 0xc0
+		binary.BigEndian.PutUint32(option[4:], uint32(prefixValidLifetime/time.Second))
+		binary.BigEndian.PutUint32(option[8:], uint32(prefixPreferLifetime/time.Second))
+		prefixAddress := prefix.Masked().Addr().As16()
+		copy(option[16:], prefixAddress[:])
+		content = append(content, option...)
+	}
+	optionLifetime := uint32(3 * a.interval / time.Second)
+	if len(a.dns) > 0 {
+		option := make([]byte, 8, 8+16*len(a.dns))
+		option[0] = 25
+		option[1] = byte(1 + 2*len(a.dns))
+		binary.BigEndian.PutUint32(option[4:], optionLifetime)
+		for _, address := range a.dns {
+			address16 := address.As16()
+			option = append(option, address16[:]...)
+		}
+		content = append(content, option...)
+	}
+	if a.domain != "" {
+		option := make([]byte, 8)
+		option[0] = 31
+		binary.BigEndian.PutUint32(option[4:], optionLifetime)
+		for _, label := range strings.Split(strings.Trim(a.domain, "."), ".") {
+			option = append(option, byte(len(label)))
+			option = append(option, label...)
+		}
+		option = append(option, 0)
+		for len(option)%8 != 0 {
+			option = append(option, 0)
+		}
+		option[1] = byte(len(option) / 8)
+		content = append(content, option...)
+	}
+	return content
+}
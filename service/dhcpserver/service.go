@@ -0,0 +1,278 @@
+//go:build linux
+
+package dhcpserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	boxService "github.com/sagernet/sing-box/adapter/service"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/service"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+)
+
+const (
+	defaultLeaseTime      = 12 * time.Hour
+	defaultRAInterval     = 200 * time.Second
+	defaultRouterLifetime = 30 * time.Minute
+	purgeInterval         = time.Minute
+)
+
+func RegisterService(registry *boxService.Registry) {
+	boxService.Register[option.DHCPServerServiceOptions](registry, C.TypeDHCPServer, NewService)
+}
+
+type Service struct {
+	boxService.Adapter
+	ctx           context.Context
+	logger        log.ContextLogger
+	options       option.DHCPServerServiceOptions
+	router        adapter.Router
+	cacheFile     adapter.CacheFile
+	staticLeases  []adapter.DHCPLease
+	leaseTime     time.Duration
+	prefix        netip.Prefix
+	serverAddress netip.Addr
+	gateway       netip.Addr
+	dns           []net.IP
+	pool          *leasePool
+	conn          *net.UDPConn
+	advertiser    *routerAdvertiser
+	done          chan struct{}
+}
+
+func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.DHCPServerServiceOptions) (adapter.Service, error) {
+	if options.Interface == "" {
+		return nil, E.New("missing interface")
+	}
+	if options.Address != nil && !netip.Prefix(*options.Address).Addr().Is4() {
+		return nil, E.New("address must be an IPv4 prefix")
+	}
+	var staticLeases []adapter.DHCPLease
+	for index, staticLease := range options.StaticLeases {
+		macAddress, err := net.ParseMAC(staticLease.MACAddress)
+		if err != nil {
+			return nil, E.Cause(err, "parse static_leases[", index, "]")
+		}
+		address := netip.Addr(staticLease.Address)
+		if !address.Is4() {
+			return nil, E.New("static_leases[", index, "]: address must be IPv4")
+		}
+		staticLeases = append(staticLeases, adapter.DHCPLease{
+			Address:    address,
+			MACAddress: macAddress,
+			Hostname:   staticLease.Hostname,
+		})
+	}
+	leaseTime := time.Duration(options.LeaseTime)
+	if leaseTime == 0 {
+		leaseTime = defaultLeaseTime
+	}
+	return &Service{
+		Adapter:      boxService.NewAdapter(C.TypeDHCPServer, tag),
+		ctx:          ctx,
+		logger:       logger,
+		options:      options,
+		router:       service.FromContext[adapter.Router](ctx),
+		cacheFile:    service.FromContext[adapter.CacheFile](ctx),
+		staticLeases: staticLeases,
+		leaseTime:    leaseTime,
+		done:         make(chan struct{}),
+	}, nil
+}
+
+func (s *Service) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	iface, err := net.InterfaceByName(s.options.Interface)
+	if err != nil {
+		return E.Cause(err, "find interface ", s.options.Interface)
+	}
+	addresses, err := interfacePrefixes(iface)
+	if err != nil {
+		return err
+	}
+	if s.options.Address != nil {
+		s.prefix = netip.Prefix(*s.options.Address)
+	} else {
+		for _, prefix := range addresses {
+			if prefix.Addr().Is4() {
+				s.prefix = prefix
+				break
+			}
+		}
+		if !s.prefix.IsValid() {
+			return E.New("missing IPv4 address on interface ", iface.Name)
+		}
+	}
+	s.serverAddress = s.prefix.Addr()
+	s.gateway = s.options.Router.Build(s.serverAddress)
+	if len(s.options.DNS) > 0 {
+		for _, address := range s.options.DNS {
+			s.dns = append(s.dns, address.AsSlice())
+		}
+	} else {
+		s.dns = []net.IP{s.serverAddress.AsSlice()}
+	}
+	rangeStart, rangeEnd := defaultRange(s.prefix)
+	rangeStart = s.options.RangeStart.Build(rangeStart)
+	rangeEnd = s.options.RangeEnd.Build(rangeEnd)
+	if !s.prefix.Contains(rangeStart) || !s.prefix.Contains(rangeEnd) || rangeStart.Compare(rangeEnd) > 0 {
+		return E.New("invalid range: ", rangeStart, " - ", rangeEnd, " for ", s.prefix)
+	}
+	s.pool = newLeasePool(s.prefix, rangeStart, rangeEnd, []netip.Addr{s.serverAddress, s.gateway}, s.staticLeases, s.leaseTime)
+	if s.cacheFile != nil {
+		s.pool.restore(s.cacheFile.LoadDHCPLeases(s.Tag()), time.Now())
+	}
+	s.conn, err = server4.NewIPv4UDPConn(iface.Name, &net.UDPAddr{Port: dhcpv4.ServerPort})
+	if err != nil {
+		return E.Cause(err, "listen dhcp")
+	}
+	go s.loopDHCPv4()
+	go s.loopPurge()
+	s.logger.Info("dhcp server started on ", iface.Name, ", range ", rangeStart, " - ", rangeEnd)
+	if s.options.RouterAdvertisement != nil && s.options.RouterAdvertisement.Enabled {
+		err = s.startRouterAdvertisement(iface, addresses)
+		if err != nil {
+			return err
+		}
+	}
+	s.updateNeighbors()
+	return nil
+}
+
+func (s *Service) startRouterAdvertisement(iface *net.Interface, addresses []netip.Prefix) error {
+	options := s.options.RouterAdvertisement
+	advertiser := &routerAdvertiser{
+		logger:         s.logger,
+		iface:          iface,
+		prefixes:       options.Prefix,
+		dns:            options.DNS,
+		domain:         s.options.Domain,
+		interval:       time.Duration(options.Interval),
+		routerLifetime: time.Duration(options.RouterLifetime),
+	}
+	if advertiser.interval == 0 {
+		advertiser.interval = defaultRAInterval
+	}
+	if advertiser.routerLifetime == 0 {
+		advertiser.routerLifetime = defaultRouterLifetime
+	}
+	var linkLocalAddress netip.Addr
+	for _, prefix := range addresses {
+		address := prefix.Addr()
+		if !address.Is6() {
+			continue
+		}
+		if address.IsLinkLocalUnicast() {
+			if !linkLocalAddress.IsValid() {
+				linkLocalAddress = address
+			}
+			continue
+		}
+		if len(options.Prefix) == 0 && prefix.Bits() == 64 {
+			advertiser.prefixes = append(advertiser.prefixes, prefix.Masked())
+		}
+		if len(options.DNS) == 0 && len(advertiser.dns) == 0 {
+			advertiser.dns = []netip.Addr{address}
+		}
+	}
+	if len(advertiser.dns) == 0 && linkLocalAddress.IsValid() {
+		advertiser.dns = []netip.Addr{linkLocalAddress}
+	}
+	err := advertiser.start(s.ctx)
+	if err != nil {
+		return E.Cause(err, "start router advertisement")
+	}
+	s.advertiser = advertiser
+	s.logger.Info("router advertisement started on ", iface.Name)
+	return nil
+}
+
+func (s *Service) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	var err error
+	if s.advertiser != nil {
+		err = s.advertiser.close()
+	}
+	return E.Errors(err, common.Close(common.PtrOrNil(s.conn)))
+}
+
+func (s *Service) loopPurge() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.pool.purge(time.Now()) {
+				s.leasesUpdated()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Service) leasesUpdated() {
+	if s.cacheFile != nil {
+		err := s.cacheFile.StoreDHCPLeases(s.Tag(), s.pool.entries(time.Now()))
+		if err != nil {
+			s.logger.Error(E.Cause(err, "save dhcp leases"))
+		}
+	}
+	s.updateNeighbors()
+}
+
+func (s *Service) updateNeighbors() {
+	if s.router == nil {
+		return
+	}
+	updater, loaded := s.router.NeighborResolver().(adapter.NeighborLeaseUpdater)
+	if !loaded {
+		return
+	}
+	leases := s.pool.entries(time.Now())
+	entries := make([]adapter.NeighborEntry, 0, len(leases))
+	for _, lease := range leases {
+		entries = append(entries, adapter.NeighborEntry{
+			Address:    lease.Address,
+			MACAddress: lease.MACAddress,
+			Hostname:   lease.Hostname,
+		})
+	}
+	updater.UpdateLeases("dhcp-server/"+s.Tag(), entries)
+}
+
+func interfacePrefixes(iface *net.Interface) ([]netip.Prefix, error) {
+	addresses, err := iface.Addrs()
+	if err != nil {
+		return nil, E.Cause(err, "list addresses of interface ", iface.Name)
+	}
+	var prefixes []netip.Prefix
+	for _, address := range addresses {
+		ipNet, isIPNet := address.(*net.IPNet)
+		if !isIPNet {
+			continue
+		}
+		ip, _ := netip.AddrFromSlice(ipNet.IP)
+		bits, _ := ipNet.Mask.Size()
+		prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), bits))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,154 @@
+//go:build linux
+
+package dhcpserver
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netns"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+func TestServiceNetns(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("requires iproute2")
+	}
+	suffix := strconv.Itoa(os.Getpid())
+	serverNS, clientNS := "sbdhcps"+suffix, "sbdhcpc"+suffix
+	run := func(args ...string) {
+		output, err := exec.Command("ip", args...).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	run("netns", "add", serverNS)
+	t.Cleanup(func() { exec.Command("ip", "netns", "del", serverNS).Run() })
+	run("netns", "add", clientNS)
+	t.Cleanup(func() { exec.Command("ip", "netns", "del", clientNS).Run() })
+	run("link", "add", "dhcps0", "netns", serverNS, "type", "veth", "peer", "name", "dhcpc0", "netns", clientNS)
+	run("-n", serverNS, "addr", "add", "192.168.77.1/24", "dev", "dhcps0")
+	run("-n", serverNS, "addr", "add", "fd77::1/64", "dev", "dhcps0", "nodad")
+	run("netns", "exec", serverNS, "sysctl", "-qw", "net.ipv6.conf.dhcps0.accept_dad=0")
+	run("netns", "exec", clientNS, "sysctl", "-qw", "net.ipv6.conf.dhcpc0.accept_dad=0")
+	run("-n", serverNS, "link", "set", "dhcps0", "up")
+	run("-n", clientNS, "link", "set", "dhcpc0", "up")
+
+	var dhcpService adapter.Service
+	inNetns(t, serverNS, func() {
+		var err error
+		dhcpService, err = NewService(context.Background(), log.NewNOPFactory().Logger(), "dhcp", option.DHCPServerServiceOptions{
+			Interface: "dhcps0",
+			Domain:    "lan",
+			StaticLeases: []option.DHCPStaticLease{{
+				MACAddress: "02:00:00:00:77:01",
+				Address:    badoption.Addr(netip.MustParseAddr("192.168.77.200")),
+				Hostname:   "printer",
+			}},
+			RouterAdvertisement: &option.DHCPServerRouterAdvertisementOptions{
+				Enabled:  true,
+				Interval: badoption.Duration(time.Second),
+			},
+		})
+		require.NoError(t, err)
+		require.NoError(t, dhcpService.Start(adapter.StartStateStart))
+	})
+	t.Cleanup(func() { dhcpService.Close() })
+
+	inNetns(t, clientNS, func() {
+		client, err := nclient4.New("dhcpc0", nclient4.WithTimeout(2*time.Second), nclient4.WithRetry(3))
+		require.NoError(t, err)
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		lease, err := client.Request(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "192.168.77.2", lease.ACK.YourIPAddr.String())
+		require.Equal(t, "192.168.77.1", lease.ACK.ServerIdentifier().String())
+		require.Equal(t, []net.IP{net.IPv4(192, 168, 77, 1).To4()}, lease.ACK.DNS())
+		require.Equal(t, "lan", lease.ACK.DomainName())
+
+		staticClient, err := nclient4.New("dhcpc0", nclient4.WithHWAddr(net.HardwareAddr{0x02, 0, 0, 0, 0x77, 0x01}), nclient4.WithTimeout(2*time.Second))
+		require.NoError(t, err)
+		defer staticClient.Close()
+		lease, err = staticClient.Request(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "192.168.77.200", lease.ACK.YourIPAddr.String())
+	})
+	entries := dhcpService.(*Service).pool.entries(time.Now())
+	require.Len(t, entries, 2)
+
+	inNetns(t, clientNS, func() {
+		packetConn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+		require.NoError(t, err)
+		defer packetConn.Close()
+		var filter ipv6.ICMPFilter
+		filter.SetAll(true)
+		filter.Accept(ipv6.ICMPTypeRouterAdvertisement)
+		require.NoError(t, packetConn.IPv6PacketConn().SetICMPFilter(&filter))
+		require.NoError(t, packetConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buffer := make([]byte, 1500)
+		n, _, err := packetConn.ReadFrom(buffer)
+		require.NoError(t, err)
+		message, err := icmp.ParseMessage(58, buffer[:n])
+		require.NoError(t, err)
+		require.Equal(t, ipv6.ICMPTypeRouterAdvertisement, message.Type)
+		prefix, dns := parseAdvertisement(message.Body.(*icmp.RawBody).Data)
+		require.Equal(t, []netip.Prefix{netip.MustParsePrefix("fd77::/64")}, prefix)
+		require.Equal(t, []netip.Addr{netip.MustParseAddr("fd77::1")}, dns)
+	})
+}
+
+func inNetns(t *testing.T, name string, block func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	origin, err := netns.Get()
+	require.NoError(t, err)
+	defer origin.Close()
+	handle, err := netns.GetFromName(name)
+	require.NoError(t, err)
+	defer handle.Close()
+	require.NoError(t, netns.Set(handle))
+	defer netns.Set(origin)
+	block()
+}
+
+func parseAdvertisement(content []byte) (prefixes []netip.Prefix, dns []netip.Addr) {
+	options := content[12:]
+	for len(options) >= 8 {
+		length := int(options[1]) * 8
+		if length == 0 || length > len(options) {
+			break
+		}
+		option := options[:length]
+		switch option[0] {
+		case 3:
+			prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom16([16]byte(option[16:32])), int(option[2])))
+		case 25:
+			if binary.BigEndian.Uint32(option[4:]) > 0 {
+				for address := option[8:]; len(address) >= 16; address = address[16:] {
+					dns = append(dns, netip.AddrFrom16([16]byte(address[:16])))
+				}
+			}
+		}
+		options = options[length:]
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package echkeys
+
+import (
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/service/filemanager"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const generatedHeader = "Generated"
+
+type echKey struct {
+	configID   uint8
+	privateKey []byte
+	config     []byte
+}
+
+// encodeKeys encodes keys in the "ECH KEYS" PEM format accepted by inbound TLS `ech.key`,
+// with the generation time of the current key stored as a PEM header.
+func encodeKeys(keys []echKey, generated time.Time) ([]byte, error) {
+	builder := cryptobyte.NewBuilder(nil)
+	for _, key := range keys {
+		builder.AddUint16LengthPrefixed(func(builder *cryptobyte.Builder) {
+			builder.AddBytes(key.privateKey)
+		})
+		builder.AddUint16LengthPrefixed(func(builder *cryptobyte.Builder) {
+			builder.AddBytes(key.config)
+		})
+	}
+	content, err := builder.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type: "ECH KEYS",
+		Headers: map[string]string{
+			generatedHeader: generated.UTC().Format(time.RFC3339),
+		},
+		Bytes: content,
+	}), nil
+}
+
+func decodeKeys(content []byte) ([]echKey, time.Time, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "ECH KEYS" {
+		return nil, time.Time{}, E.New("invalid ECH keys pem")
+	}
+	generated, err := time.Parse(time.RFC3339, block.Headers[generatedHeader])
+	if err != nil {
+		return nil, time.Time{}, E.Cause(err, "parse generation time")
+	}
+	var keys []echKey
+	rawString := cryptobyte.String(block.Bytes)
+	for !rawString.Empty() {
+		var key echKey
+		if !rawString.ReadUint16LengthPrefixed((*cryptobyte.String)(&key.privateKey)) {
+			return nil, time.Time{}, E.New("error parsing private key")
+		}
+		if !rawString.ReadUint16LengthPrefixed((*cryptobyte.String)(&key.config)) {
+			return nil, time.Time{}, E.New("error parsing config")
+		}
+		// ECHConfig: version(2) length(2) config_id(1) ...
+		if len(key.config) < 5 {
+			return nil, time.Time{}, E.New("invalid ECH config")
+		}
+		key.configID = key.config[4]
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, time.Time{}, E.New("empty ECH keys")
+	}
+	return keys, generated, nil
+}
+
+func encodeConfigList(keys []echKey) []byte {
+	builder := cryptobyte.NewBuilder(nil)
+	builder.AddUint16LengthPrefixed(func(builder *cryptobyte.Builder) {
+		for _, key := range keys {
+			builder.AddBytes(key.config)
+		}
+	})
+	return builder.BytesOrPanic()
+}
+
+func writeFile(ctx context.Context, path string, content []byte) error {
+	err := filemanager.MkdirAll(ctx, filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	temporaryPath := path + ".tmp"
+	err = filemanager.WriteFile(ctx, temporaryPath, content, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
@@ -0,0 +1,111 @@
+package echkeys
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/service/acme"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/service"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/libdns/libdns"
+	mDNS "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// dnsPublisher replaces the HTTPS records of the configured domains with
+// records carrying the current ECHConfigList.
+type dnsPublisher struct {
+	provider  libdns.RecordSetter
+	domain    []string
+	zone      string
+	alpn      []string
+	ttl       time.Duration
+	resolvers []string
+}
+
+func newDNSPublisher(ctx context.Context, logger log.ContextLogger, options option.ECHKeyManagerDNSOptions) (*dnsPublisher, error) {
+	if len(options.Domain) == 0 {
+		return nil, E.New("missing domain")
+	}
+	if options.Provider == nil || options.Provider.Provider == "" {
+		return nil, E.New("missing provider")
+	}
+	if options.Provider.TTL < 0 {
+		return nil, E.New("invalid ttl: ", options.Provider.TTL)
+	}
+	httpClientOptions := common.PtrValueOrDefault(options.HTTPClient)
+	httpClientManager := service.FromContext[adapter.HTTPClientManager](ctx)
+	transport, err := httpClientManager.ResolveTransport(ctx, logger, httpClientOptions)
+	if err != nil {
+		return nil, E.Cause(err, "create DNS provider http client")
+	}
+	provider, err := acme.NewDNSProvider(options.Provider, &http.Client{
+		Transport: transport,
+		Timeout:   certmagic.HTTPTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordSetter, isSetter := provider.(libdns.RecordSetter)
+	if !isSetter {
+		return nil, E.New("DNS provider ", options.Provider.Provider, " does not support setting HTTPS records")
+	}
+	domain := make([]string, 0, len(options.Domain))
+	for _, name := range options.Domain {
+		domain = append(domain, strings.ToLower(strings.TrimSuffix(name, ".")))
+	}
+	var zone string
+	if options.Zone != "" {
+		zone = mDNS.Fqdn(strings.ToLower(options.Zone))
+	}
+	return &dnsPublisher{
+		provider:  recordSetter,
+		domain:    domain,
+		zone:      zone,
+		alpn:      options.ALPN,
+		ttl:       time.Duration(options.Provider.TTL),
+		resolvers: options.Provider.Resolvers,
+	}, nil
+}
+
+func (p *dnsPublisher) Publish(ctx context.Context, echConfigList []byte) error {
+	params := libdns.SvcParams{
+		"ech": {base64.StdEncoding.EncodeToString(echConfigList)},
+	}
+	if len(p.alpn) > 0 {
+		params["alpn"] = p.alpn
+	}
+	var errors []error
+	for _, name := range p.domain {
+		zone := p.zone
+		if zone == "" {
+			var err error
+			zone, err = certmagic.FindZoneByFQDN(ctx, zap.NewNop(), mDNS.Fqdn(name), certmagic.RecursiveNameservers(p.resolvers))
+			if err != nil {
+				errors = append(errors, E.Cause(err, "find zone for ", name))
+				continue
+			}
+		}
+		_, err := p.provider.SetRecords(ctx, zone, []libdns.Record{libdns.ServiceBinding{
+			Scheme:   "https",
+			Name:     libdns.RelativeName(mDNS.Fqdn(name), zone),
+			TTL:      p.ttl,
+			Priority: 1,
+			Target:   ".",
+			Params:   params,
+		}})
+		if err != nil {
+			errors = append(errors, E.Cause(err, "set HTTPS record for ", name))
+		}
+	}
+	return E.Errors(errors...)
+}
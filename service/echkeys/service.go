@@ -0,0 +1,332 @@
+package echkeys
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	boxService "github.com/sagernet/sing-box/adapter/service"
+	"github.com/sagernet/sing-box/common/listener"
+	"github.com/sagernet/sing-box/common/tls"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/ntp"
+	aTLS "github.com/sagernet/sing/common/tls"
+	"github.com/sagernet/sing/common/x/list"
+	"github.com/sagernet/sing/service/filemanager"
+)
+
+const (
+	defaultDataDirectory    = "ech_keys"
+	defaultRotationInterval = 24 * time.Hour
+	minimumRotationInterval = time.Minute
+	rotateRetryDelay        = time.Minute
+)
+
+func RegisterService(registry *boxService.Registry) {
+	boxService.Register[option.ECHKeyManagerServiceOptions](registry, C.TypeECHKeyManager, NewService)
+}
+
+var _ adapter.ECHKeyManager = (*Service)(nil)
+
+type Service struct {
+	boxService.Adapter
+	ctx              context.Context
+	cancel           context.CancelFunc
+	logger           log.ContextLogger
+	listener         *listener.Listener
+	tlsConfig        tls.ServerConfig
+	httpServer       *http.Server
+	timeFunc         func() time.Time
+	publicName       string
+	keyPath          string
+	rotationInterval time.Duration
+	publisher        *dnsPublisher
+	done             chan struct{}
+
+	access    sync.RWMutex
+	keys      []echKey
+	generated time.Time
+	callbacks list.List[adapter.ECHKeysUpdateCallback]
+}
+
+func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.ECHKeyManagerServiceOptions) (adapter.Service, error) {
+	if options.PublicName == "" {
+		return nil, E.New("missing public_name")
+	}
+	rotationInterval := time.Duration(options.RotationInterval)
+	if rotationInterval == 0 {
+		rotationInterval = defaultRotationInterval
+	} else if rotationInterval < minimumRotationInterval {
+		return nil, E.New("rotation_interval must be at least ", minimumRotationInterval)
+	}
+	dataDirectory := options.DataDirectory
+	if dataDirectory == "" {
+		dataDirectory = defaultDataDirectory
+	}
+	dataDirectory = filemanager.BasePath(ctx, os.ExpandEnv(dataDirectory))
+	timeFunc := ntp.TimeFuncFromContext(ctx)
+	if timeFunc == nil {
+		timeFunc = time.Now
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Service{
+		Adapter:          boxService.NewAdapter(C.TypeECHKeyManager, tag),
+		ctx:              ctx,
+		cancel:           cancel,
+		logger:           logger,
+		timeFunc:         timeFunc,
+		publicName:       options.PublicName,
+		keyPath:          filepath.Join(dataDirectory, "keys.pem"),
+		rotationInterval: rotationInterval,
+	}
+	if options.DNS != nil {
+		publisher, err := newDNSPublisher(ctx, logger, *options.DNS)
+		if err != nil {
+			cancel()
+			return nil, E.Cause(err, "create DNS publisher")
+		}
+		if publisher.ttl >= rotationInterval {
+			logger.Warn("DNS record ttl is not less than rotation_interval, clients may use expired ECH configs")
+		}
+		s.publisher = publisher
+	}
+	if options.Listen != nil {
+		s.listener = listener.New(listener.Options{
+			Context: ctx,
+			Logger:  logger,
+			Network: []string{N.NetworkTCP},
+			Listen:  options.ListenOptions,
+		})
+		s.httpServer = &http.Server{
+			Handler: http.HandlerFunc(s.serveHTTP),
+		}
+		if options.TLS != nil {
+			tlsConfig, err := tls.NewServer(ctx, logger, common.PtrValueOrDefault(options.TLS))
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			s.tlsConfig = tlsConfig
+		}
+	}
+	return s, nil
+}
+
+func (s *Service) Start(stage adapter.StartStage) error {
+	switch stage {
+	case adapter.StartStateInitialize:
+		// inbounds look up keys in their start stage, so keys must be ready before that
+		err := s.loadKeys()
+		if err != nil {
+			return err
+		}
+	case adapter.StartStateStart:
+		if s.httpServer != nil {
+			err := s.startServer()
+			if err != nil {
+				return err
+			}
+		}
+		s.done = make(chan struct{})
+		go s.loopRotate()
+	}
+	return nil
+}
+
+func (s *Service) loadKeys() error {
+	content, err := os.ReadFile(s.keyPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return E.Cause(err, "read ECH keys")
+		}
+		return s.rotate()
+	}
+	keys, generated, err := decodeKeys(content)
+	if err != nil {
+		return E.Cause(err, "parse ECH keys from ", s.keyPath)
+	}
+	s.access.Lock()
+	s.keys = keys
+	s.generated = generated
+	s.access.Unlock()
+	if !s.timeFunc().Before(generated.Add(s.rotationInterval)) {
+		return s.rotate()
+	}
+	s.logger.Info("loaded ECH keys, next rotation at ", generated.Add(s.rotationInterval).Format(time.RFC3339))
+	return nil
+}
+
+func (s *Service) startServer() error {
+	if s.tlsConfig != nil {
+		err := s.tlsConfig.Start()
+		if err != nil {
+			return E.Cause(err, "create TLS config")
+		}
+	}
+	tcpListener, err := s.listener.ListenTCP()
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		tcpListener = aTLS.NewListener(tcpListener, s.tlsConfig)
+	}
+	go func() {
+		err = s.httpServer.Serve(tcpListener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("serve error: ", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Service) loopRotate() {
+	defer close(s.done)
+	s.publish()
+	for {
+		s.access.RLock()
+		nextRotation := s.generated.Add(s.rotationInterval)
+		s.access.RUnlock()
+		timer := time.NewTimer(nextRotation.Sub(s.timeFunc()))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		err := s.rotate()
+		if err != nil {
+			s.logger.Error(E.Cause(err, "rotate ECH keys"))
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(rotateRetryDelay):
+			}
+			continue
+		}
+		s.publish()
+	}
+}
+
+// rotate generates a new current key and keeps the previous current key,
+// so clients holding the last published ECHConfigList can still connect.
+func (s *Service) rotate() error {
+	s.access.Lock()
+	var configID uint8
+	if len(s.keys) > 0 {
+		configID = s.keys[0].configID + 1
+	}
+	privateKey, config, err := tls.ECHKeygen(configID, s.publicName)
+	if err != nil {
+		s.access.Unlock()
+		return E.Cause(err, "generate ECH key")
+	}
+	keys := []echKey{{configID: configID, privateKey: privateKey, config: config}}
+	if len(s.keys) > 0 {
+		keys = append(keys, s.keys[0])
+	}
+	generated := s.timeFunc()
+	content, err := encodeKeys(keys, generated)
+	if err == nil {
+		err = writeFile(s.ctx, s.keyPath, content)
+	}
+	if err != nil {
+		s.access.Unlock()
+		return E.Cause(err, "save ECH keys")
+	}
+	s.keys = keys
+	s.generated = generated
+	callbacks := s.callbacks.Array()
+	s.access.Unlock()
+	s.logger.Info("rotated ECH keys, next rotation at ", generated.Add(s.rotationInterval).Format(time.RFC3339))
+	for _, callback := range callbacks {
+		callback(content)
+	}
+	return nil
+}
+
+func (s *Service) publish() {
+	if s.publisher == nil {
+		return
+	}
+	err := s.publisher.Publish(s.ctx, s.ECHConfigList())
+	if err != nil {
+		s.logger.Error(E.Cause(err, "publish ECH config list"))
+		return
+	}
+	s.logger.Info("published ECH config list to DNS")
+}
+
+func (s *Service) ECHKeys() []byte {
+	s.access.RLock()
+	defer s.access.RUnlock()
+	content, _ := encodeKeys(s.keys, s.generated)
+	return content
+}
+
+func (s *Service) ECHConfigList() []byte {
+	s.access.RLock()
+	defer s.access.RUnlock()
+	if len(s.keys) == 0 {
+		return nil
+	}
+	return encodeConfigList(s.keys[:1])
+}
+
+func (s *Service) RegisterCallback(callback adapter.ECHKeysUpdateCallback) *list.Element[adapter.ECHKeysUpdateCallback] {
+	s.access.Lock()
+	defer s.access.Unlock()
+	return s.callbacks.PushBack(callback)
+}
+
+func (s *Service) UnregisterCallback(element *list.Element[adapter.ECHKeysUpdateCallback]) {
+	s.access.Lock()
+	defer s.access.Unlock()
+	s.callbacks.Remove(element)
+}
+
+func (s *Service) serveHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if request.URL.Path != "/" {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.access.RLock()
+	nextRotation := s.generated.Add(s.rotationInterval)
+	s.access.RUnlock()
+	maxAge := int64(nextRotation.Sub(s.timeFunc()) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	writer.Header().Set("Content-Type", "application/x-pem-file")
+	writer.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(maxAge, 10))
+	writer.Write(pem.EncodeToMemory(&pem.Block{Type: "ECH CONFIGS", Bytes: s.ECHConfigList()}))
+}
+
+func (s *Service) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.done != nil {
+		<-s.done
+	}
+	return common.Close(
+		common.PtrOrNil(s.httpServer),
+		common.PtrOrNil(s.listener),
+		s.tlsConfig,
+	)
+}
@@ -0,0 +1,135 @@
+package echkeys
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/common/tls"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/libdns/libdns"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T, dataDirectory string) *Service {
+	rawService, err := NewService(context.Background(), log.NewNOPFactory().Logger(), "ech", option.ECHKeyManagerServiceOptions{
+		PublicName:       "public.example.org",
+		DataDirectory:    dataDirectory,
+		RotationInterval: badoption.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+	return rawService.(*Service)
+}
+
+func parseTestKeys(t *testing.T, content []byte) [][]byte {
+	block, _ := pem.Decode(content)
+	require.NotNil(t, block)
+	require.Equal(t, "ECH KEYS", block.Type)
+	keys, err := tls.UnmarshalECHKeys(block.Bytes)
+	require.NoError(t, err)
+	var configs [][]byte
+	for _, key := range keys {
+		configs = append(configs, key.Config)
+	}
+	return configs
+}
+
+func TestRotate(t *testing.T) {
+	t.Parallel()
+	dataDirectory := t.TempDir()
+	service := newTestService(t, dataDirectory)
+	require.NoError(t, service.loadKeys())
+	initialConfigs := parseTestKeys(t, service.ECHKeys())
+	require.Len(t, initialConfigs, 1)
+
+	var updatedKeys []byte
+	element := service.RegisterCallback(func(echKeys []byte) {
+		updatedKeys = echKeys
+	})
+	require.NoError(t, service.rotate())
+	rotatedConfigs := parseTestKeys(t, updatedKeys)
+	require.Len(t, rotatedConfigs, 2)
+	require.Equal(t, initialConfigs[0], rotatedConfigs[1])
+	require.NotEqual(t, rotatedConfigs[0][4], rotatedConfigs[1][4])
+	require.Equal(t, encodeConfigList([]echKey{{config: rotatedConfigs[0]}}), service.ECHConfigList())
+	service.UnregisterCallback(element)
+
+	// keys survive restarts until the rotation interval elapses
+	reloaded := newTestService(t, dataDirectory)
+	require.NoError(t, reloaded.loadKeys())
+	require.Equal(t, rotatedConfigs, parseTestKeys(t, reloaded.ECHKeys()))
+
+	expired := newTestService(t, dataDirectory)
+	expired.timeFunc = func() time.Time {
+		return time.Now().Add(2 * time.Hour)
+	}
+	require.NoError(t, expired.loadKeys())
+	expiredConfigs := parseTestKeys(t, expired.ECHKeys())
+	require.Len(t, expiredConfigs, 2)
+	require.Equal(t, rotatedConfigs[0], expiredConfigs[1])
+}
+
+func TestServeHTTP(t *testing.T) {
+	t.Parallel()
+	service := newTestService(t, t.TempDir())
+	require.NoError(t, service.loadKeys())
+	recorder := httptest.NewRecorder()
+	service.serveHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	block, rest := pem.Decode(recorder.Body.Bytes())
+	require.NotNil(t, block)
+	require.Empty(t, rest)
+	require.Equal(t, "ECH CONFIGS", block.Type)
+	require.Equal(t, service.ECHConfigList(), block.Bytes)
+}
+
+type testDNSProvider struct {
+	access  sync.Mutex
+	zones   []string
+	records []libdns.Record
+}
+
+func (p *testDNSProvider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	p.access.Lock()
+	defer p.access.Unlock()
+	p.zones = append(p.zones, zone)
+	p.records = append(p.records, records...)
+	return records, nil
+}
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+	service := newTestService(t, t.TempDir())
+	require.NoError(t, service.loadKeys())
+	provider := &testDNSProvider{}
+	publisher := &dnsPublisher{
+		provider: provider,
+		domain:   []string{"example.org", "www.example.org"},
+		zone:     "example.org.",
+		alpn:     []string{"h2", "http/1.1"},
+		ttl:      5 * time.Minute,
+	}
+	require.NoError(t, publisher.Publish(context.Background(), service.ECHConfigList()))
+	require.Equal(t, []string{"example.org.", "example.org."}, provider.zones)
+	require.Len(t, provider.records, 2)
+	for i, name := range []string{"@", "www"} {
+		resourceRecord := provider.records[i].RR()
+		require.Equal(t, "HTTPS", resourceRecord.Type)
+		require.Equal(t, name, resourceRecord.Name)
+		require.Equal(t, 5*time.Minute, resourceRecord.TTL)
+		parsed, err := resourceRecord.Parse()
+		require.NoError(t, err)
+		serviceBinding := parsed.(libdns.ServiceBinding)
+		require.Equal(t, uint16(1), serviceBinding.Priority)
+		require.Equal(t, []string{"h2", "http/1.1"}, serviceBinding.Params["alpn"])
+		require.Equal(t, []string{base64.StdEncoding.EncodeToString(service.ECHConfigList())}, serviceBinding.Params["ech"])
+	}
+}
@@ -0,0 +1,106 @@
+package ntpserver
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"time"
+
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+const (
+	packetLength = 48
+
+	modeClient = 3
+	modeServer = 4
+
+	leapNotInSync = 3
+
+	// precision of the served clock as log2 seconds, about one microsecond.
+	clockPrecision = -20
+
+	// maxClockDrift is the frequency tolerance used to grow the root dispersion
+	// since the last synchronisation, see RFC 5905 PHI.
+	maxClockDrift = 15e-6
+)
+
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type header struct {
+	Leap           uint8
+	Version        uint8
+	Mode           uint8
+	Stratum        uint8
+	Poll           int8
+	Precision      int8
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+	ReferenceID    [4]byte
+	ReferenceTime  time.Time
+}
+
+// parseRequest returns the version, poll and transmit timestamp of a client request.
+func parseRequest(packet []byte) (version uint8, poll int8, transmitTime []byte, ok bool) {
+	if len(packet) < packetLength {
+		return
+	}
+	version = packet[0] >> 3 & 0x7
+	if packet[0]&0x7 != modeClient || version < 1 || version > 4 {
+		return
+	}
+	return version, int8(packet[2]), packet[40:48], true
+}
+
+func writeResponse(buffer []byte, response header, originTime []byte, receiveTime time.Time, transmitTime time.Time) {
+	buffer[0] = response.Leap<<6 | response.Version<<3 | response.Mode
+	buffer[1] = response.Stratum
+	buffer[2] = byte(response.Poll)
+	buffer[3] = byte(response.Precision)
+	binary.BigEndian.PutUint32(buffer[4:], toShortTime(response.RootDelay))
+	binary.BigEndian.PutUint32(buffer[8:], toShortTime(response.RootDispersion))
+	copy(buffer[12:16], response.ReferenceID[:])
+	binary.BigEndian.PutUint64(buffer[16:], toTimestamp(response.ReferenceTime))
+	copy(buffer[24:32], originTime)
+	binary.BigEndian.PutUint64(buffer[32:], toTimestamp(receiveTime))
+	binary.BigEndian.PutUint64(buffer[40:], toTimestamp(transmitTime))
+}
+
+func toTimestamp(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	nanoseconds := t.Sub(ntpEpoch)
+	seconds := uint64(nanoseconds / time.Second)
+	fraction := uint64(nanoseconds%time.Second) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+func toShortTime(duration time.Duration) uint32 {
+	if duration < 0 {
+		return 0
+	}
+	seconds := uint64(duration / time.Second)
+	if seconds > 0xffff {
+		return 0xffffffff
+	}
+	fraction := uint64(duration%time.Second) << 16 / uint64(time.Second)
+	return uint32(seconds<<16 | fraction)
+}
+
+// referenceID identifies the upstream server as in RFC 5905: the IPv4 address,
+// or the first four bytes of the MD5 hash of an IPv6 address or domain.
+func referenceID(server M.Socksaddr) [4]byte {
+	var id [4]byte
+	switch {
+	case server.IsIPv4():
+		id = server.Addr.As4()
+	case server.IsIPv6():
+		address := server.Addr.As16()
+		hash := md5.Sum(address[:])
+		copy(id[:], hash[:4])
+	case server.IsFqdn():
+		hash := md5.Sum([]byte(server.Fqdn))
+		copy(id[:], hash[:4])
+	}
+	return id
+}
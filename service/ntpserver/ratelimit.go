@@ -0,0 +1,50 @@
+package ntpserver
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/contrab/freelru"
+	"github.com/sagernet/sing/contrab/maphash"
+)
+
+const rateLimitCapacity = 8192
+
+// rateLimiter is a per-client token bucket, it is only used from the read loop.
+type rateLimiter struct {
+	interval time.Duration
+	burst    float64
+	buckets  *freelru.LRU[netip.Addr, bucket]
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	buckets := common.Must1(freelru.New[netip.Addr, bucket](rateLimitCapacity, maphash.NewHasher[netip.Addr]().Hash32))
+	buckets.SetLifetime(interval * time.Duration(burst))
+	return &rateLimiter{
+		interval: interval,
+		burst:    float64(burst),
+		buckets:  buckets,
+	}
+}
+
+func (l *rateLimiter) allow(address netip.Addr, now time.Time) bool {
+	current, loaded := l.buckets.Get(address)
+	if loaded {
+		current.tokens = min(l.burst, current.tokens+float64(now.Sub(current.last))/float64(l.interval))
+	} else {
+		current.tokens = l.burst
+	}
+	current.last = now
+	allowed := current.tokens >= 1
+	if allowed {
+		current.tokens--
+	}
+	l.buckets.Add(address, current)
+	return allowed
+}
@@ -0,0 +1,172 @@
+package ntpserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	boxService "github.com/sagernet/sing-box/adapter/service"
+	"github.com/sagernet/sing-box/common/listener"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/json/badoption"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/ntp"
+	"github.com/sagernet/sing/service"
+)
+
+const (
+	defaultRateLimitInterval = 2 * time.Second
+	defaultRateLimitBurst    = 8
+	maxStratum               = 15
+)
+
+func RegisterService(registry *boxService.Registry) {
+	boxService.Register[option.NTPServerServiceOptions](registry, C.TypeNTPServer, NewService)
+}
+
+type Service struct {
+	boxService.Adapter
+	logger      log.ContextLogger
+	listener    *listener.Listener
+	timeService ntp.TimeService
+	timeFunc    func() time.Time
+	stratum     uint8
+	rateLimiter *rateLimiter
+}
+
+func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.NTPServerServiceOptions) (adapter.Service, error) {
+	if options.Stratum > maxStratum {
+		return nil, E.New("invalid stratum: ", options.Stratum)
+	}
+	timeService := service.FromContext[ntp.TimeService](ctx)
+	if timeService == nil && options.Stratum == 0 {
+		return nil, E.New("NTP client is not enabled, set `stratum` to serve the system clock")
+	}
+	if options.Listen == nil {
+		options.Listen = (*badoption.Addr)(common.Ptr(netip.IPv6Unspecified()))
+	}
+	if options.ListenPort == 0 {
+		options.ListenPort = 123
+	}
+	var limiter *rateLimiter
+	if options.RateLimit != nil {
+		interval := time.Duration(options.RateLimit.Interval)
+		if interval <= 0 {
+			interval = defaultRateLimitInterval
+		}
+		burst := options.RateLimit.Burst
+		if burst <= 0 {
+			burst = defaultRateLimitBurst
+		}
+		limiter = newRateLimiter(interval, burst)
+	}
+	return &Service{
+		Adapter:     boxService.NewAdapter(C.TypeNTPServer, tag),
+		logger:      logger,
+		timeService: timeService,
+		stratum:     options.Stratum,
+		rateLimiter: limiter,
+		listener: listener.New(listener.Options{
+			Context: ctx,
+			Logger:  logger,
+			Network: []string{N.NetworkUDP},
+			Listen:  options.ListenOptions,
+		}),
+	}, nil
+}
+
+func (s *Service) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	if s.timeService != nil {
+		s.timeFunc = s.timeService.TimeFunc()
+	} else {
+		s.timeFunc = time.Now
+	}
+	packetConn, err := s.listener.ListenUDP()
+	if err != nil {
+		return err
+	}
+	go s.loopPacket(packetConn.(*net.UDPConn))
+	return nil
+}
+
+func (s *Service) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Service) loopPacket(conn *net.UDPConn) {
+	buffer := make([]byte, 1024)
+	response := make([]byte, packetLength)
+	for {
+		n, source, err := conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if E.IsClosedOrCanceled(err) {
+				return
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		receiveTime := s.timeFunc()
+		version, poll, transmitTime, ok := parseRequest(buffer[:n])
+		if !ok {
+			continue
+		}
+		if s.rateLimiter != nil && !s.rateLimiter.allow(source.Addr().Unmap(), time.Now()) {
+			s.logger.Trace("rate limited request from ", source)
+			continue
+		}
+		serverHeader := s.header(receiveTime)
+		serverHeader.Version = version
+		serverHeader.Poll = poll
+		writeResponse(response, serverHeader, transmitTime, receiveTime, s.timeFunc())
+		_, err = conn.WriteToUDPAddrPort(response, source)
+		if err != nil {
+			s.logger.Debug(E.Cause(err, "write response to ", source))
+		}
+	}
+}
+
+func (s *Service) header(now time.Time) header {
+	serverHeader := header{
+		Mode:      modeServer,
+		Precision: clockPrecision,
+	}
+	if s.timeService == nil {
+		serverHeader.Stratum = s.stratum
+		serverHeader.ReferenceID = [4]byte{'L', 'O', 'C', 'L'}
+		serverHeader.ReferenceTime = now
+		return serverHeader
+	}
+	var status adapter.TimeSyncStatus
+	if statusProvider, isProvider := s.timeService.(adapter.TimeSyncStatusProvider); isProvider {
+		status = statusProvider.SyncStatus()
+	}
+	serverHeader.ReferenceTime = status.LastSync
+	if !status.Synchronized {
+		serverHeader.Leap = leapNotInSync
+		if status.LastSync.IsZero() {
+			serverHeader.ReferenceID = [4]byte{'I', 'N', 'I', 'T'}
+		} else {
+			serverHeader.ReferenceID = referenceID(status.Server)
+		}
+		return serverHeader
+	}
+	serverHeader.Leap = status.Leap
+	if s.stratum > 0 {
+		serverHeader.Stratum = s.stratum
+	} else {
+		serverHeader.Stratum = min(status.Stratum+1, maxStratum)
+	}
+	serverHeader.ReferenceID = referenceID(status.Server)
+	serverHeader.RootDelay = status.RootDelay
+	serverHeader.RootDispersion = status.RootDispersion + time.Duration(float64(now.Sub(status.LastSync))*maxClockDrift)
+	return serverHeader
+}
@@ -0,0 +1,110 @@
+package ntpserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/common/ntp"
+	"github.com/sagernet/sing/service"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testTimeService struct {
+	offset time.Duration
+	status adapter.TimeSyncStatus
+}
+
+func (s *testTimeService) TimeFunc() func() time.Time {
+	return func() time.Time {
+		return time.Now().Add(s.offset)
+	}
+}
+
+func (s *testTimeService) SyncStatus() adapter.TimeSyncStatus {
+	return s.status
+}
+
+func startTestServer(t *testing.T, timeService ntp.TimeService, options option.NTPServerServiceOptions) M.Socksaddr {
+	ctx := context.Background()
+	if timeService != nil {
+		ctx = service.ContextWith[ntp.TimeService](ctx, timeService)
+	}
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(packetConn.LocalAddr().(*net.UDPAddr).Port)
+	packetConn.Close()
+	options.Listen = (*badoption.Addr)(common.Ptr(netip.AddrFrom4([4]byte{127, 0, 0, 1})))
+	options.ListenPort = port
+	ntpService, err := NewService(ctx, log.NewNOPFactory().Logger(), "ntp", options)
+	require.NoError(t, err)
+	require.NoError(t, ntpService.Start(adapter.StartStateStart))
+	t.Cleanup(func() { ntpService.Close() })
+	return M.ParseSocksaddrHostPort("127.0.0.1", port)
+}
+
+func TestServerSynchronized(t *testing.T) {
+	t.Parallel()
+	timeService := &testTimeService{
+		offset: time.Hour,
+		status: adapter.TimeSyncStatus{
+			Synchronized: true,
+			Server:       M.ParseSocksaddrHostPort("192.0.2.1", 123),
+			LastSync:     time.Now().Add(time.Hour),
+			Stratum:      2,
+			RootDelay:    10 * time.Millisecond,
+		},
+	}
+	serverAddr := startTestServer(t, timeService, option.NTPServerServiceOptions{})
+	response, err := ntp.Exchange(context.Background(), N.SystemDialer, serverAddr)
+	require.NoError(t, err)
+	require.NoError(t, response.Validate())
+	require.InDelta(t, time.Hour, response.ClockOffset, float64(time.Second))
+	require.Equal(t, uint8(3), response.Stratum)
+	require.Equal(t, ntp.LeapNoWarning, response.Leap)
+	require.Equal(t, uint32(0xc0000201), response.ReferenceID)
+}
+
+func TestServerUnsynchronized(t *testing.T) {
+	t.Parallel()
+	serverAddr := startTestServer(t, &testTimeService{}, option.NTPServerServiceOptions{})
+	response, err := ntp.Exchange(context.Background(), N.SystemDialer, serverAddr)
+	require.NoError(t, err)
+	require.Equal(t, ntp.LeapIndicator(ntp.LeapNotInSync), response.Leap)
+	require.Error(t, response.Validate())
+}
+
+func TestServerLocalClock(t *testing.T) {
+	t.Parallel()
+	_, err := NewService(context.Background(), log.NewNOPFactory().Logger(), "ntp", option.NTPServerServiceOptions{})
+	require.Error(t, err)
+	serverAddr := startTestServer(t, nil, option.NTPServerServiceOptions{Stratum: 1})
+	response, err := ntp.Exchange(context.Background(), N.SystemDialer, serverAddr)
+	require.NoError(t, err)
+	require.NoError(t, response.Validate())
+	require.Equal(t, uint8(1), response.Stratum)
+	require.Equal(t, "LOCL", string([]byte{byte(response.ReferenceID >> 24), byte(response.ReferenceID >> 16), byte(response.ReferenceID >> 8), byte(response.ReferenceID)}))
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+	limiter := newRateLimiter(time.Second, 2)
+	address := netip.MustParseAddr("192.0.2.1")
+	now := time.Now()
+	require.True(t, limiter.allow(address, now))
+	require.True(t, limiter.allow(address, now))
+	require.False(t, limiter.allow(address, now))
+	require.True(t, limiter.allow(netip.MustParseAddr("192.0.2.2"), now))
+	require.True(t, limiter.allow(address, now.Add(time.Second)))
+	require.False(t, limiter.allow(address, now.Add(time.Second)))
+}
@@ -0,0 +1,150 @@
+package ocm
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/log"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const defaultRateLimitCooldown = time.Minute
+
+type upstreamCredential struct {
+	path          string
+	accessMutex   sync.RWMutex
+	credentials   *oauthCredentials
+	cooldownUntil time.Time
+}
+
+// credentialPool spreads requests over the configured upstream credentials
+// and skips credentials that were recently rate limited.
+type credentialPool struct {
+	logger      log.ContextLogger
+	httpClient  *http.Client
+	access      sync.Mutex
+	credentials []*upstreamCredential
+	next        int
+}
+
+func newCredentialPool(logger log.ContextLogger, httpClient *http.Client, paths []string) *credentialPool {
+	pool := &credentialPool{
+		logger:     logger,
+		httpClient: httpClient,
+	}
+	for _, path := range paths {
+		pool.credentials = append(pool.credentials, &upstreamCredential{path: path})
+	}
+	return pool
+}
+
+func (p *credentialPool) Load() error {
+	for _, credential := range p.credentials {
+		credentials, err := platformReadCredentials(credential.path)
+		if err != nil {
+			if credential.path != "" {
+				return E.Cause(err, credential.path)
+			}
+			return err
+		}
+		credential.credentials = credentials
+	}
+	for _, credential := range p.credentials[1:] {
+		if credential.credentials.isAPIKeyMode() != p.credentials[0].credentials.isAPIKeyMode() {
+			return E.New("credentials must either all use API keys or all use ChatGPT login")
+		}
+	}
+	return nil
+}
+
+func (p *credentialPool) isAPIKeyMode() bool {
+	return p.credentials[0].credentials.isAPIKeyMode()
+}
+
+// Pick returns the next credential not tried yet, preferring those not in
+// cooldown. If every credential is cooling down, the one recovering first is
+// returned for the first attempt of a request.
+func (p *credentialPool) Pick(tried map[*upstreamCredential]bool) *upstreamCredential {
+	p.access.Lock()
+	defer p.access.Unlock()
+	now := time.Now()
+	var fallback *upstreamCredential
+	for i := range p.credentials {
+		index := (p.next + i) % len(p.credentials)
+		credential := p.credentials[index]
+		if tried[credential] {
+			continue
+		}
+		if !credential.cooldownUntil.After(now) {
+			p.next = index + 1
+			return credential
+		}
+		if fallback == nil || credential.cooldownUntil.Before(fallback.cooldownUntil) {
+			fallback = credential
+		}
+	}
+	if len(tried) > 0 {
+		return nil
+	}
+	return fallback
+}
+
+func (p *credentialPool) MarkRateLimited(credential *upstreamCredential, headers http.Header) {
+	cooldown := defaultRateLimitCooldown
+	if retryAfter, err := strconv.Atoi(strings.TrimSpace(headers.Get("Retry-After"))); err == nil && retryAfter > 0 {
+		cooldown = time.Duration(retryAfter) * time.Second
+	}
+	p.access.Lock()
+	credential.cooldownUntil = time.Now().Add(cooldown)
+	p.access.Unlock()
+	if len(p.credentials) > 1 {
+		p.logger.Warn("upstream credential ", credential.name(), " rate limited, cooling down for ", cooldown.Round(time.Second))
+	}
+}
+
+func (c *upstreamCredential) name() string {
+	if c.path == "" {
+		return "default"
+	}
+	return c.path
+}
+
+func (c *upstreamCredential) getAccessToken(httpClient *http.Client, logger log.ContextLogger) (string, error) {
+	c.accessMutex.RLock()
+	if !c.credentials.needsRefresh() {
+		token := c.credentials.getAccessToken()
+		c.accessMutex.RUnlock()
+		return token, nil
+	}
+	c.accessMutex.RUnlock()
+
+	c.accessMutex.Lock()
+	defer c.accessMutex.Unlock()
+
+	if !c.credentials.needsRefresh() {
+		return c.credentials.getAccessToken(), nil
+	}
+
+	newCredentials, err := refreshToken(httpClient, c.credentials)
+	if err != nil {
+		return "", err
+	}
+
+	c.credentials = newCredentials
+
+	err = platformWriteCredentials(newCredentials, c.path)
+	if err != nil {
+		logger.Warn("persist refreshed token: ", err)
+	}
+
+	return newCredentials.getAccessToken(), nil
+}
+
+func (c *upstreamCredential) getAccountID() string {
+	c.accessMutex.RLock()
+	defer c.accessMutex.RUnlock()
+	return c.credentials.getAccountID()
+}
@@ -127,9 +127,9 @@ type Service struct {
 	boxService.Adapter
 	ctx            context.Context
 	logger         log.ContextLogger
-	credentialPath string
-	credentials    *oauthCredentials
+	credentials    *credentialPool
 	users          []option.OCMUser
+	baseURL        string
 	dialer         N.Dialer
 	httpClient     *http.Client
 	httpHeaders    http.Header
@@ -137,7 +137,6 @@ type Service struct {
 	tlsConfig      tls.ServerConfig
 	httpServer     *http.Server
 	userManager    *UserManager
-	accessMutex    sync.RWMutex
 	usageTracker   *AggregatedUsage
 	webSocketMutex sync.Mutex
 	webSocketGroup sync.WaitGroup
@@ -146,6 +145,14 @@ type Service struct {
 }
 
 func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.OCMServiceOptions) (adapter.Service, error) {
+	credentialPaths := []string{options.CredentialPath}
+	if len(options.CredentialPaths) > 0 {
+		if options.CredentialPath != "" {
+			return nil, E.New("`credential_path` and `credential_paths` are mutually exclusive")
+		}
+		credentialPaths = options.CredentialPaths
+	}
+
 	serviceDialer, err := dialer.NewWithOptions(dialer.Options{
 		Context: ctx,
 		Options: option.DialerOptions{
@@ -173,9 +180,10 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 	userManager := &UserManager{
 		tokenMap: make(map[string]string),
 	}
+	userManager.UpdateUsers(options.Users)
 
 	var usageTracker *AggregatedUsage
-	if options.UsagesPath != "" {
+	if options.UsagesPath != "" || userManager.hasBudget() {
 		usageTracker = &AggregatedUsage{
 			LastUpdated:  time.Now(),
 			Combinations: make([]CostCombination, 0),
@@ -185,14 +193,14 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 	}
 
 	service := &Service{
-		Adapter:        boxService.NewAdapter(C.TypeOCM, tag),
-		ctx:            ctx,
-		logger:         logger,
-		credentialPath: options.CredentialPath,
-		users:          options.Users,
-		dialer:         serviceDialer,
-		httpClient:     httpClient,
-		httpHeaders:    options.Headers.Build(),
+		Adapter:     boxService.NewAdapter(C.TypeOCM, tag),
+		ctx:         ctx,
+		logger:      logger,
+		credentials: newCredentialPool(logger, httpClient, credentialPaths),
+		users:       options.Users,
+		dialer:      serviceDialer,
+		httpClient:  httpClient,
+		httpHeaders: options.Headers.Build(),
 		listener: listener.New(listener.Options{
 			Context: ctx,
 			Logger:  logger,
@@ -220,13 +228,10 @@ func (s *Service) Start(stage adapter.StartStage) error {
 		return nil
 	}
 
-	s.userManager.UpdateUsers(s.users)
-
-	credentials, err := platformReadCredentials(s.credentialPath)
+	err := s.credentials.Load()
 	if err != nil {
 		return E.Cause(err, "read credentials")
 	}
-	s.credentials = credentials
 
 	if s.usageTracker != nil {
 		err = s.usageTracker.Load()
@@ -269,54 +274,61 @@ func (s *Service) Start(stage adapter.StartStage) error {
 	return nil
 }
 
-func (s *Service) getAccessToken() (string, error) {
-	s.accessMutex.RLock()
-	if !s.credentials.needsRefresh() {
-		token := s.credentials.getAccessToken()
-		s.accessMutex.RUnlock()
-		return token, nil
+func (s *Service) isAPIKeyMode() bool {
+	return s.credentials.isAPIKeyMode()
+}
+
+func (s *Service) getBaseURL() string {
+	if s.baseURL != "" {
+		return s.baseURL
 	}
-	s.accessMutex.RUnlock()
+	if s.isAPIKeyMode() {
+		return openaiAPIBaseURL
+	}
+	return chatGPTBackendURL
+}
 
-	s.accessMutex.Lock()
-	defer s.accessMutex.Unlock()
+type accessTokenError struct {
+	err error
+}
 
-	if !s.credentials.needsRefresh() {
-		return s.credentials.getAccessToken(), nil
-	}
+func (e *accessTokenError) Error() string {
+	return e.err.Error()
+}
 
-	newCredentials, err := refreshToken(s.httpClient, s.credentials)
+func (s *Service) doUpstreamRequest(r *http.Request, credential *upstreamCredential, proxyPath string, requestBody []byte) (*http.Response, error) {
+	accessToken, err := credential.getAccessToken(s.httpClient, s.logger)
 	if err != nil {
-		return "", err
+		return nil, &accessTokenError{err}
 	}
 
-	s.credentials = newCredentials
-
-	err = platformWriteCredentials(newCredentials, s.credentialPath)
+	proxyURL := s.getBaseURL() + proxyPath
+	if r.URL.RawQuery != "" {
+		proxyURL += "?" + r.URL.RawQuery
+	}
+	proxyRequest, err := http.NewRequestWithContext(r.Context(), r.Method, proxyURL, bytes.NewReader(requestBody))
 	if err != nil {
-		s.logger.Warn("persist refreshed token: ", err)
+		return nil, err
 	}
 
-	return newCredentials.getAccessToken(), nil
-}
+	for key, values := range r.Header {
+		if !isHopByHopHeader(key) && key != "Authorization" {
+			proxyRequest.Header[key] = values
+		}
+	}
 
-func (s *Service) getAccountID() string {
-	s.accessMutex.RLock()
-	defer s.accessMutex.RUnlock()
-	return s.credentials.getAccountID()
-}
+	for key, values := range s.httpHeaders {
+		proxyRequest.Header.Del(key)
+		proxyRequest.Header[key] = values
+	}
 
-func (s *Service) isAPIKeyMode() bool {
-	s.accessMutex.RLock()
-	defer s.accessMutex.RUnlock()
-	return s.credentials.isAPIKeyMode()
-}
+	proxyRequest.Header.Set("Authorization", "Bearer "+accessToken)
 
-func (s *Service) getBaseURL() string {
-	if s.isAPIKeyMode() {
-		return openaiAPIBaseURL
+	if accountID := credential.getAccountID(); accountID != "" {
+		proxyRequest.Header.Set("ChatGPT-Account-Id", accountID)
 	}
-	return chatGPTBackendURL
+
+	return s.httpClient.Do(proxyRequest)
 }
 
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -366,61 +378,57 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var requestModel string
-
-	if s.usageTracker != nil && r.Body != nil {
-		bodyBytes, err := io.ReadAll(r.Body)
-		if err == nil {
-			var request struct {
-				Model string `json:"model"`
-			}
-			err := json.Unmarshal(bodyBytes, &request)
-			if err == nil {
-				requestModel = request.Model
-			}
-			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	var requestBody []byte
+	if r.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "invalid_request_error", "read request body: "+err.Error())
+			return
 		}
 	}
 
-	accessToken, err := s.getAccessToken()
-	if err != nil {
-		s.logger.Error("get access token: ", err)
-		writeJSONError(w, r, http.StatusUnauthorized, "authentication_error", "Authentication failed")
-		return
+	var request struct {
+		Model string `json:"model"`
 	}
+	json.Unmarshal(requestBody, &request)
+	requestModel := request.Model
 
-	proxyURL := s.getBaseURL() + proxyPath
-	if r.URL.RawQuery != "" {
-		proxyURL += "?" + r.URL.RawQuery
-	}
-	proxyRequest, err := http.NewRequestWithContext(r.Context(), r.Method, proxyURL, r.Body)
-	if err != nil {
-		s.logger.Error("create proxy request: ", err)
-		writeJSONError(w, r, http.StatusInternalServerError, "api_error", "Internal server error")
-		return
-	}
-
-	for key, values := range r.Header {
-		if !isHopByHopHeader(key) && key != "Authorization" {
-			proxyRequest.Header[key] = values
+	if username != "" {
+		limitErr := s.userManager.CheckRequest(username, requestModel, isModelEndpoint(r.Method, path), s.usageTracker, time.Now())
+		if limitErr != nil {
+			s.logger.Warn("rejected request from user ", username, ": ", limitErr)
+			writeJSONError(w, r, limitErr.statusCode, limitErr.errorType, limitErr.message)
+			return
 		}
 	}
 
-	for key, values := range s.httpHeaders {
-		proxyRequest.Header.Del(key)
-		proxyRequest.Header[key] = values
-	}
-
-	proxyRequest.Header.Set("Authorization", "Bearer "+accessToken)
-
-	if accountID := s.getAccountID(); accountID != "" {
-		proxyRequest.Header.Set("ChatGPT-Account-Id", accountID)
-	}
-
-	response, err := s.httpClient.Do(proxyRequest)
-	if err != nil {
-		writeJSONError(w, r, http.StatusBadGateway, "api_error", err.Error())
-		return
+	triedCredentials := make(map[*upstreamCredential]bool)
+	credential := s.credentials.Pick(triedCredentials)
+	var response *http.Response
+	for {
+		triedCredentials[credential] = true
+		var err error
+		response, err = s.doUpstreamRequest(r, credential, proxyPath, requestBody)
+		if err != nil {
+			var tokenErr *accessTokenError
+			if errors.As(err, &tokenErr) {
+				s.logger.Error("get access token: ", tokenErr.err)
+				writeJSONError(w, r, http.StatusUnauthorized, "authentication_error", "Authentication failed")
+			} else {
+				writeJSONError(w, r, http.StatusBadGateway, "api_error", err.Error())
+			}
+			return
+		}
+		if response.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+		s.credentials.MarkRateLimited(credential, response.Header)
+		credential = s.credentials.Pick(triedCredentials)
+		if credential == nil {
+			break
+		}
+		response.Body.Close()
 	}
 	defer response.Body.Close()
 
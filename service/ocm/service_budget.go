@@ -0,0 +1,59 @@
+package ocm
+
+import (
+	"time"
+)
+
+type UserSpend struct {
+	WeekStartUnix  int64   `json:"week_start_unix"`
+	WeekCostUSD    float64 `json:"week_cost_usd"`
+	MonthStartUnix int64   `json:"month_start_unix"`
+	MonthCostUSD   float64 `json:"month_cost_usd"`
+}
+
+// budgetPeriodStarts returns the start of the calendar week (Monday) and
+// month in UTC, which budgets are reset on.
+func budgetPeriodStarts(now time.Time) (int64, int64) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	weekStart := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return weekStart.Unix(), monthStart.Unix()
+}
+
+func (s *UserSpend) roll(now time.Time) {
+	weekStart, monthStart := budgetPeriodStarts(now)
+	if s.WeekStartUnix != weekStart {
+		s.WeekStartUnix = weekStart
+		s.WeekCostUSD = 0
+	}
+	if s.MonthStartUnix != monthStart {
+		s.MonthStartUnix = monthStart
+		s.MonthCostUSD = 0
+	}
+}
+
+func (u *AggregatedUsage) UserSpend(user string, now time.Time) (float64, float64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	spend := u.UserSpends[user]
+	if spend == nil {
+		return 0, 0
+	}
+	spend.roll(now)
+	return spend.WeekCostUSD, spend.MonthCostUSD
+}
+
+func (u *AggregatedUsage) addUserSpend(user string, cost float64, now time.Time) {
+	if u.UserSpends == nil {
+		u.UserSpends = make(map[string]*UserSpend)
+	}
+	spend := u.UserSpends[user]
+	if spend == nil {
+		spend = &UserSpend{}
+		u.UserSpends[user] = spend
+	}
+	spend.roll(now)
+	spend.WeekCostUSD += cost
+	spend.MonthCostUSD += cost
+}
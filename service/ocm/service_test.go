@@ -0,0 +1,147 @@
+package ocm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockUpstream struct {
+	access        sync.Mutex
+	requests      map[string]int
+	limitedTokens map[string]bool
+}
+
+func (u *mockUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	u.access.Lock()
+	u.requests[token]++
+	limited := u.limitedTokens[token]
+	u.access.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if limited {
+		w.Header().Set("Retry-After", "30")
+		writeJSONError(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", "rate limited")
+		return
+	}
+	var request struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":     "resp_test",
+		"object": "response",
+		"model":  request.Model,
+		"usage": map[string]any{
+			"input_tokens":  1000,
+			"output_tokens": 100000,
+		},
+	})
+}
+
+func (u *mockUpstream) count(token string) int {
+	u.access.Lock()
+	defer u.access.Unlock()
+	return u.requests[token]
+}
+
+func newTestService(t *testing.T, users []option.OCMUser, apiKeys []string, limitedKeys ...string) (*Service, *mockUpstream) {
+	upstream := &mockUpstream{
+		requests:      make(map[string]int),
+		limitedTokens: make(map[string]bool),
+	}
+	for _, apiKey := range limitedKeys {
+		upstream.limitedTokens[apiKey] = true
+	}
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	var credentialPaths []string
+	for _, apiKey := range apiKeys {
+		credentialPath := filepath.Join(t.TempDir(), "auth.json")
+		require.NoError(t, writeCredentialsToFile(&oauthCredentials{APIKey: apiKey}, credentialPath))
+		credentialPaths = append(credentialPaths, credentialPath)
+	}
+	logger := log.NewNOPFactory().Logger()
+	service := &Service{
+		logger:         logger,
+		credentials:    newCredentialPool(logger, server.Client(), credentialPaths),
+		users:          users,
+		baseURL:        server.URL,
+		httpClient:     server.Client(),
+		httpHeaders:    make(http.Header),
+		userManager:    &UserManager{},
+		usageTracker:   &AggregatedUsage{logger: logger},
+		webSocketConns: make(map[*webSocketSession]struct{}),
+	}
+	service.userManager.UpdateUsers(users)
+	require.NoError(t, service.credentials.Load())
+	return service, upstream
+}
+
+func sendTestRequest(service *Service, token string, model string) *httptest.ResponseRecorder {
+	return sendTestRequestBody(service, token, `{"model":"`+model+`","input":"hello"}`)
+}
+
+func sendTestRequestBody(service *Service, token string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	service.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCredentialFailover(t *testing.T) {
+	t.Parallel()
+	users := []option.OCMUser{{Name: "alice", Token: "alice-token"}}
+	service, upstream := newTestService(t, users, []string{"key-a", "key-b"}, "key-a")
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "alice-token", "gpt-5").Code)
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "alice-token", "gpt-5").Code)
+	require.Equal(t, 1, upstream.count("key-a"))
+	require.Equal(t, 2, upstream.count("key-b"))
+}
+
+func TestMixedCredentialModes(t *testing.T) {
+	t.Parallel()
+	apiKeyPath := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, writeCredentialsToFile(&oauthCredentials{APIKey: "key"}, apiKeyPath))
+	oauthPath := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, writeCredentialsToFile(&oauthCredentials{Tokens: &tokenData{AccessToken: "token"}}, oauthPath))
+	pool := newCredentialPool(log.NewNOPFactory().Logger(), http.DefaultClient, []string{apiKeyPath, oauthPath})
+	require.Error(t, pool.Load())
+}
+
+func TestUserLimits(t *testing.T) {
+	t.Parallel()
+	users := []option.OCMUser{
+		{Name: "budget", Token: "budget-token", MonthlyBudget: 0.5},
+		{Name: "models", Token: "models-token", AllowedModels: []string{"gpt-5-mini"}},
+		{Name: "rate", Token: "rate-token", RequestsPerMinute: 1},
+	}
+	service, upstream := newTestService(t, users, []string{"key"})
+
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "budget-token", "gpt-5").Code)
+	weeklyCost, monthlyCost := service.usageTracker.UserSpend("budget", time.Now())
+	require.Greater(t, weeklyCost, 0.5)
+	require.Equal(t, weeklyCost, monthlyCost)
+	require.Equal(t, http.StatusTooManyRequests, sendTestRequest(service, "budget-token", "gpt-5").Code)
+
+	require.Equal(t, http.StatusForbidden, sendTestRequest(service, "models-token", "gpt-5").Code)
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "models-token", "gpt-5-mini").Code)
+	require.Equal(t, http.StatusForbidden, sendTestRequestBody(service, "models-token", `{"model":["gpt-5-mini"]}`).Code)
+	require.Equal(t, http.StatusForbidden, sendTestRequestBody(service, "models-token", `not json`).Code)
+
+	require.Equal(t, http.StatusOK, sendTestRequest(service, "rate-token", "gpt-5").Code)
+	require.Equal(t, http.StatusTooManyRequests, sendTestRequest(service, "rate-token", "gpt-5").Code)
+
+	require.Equal(t, 3, upstream.count("key"))
+}
@@ -53,8 +53,9 @@ type CostCombination struct {
 }
 
 type AggregatedUsage struct {
-	LastUpdated  time.Time         `json:"last_updated"`
-	Combinations []CostCombination `json:"combinations"`
+	LastUpdated  time.Time             `json:"last_updated"`
+	Combinations []CostCombination     `json:"combinations"`
+	UserSpends   map[string]*UserSpend `json:"user_spends,omitempty"`
 	mutex        sync.Mutex
 	filePath     string
 	logger       log.ContextLogger
@@ -92,6 +93,7 @@ type AggregatedUsageJSON struct {
 	LastUpdated  time.Time             `json:"last_updated"`
 	Costs        CostsSummaryJSON      `json:"costs"`
 	Combinations []CostCombinationJSON `json:"combinations"`
+	UserSpends   map[string]*UserSpend `json:"user_spends,omitempty"`
 }
 
 type WeeklyCycleHint struct {
@@ -849,15 +851,17 @@ func normalizeGPT5Model(model string) string {
 }
 
 func calculateCost(stats UsageStats, model string, serviceTier string, contextWindow int) float64 {
+	return roundCost(calculateRawCost(stats, model, serviceTier, contextWindow))
+}
+
+func calculateRawCost(stats UsageStats, model string, serviceTier string, contextWindow int) float64 {
 	pricing := getPricing(model, serviceTier, contextWindow)
 
 	regularInputTokens := max(stats.InputTokens-stats.CachedTokens, 0)
 
-	cost := (float64(regularInputTokens)*pricing.InputPrice +
+	return (float64(regularInputTokens)*pricing.InputPrice +
 		float64(stats.OutputTokens)*pricing.OutputPrice +
 		float64(stats.CachedTokens)*pricing.CachedInputPrice) / 1_000_000
-
-	return math.Round(cost*100) / 100
 }
 
 func roundCost(cost float64) float64 {
@@ -1062,6 +1066,14 @@ func (u *AggregatedUsage) ToJSON() *AggregatedUsageJSON {
 		result.Costs.ByUser[user] = roundCost(cost)
 	}
 
+	if len(u.UserSpends) > 0 {
+		result.UserSpends = make(map[string]*UserSpend, len(u.UserSpends))
+		for user, spend := range u.UserSpends {
+			spendCopy := *spend
+			result.UserSpends[user] = &spendCopy
+		}
+	}
+
 	return result
 }
 
@@ -1071,7 +1083,11 @@ func (u *AggregatedUsage) Load() error {
 
 	u.LastUpdated = time.Time{}
 	u.Combinations = nil
+	u.UserSpends = nil
 
+	if u.filePath == "" {
+		return nil
+	}
 	data, err := os.ReadFile(u.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -1081,8 +1097,9 @@ func (u *AggregatedUsage) Load() error {
 	}
 
 	var temp struct {
-		LastUpdated  time.Time         `json:"last_updated"`
-		Combinations []CostCombination `json:"combinations"`
+		LastUpdated  time.Time             `json:"last_updated"`
+		Combinations []CostCombination     `json:"combinations"`
+		UserSpends   map[string]*UserSpend `json:"user_spends"`
 	}
 
 	err = json.Unmarshal(data, &temp)
@@ -1092,12 +1109,16 @@ func (u *AggregatedUsage) Load() error {
 
 	u.LastUpdated = temp.LastUpdated
 	u.Combinations = temp.Combinations
+	u.UserSpends = temp.UserSpends
 	normalizeCombinations(u.Combinations)
 
 	return nil
 }
 
 func (u *AggregatedUsage) Save() error {
+	if u.filePath == "" {
+		return nil
+	}
 	jsonData := u.ToJSON()
 
 	data, err := json.MarshalIndent(jsonData, "", "  ")
@@ -1145,6 +1166,14 @@ func (u *AggregatedUsage) AddUsageWithCycleHint(model string, contextWindow int,
 
 	addUsageToCombinations(&u.Combinations, model, normalizedServiceTier, contextWindow, weekStartUnix, user, inputTokens, outputTokens, cachedTokens)
 
+	if user != "" {
+		u.addUserSpend(user, calculateRawCost(UsageStats{
+			InputTokens:  inputTokens,
+			OutputTokens: outputTokens,
+			CachedTokens: cachedTokens,
+		}, model, normalizedServiceTier, contextWindow), observedAt)
+	}
+
 	go u.scheduleSave()
 
 	return nil
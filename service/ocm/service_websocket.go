@@ -1,9 +1,11 @@
 package ocm
 
 import (
+	"bufio"
 	"context"
 	stdTLS "crypto/tls"
 	"encoding/json"
+	"errors"
 	"io"
 	"net"
 	"net/http"
@@ -22,9 +24,16 @@ import (
 )
 
 type webSocketSession struct {
-	clientConn   net.Conn
-	upstreamConn net.Conn
-	closeOnce    sync.Once
+	clientConn        net.Conn
+	clientWriteAccess sync.Mutex
+	upstreamConn      net.Conn
+	closeOnce         sync.Once
+}
+
+func (s *webSocketSession) writeClientMessage(opCode ws.OpCode, data []byte) error {
+	s.clientWriteAccess.Lock()
+	defer s.clientWriteAccess.Unlock()
+	return wsutil.WriteServerMessage(s.clientConn, opCode, data)
 }
 
 func (s *webSocketSession) Close() {
@@ -76,12 +85,10 @@ func isForwardableWebSocketRequestHeader(key string) bool {
 	}
 }
 
-func (s *Service) handleWebSocket(w http.ResponseWriter, r *http.Request, proxyPath string, username string) {
-	accessToken, err := s.getAccessToken()
+func (s *Service) dialUpstreamWebSocket(r *http.Request, credential *upstreamCredential, proxyPath string) (net.Conn, *bufio.Reader, http.Header, error) {
+	accessToken, err := credential.getAccessToken(s.httpClient, s.logger)
 	if err != nil {
-		s.logger.Error("get access token for websocket: ", err)
-		writeJSONError(w, r, http.StatusUnauthorized, "authentication_error", "authentication failed")
-		return
+		return nil, nil, nil, &accessTokenError{err}
 	}
 
 	upstreamURL := buildUpstreamWebSocketURL(s.getBaseURL(), proxyPath)
@@ -100,7 +107,7 @@ func (s *Service) handleWebSocket(w http.ResponseWriter, r *http.Request, proxyP
 		upstreamHeaders[key] = values
 	}
 	upstreamHeaders.Set("Authorization", "Bearer "+accessToken)
-	if accountID := s.getAccountID(); accountID != "" {
+	if accountID := credential.getAccountID(); accountID != "" {
 		upstreamHeaders.Set("ChatGPT-Account-Id", accountID)
 	}
 
@@ -122,8 +129,45 @@ func (s *Service) handleWebSocket(w http.ResponseWriter, r *http.Request, proxyP
 
 	upstreamConn, upstreamBufferedReader, _, err := upstreamDialer.Dial(r.Context(), upstreamURL)
 	if err != nil {
-		s.logger.Error("dial upstream websocket: ", err)
-		writeJSONError(w, r, http.StatusBadGateway, "api_error", "upstream websocket connection failed")
+		return nil, nil, upstreamResponseHeaders, err
+	}
+	return upstreamConn, upstreamBufferedReader, upstreamResponseHeaders, nil
+}
+
+func (s *Service) handleWebSocket(w http.ResponseWriter, r *http.Request, proxyPath string, username string) {
+	var (
+		upstreamConn            net.Conn
+		upstreamBufferedReader  *bufio.Reader
+		upstreamResponseHeaders http.Header
+		err                     error
+	)
+	triedCredentials := make(map[*upstreamCredential]bool)
+	credential := s.credentials.Pick(triedCredentials)
+	for {
+		triedCredentials[credential] = true
+		upstreamConn, upstreamBufferedReader, upstreamResponseHeaders, err = s.dialUpstreamWebSocket(r, credential, proxyPath)
+		var statusErr ws.StatusError
+		if !errors.As(err, &statusErr) || statusErr != http.StatusTooManyRequests {
+			break
+		}
+		s.credentials.MarkRateLimited(credential, upstreamResponseHeaders)
+		credential = s.credentials.Pick(triedCredentials)
+		if credential == nil {
+			break
+		}
+	}
+	if err != nil {
+		var tokenErr *accessTokenError
+		var statusErr ws.StatusError
+		if errors.As(err, &tokenErr) {
+			s.logger.Error("get access token for websocket: ", tokenErr.err)
+			writeJSONError(w, r, http.StatusUnauthorized, "authentication_error", "authentication failed")
+		} else if errors.As(err, &statusErr) && statusErr == http.StatusTooManyRequests {
+			writeJSONError(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", "upstream rate limited")
+		} else {
+			s.logger.Error("dial upstream websocket: ", err)
+			writeJSONError(w, r, http.StatusBadGateway, "api_error", "upstream websocket connection failed")
+		}
 		return
 	}
 
@@ -177,19 +221,19 @@ func (s *Service) handleWebSocket(w http.ResponseWriter, r *http.Request, proxyP
 	go func() {
 		defer waitGroup.Done()
 		defer session.Close()
-		s.proxyWebSocketClientToUpstream(clientConn, upstreamConn, modelChannel)
+		s.proxyWebSocketClientToUpstream(session, modelChannel, username)
 	}()
 	go func() {
 		defer waitGroup.Done()
 		defer session.Close()
-		s.proxyWebSocketUpstreamToClient(upstreamReadWriter, clientConn, modelChannel, username, weeklyCycleHint)
+		s.proxyWebSocketUpstreamToClient(upstreamReadWriter, session, modelChannel, username, weeklyCycleHint)
 	}()
 	waitGroup.Wait()
 }
 
-func (s *Service) proxyWebSocketClientToUpstream(clientConn net.Conn, upstreamConn net.Conn, modelChannel chan<- string) {
+func (s *Service) proxyWebSocketClientToUpstream(session *webSocketSession, modelChannel chan<- string, username string) {
 	for {
-		data, opCode, err := wsutil.ReadClientData(clientConn)
+		data, opCode, err := wsutil.ReadClientData(session.clientConn)
 		if err != nil {
 			if !E.IsClosedOrCanceled(err) {
 				s.logger.Debug("read client websocket: ", err)
@@ -197,20 +241,36 @@ func (s *Service) proxyWebSocketClientToUpstream(clientConn net.Conn, upstreamCo
 			return
 		}
 
-		if opCode == ws.OpText && s.usageTracker != nil {
+		if opCode == ws.OpText && (s.usageTracker != nil || username != "") {
+			var event struct {
+				Type string `json:"type"`
+			}
 			var request struct {
-				Type  string `json:"type"`
 				Model string `json:"model"`
 			}
-			if json.Unmarshal(data, &request) == nil && request.Type == "response.create" && request.Model != "" {
-				select {
-				case modelChannel <- request.Model:
-				default:
+			if json.Unmarshal(data, &event) == nil && event.Type == "response.create" {
+				json.Unmarshal(data, &request)
+				if username != "" {
+					limitErr := s.userManager.CheckRequest(username, request.Model, true, s.usageTracker, time.Now())
+					if limitErr != nil {
+						s.logger.Warn("rejected websocket request from user ", username, ": ", limitErr)
+						err = s.writeWebSocketError(session, limitErr)
+						if err != nil {
+							return
+						}
+						continue
+					}
+				}
+				if request.Model != "" {
+					select {
+					case modelChannel <- request.Model:
+					default:
+					}
 				}
 			}
 		}
 
-		err = wsutil.WriteClientMessage(upstreamConn, opCode, data)
+		err = wsutil.WriteClientMessage(session.upstreamConn, opCode, data)
 		if err != nil {
 			if !E.IsClosedOrCanceled(err) {
 				s.logger.Debug("write upstream websocket: ", err)
@@ -220,7 +280,7 @@ func (s *Service) proxyWebSocketClientToUpstream(clientConn net.Conn, upstreamCo
 	}
 }
 
-func (s *Service) proxyWebSocketUpstreamToClient(upstreamReadWriter io.ReadWriter, clientConn net.Conn, modelChannel <-chan string, username string, weeklyCycleHint *WeeklyCycleHint) {
+func (s *Service) proxyWebSocketUpstreamToClient(upstreamReadWriter io.ReadWriter, session *webSocketSession, modelChannel <-chan string, username string, weeklyCycleHint *WeeklyCycleHint) {
 	var requestModel string
 	for {
 		data, opCode, err := wsutil.ReadServerData(upstreamReadWriter)
@@ -274,7 +334,7 @@ func (s *Service) proxyWebSocketUpstreamToClient(upstreamReadWriter io.ReadWrite
 			}
 		}
 
-		err = wsutil.WriteServerMessage(clientConn, opCode, data)
+		err = session.writeClientMessage(opCode, data)
 		if err != nil {
 			if !E.IsClosedOrCanceled(err) {
 				s.logger.Debug("write client websocket: ", err)
@@ -283,3 +343,18 @@ func (s *Service) proxyWebSocketUpstreamToClient(upstreamReadWriter io.ReadWrite
 		}
 	}
 }
+
+func (s *Service) writeWebSocketError(session *webSocketSession, limitErr *userLimitError) error {
+	data, err := json.Marshal(map[string]any{
+		"type":   "error",
+		"status": limitErr.statusCode,
+		"error": errorDetails{
+			Type:    limitErr.errorType,
+			Message: limitErr.message,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return session.writeClientMessage(ws.OpText, data)
+}
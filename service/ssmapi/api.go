@@ -51,14 +51,18 @@ func (s *APIServer) getServerInfo(writer http.ResponseWriter, request *http.Requ
 }
 
 type UserObject struct {
-	UserName        string `json:"username"`
-	Password        string `json:"uPSK,omitempty"`
-	DownlinkBytes   int64  `json:"downlinkBytes"`
-	UplinkBytes     int64  `json:"uplinkBytes"`
-	DownlinkPackets int64  `json:"downlinkPackets"`
-	UplinkPackets   int64  `json:"uplinkPackets"`
-	TCPSessions     int64  `json:"tcpSessions"`
-	UDPSessions     int64  `json:"udpSessions"`
+	UserName string `json:"username"`
+	Password string `json:"uPSK,omitempty"`
+	TrafficObject
+}
+
+type TrafficObject struct {
+	DownlinkBytes   int64 `json:"downlinkBytes"`
+	UplinkBytes     int64 `json:"uplinkBytes"`
+	DownlinkPackets int64 `json:"downlinkPackets"`
+	UplinkPackets   int64 `json:"uplinkPackets"`
+	TCPSessions     int64 `json:"tcpSessions"`
+	UDPSessions     int64 `json:"udpSessions"`
 }
 
 func (s *APIServer) listUser(writer http.ResponseWriter, request *http.Request) {
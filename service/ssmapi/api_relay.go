@@ -0,0 +1,197 @@
+package ssmapi
+
+import (
+	"net/http"
+
+	C "github.com/sagernet/sing-box/constant"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	sHTTP "github.com/sagernet/sing/protocol/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type RelayAPIServer struct {
+	logger      logger.Logger
+	traffic     *TrafficManager
+	destination *DestinationManager
+}
+
+func NewRelayAPIServer(logger logger.Logger, traffic *TrafficManager, destination *DestinationManager) *RelayAPIServer {
+	return &RelayAPIServer{
+		logger:      logger,
+		traffic:     traffic,
+		destination: destination,
+	}
+}
+
+func (s *RelayAPIServer) Route(r chi.Router) {
+	r.Route("/server/v1", func(r chi.Router) {
+		r.Use(func(handler http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				s.logger.Debug(request.Method, " ", request.RequestURI, " ", sHTTP.SourceAddress(request))
+				handler.ServeHTTP(writer, request)
+			})
+		})
+		r.Get("/", s.getServerInfo)
+		r.Get("/destinations", s.listDestination)
+		r.Post("/destinations", s.addDestination)
+		r.Get("/destinations/{name}", s.getDestination)
+		r.Put("/destinations/{name}", s.updateDestination)
+		r.Delete("/destinations/{name}", s.deleteDestination)
+		r.Get("/stats", s.getStats)
+	})
+}
+
+func (s *RelayAPIServer) getServerInfo(writer http.ResponseWriter, request *http.Request) {
+	render.JSON(writer, request, render.M{
+		"server":     "sing-box " + C.Version,
+		"apiVersion": "v1",
+		"relay":      true,
+	})
+}
+
+type DestinationObject struct {
+	Name       string `json:"name"`
+	Password   string `json:"uPSK,omitempty"`
+	Server     string `json:"server,omitempty"`
+	ServerPort uint16 `json:"server_port,omitempty"`
+	TrafficObject
+}
+
+type destinationRequest struct {
+	Name       string `json:"name"`
+	Password   string `json:"uPSK"`
+	Server     string `json:"server"`
+	ServerPort uint16 `json:"server_port"`
+}
+
+func (r *destinationRequest) build() (M.Socksaddr, error) {
+	if r.Password == "" {
+		return M.Socksaddr{}, E.New("missing uPSK")
+	}
+	server := M.ParseSocksaddrHostPort(r.Server, r.ServerPort)
+	if !server.IsValid() || server.Port == 0 {
+		return M.Socksaddr{}, E.New("invalid server address")
+	}
+	return server, nil
+}
+
+func (s *RelayAPIServer) listDestination(writer http.ResponseWriter, request *http.Request) {
+	render.JSON(writer, request, render.M{
+		"destinations": s.destination.List(),
+	})
+}
+
+func (s *RelayAPIServer) addDestination(writer http.ResponseWriter, request *http.Request) {
+	var addRequest destinationRequest
+	err := render.DecodeJSON(request.Body, &addRequest)
+	if err != nil {
+		render.Status(request, http.StatusBadRequest)
+		render.PlainText(writer, request, err.Error())
+		return
+	}
+	if addRequest.Name == "" {
+		render.Status(request, http.StatusBadRequest)
+		render.PlainText(writer, request, "missing name")
+		return
+	}
+	server, err := addRequest.build()
+	if err == nil {
+		err = s.destination.Add(addRequest.Name, addRequest.Password, server)
+	}
+	if err != nil {
+		render.Status(request, http.StatusBadRequest)
+		render.PlainText(writer, request, err.Error())
+		return
+	}
+	writer.WriteHeader(http.StatusCreated)
+}
+
+func (s *RelayAPIServer) getDestination(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	if name == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	destination, loaded := s.destination.Get(name)
+	if !loaded {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.traffic.ReadDestination(destination)
+	render.JSON(writer, request, destination)
+}
+
+func (s *RelayAPIServer) updateDestination(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	if name == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var updateRequest destinationRequest
+	err := render.DecodeJSON(request.Body, &updateRequest)
+	if err != nil {
+		render.Status(request, http.StatusBadRequest)
+		render.PlainText(writer, request, err.Error())
+		return
+	}
+	_, loaded := s.destination.Get(name)
+	if !loaded {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	server, err := updateRequest.build()
+	if err == nil {
+		err = s.destination.Update(name, updateRequest.Password, server)
+	}
+	if err != nil {
+		render.Status(request, http.StatusBadRequest)
+		render.PlainText(writer, request, err.Error())
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RelayAPIServer) deleteDestination(writer http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	if name == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	_, loaded := s.destination.Get(name)
+	if !loaded {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	err := s.destination.Delete(name)
+	if err != nil {
+		render.Status(request, http.StatusBadRequest)
+		render.PlainText(writer, request, err.Error())
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RelayAPIServer) getStats(writer http.ResponseWriter, request *http.Request) {
+	requireClear := request.URL.Query().Get("clear") == "true"
+
+	destinations := s.destination.List()
+	s.traffic.ReadDestinations(destinations, requireClear)
+	for i := range destinations {
+		destinations[i].Password = ""
+	}
+	uplinkBytes, downlinkBytes, uplinkPackets, downlinkPackets, tcpSessions, udpSessions := s.traffic.ReadGlobal(requireClear)
+
+	render.JSON(writer, request, render.M{
+		"uplinkBytes":     uplinkBytes,
+		"downlinkBytes":   downlinkBytes,
+		"uplinkPackets":   uplinkPackets,
+		"downlinkPackets": downlinkPackets,
+		"tcpSessions":     tcpSessions,
+		"udpSessions":     udpSessions,
+		"destinations":    destinations,
+	})
+}
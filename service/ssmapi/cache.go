@@ -9,6 +9,7 @@ import (
 
 	"github.com/sagernet/sing/common/json"
 	"github.com/sagernet/sing/common/json/badjson"
+	M "github.com/sagernet/sing/common/metadata"
 	"github.com/sagernet/sing/service/filemanager"
 )
 
@@ -17,19 +18,26 @@ type Cache struct {
 }
 
 type EndpointCache struct {
-	GlobalUplink          int64                             `json:"global_uplink"`
-	GlobalDownlink        int64                             `json:"global_downlink"`
-	GlobalUplinkPackets   int64                             `json:"global_uplink_packets"`
-	GlobalDownlinkPackets int64                             `json:"global_downlink_packets"`
-	GlobalTCPSessions     int64                             `json:"global_tcp_sessions"`
-	GlobalUDPSessions     int64                             `json:"global_udp_sessions"`
-	UserUplink            *badjson.TypedMap[string, int64]  `json:"user_uplink"`
-	UserDownlink          *badjson.TypedMap[string, int64]  `json:"user_downlink"`
-	UserUplinkPackets     *badjson.TypedMap[string, int64]  `json:"user_uplink_packets"`
-	UserDownlinkPackets   *badjson.TypedMap[string, int64]  `json:"user_downlink_packets"`
-	UserTCPSessions       *badjson.TypedMap[string, int64]  `json:"user_tcp_sessions"`
-	UserUDPSessions       *badjson.TypedMap[string, int64]  `json:"user_udp_sessions"`
-	Users                 *badjson.TypedMap[string, string] `json:"users"`
+	GlobalUplink          int64                                        `json:"global_uplink"`
+	GlobalDownlink        int64                                        `json:"global_downlink"`
+	GlobalUplinkPackets   int64                                        `json:"global_uplink_packets"`
+	GlobalDownlinkPackets int64                                        `json:"global_downlink_packets"`
+	GlobalTCPSessions     int64                                        `json:"global_tcp_sessions"`
+	GlobalUDPSessions     int64                                        `json:"global_udp_sessions"`
+	UserUplink            *badjson.TypedMap[string, int64]             `json:"user_uplink"`
+	UserDownlink          *badjson.TypedMap[string, int64]             `json:"user_downlink"`
+	UserUplinkPackets     *badjson.TypedMap[string, int64]             `json:"user_uplink_packets"`
+	UserDownlinkPackets   *badjson.TypedMap[string, int64]             `json:"user_downlink_packets"`
+	UserTCPSessions       *badjson.TypedMap[string, int64]             `json:"user_tcp_sessions"`
+	UserUDPSessions       *badjson.TypedMap[string, int64]             `json:"user_udp_sessions"`
+	Users                 *badjson.TypedMap[string, string]            `json:"users"`
+	Destinations          *badjson.TypedMap[string, *DestinationCache] `json:"destinations,omitempty"`
+}
+
+type DestinationCache struct {
+	Password   string `json:"uPSK"`
+	Server     string `json:"server"`
+	ServerPort uint16 `json:"server_port"`
 }
 
 func (s *Service) loadCache() error {
@@ -113,12 +121,22 @@ func (s *Service) decodeCache(cacheBinary []byte) error {
 		trafficManager.userDownlinkPackets = typedAtomicInt64Map(entry.Value.UserDownlinkPackets)
 		trafficManager.userTCPSessions = typedAtomicInt64Map(entry.Value.UserTCPSessions)
 		trafficManager.userUDPSessions = typedAtomicInt64Map(entry.Value.UserUDPSessions)
-		userManager, loaded := s.users[entry.Key]
-		if !loaded {
-			continue
+		if userManager, loaded := s.users[entry.Key]; loaded {
+			userManager.usersMap = typedMap(entry.Value.Users)
+			_ = userManager.postUpdate(false)
+		}
+		if destinationManager, loaded := s.destinations[entry.Key]; loaded {
+			destinationManager.destinationsMap = make(map[string]destinationEntry)
+			if entry.Value.Destinations != nil {
+				for _, destination := range entry.Value.Destinations.Entries() {
+					destinationManager.destinationsMap[destination.Key] = destinationEntry{
+						Password: destination.Value.Password,
+						Server:   M.ParseSocksaddrHostPort(destination.Value.Server, destination.Value.ServerPort),
+					}
+				}
+			}
+			_ = destinationManager.postUpdate(false)
 		}
-		userManager.usersMap = typedMap(entry.Value.Users)
-		_ = userManager.postUpdate(false)
 	}
 	return nil
 }
@@ -174,6 +192,22 @@ func (s *Service) encodeCache() ([]byte, error) {
 				}
 			}
 		}
+		var destinationMap *badjson.TypedMap[string, *DestinationCache]
+		destinationManager := s.destinations[tag]
+		if destinationManager != nil {
+			destinationManager.access.Lock()
+			if len(destinationManager.destinationsMap) > 0 {
+				destinationMap = new(badjson.TypedMap[string, *DestinationCache])
+				for name, entry := range destinationManager.destinationsMap {
+					destinationMap.Put(name, &DestinationCache{
+						Password:   entry.Password,
+						Server:     entry.Server.AddrString(),
+						ServerPort: entry.Server.Port,
+					})
+				}
+			}
+			destinationManager.access.Unlock()
+		}
 		endpoints.Put(tag, &EndpointCache{
 			GlobalUplink:          traffic.globalUplink.Load(),
 			GlobalDownlink:        traffic.globalDownlink.Load(),
@@ -188,6 +222,7 @@ func (s *Service) encodeCache() ([]byte, error) {
 			UserTCPSessions:       sortTypedMap(userTCPSessions),
 			UserUDPSessions:       sortTypedMap(userUDPSessions),
 			Users:                 sortTypedMap(userMap),
+			Destinations:          sortTypedMap(destinationMap),
 		})
 	}
 	var buffer bytes.Buffer
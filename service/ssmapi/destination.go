@@ -0,0 +1,114 @@
+package ssmapi
+
+import (
+	"sync"
+
+	"github.com/sagernet/sing-box/adapter"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+type destinationEntry struct {
+	Password string
+	Server   M.Socksaddr
+}
+
+type DestinationManager struct {
+	access          sync.Mutex
+	destinationsMap map[string]destinationEntry
+	server          adapter.ManagedSSMRelayServer
+	trafficManager  *TrafficManager
+}
+
+func NewDestinationManager(inbound adapter.ManagedSSMRelayServer, trafficManager *TrafficManager) *DestinationManager {
+	return &DestinationManager{
+		destinationsMap: make(map[string]destinationEntry),
+		server:          inbound,
+		trafficManager:  trafficManager,
+	}
+}
+
+func (m *DestinationManager) postUpdate(updated bool) error {
+	destinations := make([]string, 0, len(m.destinationsMap))
+	uPSKs := make([]string, 0, len(m.destinationsMap))
+	servers := make([]M.Socksaddr, 0, len(m.destinationsMap))
+	for name, entry := range m.destinationsMap {
+		destinations = append(destinations, name)
+		uPSKs = append(uPSKs, entry.Password)
+		servers = append(servers, entry.Server)
+	}
+	err := m.server.UpdateDestinations(destinations, uPSKs, servers)
+	if err != nil {
+		return err
+	}
+	if updated {
+		m.trafficManager.UpdateUsers(destinations)
+	}
+	return nil
+}
+
+func (m *DestinationManager) List() []*DestinationObject {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	destinations := make([]*DestinationObject, 0, len(m.destinationsMap))
+	for name, entry := range m.destinationsMap {
+		destinations = append(destinations, newDestinationObject(name, entry))
+	}
+	return destinations
+}
+
+func (m *DestinationManager) Add(name string, password string, server M.Socksaddr) error {
+	m.access.Lock()
+	defer m.access.Unlock()
+	if _, found := m.destinationsMap[name]; found {
+		return E.New("destination ", name, " already exists")
+	}
+	return m.update(name, destinationEntry{password, server})
+}
+
+func (m *DestinationManager) Get(name string) (*DestinationObject, bool) {
+	m.access.Lock()
+	defer m.access.Unlock()
+	if entry, found := m.destinationsMap[name]; found {
+		return newDestinationObject(name, entry), true
+	}
+	return nil, false
+}
+
+func (m *DestinationManager) Update(name string, password string, server M.Socksaddr) error {
+	m.access.Lock()
+	defer m.access.Unlock()
+	return m.update(name, destinationEntry{password, server})
+}
+
+func (m *DestinationManager) update(name string, entry destinationEntry) error {
+	oldEntry, loaded := m.destinationsMap[name]
+	m.destinationsMap[name] = entry
+	err := m.postUpdate(true)
+	if err != nil {
+		if loaded {
+			m.destinationsMap[name] = oldEntry
+		} else {
+			delete(m.destinationsMap, name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *DestinationManager) Delete(name string) error {
+	m.access.Lock()
+	defer m.access.Unlock()
+	delete(m.destinationsMap, name)
+	return m.postUpdate(true)
+}
+
+func newDestinationObject(name string, entry destinationEntry) *DestinationObject {
+	return &DestinationObject{
+		Name:       name,
+		Password:   entry.Password,
+		Server:     entry.Server.AddrString(),
+		ServerPort: entry.Server.Port,
+	}
+}
@@ -38,6 +38,7 @@ type Service struct {
 	httpServer     *http.Server
 	traffics       map[string]*TrafficManager
 	users          map[string]*UserManager
+	destinations   map[string]*DestinationManager
 	cachePath      string
 	saveTicker     *time.Ticker
 	lastSavedCache []byte
@@ -61,9 +62,10 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 		httpServer: &http.Server{
 			Handler: chiRouter,
 		},
-		traffics:  make(map[string]*TrafficManager),
-		users:     make(map[string]*UserManager),
-		cachePath: options.CachePath,
+		traffics:     make(map[string]*TrafficManager),
+		users:        make(map[string]*UserManager),
+		destinations: make(map[string]*DestinationManager),
+		cachePath:    options.CachePath,
 	}
 	inboundManager := service.FromContext[adapter.InboundManager](ctx)
 	if options.Servers.Size() == 0 {
@@ -74,16 +76,22 @@ func NewService(ctx context.Context, logger log.ContextLogger, tag string, optio
 		if !loaded {
 			return nil, E.New("parse SSM server[", i, "]: inbound ", entry.Value, " not found")
 		}
-		managedServer, isManaged := inbound.(adapter.ManagedSSMServer)
-		if !isManaged {
+		traffic := NewTrafficManager()
+		switch managedServer := inbound.(type) {
+		case adapter.ManagedSSMServer:
+			managedServer.SetTracker(traffic)
+			user := NewUserManager(managedServer, traffic)
+			chiRouter.Route(entry.Key, NewAPIServer(logger, traffic, user).Route)
+			s.users[entry.Key] = user
+		case adapter.ManagedSSMRelayServer:
+			managedServer.SetTracker(traffic)
+			destination := NewDestinationManager(managedServer, traffic)
+			chiRouter.Route(entry.Key, NewRelayAPIServer(logger, traffic, destination).Route)
+			s.destinations[entry.Key] = destination
+		default:
 			return nil, E.New("parse SSM server[", i, "]: inbound/", inbound.Type(), "[", inbound.Tag(), "] is not a SSM server")
 		}
-		traffic := NewTrafficManager()
-		managedServer.SetTracker(traffic)
-		user := NewUserManager(managedServer, traffic)
-		chiRouter.Route(entry.Key, NewAPIServer(logger, traffic, user).Route)
 		s.traffics[entry.Key] = traffic
-		s.users[entry.Key] = user
 	}
 	if options.TLS != nil {
 		tlsConfig, err := tls.NewServer(ctx, logger, common.PtrValueOrDefault(options.TLS))
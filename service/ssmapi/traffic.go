@@ -148,50 +148,56 @@ func (s *TrafficManager) TrackPacketConnection(conn N.PacketConn, metadata adapt
 func (s *TrafficManager) ReadUser(user *UserObject) {
 	s.userAccess.Lock()
 	defer s.userAccess.Unlock()
-	s.readUser(user, false)
+	s.readTraffic(user.UserName, &user.TrafficObject, false)
 }
 
-func (s *TrafficManager) readUser(user *UserObject, swap bool) {
-	if counter, loaded := s.userUplink[user.UserName]; loaded {
+func (s *TrafficManager) ReadDestination(destination *DestinationObject) {
+	s.userAccess.Lock()
+	defer s.userAccess.Unlock()
+	s.readTraffic(destination.Name, &destination.TrafficObject, false)
+}
+
+func (s *TrafficManager) readTraffic(name string, traffic *TrafficObject, swap bool) {
+	if counter, loaded := s.userUplink[name]; loaded {
 		if swap {
-			user.UplinkBytes = counter.Swap(0)
+			traffic.UplinkBytes = counter.Swap(0)
 		} else {
-			user.UplinkBytes = counter.Load()
+			traffic.UplinkBytes = counter.Load()
 		}
 	}
-	if counter, loaded := s.userDownlink[user.UserName]; loaded {
+	if counter, loaded := s.userDownlink[name]; loaded {
 		if swap {
-			user.DownlinkBytes = counter.Swap(0)
+			traffic.DownlinkBytes = counter.Swap(0)
 		} else {
-			user.DownlinkBytes = counter.Load()
+			traffic.DownlinkBytes = counter.Load()
 		}
 	}
-	if counter, loaded := s.userUplinkPackets[user.UserName]; loaded {
+	if counter, loaded := s.userUplinkPackets[name]; loaded {
 		if swap {
-			user.UplinkPackets = counter.Swap(0)
+			traffic.UplinkPackets = counter.Swap(0)
 		} else {
-			user.UplinkPackets = counter.Load()
+			traffic.UplinkPackets = counter.Load()
 		}
 	}
-	if counter, loaded := s.userDownlinkPackets[user.UserName]; loaded {
+	if counter, loaded := s.userDownlinkPackets[name]; loaded {
 		if swap {
-			user.DownlinkPackets = counter.Swap(0)
+			traffic.DownlinkPackets = counter.Swap(0)
 		} else {
-			user.DownlinkPackets = counter.Load()
+			traffic.DownlinkPackets = counter.Load()
 		}
 	}
-	if counter, loaded := s.userTCPSessions[user.UserName]; loaded {
+	if counter, loaded := s.userTCPSessions[name]; loaded {
 		if swap {
-			user.TCPSessions = counter.Swap(0)
+			traffic.TCPSessions = counter.Swap(0)
 		} else {
-			user.TCPSessions = counter.Load()
+			traffic.TCPSessions = counter.Load()
 		}
 	}
-	if counter, loaded := s.userUDPSessions[user.UserName]; loaded {
+	if counter, loaded := s.userUDPSessions[name]; loaded {
 		if swap {
-			user.UDPSessions = counter.Swap(0)
+			traffic.UDPSessions = counter.Swap(0)
 		} else {
-			user.UDPSessions = counter.Load()
+			traffic.UDPSessions = counter.Load()
 		}
 	}
 }
@@ -200,7 +206,15 @@ func (s *TrafficManager) ReadUsers(users []*UserObject, swap bool) {
 	s.userAccess.Lock()
 	defer s.userAccess.Unlock()
 	for _, user := range users {
-		s.readUser(user, swap)
+		s.readTraffic(user.UserName, &user.TrafficObject, swap)
+	}
+}
+
+func (s *TrafficManager) ReadDestinations(destinations []*DestinationObject, swap bool) {
+	s.userAccess.Lock()
+	defer s.userAccess.Unlock()
+	for _, destination := range destinations {
+		s.readTraffic(destination.Name, &destination.TrafficObject, swap)
 	}
 }
 
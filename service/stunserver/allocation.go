@@ -0,0 +1,155 @@
+package stunserver
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+type allocation struct {
+	server         *turnServer
+	client         netip.AddrPort
+	username       string
+	transactionID  [12]byte
+	access         sync.Mutex
+	relay          net.PacketConn
+	relayedAddress netip.AddrPort
+	response       []byte
+	expiry         time.Time
+	permissions    map[netip.Addr]time.Time
+	channels       map[uint16]*channelBinding
+	peerChannels   map[netip.AddrPort]uint16
+	done           chan struct{}
+	closeOnce      sync.Once
+}
+
+type channelBinding struct {
+	peer   netip.AddrPort
+	expiry time.Time
+}
+
+func (a *allocation) ready() bool {
+	a.access.Lock()
+	defer a.access.Unlock()
+	return a.relay != nil
+}
+
+func (a *allocation) allocateResponse() []byte {
+	a.access.Lock()
+	defer a.access.Unlock()
+	return a.response
+}
+
+// expired reports whether the allocation timed out and drops expired
+// permissions and channel bindings.
+func (a *allocation) expired(now time.Time) bool {
+	a.access.Lock()
+	defer a.access.Unlock()
+	if !a.expiry.After(now) {
+		return true
+	}
+	for peer, expiry := range a.permissions {
+		if !expiry.After(now) {
+			delete(a.permissions, peer)
+		}
+	}
+	for channel, binding := range a.channels {
+		if !binding.expiry.After(now) {
+			delete(a.channels, channel)
+			if a.peerChannels[binding.peer] == channel {
+				delete(a.peerChannels, binding.peer)
+			}
+		}
+	}
+	return false
+}
+
+func (a *allocation) close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.access.Lock()
+		relay := a.relay
+		a.access.Unlock()
+		if relay != nil {
+			relay.Close()
+		}
+	})
+}
+
+func (a *allocation) permitted(peer netip.Addr, now time.Time) bool {
+	expiry, loaded := a.permissions[peer]
+	return loaded && expiry.After(now)
+}
+
+func (a *allocation) send(data []byte, peer netip.AddrPort) {
+	peer = netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port())
+	a.access.Lock()
+	relay := a.relay
+	permitted := a.permitted(peer.Addr(), time.Now())
+	a.access.Unlock()
+	if relay == nil || !permitted {
+		return
+	}
+	_, err := relay.WriteTo(data, M.SocksaddrFromNetIP(peer).UDPAddr())
+	if err != nil && !E.IsClosedOrCanceled(err) {
+		a.server.logger.Debug(E.Cause(err, "relay to ", peer))
+	}
+}
+
+func (a *allocation) loopRelay() {
+	buffer := make([]byte, 65535)
+	for {
+		n, addr, err := a.relay.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-a.done:
+			default:
+				if !E.IsClosedOrCanceled(err) {
+					a.server.logger.Debug(E.Cause(err, "read relay of ", a.client))
+				}
+				a.server.access.Lock()
+				if a.server.allocations[a.client] == a {
+					delete(a.server.allocations, a.client)
+				}
+				a.server.access.Unlock()
+				a.close()
+			}
+			return
+		}
+		peer := M.SocksaddrFromNet(addr).Unwrap().AddrPort()
+		peer = netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port())
+		now := time.Now()
+		a.access.Lock()
+		if !a.permitted(peer.Addr(), now) {
+			a.access.Unlock()
+			continue
+		}
+		channel, hasChannel := a.peerChannels[peer]
+		if hasChannel {
+			binding := a.channels[channel]
+			hasChannel = binding != nil && binding.expiry.After(now)
+		}
+		a.access.Unlock()
+		var packet []byte
+		if hasChannel {
+			packet = make([]byte, 4, 4+n)
+			binary.BigEndian.PutUint16(packet[0:2], channel)
+			binary.BigEndian.PutUint16(packet[2:4], uint16(n))
+			packet = append(packet, buffer[:n]...)
+		} else {
+			var transactionID [12]byte
+			_, _ = rand.Read(transactionID[:])
+			packet = newMessageBuilder(methodData, classIndication, transactionID).
+				addXORAddress(attrXORPeerAddress, peer).
+				add(attrData, buffer[:n]).
+				bytes()
+		}
+		a.server.service.write(packet, a.client)
+	}
+}
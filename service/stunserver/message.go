@@ -0,0 +1,281 @@
+package stunserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/crc32"
+	"net/netip"
+
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const (
+	magicCookie = 0x2112A442
+	headerSize  = 20
+
+	fingerprintXOR = 0x5354554e
+	integritySize  = 20
+)
+
+const (
+	methodBinding          = 0x001
+	methodAllocate         = 0x003
+	methodRefresh          = 0x004
+	methodSend             = 0x006
+	methodData             = 0x007
+	methodCreatePermission = 0x008
+	methodChannelBind      = 0x009
+)
+
+const (
+	classRequest    = 0x0000
+	classIndication = 0x0010
+	classSuccess    = 0x0100
+	classError      = 0x0110
+)
+
+const (
+	attrMappedAddress          = 0x0001
+	attrUsername               = 0x0006
+	attrMessageIntegrity       = 0x0008
+	attrErrorCode              = 0x0009
+	attrUnknownAttributes      = 0x000A
+	attrChannelNumber          = 0x000C
+	attrLifetime               = 0x000D
+	attrXORPeerAddress         = 0x0012
+	attrData                   = 0x0013
+	attrRealm                  = 0x0014
+	attrNonce                  = 0x0015
+	attrXORRelayedAddress      = 0x0016
+	attrRequestedAddressFamily = 0x0017
+	attrEvenPort               = 0x0018
+	attrRequestedTransport     = 0x0019
+	attrDontFragment           = 0x001A
+	attrMessageIntegritySHA256 = 0x001C
+	attrPasswordAlgorithm      = 0x001D
+	attrUserhash               = 0x001E
+	attrXORMappedAddress       = 0x0020
+	attrReservationToken       = 0x0022
+	attrSoftware               = 0x8022
+	attrFingerprint            = 0x8028
+)
+
+const (
+	familyIPv4 = 0x01
+	familyIPv6 = 0x02
+
+	protocolUDP = 17
+)
+
+type message struct {
+	method        uint16
+	class         uint16
+	transactionID [12]byte
+	attributes    []attribute
+	raw           []byte
+}
+
+type attribute struct {
+	typ    uint16
+	value  []byte
+	offset int
+}
+
+func isMessage(packet []byte) bool {
+	return len(packet) >= headerSize && packet[0]&0xC0 == 0 && binary.BigEndian.Uint32(packet[4:8]) == magicCookie
+}
+
+func parseMessage(packet []byte) (*message, error) {
+	if !isMessage(packet) {
+		return nil, E.New("not a STUN message")
+	}
+	length := int(binary.BigEndian.Uint16(packet[2:4]))
+	if length%4 != 0 || headerSize+length > len(packet) {
+		return nil, E.New("invalid message length")
+	}
+	messageType := binary.BigEndian.Uint16(packet[0:2])
+	msg := &message{
+		method: messageType&0x000F | messageType&0x00E0>>1 | messageType&0x3E00>>2,
+		class:  messageType & 0x0110,
+		raw:    packet[:headerSize+length],
+	}
+	copy(msg.transactionID[:], packet[8:20])
+	for offset := headerSize; offset+4 <= len(msg.raw); {
+		attributeType := binary.BigEndian.Uint16(msg.raw[offset:])
+		attributeLength := int(binary.BigEndian.Uint16(msg.raw[offset+2:]))
+		if offset+4+attributeLength > len(msg.raw) {
+			return nil, E.New("invalid attribute length")
+		}
+		msg.attributes = append(msg.attributes, attribute{
+			typ:    attributeType,
+			value:  msg.raw[offset+4 : offset+4+attributeLength],
+			offset: offset,
+		})
+		offset += 4 + attributeLength + paddingLen(attributeLength)
+	}
+	return msg, nil
+}
+
+func (m *message) get(typ uint16) ([]byte, bool) {
+	for _, attr := range m.attributes {
+		if attr.typ == typ {
+			return attr.value, true
+		}
+	}
+	return nil, false
+}
+
+// unknownAttributes returns comprehension-required attributes not in known.
+func (m *message) unknownAttributes(known ...uint16) []uint16 {
+	var unknown []uint16
+	for _, attr := range m.attributes {
+		if attr.typ >= 0x8000 {
+			continue
+		}
+		var isKnown bool
+		for _, knownType := range known {
+			if attr.typ == knownType {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			unknown = append(unknown, attr.typ)
+		}
+	}
+	return unknown
+}
+
+// checkIntegrity verifies the MESSAGE-INTEGRITY attribute, see RFC 8489 Section 14.5.
+func (m *message) checkIntegrity(key []byte) bool {
+	for _, attr := range m.attributes {
+		if attr.typ != attrMessageIntegrity {
+			continue
+		}
+		if len(attr.value) != integritySize {
+			return false
+		}
+		header := make([]byte, headerSize)
+		copy(header, m.raw[:headerSize])
+		binary.BigEndian.PutUint16(header[2:4], uint16(attr.offset+4+integritySize-headerSize))
+		mac := hmac.New(sha1.New, key)
+		mac.Write(header)
+		mac.Write(m.raw[headerSize:attr.offset])
+		return hmac.Equal(mac.Sum(nil), attr.value)
+	}
+	return false
+}
+
+func (m *message) xorAddress(typ uint16) (netip.AddrPort, bool) {
+	value, loaded := m.get(typ)
+	if !loaded {
+		return netip.AddrPort{}, false
+	}
+	return parseXORAddress(value, m.transactionID)
+}
+
+type messageBuilder struct {
+	buffer        []byte
+	transactionID [12]byte
+}
+
+func newMessageBuilder(method uint16, class uint16, transactionID [12]byte) *messageBuilder {
+	buffer := make([]byte, headerSize, 128)
+	messageType := method&0x000F | method&0x0070<<1 | method&0x0F80<<2 | class
+	binary.BigEndian.PutUint16(buffer[0:2], messageType)
+	binary.BigEndian.PutUint32(buffer[4:8], magicCookie)
+	copy(buffer[8:20], transactionID[:])
+	return &messageBuilder{buffer: buffer, transactionID: transactionID}
+}
+
+func (b *messageBuilder) add(typ uint16, value []byte) *messageBuilder {
+	b.buffer = binary.BigEndian.AppendUint16(b.buffer, typ)
+	b.buffer = binary.BigEndian.AppendUint16(b.buffer, uint16(len(value)))
+	b.buffer = append(b.buffer, value...)
+	b.buffer = append(b.buffer, make([]byte, paddingLen(len(value)))...)
+	b.setLength(len(b.buffer) - headerSize)
+	return b
+}
+
+func (b *messageBuilder) addUint32(typ uint16, value uint32) *messageBuilder {
+	return b.add(typ, binary.BigEndian.AppendUint32(nil, value))
+}
+
+func (b *messageBuilder) addXORAddress(typ uint16, address netip.AddrPort) *messageBuilder {
+	return b.add(typ, xorAddress(address, b.transactionID))
+}
+
+func (b *messageBuilder) addError(code int, reason string) *messageBuilder {
+	value := []byte{0, 0, byte(code / 100), byte(code % 100)}
+	return b.add(attrErrorCode, append(value, reason...))
+}
+
+func (b *messageBuilder) addIntegrity(key []byte) *messageBuilder {
+	b.setLength(len(b.buffer) + 4 + integritySize - headerSize)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(b.buffer)
+	return b.add(attrMessageIntegrity, mac.Sum(nil))
+}
+
+func (b *messageBuilder) addFingerprint() *messageBuilder {
+	b.setLength(len(b.buffer) + 8 - headerSize)
+	return b.addUint32(attrFingerprint, crc32.ChecksumIEEE(b.buffer)^fingerprintXOR)
+}
+
+func (b *messageBuilder) setLength(length int) {
+	binary.BigEndian.PutUint16(b.buffer[2:4], uint16(length))
+}
+
+func (b *messageBuilder) bytes() []byte {
+	return b.buffer
+}
+
+func xorAddress(address netip.AddrPort, transactionID [12]byte) []byte {
+	ip := address.Addr().Unmap()
+	value := make([]byte, 4, 20)
+	value[1] = familyIPv4
+	if ip.Is6() {
+		value[1] = familyIPv6
+	}
+	binary.BigEndian.PutUint16(value[2:4], address.Port()^magicCookie>>16)
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint32(key[0:4], magicCookie)
+	copy(key[4:], transactionID[:])
+	for i, b := range ip.AsSlice() {
+		value = append(value, b^key[i])
+	}
+	return value
+}
+
+func parseXORAddress(value []byte, transactionID [12]byte) (netip.AddrPort, bool) {
+	if len(value) < 4 {
+		return netip.AddrPort{}, false
+	}
+	var addressLength int
+	switch value[1] {
+	case familyIPv4:
+		addressLength = 4
+	case familyIPv6:
+		addressLength = 16
+	default:
+		return netip.AddrPort{}, false
+	}
+	if len(value) < 4+addressLength {
+		return netip.AddrPort{}, false
+	}
+	port := binary.BigEndian.Uint16(value[2:4]) ^ magicCookie>>16
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint32(key[0:4], magicCookie)
+	copy(key[4:], transactionID[:])
+	ip := make([]byte, addressLength)
+	for i := range ip {
+		ip[i] = value[4+i] ^ key[i]
+	}
+	address, _ := netip.AddrFromSlice(ip)
+	return netip.AddrPortFrom(address, port), true
+}
+
+func paddingLen(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,124 @@
+package stunserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	boxService "github.com/sagernet/sing-box/adapter/service"
+	"github.com/sagernet/sing-box/common/listener"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/sing/common/json/badoption"
+	N "github.com/sagernet/sing/common/network"
+)
+
+func RegisterService(registry *boxService.Registry) {
+	boxService.Register[option.STUNServiceOptions](registry, C.TypeSTUN, NewService)
+}
+
+type Service struct {
+	boxService.Adapter
+	ctx      context.Context
+	logger   log.ContextLogger
+	listener *listener.Listener
+	conn     *net.UDPConn
+	turn     *turnServer
+}
+
+func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.STUNServiceOptions) (adapter.Service, error) {
+	if options.Listen == nil {
+		options.Listen = (*badoption.Addr)(common.Ptr(netip.IPv6Unspecified()))
+	}
+	if options.ListenPort == 0 {
+		options.ListenPort = 3478
+	}
+	stunService := &Service{
+		Adapter: boxService.NewAdapter(C.TypeSTUN, tag),
+		ctx:     ctx,
+		logger:  logger,
+		listener: listener.New(listener.Options{
+			Context: ctx,
+			Logger:  logger,
+			Network: []string{N.NetworkUDP},
+			Listen:  options.ListenOptions,
+		}),
+	}
+	if options.TURN != nil && options.TURN.Enabled {
+		turn, err := newTURNServer(ctx, logger, stunService, *options.TURN)
+		if err != nil {
+			return nil, E.Cause(err, "create TURN server")
+		}
+		stunService.turn = turn
+	}
+	return stunService, nil
+}
+
+func (s *Service) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	packetConn, err := s.listener.ListenUDP()
+	if err != nil {
+		return err
+	}
+	s.conn = packetConn.(*net.UDPConn)
+	if s.turn != nil {
+		s.turn.start()
+	}
+	go s.loopPacket()
+	return nil
+}
+
+func (s *Service) Close() error {
+	var err error
+	if s.turn != nil {
+		err = s.turn.close()
+	}
+	return E.Errors(err, s.listener.Close())
+}
+
+func (s *Service) loopPacket() {
+	buffer := make([]byte, 65535)
+	for {
+		n, source, err := s.conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if E.IsClosedOrCanceled(err) {
+				return
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		source = netip.AddrPortFrom(source.Addr().Unmap(), source.Port())
+		packet := buffer[:n]
+		if s.turn != nil && isChannelData(packet) {
+			s.turn.handleChannelData(packet, source)
+			continue
+		}
+		msg, err := parseMessage(packet)
+		if err != nil {
+			continue
+		}
+		switch {
+		case msg.method == methodBinding && msg.class == classRequest:
+			s.write(newMessageBuilder(methodBinding, classSuccess, msg.transactionID).
+				addXORAddress(attrXORMappedAddress, source).
+				addFingerprint().
+				bytes(), source)
+		case s.turn != nil:
+			s.turn.handleMessage(msg, source)
+		}
+	}
+}
+
+func (s *Service) write(packet []byte, destination netip.AddrPort) {
+	_, err := s.conn.WriteToUDPAddrPort(packet, destination)
+	if err != nil && !E.IsClosedOrCanceled(err) {
+		s.logger.Debug(E.Cause(err, "write to ", destination))
+	}
+}
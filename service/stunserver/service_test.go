@@ -0,0 +1,195 @@
+package stunserver
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testClient struct {
+	t      *testing.T
+	conn   *net.UDPConn
+	server netip.AddrPort
+	key    []byte
+	realm  []byte
+	nonce  []byte
+}
+
+func (c *testClient) transactionID() [12]byte {
+	var transactionID [12]byte
+	binary.BigEndian.PutUint64(transactionID[:], uint64(time.Now().UnixNano()))
+	return transactionID
+}
+
+func (c *testClient) write(packet []byte) {
+	_, err := c.conn.WriteToUDPAddrPort(packet, c.server)
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) read() []byte {
+	buffer := make([]byte, 65535)
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := c.conn.ReadFromUDPAddrPort(buffer)
+	require.NoError(c.t, err)
+	return buffer[:n]
+}
+
+func (c *testClient) readMessage() *message {
+	msg, err := parseMessage(c.read())
+	require.NoError(c.t, err)
+	return msg
+}
+
+func (c *testClient) request(builder *messageBuilder) *message {
+	if c.nonce != nil {
+		builder.add(attrUsername, []byte("user")).
+			add(attrRealm, c.realm).
+			add(attrNonce, c.nonce).
+			addIntegrity(c.key)
+	}
+	c.write(builder.addFingerprint().bytes())
+	return c.readMessage()
+}
+
+func errorCode(msg *message) int {
+	value, _ := msg.get(attrErrorCode)
+	if len(value) < 4 {
+		return 0
+	}
+	return int(value[2])*100 + int(value[3])
+}
+
+func TestSTUNServer(t *testing.T) {
+	t.Parallel()
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(packetConn.LocalAddr().(*net.UDPAddr).Port)
+	packetConn.Close()
+	loopback := netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	service, err := NewService(context.Background(), log.NewNOPFactory().Logger(), "stun", option.STUNServiceOptions{
+		ListenOptions: option.ListenOptions{
+			Listen:     (*badoption.Addr)(common.Ptr(loopback)),
+			ListenPort: port,
+		},
+		TURN: &option.TURNServerOptions{
+			Enabled:      true,
+			Users:        []option.TURNUser{{Username: "user", Password: "password"}},
+			RelayAddress: (*badoption.Addr)(common.Ptr(loopback)),
+			AllowedPeers: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, service.Start(adapter.StartStateStart))
+	t.Cleanup(func() { service.Close() })
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	client := &testClient{t: t, conn: conn, server: netip.AddrPortFrom(loopback, port)}
+	localAddress := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	response := client.request(newMessageBuilder(methodBinding, classRequest, client.transactionID()))
+	require.Equal(t, uint16(classSuccess), response.class)
+	mappedAddress, ok := response.xorAddress(attrXORMappedAddress)
+	require.True(t, ok)
+	require.Equal(t, localAddress, mappedAddress)
+
+	allocateRequest := func() *messageBuilder {
+		return newMessageBuilder(methodAllocate, classRequest, client.transactionID()).
+			add(attrRequestedTransport, []byte{protocolUDP, 0, 0, 0})
+	}
+	response = client.request(allocateRequest())
+	require.Equal(t, 401, errorCode(response))
+	client.realm, _ = response.get(attrRealm)
+	client.nonce, _ = response.get(attrNonce)
+	key := md5.Sum([]byte("user:" + string(client.realm) + ":password"))
+	client.key = key[:]
+	response = client.request(allocateRequest())
+	require.Equal(t, uint16(classSuccess), response.class, errorCode(response))
+	require.True(t, response.checkIntegrity(client.key))
+	relayedAddress, ok := response.xorAddress(attrXORRelayedAddress)
+	require.True(t, ok)
+	require.Equal(t, loopback, relayedAddress.Addr())
+
+	peer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer peer.Close()
+	peerAddress := peer.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	response = client.request(newMessageBuilder(methodCreatePermission, classRequest, client.transactionID()).
+		addXORAddress(attrXORPeerAddress, peerAddress))
+	require.Equal(t, uint16(classSuccess), response.class, errorCode(response))
+
+	client.write(newMessageBuilder(methodSend, classIndication, client.transactionID()).
+		addXORAddress(attrXORPeerAddress, peerAddress).
+		add(attrData, []byte("ping")).
+		bytes())
+	buffer := make([]byte, 1024)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, source, err := peer.ReadFromUDPAddrPort(buffer)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buffer[:n]))
+	require.Equal(t, relayedAddress.Port(), source.Port())
+
+	_, err = peer.WriteToUDPAddrPort([]byte("pong"), relayedAddress)
+	require.NoError(t, err)
+	indication := client.readMessage()
+	require.Equal(t, uint16(methodData), indication.method)
+	data, _ := indication.get(attrData)
+	require.Equal(t, "pong", string(data))
+
+	response = client.request(newMessageBuilder(methodChannelBind, classRequest, client.transactionID()).
+		add(attrChannelNumber, []byte{0x40, 0x01, 0, 0}).
+		addXORAddress(attrXORPeerAddress, peerAddress))
+	require.Equal(t, uint16(classSuccess), response.class, errorCode(response))
+
+	client.write(append([]byte{0x40, 0x01, 0, 5}, "hello"...))
+	n, _, err = peer.ReadFromUDPAddrPort(buffer)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buffer[:n]))
+	_, err = peer.WriteToUDPAddrPort([]byte("world"), relayedAddress)
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{0x40, 0x01, 0, 5}, "world"...), client.read())
+
+	response = client.request(newMessageBuilder(methodRefresh, classRequest, client.transactionID()).
+		addUint32(attrLifetime, 0))
+	require.Equal(t, uint16(classSuccess), response.class, errorCode(response))
+	response = client.request(newMessageBuilder(methodRefresh, classRequest, client.transactionID()))
+	require.Equal(t, 437, errorCode(response))
+}
+
+func TestTURNAllowPeer(t *testing.T) {
+	t.Parallel()
+	server := &turnServer{allowedPeers: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}}
+	for address, allowed := range map[string]bool{
+		"198.51.100.1":        true,
+		"2001:db8::1":         true,
+		"192.168.1.10":        true,
+		"::ffff:192.168.1.10": true,
+		"0.0.0.0":             false,
+		"224.0.0.1":           false,
+		"127.0.0.1":           false,
+		"10.0.0.1":            false,
+		"172.16.0.1":          false,
+		"192.168.2.1":         false,
+		"169.254.169.254":     false,
+		"::1":                 false,
+		"fd00::1":             false,
+		"fe80::1":             false,
+		"::ffff:10.0.0.1":     false,
+	} {
+		require.Equal(t, allowed, server.allowPeer(netip.MustParseAddr(address)), address)
+	}
+}
@@ -0,0 +1,594 @@
+package stunserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/common/dialer"
+	"github.com/sagernet/sing-box/common/stun"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const (
+	defaultRealm       = "sing-box"
+	defaultLifetime    = 10 * time.Minute
+	maxLifetime        = time.Hour
+	permissionLifetime = 5 * time.Minute
+	channelLifetime    = 10 * time.Minute
+	nonceLifetime      = 10 * time.Minute
+	cleanupInterval    = 30 * time.Second
+	allocateTimeout    = 10 * time.Second
+
+	minChannelNumber = 0x4000
+	maxChannelNumber = 0x4FFF
+)
+
+// turnServer relays UDP for clients with long-term credentials as described
+// in RFC 8656, relayed sockets are opened through the configured dialer.
+type turnServer struct {
+	ctx             context.Context
+	logger          log.ContextLogger
+	service         *Service
+	realm           string
+	keys            map[string][]byte
+	dialer          N.Dialer
+	relayAddress    netip.Addr
+	relaySTUNServer M.Socksaddr
+	nonceSecret     []byte
+	access          sync.Mutex
+	allocations     map[netip.AddrPort]*allocation
+	done            chan struct{}
+	allowedPeers    []netip.Prefix
+}
+
+func newTURNServer(ctx context.Context, logger log.ContextLogger, service *Service, options option.TURNServerOptions) (*turnServer, error) {
+	if len(options.Users) == 0 {
+		return nil, E.New("missing users")
+	}
+	realm := options.Realm
+	if realm == "" {
+		realm = defaultRealm
+	}
+	keys := make(map[string][]byte)
+	for index, user := range options.Users {
+		if user.Username == "" {
+			return nil, E.New("missing username for user[", index, "]")
+		}
+		key := md5.Sum([]byte(user.Username + ":" + realm + ":" + user.Password))
+		keys[user.Username] = key[:]
+	}
+	var relaySTUNServer M.Socksaddr
+	if options.RelaySTUNServer != "" {
+		relaySTUNServer = M.ParseSocksaddr(options.RelaySTUNServer)
+		if relaySTUNServer.Port == 0 {
+			relaySTUNServer.Port = 3478
+		}
+	} else if options.RelayAddress == nil {
+		return nil, E.New("missing relay_address or relay_stun_server")
+	}
+	relayDialer, err := dialer.NewWithOptions(dialer.Options{
+		Context: ctx,
+		Options: option.DialerOptions{
+			Detour: options.Detour,
+		},
+		RemoteIsDomain: relaySTUNServer.IsFqdn(),
+	})
+	if err != nil {
+		return nil, E.Cause(err, "create dialer")
+	}
+	nonceSecret := make([]byte, 32)
+	_, err = rand.Read(nonceSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &turnServer{
+		ctx:             ctx,
+		logger:          logger,
+		service:         service,
+		realm:           realm,
+		keys:            keys,
+		dialer:          relayDialer,
+		relayAddress:    options.RelayAddress.Build(netip.Addr{}),
+		relaySTUNServer: relaySTUNServer,
+		nonceSecret:     nonceSecret,
+		allocations:     make(map[netip.AddrPort]*allocation),
+		done:            make(chan struct{}),
+		allowedPeers:    options.AllowedPeers,
+	}, nil
+}
+
+func (t *turnServer) start() {
+	go t.loopCleanup()
+}
+
+func (t *turnServer) close() error {
+	close(t.done)
+	t.access.Lock()
+	allocations := t.allocations
+	t.allocations = make(map[netip.AddrPort]*allocation)
+	t.access.Unlock()
+	for _, current := range allocations {
+		current.close()
+	}
+	return nil
+}
+
+func (t *turnServer) loopCleanup() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			return
+		}
+		now := time.Now()
+		t.access.Lock()
+		for client, current := range t.allocations {
+			if current.expired(now) {
+				delete(t.allocations, client)
+				go current.close()
+			}
+		}
+		t.access.Unlock()
+	}
+}
+
+func (t *turnServer) handleMessage(msg *message, source netip.AddrPort) {
+	switch msg.class {
+	case classRequest:
+	case classIndication:
+		if msg.method == methodSend {
+			t.handleSend(msg, source)
+		}
+		return
+	default:
+		return
+	}
+	switch msg.method {
+	case methodAllocate, methodRefresh, methodCreatePermission, methodChannelBind:
+	default:
+		t.service.write(newMessageBuilder(msg.method, classError, msg.transactionID).
+			addError(400, "Bad Request").
+			addFingerprint().
+			bytes(), source)
+		return
+	}
+	username, key, ok := t.authenticate(msg, source)
+	if !ok {
+		return
+	}
+	unknown := msg.unknownAttributes(
+		attrUsername, attrMessageIntegrity, attrMessageIntegritySHA256, attrPasswordAlgorithm, attrUserhash,
+		attrRealm, attrNonce, attrChannelNumber, attrLifetime, attrXORPeerAddress, attrData,
+		attrRequestedAddressFamily, attrEvenPort, attrRequestedTransport, attrDontFragment, attrReservationToken,
+	)
+	if len(unknown) > 0 {
+		value := make([]byte, 0, 2*len(unknown))
+		for _, attributeType := range unknown {
+			value = binary.BigEndian.AppendUint16(value, attributeType)
+		}
+		t.service.write(newMessageBuilder(msg.method, classError, msg.transactionID).
+			addError(420, "Unknown Attribute").
+			add(attrUnknownAttributes, value).
+			addIntegrity(key).
+			addFingerprint().
+			bytes(), source)
+		return
+	}
+	if msg.method == methodAllocate {
+		t.handleAllocate(msg, source, username, key)
+		return
+	}
+	t.access.Lock()
+	current := t.allocations[source]
+	t.access.Unlock()
+	if current == nil || !current.ready() || current.username != username {
+		t.writeError(msg, source, key, 437, "Allocation Mismatch")
+		return
+	}
+	switch msg.method {
+	case methodRefresh:
+		t.handleRefresh(msg, current, key)
+	case methodCreatePermission:
+		t.handleCreatePermission(msg, current, key)
+	case methodChannelBind:
+		t.handleChannelBind(msg, current, key)
+	}
+}
+
+// authenticate checks the long-term credential of a request, see RFC 8489 Section 9.2.
+func (t *turnServer) authenticate(msg *message, source netip.AddrPort) (string, []byte, bool) {
+	if _, hasIntegrity := msg.get(attrMessageIntegrity); !hasIntegrity {
+		t.writeChallenge(msg, source, 401, "Unauthorized")
+		return "", nil, false
+	}
+	username, hasUsername := msg.get(attrUsername)
+	realm, hasRealm := msg.get(attrRealm)
+	nonce, hasNonce := msg.get(attrNonce)
+	if !hasUsername || !hasRealm || !hasNonce {
+		t.writeError(msg, source, nil, 400, "Bad Request")
+		return "", nil, false
+	}
+	if !t.checkNonce(string(nonce), source.Addr()) || string(realm) != t.realm {
+		t.writeChallenge(msg, source, 438, "Stale Nonce")
+		return "", nil, false
+	}
+	key, loaded := t.keys[string(username)]
+	if !loaded || !msg.checkIntegrity(key) {
+		t.logger.Debug("TURN authentication failed for ", string(username), " from ", source)
+		t.writeChallenge(msg, source, 401, "Unauthorized")
+		return "", nil, false
+	}
+	return string(username), key, true
+}
+
+func (t *turnServer) writeChallenge(msg *message, source netip.AddrPort, code int, reason string) {
+	t.service.write(newMessageBuilder(msg.method, classError, msg.transactionID).
+		addError(code, reason).
+		add(attrRealm, []byte(t.realm)).
+		add(attrNonce, []byte(t.newNonce(source.Addr(), time.Now()))).
+		addFingerprint().
+		bytes(), source)
+}
+
+func (t *turnServer) writeError(msg *message, source netip.AddrPort, key []byte, code int, reason string) {
+	builder := newMessageBuilder(msg.method, classError, msg.transactionID).addError(code, reason)
+	if key != nil {
+		builder.addIntegrity(key)
+	}
+	t.service.write(builder.addFingerprint().bytes(), source)
+}
+
+func (t *turnServer) writeSuccess(builder *messageBuilder, destination netip.AddrPort, key []byte) []byte {
+	packet := builder.addIntegrity(key).addFingerprint().bytes()
+	t.service.write(packet, destination)
+	return packet
+}
+
+// newNonce returns a stateless nonce bound to the client address.
+func (t *turnServer) newNonce(address netip.Addr, now time.Time) string {
+	timestamp := binary.BigEndian.AppendUint64(nil, uint64(now.Unix()))
+	return hex.EncodeToString(timestamp) + hex.EncodeToString(t.nonceMAC(timestamp, address))
+}
+
+func (t *turnServer) checkNonce(nonce string, address netip.Addr) bool {
+	content, err := hex.DecodeString(nonce)
+	if err != nil || len(content) != 16 {
+		return false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(content[:8])), 0)
+	if time.Since(issued) > nonceLifetime {
+		return false
+	}
+	return hmac.Equal(content[8:], t.nonceMAC(content[:8], address))
+}
+
+func (t *turnServer) nonceMAC(timestamp []byte, address netip.Addr) []byte {
+	mac := hmac.New(sha256.New, t.nonceSecret)
+	mac.Write(timestamp)
+	mac.Write(address.AsSlice())
+	return mac.Sum(nil)[:8]
+}
+
+func (t *turnServer) handleAllocate(msg *message, source netip.AddrPort, username string, key []byte) {
+	t.access.Lock()
+	current, exists := t.allocations[source]
+	if exists {
+		t.access.Unlock()
+		if current.transactionID != msg.transactionID {
+			t.writeError(msg, source, key, 437, "Allocation Mismatch")
+		} else if response := current.allocateResponse(); response != nil {
+			t.service.write(response, source)
+		}
+		return
+	}
+	transport, hasTransport := msg.get(attrRequestedTransport)
+	if !hasTransport || len(transport) != 4 {
+		t.access.Unlock()
+		t.writeError(msg, source, key, 400, "Bad Request")
+		return
+	}
+	if transport[0] != protocolUDP {
+		t.access.Unlock()
+		t.writeError(msg, source, key, 442, "Unsupported Transport Protocol")
+		return
+	}
+	if _, hasToken := msg.get(attrReservationToken); hasToken {
+		t.access.Unlock()
+		t.writeError(msg, source, key, 508, "Insufficient Capacity")
+		return
+	}
+	if _, hasEvenPort := msg.get(attrEvenPort); hasEvenPort {
+		t.access.Unlock()
+		t.writeError(msg, source, key, 508, "Insufficient Capacity")
+		return
+	}
+	family := byte(familyIPv4)
+	if value, loaded := msg.get(attrRequestedAddressFamily); loaded && len(value) == 4 {
+		family = value[0]
+		if family != familyIPv4 && family != familyIPv6 {
+			t.access.Unlock()
+			t.writeError(msg, source, key, 440, "Address Family not Supported")
+			return
+		}
+	}
+	current = &allocation{
+		server:        t,
+		client:        source,
+		username:      username,
+		transactionID: msg.transactionID,
+		expiry:        time.Now().Add(allocateTimeout),
+		permissions:   make(map[netip.Addr]time.Time),
+		channels:      make(map[uint16]*channelBinding),
+		peerChannels:  make(map[netip.AddrPort]uint16),
+		done:          make(chan struct{}),
+	}
+	t.allocations[source] = current
+	t.access.Unlock()
+	lifetime := requestedLifetime(msg)
+	go t.createAllocation(current, msg.method, family, lifetime, key)
+}
+
+func (t *turnServer) createAllocation(current *allocation, method uint16, family byte, lifetime time.Duration, key []byte) {
+	ctx, cancel := context.WithTimeout(t.ctx, allocateTimeout)
+	defer cancel()
+	relay, relayedAddress, err := t.openRelay(ctx, family)
+	if err != nil {
+		t.logger.Error(E.Cause(err, "create allocation for ", current.client))
+		t.access.Lock()
+		if t.allocations[current.client] == current {
+			delete(t.allocations, current.client)
+		}
+		t.access.Unlock()
+		code, reason := 508, "Insufficient Capacity"
+		if err == errAddressFamily {
+			code, reason = 440, "Address Family not Supported"
+		}
+		t.service.write(newMessageBuilder(method, classError, current.transactionID).
+			addError(code, reason).
+			addIntegrity(key).
+			addFingerprint().
+			bytes(), current.client)
+		return
+	}
+	current.access.Lock()
+	current.relay = relay
+	current.relayedAddress = relayedAddress
+	current.expiry = time.Now().Add(lifetime)
+	current.response = newMessageBuilder(method, classSuccess, current.transactionID).
+		addXORAddress(attrXORRelayedAddress, relayedAddress).
+		addUint32(attrLifetime, uint32(lifetime/time.Second)).
+		addXORAddress(attrXORMappedAddress, current.client).
+		addIntegrity(key).
+		addFingerprint().
+		bytes()
+	response := current.response
+	current.access.Unlock()
+	t.access.Lock()
+	registered := t.allocations[current.client] == current
+	t.access.Unlock()
+	if !registered {
+		current.close()
+		return
+	}
+	go current.loopRelay()
+	t.logger.Info("allocated relay ", relayedAddress, " for ", current.username, " at ", current.client)
+	t.service.write(response, current.client)
+}
+
+var errAddressFamily = E.New("address family not supported")
+
+func (t *turnServer) openRelay(ctx context.Context, family byte) (net.PacketConn, netip.AddrPort, error) {
+	listenAddress := netip.IPv4Unspecified()
+	if family == familyIPv6 {
+		listenAddress = netip.IPv6Unspecified()
+	}
+	if t.relayAddress.IsValid() && t.relayAddress.Is4() != (family == familyIPv4) {
+		return nil, netip.AddrPort{}, errAddressFamily
+	}
+	relay, err := t.dialer.ListenPacket(ctx, M.Socksaddr{Addr: listenAddress})
+	if err != nil {
+		return nil, netip.AddrPort{}, err
+	}
+	var relayedAddress netip.AddrPort
+	if t.relaySTUNServer.IsValid() {
+		relayedAddress, err = stun.Binding(relay, t.relaySTUNServer)
+		if err != nil {
+			relay.Close()
+			return nil, netip.AddrPort{}, E.Cause(err, "discover relayed address")
+		}
+		relayedAddress = netip.AddrPortFrom(relayedAddress.Addr().Unmap(), relayedAddress.Port())
+		if relayedAddress.Addr().Is4() != (family == familyIPv4) {
+			relay.Close()
+			return nil, netip.AddrPort{}, errAddressFamily
+		}
+	} else {
+		localAddress := M.SocksaddrFromNet(relay.LocalAddr())
+		if localAddress.Port == 0 {
+			relay.Close()
+			return nil, netip.AddrPort{}, E.New("unknown relayed port, set relay_stun_server instead")
+		}
+		relayedAddress = netip.AddrPortFrom(t.relayAddress, localAddress.Port)
+	}
+	return relay, relayedAddress, nil
+}
+
+func requestedLifetime(msg *message) time.Duration {
+	lifetime := defaultLifetime
+	if value, loaded := msg.get(attrLifetime); loaded && len(value) == 4 {
+		lifetime = time.Duration(binary.BigEndian.Uint32(value)) * time.Second
+	}
+	return min(max(lifetime, defaultLifetime), maxLifetime)
+}
+
+func (t *turnServer) handleRefresh(msg *message, current *allocation, key []byte) {
+	lifetime := requestedLifetime(msg)
+	if value, loaded := msg.get(attrLifetime); loaded && len(value) == 4 && binary.BigEndian.Uint32(value) == 0 {
+		lifetime = 0
+	}
+	if lifetime == 0 {
+		t.access.Lock()
+		if t.allocations[current.client] == current {
+			delete(t.allocations, current.client)
+		}
+		t.access.Unlock()
+		current.close()
+		t.logger.Info("released relay ", current.relayedAddress, " for ", current.username)
+	} else {
+		current.access.Lock()
+		current.expiry = time.Now().Add(lifetime)
+		current.access.Unlock()
+	}
+	t.writeSuccess(newMessageBuilder(methodRefresh, classSuccess, msg.transactionID).
+		addUint32(attrLifetime, uint32(lifetime/time.Second)), current.client, key)
+}
+
+func (t *turnServer) handleCreatePermission(msg *message, current *allocation, key []byte) {
+	var peers []netip.Addr
+	for _, attr := range msg.attributes {
+		if attr.typ != attrXORPeerAddress {
+			continue
+		}
+		peer, ok := parseXORAddress(attr.value, msg.transactionID)
+		if !ok {
+			t.writeError(msg, current.client, key, 400, "Bad Request")
+			return
+		}
+		if !t.allowPeer(peer.Addr()) {
+			t.writeError(msg, current.client, key, 403, "Forbidden")
+			return
+		}
+		if peer.Addr().Is4() != current.relayedAddress.Addr().Is4() {
+			t.writeError(msg, current.client, key, 443, "Peer Address Family Mismatch")
+			return
+		}
+		peers = append(peers, peer.Addr())
+	}
+	if len(peers) == 0 {
+		t.writeError(msg, current.client, key, 400, "Bad Request")
+		return
+	}
+	expiry := time.Now().Add(permissionLifetime)
+	current.access.Lock()
+	for _, peer := range peers {
+		current.permissions[peer] = expiry
+	}
+	current.access.Unlock()
+	t.writeSuccess(newMessageBuilder(methodCreatePermission, classSuccess, msg.transactionID), current.client, key)
+}
+
+func (t *turnServer) handleChannelBind(msg *message, current *allocation, key []byte) {
+	value, hasChannel := msg.get(attrChannelNumber)
+	peer, hasPeer := msg.xorAddress(attrXORPeerAddress)
+	if !hasChannel || len(value) != 4 || !hasPeer {
+		t.writeError(msg, current.client, key, 400, "Bad Request")
+		return
+	}
+	channel := binary.BigEndian.Uint16(value)
+	if channel < minChannelNumber || channel > maxChannelNumber {
+		t.writeError(msg, current.client, key, 400, "Bad Request")
+		return
+	}
+	if !t.allowPeer(peer.Addr()) {
+		t.writeError(msg, current.client, key, 403, "Forbidden")
+		return
+	}
+	if peer.Addr().Is4() != current.relayedAddress.Addr().Is4() {
+		t.writeError(msg, current.client, key, 443, "Peer Address Family Mismatch")
+		return
+	}
+	now := time.Now()
+	current.access.Lock()
+	binding := current.channels[channel]
+	if binding != nil && binding.peer != peer && binding.expiry.After(now) {
+		current.access.Unlock()
+		t.writeError(msg, current.client, key, 400, "Bad Request")
+		return
+	}
+	if boundChannel, loaded := current.peerChannels[peer]; loaded && boundChannel != channel {
+		if boundBinding := current.channels[boundChannel]; boundBinding != nil && boundBinding.expiry.After(now) {
+			current.access.Unlock()
+			t.writeError(msg, current.client, key, 400, "Bad Request")
+			return
+		}
+	}
+	if binding != nil && current.peerChannels[binding.peer] == channel {
+		delete(current.peerChannels, binding.peer)
+	}
+	current.channels[channel] = &channelBinding{peer: peer, expiry: now.Add(channelLifetime)}
+	current.peerChannels[peer] = channel
+	if permissionExpiry := now.Add(permissionLifetime); current.permissions[peer.Addr()].Before(permissionExpiry) {
+		current.permissions[peer.Addr()] = permissionExpiry
+	}
+	current.access.Unlock()
+	t.writeSuccess(newMessageBuilder(methodChannelBind, classSuccess, msg.transactionID), current.client, key)
+}
+
+func (t *turnServer) handleSend(msg *message, source netip.AddrPort) {
+	peer, hasPeer := msg.xorAddress(attrXORPeerAddress)
+	data, hasData := msg.get(attrData)
+	if !hasPeer || !hasData {
+		return
+	}
+	t.access.Lock()
+	current := t.allocations[source]
+	t.access.Unlock()
+	if current == nil {
+		return
+	}
+	current.send(data, peer)
+}
+
+func (t *turnServer) handleChannelData(packet []byte, source netip.AddrPort) {
+	channel := binary.BigEndian.Uint16(packet[0:2])
+	length := int(binary.BigEndian.Uint16(packet[2:4]))
+	if 4+length > len(packet) {
+		return
+	}
+	t.access.Lock()
+	current := t.allocations[source]
+	t.access.Unlock()
+	if current == nil {
+		return
+	}
+	current.access.Lock()
+	binding := current.channels[channel]
+	current.access.Unlock()
+	if binding == nil {
+		return
+	}
+	current.send(packet[4:4+length], binding.peer)
+}
+
+// allowPeer denies loopback, private, link-local and ULA peers unless they are
+// explicitly allowed, so the relay cannot reach the network of the server (RFC 8656 section 21.2.1).
+func (t *turnServer) allowPeer(address netip.Addr) bool {
+	address = address.Unmap()
+	if !address.IsValid() || address.IsUnspecified() || address.IsMulticast() {
+		return false
+	}
+	for _, prefix := range t.allowedPeers {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return !address.IsLoopback() && !address.IsPrivate() && !address.IsLinkLocalUnicast()
+}
+
+func isChannelData(packet []byte) bool {
+	return len(packet) >= 4 && packet[0]&0xC0 == 0x40
+}
@@ -0,0 +1,285 @@
+//go:build with_gvisor
+
+package tailscalecontrol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/tailscale/net/tsaddr"
+	"github.com/sagernet/tailscale/tailcfg"
+	"github.com/sagernet/tailscale/types/key"
+	"github.com/sagernet/tailscale/util/zstdframe"
+)
+
+// keepAliveInterval must stay well below the two minute watchdog of clients.
+const keepAliveInterval = 50 * time.Second
+
+type mapSession struct {
+	node    *controlNode
+	updates chan struct{}
+}
+
+func (s *Service) serveMap(w http.ResponseWriter, r *http.Request, machineKey key.MachinePublic) {
+	var request tailcfg.MapRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.access.Lock()
+	node := s.findNodeLocked(machineKey, request.NodeKey)
+	if node == nil {
+		s.access.Unlock()
+		http.Error(w, "node not found", http.StatusUnauthorized)
+		return
+	}
+	s.updateNodeLocked(node, &request)
+	if !request.Stream && request.OmitPeers {
+		s.access.Unlock()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var session *mapSession
+	if request.Stream {
+		node.sessions++
+		if node.expireTimer != nil {
+			node.expireTimer.Stop()
+			node.expireTimer = nil
+		}
+		s.notifyLocked()
+		session = &mapSession{
+			node:    node,
+			updates: make(chan struct{}, 1),
+		}
+		s.sessions[session] = struct{}{}
+	}
+	s.access.Unlock()
+	if session != nil {
+		defer s.closeSession(session)
+	}
+	compress := request.Compress == "zstd"
+	sentPeers := make(map[tailcfg.NodeID]bool)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	err = s.writeMap(w, node, compress, sentPeers)
+	if err != nil || session == nil {
+		return
+	}
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case <-session.updates:
+			err = s.writeMap(w, node, compress, sentPeers)
+		case <-ticker.C:
+			err = writeMapMessage(w, &tailcfg.MapResponse{KeepAlive: true}, compress)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Service) closeSession(session *mapSession) {
+	s.access.Lock()
+	defer s.access.Unlock()
+	delete(s.sessions, session)
+	node := session.node
+	node.sessions--
+	node.LastSeen = time.Now()
+	if node.sessions == 0 && node.Ephemeral && s.nodes[node.ID] == node {
+		node.expireTimer = time.AfterFunc(ephemeralNodeTimeout, func() {
+			s.access.Lock()
+			defer s.access.Unlock()
+			if s.nodes[node.ID] == node && node.sessions == 0 {
+				s.logger.Info("ephemeral node expired: ", node.Hostname)
+				s.removeNodeLocked(node)
+			}
+		})
+	}
+	s.notifyLocked()
+}
+
+func (s *Service) notifyLocked() {
+	for session := range s.sessions {
+		select {
+		case session.updates <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Service) updateNodeLocked(node *controlNode, request *tailcfg.MapRequest) {
+	var changed bool
+	if !request.DiscoKey.IsZero() && request.DiscoKey != node.DiscoKey {
+		node.DiscoKey = request.DiscoKey
+		changed = true
+	}
+	if len(request.Endpoints) > 0 && !slices.Equal(request.Endpoints, node.Endpoints) {
+		node.Endpoints = request.Endpoints
+		changed = true
+	}
+	if request.Hostinfo != nil && !request.Hostinfo.Equal(node.Hostinfo) {
+		node.Hostinfo = request.Hostinfo
+		node.Hostname = s.uniqueHostnameLocked(node, request.Hostinfo.Hostname)
+		changed = true
+	}
+	node.CapVersion = request.Version
+	node.LastSeen = time.Now()
+	if changed {
+		s.notifyLocked()
+	}
+}
+
+func (s *Service) writeMap(w http.ResponseWriter, node *controlNode, compress bool, sentPeers map[tailcfg.NodeID]bool) error {
+	s.access.Lock()
+	if s.nodes[node.ID] != node {
+		s.access.Unlock()
+		return E.New("node removed")
+	}
+	response := s.mapResponseLocked(node)
+	s.access.Unlock()
+	currentPeers := make(map[tailcfg.NodeID]bool, len(response.Peers))
+	for _, peer := range response.Peers {
+		currentPeers[peer.ID] = true
+	}
+	for peerID := range sentPeers {
+		if !currentPeers[peerID] {
+			response.PeersRemoved = append(response.PeersRemoved, peerID)
+			delete(sentPeers, peerID)
+		}
+	}
+	for peerID := range currentPeers {
+		sentPeers[peerID] = true
+	}
+	return writeMapMessage(w, response, compress)
+}
+
+func writeMapMessage(w io.Writer, response *tailcfg.MapResponse, compress bool) error {
+	content, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if compress {
+		content = zstdframe.AppendEncode(nil, content, zstdframe.FastestCompression)
+	}
+	var header [4]byte
+	binary.LittleEndian.PutUint32(header[:], uint32(len(content)))
+	_, err = w.Write(header[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	if err != nil {
+		return err
+	}
+	if flusher, isFlusher := w.(http.Flusher); isFlusher {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (s *Service) mapResponseLocked(self *controlNode) *tailcfg.MapResponse {
+	now := time.Now()
+	nodes := make([]*controlNode, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b *controlNode) int {
+		return int(a.ID - b.ID)
+	})
+	primaryRoutes := make(map[netip.Prefix]tailcfg.NodeID)
+	for _, node := range nodes {
+		if node.Hostinfo == nil {
+			continue
+		}
+		for _, route := range node.Hostinfo.RoutableIPs {
+			if tsaddr.IsExitRoute(route) {
+				continue
+			}
+			if _, loaded := primaryRoutes[route]; !loaded {
+				primaryRoutes[route] = node.ID
+			}
+		}
+	}
+	response := &tailcfg.MapResponse{
+		Node:            s.tailcfgNodeLocked(self, primaryRoutes),
+		DERPMap:         s.derpMap,
+		Domain:          s.baseDomain,
+		CollectServices: "false",
+		PacketFilter:    tailcfg.FilterAllowAll,
+		UserProfiles: []tailcfg.UserProfile{{
+			ID:          controlUserID,
+			LoginName:   "sing-box",
+			DisplayName: "sing-box",
+		}},
+		ControlTime: &now,
+	}
+	if s.baseDomain != "" {
+		response.DNSConfig = &tailcfg.DNSConfig{
+			Domains: []string{s.baseDomain},
+			Proxied: true,
+		}
+	}
+	for _, node := range nodes {
+		if node == self || node.Key.IsZero() {
+			continue
+		}
+		response.Peers = append(response.Peers, s.tailcfgNodeLocked(node, primaryRoutes))
+	}
+	return response
+}
+
+func (s *Service) tailcfgNodeLocked(node *controlNode, primaryRoutes map[netip.Prefix]tailcfg.NodeID) *tailcfg.Node {
+	online := node.sessions > 0
+	name := node.Hostname + "."
+	if s.baseDomain != "" {
+		name = node.Hostname + "." + s.baseDomain + "."
+	}
+	tsNode := &tailcfg.Node{
+		ID:                node.ID,
+		StableID:          tailcfg.StableNodeID(strconv.FormatInt(int64(node.ID), 10)),
+		Name:              name,
+		User:              controlUserID,
+		Key:               node.Key,
+		Machine:           node.Machine,
+		DiscoKey:          node.DiscoKey,
+		Addresses:         node.Addresses,
+		AllowedIPs:        slices.Clone(node.Addresses),
+		Endpoints:         node.Endpoints,
+		Created:           node.Created,
+		Cap:               node.CapVersion,
+		Tags:              node.Tags,
+		Online:            &online,
+		MachineAuthorized: true,
+	}
+	if !node.LastSeen.IsZero() {
+		lastSeen := node.LastSeen
+		tsNode.LastSeen = &lastSeen
+	}
+	if node.Hostinfo != nil {
+		tsNode.Hostinfo = node.Hostinfo.View()
+		if node.Hostinfo.NetInfo != nil {
+			tsNode.HomeDERP = node.Hostinfo.NetInfo.PreferredDERP
+		}
+		// Without ACLs, every advertised route is approved.
+		for _, route := range node.Hostinfo.RoutableIPs {
+			tsNode.AllowedIPs = append(tsNode.AllowedIPs, route)
+			if primaryRoutes[route] == node.ID {
+				tsNode.PrimaryRoutes = append(tsNode.PrimaryRoutes, route)
+			}
+		}
+	}
+	return tsNode
+}
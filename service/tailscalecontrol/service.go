@@ -0,0 +1,303 @@
+//go:build with_gvisor
+
+package tailscalecontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sagernet/sing-box/adapter"
+	boxService "github.com/sagernet/sing-box/adapter/service"
+	"github.com/sagernet/sing-box/common/listener"
+	"github.com/sagernet/sing-box/common/tls"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/service/derp"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/logger"
+	N "github.com/sagernet/sing/common/network"
+	aTLS "github.com/sagernet/sing/common/tls"
+	"github.com/sagernet/sing/service"
+	"github.com/sagernet/sing/service/filemanager"
+	"github.com/sagernet/tailscale/control/controlbase"
+	"github.com/sagernet/tailscale/control/controlhttp/controlhttpserver"
+	"github.com/sagernet/tailscale/net/tsaddr"
+	"github.com/sagernet/tailscale/tailcfg"
+	"github.com/sagernet/tailscale/types/key"
+
+	"golang.org/x/net/http2"
+)
+
+func RegisterService(registry *boxService.Registry) {
+	boxService.Register[option.TailscaleControlServiceOptions](registry, C.TypeTailscaleControl, NewService)
+}
+
+type Service struct {
+	boxService.Adapter
+	ctx         context.Context
+	cancel      context.CancelFunc
+	logger      logger.ContextLogger
+	listener    *listener.Listener
+	tlsConfig   tls.ServerConfig
+	httpServer  *http.Server
+	statePath   string
+	authKeys    map[string]bool
+	inet4Range  netip.Prefix
+	inet6Range  netip.Prefix
+	baseDomain  string
+	derpOptions []option.TailscaleControlDERPOptions
+	derpMap     *tailcfg.DERPMap
+
+	access     sync.Mutex
+	privateKey key.MachinePrivate
+	nodes      map[tailcfg.NodeID]*controlNode
+	nextID     tailcfg.NodeID
+	sessions   map[*mapSession]struct{}
+	conns      map[*controlbase.Conn]struct{}
+}
+
+func NewService(ctx context.Context, logger log.ContextLogger, tag string, options option.TailscaleControlServiceOptions) (adapter.Service, error) {
+	if len(options.AuthKeys) == 0 {
+		return nil, E.New("missing auth_keys")
+	}
+	var tlsConfig tls.ServerConfig
+	if options.TLS != nil && options.TLS.Enabled {
+		var err error
+		tlsConfig, err = tls.NewServer(ctx, logger, common.PtrValueOrDefault(options.TLS))
+		if err != nil {
+			return nil, err
+		}
+	}
+	inet4Range := tsaddr.CGNATRange()
+	if options.Inet4Range != nil {
+		inet4Range = options.Inet4Range.Build(netip.Prefix{})
+		if !inet4Range.Addr().Is4() {
+			return nil, E.New("invalid inet4_range: ", inet4Range)
+		}
+	}
+	inet6Range := tsaddr.TailscaleULARange()
+	if options.Inet6Range != nil {
+		inet6Range = options.Inet6Range.Build(netip.Prefix{})
+		if !inet6Range.Addr().Is6() {
+			return nil, E.New("invalid inet6_range: ", inet6Range)
+		}
+	}
+	var statePath string
+	if options.StatePath != "" {
+		statePath = filemanager.BasePath(ctx, os.ExpandEnv(options.StatePath))
+	}
+	authKeys := make(map[string]bool)
+	for _, authKey := range options.AuthKeys {
+		authKeys[authKey] = true
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Service{
+		Adapter: boxService.NewAdapter(C.TypeTailscaleControl, tag),
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logger,
+		listener: listener.New(listener.Options{
+			Context: ctx,
+			Logger:  logger,
+			Network: []string{N.NetworkTCP},
+			Listen:  options.ListenOptions,
+		}),
+		tlsConfig:   tlsConfig,
+		statePath:   statePath,
+		authKeys:    authKeys,
+		inet4Range:  inet4Range.Masked(),
+		inet6Range:  inet6Range.Masked(),
+		baseDomain:  strings.Trim(strings.ToLower(options.BaseDomain), "."),
+		derpOptions: options.DERP,
+		nodes:       make(map[tailcfg.NodeID]*controlNode),
+		nextID:      1,
+		sessions:    make(map[*mapSession]struct{}),
+		conns:       make(map[*controlbase.Conn]struct{}),
+	}, nil
+}
+
+func (s *Service) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	derpMap, err := s.buildDERPMap()
+	if err != nil {
+		return err
+	}
+	s.derpMap = derpMap
+	err = s.loadState()
+	if err != nil {
+		return E.Cause(err, "load state")
+	}
+	if s.tlsConfig != nil {
+		err = s.tlsConfig.Start()
+		if err != nil {
+			return err
+		}
+		// The ts2021 upgrade hijacks the connection and requires HTTP/1.1.
+		s.tlsConfig.SetNextProtos([]string{"http/1.1"})
+	}
+	tcpListener, err := s.listener.ListenTCP()
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		tcpListener = aTLS.NewListener(tcpListener, s.tlsConfig)
+	}
+	s.httpServer = &http.Server{
+		Handler: s.newHandler(),
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+	}
+	go func() {
+		serveErr := s.httpServer.Serve(tcpListener)
+		if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) && !E.IsClosedOrCanceled(serveErr) {
+			s.logger.Error(E.Cause(serveErr, "serve control"))
+		}
+	}()
+	return nil
+}
+
+func (s *Service) buildDERPMap() (*tailcfg.DERPMap, error) {
+	if len(s.derpOptions) == 0 {
+		return nil, nil
+	}
+	serviceManager := service.FromContext[adapter.ServiceManager](s.ctx)
+	derpMap := &tailcfg.DERPMap{
+		Regions: make(map[int]*tailcfg.DERPRegion),
+	}
+	for i, derpOptions := range s.derpOptions {
+		rawService, loaded := serviceManager.Get(derpOptions.Service)
+		if !loaded {
+			return nil, E.New("derp[", i, "]: service not found: ", derpOptions.Service)
+		}
+		derpService, isDERP := rawService.(*derp.Service)
+		if !isDERP {
+			return nil, E.New("derp[", i, "]: service is not DERP: ", derpOptions.Service)
+		}
+		// Region IDs from 900 up are reserved for custom DERP servers.
+		regionID := 900 + i
+		node := derpService.DERPNode()
+		node.Name = F.ToString(regionID, "a")
+		node.RegionID = regionID
+		if derpOptions.HostName != "" {
+			node.HostName = derpOptions.HostName
+		}
+		if node.HostName == "" {
+			return nil, E.New("derp[", i, "]: missing host_name")
+		}
+		if address, err := netip.ParseAddr(node.HostName); err == nil {
+			if address.Is4() {
+				node.IPv4 = address.String()
+			} else {
+				node.IPv6 = address.String()
+			}
+		}
+		if derpOptions.Port != 0 {
+			node.DERPPort = int(derpOptions.Port)
+		}
+		node.InsecureForTests = derpOptions.Insecure
+		derpMap.Regions[regionID] = &tailcfg.DERPRegion{
+			RegionID:   regionID,
+			RegionCode: derpOptions.Service,
+			RegionName: derpOptions.Service,
+			Nodes:      []*tailcfg.DERPNode{&node},
+		}
+	}
+	return derpMap, nil
+}
+
+func (s *Service) newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /key", s.serveKey)
+	mux.HandleFunc("/ts2021", s.serveNoiseUpgrade)
+	return mux
+}
+
+func (s *Service) serveKey(w http.ResponseWriter, r *http.Request) {
+	s.access.Lock()
+	publicKey := s.privateKey.Public()
+	s.access.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&tailcfg.OverTLSPublicKeyResponse{
+		PublicKey: publicKey,
+	})
+}
+
+func (s *Service) serveNoiseUpgrade(w http.ResponseWriter, r *http.Request) {
+	s.access.Lock()
+	privateKey := s.privateKey
+	s.access.Unlock()
+	conn, err := controlhttpserver.AcceptHTTP(r.Context(), w, r, privateKey, nil)
+	if err != nil {
+		s.logger.DebugContext(r.Context(), E.Cause(err, "accept control connection from ", r.RemoteAddr))
+		return
+	}
+	s.access.Lock()
+	s.conns[conn] = struct{}{}
+	s.access.Unlock()
+	defer func() {
+		s.access.Lock()
+		delete(s.conns, conn)
+		s.access.Unlock()
+		conn.Close()
+	}()
+	machineKey := conn.Peer()
+	noiseMux := http.NewServeMux()
+	noiseMux.HandleFunc("POST /machine/register", func(w http.ResponseWriter, r *http.Request) {
+		s.serveRegister(w, r, machineKey)
+	})
+	noiseMux.HandleFunc("POST /machine/map", func(w http.ResponseWriter, r *http.Request) {
+		s.serveMap(w, r, machineKey)
+	})
+	var h2Server http2.Server
+	h2Server.ServeConn(conn, &http2.ServeConnOpts{
+		Context: log.ContextWithNewID(s.ctx),
+		Handler: noiseMux,
+	})
+}
+
+func (s *Service) serveRegister(w http.ResponseWriter, r *http.Request, machineKey key.MachinePublic) {
+	var request tailcfg.RegisterRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := s.register(r.Context(), machineKey, &request)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Service) Close() error {
+	s.cancel()
+	var err error
+	if s.httpServer != nil {
+		err = s.httpServer.Close()
+	}
+	s.access.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for _, node := range s.nodes {
+		if node.expireTimer != nil {
+			node.expireTimer.Stop()
+		}
+	}
+	s.access.Unlock()
+	return E.Errors(err, common.Close(
+		common.PtrOrNil(s.listener),
+		s.tlsConfig,
+	))
+}
@@ -0,0 +1,215 @@
+//go:build with_gvisor
+
+package tailscalecontrol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/tailscale/derp/derpserver"
+	"github.com/sagernet/tailscale/ipn/ipnstate"
+	tsDNS "github.com/sagernet/tailscale/net/dns"
+	"github.com/sagernet/tailscale/tailcfg"
+	"github.com/sagernet/tailscale/tsnet"
+	"github.com/sagernet/tailscale/types/key"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAuthKey = "sing-box-test"
+
+func newTestService(t *testing.T, statePath string) *Service {
+	rawService, err := NewService(context.Background(), log.NewNOPFactory().Logger(), "control", option.TailscaleControlServiceOptions{
+		StatePath:  statePath,
+		AuthKeys:   []string{testAuthKey},
+		BaseDomain: "sing-box.test",
+	})
+	require.NoError(t, err)
+	controlService := rawService.(*Service)
+	require.NoError(t, controlService.loadState())
+	t.Cleanup(func() {
+		controlService.Close()
+	})
+	return controlService
+}
+
+func TestRegisterPersistence(t *testing.T) {
+	t.Parallel()
+	statePath := filepath.Join(t.TempDir(), "control.json")
+	machineKey := key.NewMachine().Public()
+	nodeKey := key.NewNode().Public()
+
+	controlService := newTestService(t, statePath)
+	response := controlService.register(context.Background(), key.NewMachine().Public(), &tailcfg.RegisterRequest{
+		NodeKey:  key.NewNode().Public(),
+		Hostinfo: &tailcfg.Hostinfo{Hostname: "rejected"},
+	})
+	require.NotEmpty(t, response.Error)
+	response = controlService.register(context.Background(), machineKey, &tailcfg.RegisterRequest{
+		NodeKey:  nodeKey,
+		Auth:     &tailcfg.RegisterResponseAuth{AuthKey: testAuthKey},
+		Hostinfo: &tailcfg.Hostinfo{Hostname: "Node A"},
+	})
+	require.Empty(t, response.Error)
+	require.True(t, response.MachineAuthorized)
+	node := controlService.findNodeLocked(machineKey, nodeKey)
+	require.NotNil(t, node)
+	require.Equal(t, "node-a", node.Hostname)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("100.64.0.1/32"),
+		netip.MustParsePrefix("fd7a:115c:a1e0::1/128"),
+	}, node.Addresses)
+	publicKey := controlService.privateKey.Public()
+
+	reloadedService := newTestService(t, statePath)
+	require.Equal(t, publicKey, reloadedService.privateKey.Public())
+	reloadedNode := reloadedService.findNodeLocked(machineKey, nodeKey)
+	require.NotNil(t, reloadedNode)
+	require.Equal(t, node.Addresses, reloadedNode.Addresses)
+
+	// Key rotation from a known machine does not require an auth key.
+	newNodeKey := key.NewNode().Public()
+	response = reloadedService.register(context.Background(), machineKey, &tailcfg.RegisterRequest{
+		NodeKey:    newNodeKey,
+		OldNodeKey: nodeKey,
+	})
+	require.Empty(t, response.Error)
+	require.Equal(t, reloadedNode, reloadedService.findNodeLocked(machineKey, newNodeKey))
+}
+
+func TestTailnet(t *testing.T) {
+	controlService := newTestService(t, "")
+	controlService.derpMap = startTestDERP(t)
+	controlServer := httptest.NewServer(controlService.newHandler())
+	t.Cleanup(controlServer.Close)
+
+	nodeA := startTestNode(t, controlServer.URL, "node-a", testAuthKey)
+	nodeB := startTestNode(t, controlServer.URL, "node-b", testAuthKey)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// Without DERP, nodes stay in the Starting state until a peer handshake completes.
+	statusA := waitForPeer(t, ctx, nodeA, "node-b")
+	statusB := waitForPeer(t, ctx, nodeB, "node-a")
+	require.Equal(t, "node-a.sing-box.test.", statusA.Self.DNSName)
+
+	listener, err := nodeB.Listen("tcp", ":80")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	conn, err := nodeA.Dial(ctx, "tcp", netip.AddrPortFrom(statusB.TailscaleIPs[0], 80).String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buffer := make([]byte, 5)
+	_, err = io.ReadFull(conn, buffer)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buffer))
+
+	rejectedNode := startTestNode(t, controlServer.URL, "node-c", "invalid")
+	_, err = rejectedNode.Up(ctx)
+	require.ErrorContains(t, err, "invalid auth key")
+}
+
+func startTestDERP(t *testing.T) *tailcfg.DERPMap {
+	derpServer := derpserver.New(key.NewNode(), func(format string, args ...any) {})
+	t.Cleanup(func() {
+		derpServer.Close()
+	})
+	httpServer := httptest.NewTLSServer(derpserver.Handler(derpServer))
+	t.Cleanup(httpServer.Close)
+	serverAddr := M.ParseSocksaddr(httpServer.Listener.Addr().String())
+	return &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			900: {
+				RegionID:   900,
+				RegionCode: "test",
+				Nodes: []*tailcfg.DERPNode{{
+					Name:             "900a",
+					RegionID:         900,
+					HostName:         serverAddr.Addr.String(),
+					IPv4:             serverAddr.Addr.String(),
+					IPv6:             "none",
+					DERPPort:         int(serverAddr.Port),
+					STUNPort:         -1,
+					InsecureForTests: true,
+				}},
+			},
+		},
+	}
+}
+
+func waitForPeer(t *testing.T, ctx context.Context, server *tsnet.Server, peerHostname string) *ipnstate.Status {
+	localClient, err := server.LocalClient()
+	require.NoError(t, err)
+	var status *ipnstate.Status
+	require.Eventually(t, func() bool {
+		status, err = localClient.Status(ctx)
+		if err != nil || len(status.TailscaleIPs) == 0 {
+			return false
+		}
+		for _, peer := range status.Peer {
+			if peer.HostName == peerHostname {
+				return true
+			}
+		}
+		return false
+	}, 30*time.Second, 100*time.Millisecond)
+	return status
+}
+
+func startTestNode(t *testing.T, controlURL string, hostname string, authKey string) *tsnet.Server {
+	server := &tsnet.Server{
+		Dir:        t.TempDir(),
+		Hostname:   hostname,
+		AuthKey:    authKey,
+		ControlURL: controlURL,
+		Ephemeral:  true,
+		Logf:       func(format string, args ...any) {},
+		UserLogf: func(format string, args ...any) {
+			t.Log(hostname, ": ", fmt.Sprintf(format, args...))
+		},
+		Dialer: N.SystemDialer,
+		DNS:    &testDNSConfigurator{},
+	}
+	require.NoError(t, server.Start())
+	t.Cleanup(func() {
+		server.Close()
+	})
+	return server
+}
+
+type testDNSConfigurator struct{}
+
+func (c *testDNSConfigurator) SetDNS(cfg tsDNS.OSConfig) error {
+	return nil
+}
+
+func (c *testDNSConfigurator) SupportsSplitDNS() bool {
+	return true
+}
+
+func (c *testDNSConfigurator) GetBaseConfig() (tsDNS.OSConfig, error) {
+	return tsDNS.OSConfig{}, nil
+}
+
+func (c *testDNSConfigurator) Close() error {
+	return nil
+}
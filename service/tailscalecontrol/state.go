@@ -0,0 +1,253 @@
+//go:build with_gvisor
+
+package tailscalecontrol
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/tailscale/net/tsaddr"
+	"github.com/sagernet/tailscale/tailcfg"
+	"github.com/sagernet/tailscale/types/key"
+	"github.com/sagernet/tailscale/util/dnsname"
+)
+
+// ephemeralNodeTimeout is how long an ephemeral node may stay offline before it is removed.
+const ephemeralNodeTimeout = 5 * time.Minute
+
+const controlUserID tailcfg.UserID = 1
+
+type controlNode struct {
+	ID         tailcfg.NodeID            `json:"id"`
+	Machine    key.MachinePublic         `json:"machine"`
+	Key        key.NodePublic            `json:"key"`
+	Hostname   string                    `json:"hostname"`
+	Addresses  []netip.Prefix            `json:"addresses"`
+	Tags       []string                  `json:"tags,omitempty"`
+	Created    time.Time                 `json:"created"`
+	Ephemeral  bool                      `json:"-"`
+	DiscoKey   key.DiscoPublic           `json:"-"`
+	Endpoints  []netip.AddrPort          `json:"-"`
+	Hostinfo   *tailcfg.Hostinfo         `json:"-"`
+	CapVersion tailcfg.CapabilityVersion `json:"-"`
+	LastSeen   time.Time                 `json:"-"`
+
+	sessions    int
+	expireTimer *time.Timer
+}
+
+type controlState struct {
+	PrivateKey key.MachinePrivate `json:"private_key"`
+	Nodes      []*controlNode     `json:"nodes"`
+}
+
+func (s *Service) loadState() error {
+	s.access.Lock()
+	defer s.access.Unlock()
+	if s.statePath != "" {
+		content, err := os.ReadFile(s.statePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			var state controlState
+			err = json.Unmarshal(content, &state)
+			if err != nil {
+				return err
+			}
+			s.privateKey = state.PrivateKey
+			for _, node := range state.Nodes {
+				s.nodes[node.ID] = node
+				if node.ID >= s.nextID {
+					s.nextID = node.ID + 1
+				}
+			}
+		}
+	}
+	if s.privateKey.IsZero() {
+		s.privateKey = key.NewMachine()
+		return s.saveStateLocked()
+	}
+	return nil
+}
+
+func (s *Service) saveStateLocked() error {
+	if s.statePath == "" {
+		return nil
+	}
+	state := controlState{
+		PrivateKey: s.privateKey,
+	}
+	for _, node := range s.nodes {
+		if !node.Ephemeral {
+			state.Nodes = append(state.Nodes, node)
+		}
+	}
+	slices.SortFunc(state.Nodes, func(a, b *controlNode) int {
+		return int(a.ID - b.ID)
+	})
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.statePath), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.statePath, content, 0o600)
+}
+
+func (s *Service) register(ctx context.Context, machineKey key.MachinePublic, request *tailcfg.RegisterRequest) *tailcfg.RegisterResponse {
+	s.access.Lock()
+	defer s.access.Unlock()
+	node := s.findNodeLocked(machineKey, request.NodeKey)
+	if node == nil && !request.OldNodeKey.IsZero() {
+		node = s.findNodeLocked(machineKey, request.OldNodeKey)
+	}
+	if !request.Expiry.IsZero() && request.Expiry.Before(time.Now()) {
+		if node != nil {
+			s.logger.InfoContext(ctx, "node logged out: ", node.Hostname)
+			s.removeNodeLocked(node)
+		}
+		return &tailcfg.RegisterResponse{NodeKeyExpired: true}
+	}
+	if node == nil {
+		for _, machineNode := range s.nodes {
+			if machineNode.Machine == machineKey {
+				node = machineNode
+				break
+			}
+		}
+	}
+	if node == nil {
+		if request.Auth == nil || !s.authKeys[request.Auth.AuthKey] {
+			s.logger.WarnContext(ctx, "rejected registration from machine ", machineKey.ShortString(), ": invalid auth key")
+			return &tailcfg.RegisterResponse{Error: "invalid auth key"}
+		}
+		addresses, err := s.allocateAddressesLocked()
+		if err != nil {
+			s.logger.ErrorContext(ctx, E.Cause(err, "allocate addresses"))
+			return &tailcfg.RegisterResponse{Error: err.Error()}
+		}
+		node = &controlNode{
+			ID:        s.nextID,
+			Machine:   machineKey,
+			Addresses: addresses,
+			Created:   time.Now(),
+		}
+		s.nextID++
+		s.nodes[node.ID] = node
+	}
+	node.Key = request.NodeKey
+	node.Ephemeral = request.Ephemeral
+	if request.Hostinfo != nil {
+		node.Hostinfo = request.Hostinfo
+		node.Hostname = s.uniqueHostnameLocked(node, request.Hostinfo.Hostname)
+		node.Tags = request.Hostinfo.RequestTags
+	}
+	s.logger.InfoContext(ctx, "node registered: ", node.Hostname, " ", node.Addresses)
+	err := s.saveStateLocked()
+	if err != nil {
+		s.logger.ErrorContext(ctx, E.Cause(err, "save state"))
+	}
+	s.notifyLocked()
+	return &tailcfg.RegisterResponse{
+		User: tailcfg.User{
+			ID:          controlUserID,
+			DisplayName: "sing-box",
+		},
+		Login: tailcfg.Login{
+			ID:          tailcfg.LoginID(controlUserID),
+			LoginName:   "sing-box",
+			DisplayName: "sing-box",
+		},
+		MachineAuthorized: true,
+	}
+}
+
+func (s *Service) findNodeLocked(machineKey key.MachinePublic, nodeKey key.NodePublic) *controlNode {
+	if nodeKey.IsZero() {
+		return nil
+	}
+	for _, node := range s.nodes {
+		if node.Machine == machineKey && node.Key == nodeKey {
+			return node
+		}
+	}
+	return nil
+}
+
+func (s *Service) removeNodeLocked(node *controlNode) {
+	delete(s.nodes, node.ID)
+	if node.expireTimer != nil {
+		node.expireTimer.Stop()
+	}
+	err := s.saveStateLocked()
+	if err != nil {
+		s.logger.Error(E.Cause(err, "save state"))
+	}
+	s.notifyLocked()
+}
+
+func (s *Service) uniqueHostnameLocked(self *controlNode, hostname string) string {
+	hostname = dnsname.SanitizeHostname(hostname)
+	if hostname == "" {
+		hostname = "node"
+	}
+	candidate := hostname
+	for i := 1; ; i++ {
+		var conflict bool
+		for _, node := range s.nodes {
+			if node != self && node.Hostname == candidate {
+				conflict = true
+				break
+			}
+		}
+		if !conflict {
+			return candidate
+		}
+		candidate = hostname + "-" + strconv.Itoa(i)
+	}
+}
+
+func (s *Service) allocateAddressesLocked() ([]netip.Prefix, error) {
+	usedAddresses := make(map[netip.Addr]bool)
+	for _, node := range s.nodes {
+		for _, address := range node.Addresses {
+			usedAddresses[address.Addr()] = true
+		}
+	}
+	inet4Address, err := allocateAddress(s.inet4Range, tsaddr.TailscaleServiceIP(), usedAddresses)
+	if err != nil {
+		return nil, err
+	}
+	inet6Address, err := allocateAddress(s.inet6Range, tsaddr.TailscaleServiceIPv6(), usedAddresses)
+	if err != nil {
+		return nil, err
+	}
+	return []netip.Prefix{
+		netip.PrefixFrom(inet4Address, 32),
+		netip.PrefixFrom(inet6Address, 128),
+	}, nil
+}
+
+func allocateAddress(prefix netip.Prefix, reserved netip.Addr, usedAddresses map[netip.Addr]bool) (netip.Addr, error) {
+	for address := prefix.Addr().Next(); prefix.Contains(address); address = address.Next() {
+		if address == reserved || usedAddresses[address] {
+			continue
+		}
+		if address.Is4() && !prefix.Contains(address.Next()) {
+			// broadcast address
+			break
+		}
+		return address, nil
+	}
+	return netip.Addr{}, E.New("address range exhausted: ", prefix)
+}
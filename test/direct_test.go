@@ -1,17 +1,42 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
 	"net/netip"
 	"testing"
+	"time"
 
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/option"
 	"github.com/sagernet/sing/common"
+	F "github.com/sagernet/sing/common/format"
 	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/protocol/socks"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/require"
 )
 
-// Since this is a feature one-off added by outsiders, I won't address these anymore.
-func _TestProxyProtocol(t *testing.T) {
+func TestProxyProtocol(t *testing.T) {
+	for _, version := range []uint8{1, 2} {
+		t.Run(F.ToString("v", version), func(t *testing.T) {
+			testProxyProtocol(t, version)
+		})
+	}
+}
+
+func testProxyProtocol(t *testing.T, version uint8) {
+	var inboundRule option.RawDefaultRule
+	if version == 2 {
+		inboundRule.ProxyProtocolInbound = []string{"mixed-in"}
+	} else {
+		inboundRule.Inbound = []string{"direct-in"}
+	}
 	startInstance(t, option.Options{
 		Inbounds: []option.Inbound{
 			{
@@ -26,6 +51,7 @@ func _TestProxyProtocol(t *testing.T) {
 			},
 			{
 				Type: C.TypeDirect,
+				Tag:  "direct-in",
 				Options: &option.DirectInboundOptions{
 					ListenOptions: option.ListenOptions{
 						Listen:        common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
@@ -38,14 +64,15 @@ func _TestProxyProtocol(t *testing.T) {
 		Outbounds: []option.Outbound{
 			{
 				Type: C.TypeDirect,
+				Tag:  "direct",
 			},
 			{
 				Type: C.TypeDirect,
 				Tag:  "proxy-out",
 				Options: &option.DirectOutboundOptions{
-					OverrideAddress: "127.0.0.1",
-					OverridePort:    serverPort,
-					ProxyProtocol:   2,
+					DialerOptions: option.DialerOptions{
+						ProxyProtocol: version,
+					},
 				},
 			},
 		},
@@ -59,7 +86,172 @@ func _TestProxyProtocol(t *testing.T) {
 						},
 						RuleAction: option.RuleAction{
 							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "proxy-out",
+								RawRouteOptionsActionOptions: option.RawRouteOptionsActionOptions{
+									OverrideAddress: "127.0.0.1",
+									OverridePort:    serverPort,
+								},
+							},
+						},
+					},
+				},
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: inboundRule,
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "direct",
+							},
+						},
+					},
+				},
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"direct-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeReject,
+						},
+					},
+				},
+			},
+		},
+	})
+	testTCP(t, clientPort, testPort)
+}
+
+func TestProxyProtocolUDP(t *testing.T) {
+	for _, version := range []uint8{1, 2} {
+		t.Run(F.ToString("v", version), func(t *testing.T) {
+			testProxyProtocolUDP(t, version)
+		})
+	}
+}
+
+func testProxyProtocolUDP(t *testing.T, version uint8) {
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+				Options: &option.DirectOutboundOptions{
+					DialerOptions: option.DialerOptions{
+						ProxyProtocol: version,
+					},
+				},
+			},
+		},
+	})
+	for _, port := range []uint16{testPort, otherPort} {
+		listener, err := net.ListenPacket("udp", netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), port).String())
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			buffer := make([]byte, 1024)
+			for {
+				n, remoteAddr, readErr := listener.ReadFrom(buffer)
+				if readErr != nil {
+					return
+				}
+				header, readErr := proxyproto.Read(bufio.NewReader(bytes.NewReader(buffer[:n])))
+				if readErr != nil {
+					listener.WriteTo(buffer[:n], remoteAddr)
+				} else {
+					listener.WriteTo([]byte(header.DestinationAddr.String()), remoteAddr)
+				}
+			}
+		}()
+	}
+	dialer := socks.NewClient(N.SystemDialer, M.ParseSocksaddrHostPort("127.0.0.1", clientPort), socks.Version5, "", "")
+	packetConn, err := dialer.ListenPacket(context.Background(), M.ParseSocksaddrHostPort("127.0.0.1", testPort))
+	require.NoError(t, err)
+	defer packetConn.Close()
+	// v1 sends UDP without header, and v2 headers of packets to a peer other than the first
+	// must carry their own destination
+	for _, port := range []uint16{testPort, otherPort, testPort} {
+		destination := M.ParseSocksaddrHostPort("127.0.0.1", port)
+		_, err = packetConn.WriteTo([]byte("hello"), destination.UDPAddr())
+		require.NoError(t, err)
+		require.NoError(t, packetConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buffer := make([]byte, 1024)
+		n, _, err := packetConn.ReadFrom(buffer)
+		require.NoError(t, err)
+		if version == 1 {
+			require.Equal(t, "hello", string(buffer[:n]))
+		} else {
+			require.Equal(t, destination.String(), string(buffer[:n]))
+		}
+	}
+}
 
+func TestProxyProtocolOutboundUDP(t *testing.T) {
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type: C.TypeSOCKS,
+				Tag:  "socks-in",
+				Options: &option.SocksInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:        common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort:    serverPort,
+						ProxyProtocol: true,
+					},
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			{
+				Type: C.TypeSOCKS,
+				Tag:  "proxy-out",
+				Options: &option.SOCKSOutboundOptions{
+					ServerOptions: option.ServerOptions{
+						Server:     "127.0.0.1",
+						ServerPort: serverPort,
+					},
+					DialerOptions: option.DialerOptions{
+						ProxyProtocol: 2,
+					},
+				},
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
 							RouteOptions: option.RouteActionOptions{
 								Outbound: "proxy-out",
 							},
@@ -69,5 +261,6 @@ func _TestProxyProtocol(t *testing.T) {
 			},
 		},
 	})
+	// the SOCKS5 UDP relay owned by the socks outbound must not receive headers
 	testSuit(t, clientPort, testPort)
 }
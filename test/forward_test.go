@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/sagernet/sing-box"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForward(t *testing.T) {
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeForward,
+				Options: &option.ForwardInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen: common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+					},
+					Forwards: []option.ForwardOptions{
+						{
+							ListenPorts: []string{F.ToString(clientPort)},
+							Destinations: []option.ForwardDestinationOptions{
+								{
+									ServerOptions: option.ServerOptions{
+										Server:     "127.0.0.1",
+										ServerPort: testPort,
+									},
+								},
+							},
+						},
+					},
+					SendProxyProtocol: 2,
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+		},
+	})
+
+	tcpListener, err := net.Listen("tcp", netip.AddrPortFrom(netip.IPv4Unspecified(), testPort).String())
+	require.NoError(t, err)
+	defer tcpListener.Close()
+	go func() {
+		conn, acceptErr := tcpListener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		header, readErr := proxyproto.Read(reader)
+		if readErr != nil {
+			return
+		}
+		io.WriteString(conn, header.SourceAddr.String())
+		io.Copy(conn, reader)
+	}()
+	conn, err := net.Dial("tcp", netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), clientPort).String())
+	require.NoError(t, err)
+	defer conn.Close()
+	sourceAddr := conn.LocalAddr().String()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	response := make([]byte, len(sourceAddr)+5)
+	_, err = io.ReadFull(conn, response)
+	require.NoError(t, err)
+	require.Equal(t, sourceAddr+"hello", string(response))
+
+	udpListener, err := net.ListenPacket("udp", netip.AddrPortFrom(netip.IPv4Unspecified(), testPort).String())
+	require.NoError(t, err)
+	defer udpListener.Close()
+	go func() {
+		buffer := make([]byte, 1024)
+		n, remoteAddr, readErr := udpListener.ReadFrom(buffer)
+		if readErr != nil {
+			return
+		}
+		reader := bufio.NewReader(bytes.NewReader(buffer[:n]))
+		header, readErr := proxyproto.Read(reader)
+		if readErr != nil {
+			return
+		}
+		payload, _ := io.ReadAll(reader)
+		udpListener.WriteTo(append([]byte(header.SourceAddr.String()), payload...), remoteAddr)
+	}()
+	packetConn, err := net.Dial("udp", netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), clientPort).String())
+	require.NoError(t, err)
+	defer packetConn.Close()
+	sourceAddr = M.SocksaddrFromNet(packetConn.LocalAddr()).String()
+	_, err = packetConn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buffer := make([]byte, 1024)
+	n, err := packetConn.Read(buffer)
+	require.NoError(t, err)
+	require.Equal(t, sourceAddr+"hello", string(buffer[:n]))
+}
+
+func TestForwardRejectOptions(t *testing.T) {
+	for message, options := range map[string]option.ForwardInboundOptions{
+		"`health_check` connects to destinations over TCP": {
+			Network: option.NetworkList(N.NetworkUDP),
+			Forwards: []option.ForwardOptions{
+				{
+					ListenPorts: []string{"10000"},
+					Destinations: []option.ForwardDestinationOptions{
+						{ServerOptions: option.ServerOptions{Server: "127.0.0.1"}},
+						{ServerOptions: option.ServerOptions{Server: "127.0.0.2"}},
+					},
+				},
+			},
+			HealthCheck: &option.ForwardHealthCheckOptions{},
+		},
+		"too many listen ports": {
+			Forwards: []option.ForwardOptions{
+				{
+					ListenPorts: []string{"10000:11024"},
+					Destinations: []option.ForwardDestinationOptions{
+						{ServerOptions: option.ServerOptions{Server: "127.0.0.1"}},
+					},
+				},
+			},
+		},
+	} {
+		_, err := box.New(box.Options{
+			Context: globalCtx,
+			Options: option.Options{
+				Inbounds: []option.Inbound{
+					{
+						Type:    C.TypeForward,
+						Options: &options,
+					},
+				},
+			},
+		})
+		require.ErrorContains(t, err, message)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strconv"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPReverse(t *testing.T) {
+	user, err := uuid.DefaultGenerator.NewV4()
+	require.NoError(t, err)
+	caPem, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	defer upstream.Close()
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type: C.TypeHTTPReverse,
+				Options: &option.HTTPReverseInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: serverPort,
+					},
+					InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{
+						TLS: &option.InboundTLSOptions{
+							Enabled:         true,
+							ServerName:      "example.org",
+							CertificatePath: certPem,
+							KeyPath:         keyPem,
+						},
+					},
+					Routes: []option.HTTPReverseRouteOptions{
+						{
+							Path:    []string{"/vless"},
+							Inbound: "vless-in",
+						},
+						{
+							Host:      []string{"example.org"},
+							Path:      []string{"/app/"},
+							URL:       upstream.URL + "/upstream",
+							StripPath: true,
+						},
+						{
+							Host: []string{"*.example.org"},
+							URL:  upstream.URL,
+						},
+					},
+				},
+			},
+			{
+				Type: C.TypeVLESS,
+				Tag:  "vless-in",
+				Options: &option.VLESSInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: otherPort,
+					},
+					Users: []option.VLESSUser{
+						{
+							Name: "sekai",
+							UUID: user.String(),
+						},
+					},
+					Transport: &option.V2RayTransportOptions{
+						Type: C.V2RayTransportTypeWebsocket,
+						WebsocketOptions: option.V2RayWebsocketOptions{
+							Path: "/vless",
+						},
+					},
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			{
+				Type: C.TypeVLESS,
+				Tag:  "vless-out",
+				Options: &option.VLESSOutboundOptions{
+					ServerOptions: option.ServerOptions{
+						Server:     "127.0.0.1",
+						ServerPort: serverPort,
+					},
+					UUID: user.String(),
+					OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+						TLS: &option.OutboundTLSOptions{
+							Enabled:         true,
+							ServerName:      "example.org",
+							CertificatePath: certPem,
+						},
+					},
+					Transport: &option.V2RayTransportOptions{
+						Type: C.V2RayTransportTypeWebsocket,
+						WebsocketOptions: option.V2RayWebsocketOptions{
+							Path: "/vless",
+						},
+					},
+				},
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "vless-out",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	caContent, err := os.ReadFile(caPem)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	require.True(t, rootCAs.AppendCertsFromPEM(caContent))
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, net.JoinHostPort("127.0.0.1", strconv.Itoa(int(serverPort))))
+			},
+			TLSClientConfig: &tls.Config{
+				RootCAs:    rootCAs,
+				ServerName: "example.org",
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+	get := func(host string, path string) (int, string) {
+		request, err := http.NewRequest(http.MethodGet, "https://example.org"+path, nil)
+		require.NoError(t, err)
+		request.Host = host
+		response, err := client.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		content, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response.StatusCode, string(content)
+	}
+	statusCode, content := get("example.org", "/app/hello")
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Equal(t, "example.org/upstream/hello", content)
+	statusCode, content = get("www.example.org", "/app/hello")
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Equal(t, "www.example.org/app/hello", content)
+	statusCode, _ = get("example.org", "/other")
+	require.Equal(t, http.StatusNotFound, statusCode)
+
+	testTCP(t, clientPort, testPort)
+}
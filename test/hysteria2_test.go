@@ -5,12 +5,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sagernet/sing-box"
 	C "github.com/sagernet/sing-box/constant"
 	"github.com/sagernet/sing-box/option"
 	"github.com/sagernet/sing-quic/hysteria2"
 	"github.com/sagernet/sing/common"
 	F "github.com/sagernet/sing/common/format"
 	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestHysteria2Self(t *testing.T) {
@@ -140,6 +143,122 @@ func testHysteria2Self(t *testing.T, salamanderPassword string, portHop bool) {
 	}
 }
 
+func TestHysteria2ListenPorts(t *testing.T) {
+	_, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type: C.TypeHysteria2,
+				Options: &option.Hysteria2InboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen: common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+					},
+					ListenPorts: []string{F.ToString(serverPort+100, ":", serverPort+103)},
+					UpMbps:      100,
+					DownMbps:    100,
+					Users: []option.Hysteria2User{{
+						Password: "password",
+					}},
+					InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{
+						TLS: &option.InboundTLSOptions{
+							Enabled:         true,
+							ServerName:      "example.org",
+							CertificatePath: certPem,
+							KeyPath:         keyPem,
+						},
+					},
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			{
+				Type: C.TypeHysteria2,
+				Tag:  "hy2-out",
+				Options: &option.Hysteria2OutboundOptions{
+					ServerOptions: option.ServerOptions{
+						Server: "127.0.0.1",
+					},
+					ServerPorts: []string{F.ToString(serverPort+100, ":", serverPort+103)},
+					HopInterval: badoption.Duration(5 * time.Second),
+					UpMbps:      100,
+					DownMbps:    100,
+					Password:    "password",
+					OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+						TLS: &option.OutboundTLSOptions{
+							Enabled:         true,
+							ServerName:      "example.org",
+							CertificatePath: certPem,
+						},
+					},
+				},
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "hy2-out",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	testSuitLargeUDP(t, clientPort, testPort)
+	time.Sleep(5 * time.Second)
+	testSuitLargeUDP(t, clientPort, testPort)
+}
+
+func TestHysteria2TooManyListenPorts(t *testing.T) {
+	_, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	_, err := box.New(box.Options{
+		Context: globalCtx,
+		Options: option.Options{
+			Inbounds: []option.Inbound{
+				{
+					Type: C.TypeHysteria2,
+					Options: &option.Hysteria2InboundOptions{
+						ListenPorts: []string{"20000:21024"},
+						Users: []option.Hysteria2User{{
+							Password: "password",
+						}},
+						InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{
+							TLS: &option.InboundTLSOptions{
+								Enabled:         true,
+								ServerName:      "example.org",
+								CertificatePath: certPem,
+								KeyPath:         keyPem,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	require.ErrorContains(t, err, "too many listen ports")
+}
+
 func TestHysteria2Inbound(t *testing.T) {
 	caPem, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
 	startInstance(t, option.Options{
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	reverseDomain   = "reverse.sing-box.test"
+	reversePassword = "reverse-password"
+)
+
+func TestReverseSelf(t *testing.T) {
+	portal := startReversePortal(t)
+	startReverseBridge(t, "home", reversePassword)
+	require.Eventually(t, func() bool {
+		bridges := portal.Bridges()
+		return len(bridges) == 1 && bridges[0].Connections > 0
+	}, 5*time.Second, 100*time.Millisecond)
+	testSuit(t, clientPort, testPort)
+	bridges := portal.Bridges()
+	require.Equal(t, "home", bridges[0].Name)
+	require.NotZero(t, bridges[0].Upload)
+	require.NotZero(t, bridges[0].Download)
+}
+
+func TestReverseRejectBridge(t *testing.T) {
+	portal := startReversePortal(t)
+	startReverseBridge(t, "home", "wrong password")
+	startReverseBridge(t, "unknown", reversePassword)
+	time.Sleep(2 * time.Second)
+	bridges := portal.Bridges()
+	require.Len(t, bridges, 1)
+	require.Zero(t, bridges[0].Connections)
+
+	startReverseBridge(t, "home", reversePassword)
+	startReverseBridge(t, "home", reversePassword)
+	require.Eventually(t, func() bool {
+		return portal.Bridges()[0].Connections > 0
+	}, 5*time.Second, 100*time.Millisecond)
+	time.Sleep(2 * time.Second)
+	require.Equal(t, 1, portal.Bridges()[0].Connections)
+	testTCP(t, clientPort, testPort)
+}
+
+func startReversePortal(t *testing.T) adapter.ReversePortal {
+	portalInstance := startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type: C.TypeShadowsocks,
+				Tag:  "ss-in",
+				Options: &option.ShadowsocksInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: serverPort,
+					},
+					Method:   "2022-blake3-aes-128-gcm",
+					Password: "4Qc5kB43yRFydcfHN1j5Wg==",
+				},
+			},
+		},
+		Endpoints: []option.Endpoint{
+			{
+				Type: C.TypeReverse,
+				Tag:  "portal",
+				Options: &option.ReverseEndpointOptions{
+					Mode:   "portal",
+					Domain: reverseDomain,
+					Users: []option.ReverseUser{
+						{
+							Name:     "home",
+							Password: reversePassword,
+						},
+					},
+				},
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "portal",
+							},
+						},
+					},
+				},
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Domain: []string{reverseDomain},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "portal",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	portalEndpoint, loaded := portalInstance.Endpoint().Get("portal")
+	require.True(t, loaded)
+	return portalEndpoint.(adapter.ReversePortal)
+}
+
+func startReverseBridge(t *testing.T, name string, password string) {
+	startInstance(t, option.Options{
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			{
+				Type: C.TypeShadowsocks,
+				Tag:  "ss-out",
+				Options: &option.ShadowsocksOutboundOptions{
+					ServerOptions: option.ServerOptions{
+						Server:     "127.0.0.1",
+						ServerPort: serverPort,
+					},
+					Method:   "2022-blake3-aes-128-gcm",
+					Password: "4Qc5kB43yRFydcfHN1j5Wg==",
+				},
+			},
+		},
+		Endpoints: []option.Endpoint{
+			{
+				Type: C.TypeReverse,
+				Tag:  "bridge",
+				Options: &option.ReverseEndpointOptions{
+					DialerOptions: option.DialerOptions{
+						Detour: "ss-out",
+					},
+					Mode:     "bridge",
+					Domain:   reverseDomain,
+					Name:     name,
+					Password: password,
+				},
+			},
+		},
+	})
+}
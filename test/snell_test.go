@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/sagernet/sing-box"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnellSelf(t *testing.T) {
+	startInstance(t, snellSelfOptions(
+		option.SnellInboundOptions{},
+		option.SnellOutboundOptions{},
+	))
+	testSuit(t, clientPort, testPort)
+}
+
+func TestSnellSelfReuse(t *testing.T) {
+	startInstance(t, snellSelfOptions(
+		option.SnellInboundOptions{},
+		option.SnellOutboundOptions{
+			Reuse: common.Ptr(true),
+		},
+	))
+	testSuit(t, clientPort, testPort)
+}
+
+func TestSnellSelfVersion1(t *testing.T) {
+	startInstance(t, snellSelfOptions(
+		option.SnellInboundOptions{
+			Version: 1,
+		},
+		option.SnellOutboundOptions{
+			Version: 1,
+		},
+	))
+	testTCP(t, clientPort, testPort)
+}
+
+// Snell v4 framing is not implemented, so the option must be refused
+// instead of silently speaking v3 to Surge v4 peers.
+func TestSnellVersion4(t *testing.T) {
+	for _, options := range []option.Options{
+		snellSelfOptions(option.SnellInboundOptions{Version: 4}, option.SnellOutboundOptions{}),
+		snellSelfOptions(option.SnellInboundOptions{}, option.SnellOutboundOptions{Version: 4}),
+	} {
+		_, err := box.New(box.Options{
+			Context: globalCtx,
+			Options: options,
+		})
+		require.ErrorContains(t, err, "snell version 4 is not supported")
+	}
+}
+
+func TestSnellSelfObfsHTTP(t *testing.T) {
+	obfsOptions := &option.SnellObfsOptions{
+		Type: "http",
+		Host: "www.bing.com",
+	}
+	startInstance(t, snellSelfOptions(
+		option.SnellInboundOptions{
+			Obfs: obfsOptions,
+		},
+		option.SnellOutboundOptions{
+			Obfs:  obfsOptions,
+			Reuse: common.Ptr(true),
+		},
+	))
+	testSuit(t, clientPort, testPort)
+}
+
+func TestSnellSelfObfsTLS(t *testing.T) {
+	obfsOptions := &option.SnellObfsOptions{
+		Type: "tls",
+		Host: "www.bing.com",
+	}
+	startInstance(t, snellSelfOptions(
+		option.SnellInboundOptions{
+			Obfs: obfsOptions,
+		},
+		option.SnellOutboundOptions{
+			Obfs:  obfsOptions,
+			Reuse: common.Ptr(true),
+		},
+	))
+	testSuit(t, clientPort, testPort)
+}
+
+func snellSelfOptions(inboundOptions option.SnellInboundOptions, outboundOptions option.SnellOutboundOptions) option.Options {
+	inboundOptions.ListenOptions = option.ListenOptions{
+		Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+		ListenPort: serverPort,
+	}
+	inboundOptions.PSK = "password"
+	outboundOptions.ServerOptions = option.ServerOptions{
+		Server:     "127.0.0.1",
+		ServerPort: serverPort,
+	}
+	outboundOptions.PSK = "password"
+	return option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type:    C.TypeSnell,
+				Tag:     "snell-in",
+				Options: &inboundOptions,
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			{
+				Type:    C.TypeSnell,
+				Tag:     "snell-out",
+				Options: &outboundOptions,
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "snell-out",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/protocol/socks"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHSelf(t *testing.T) {
+	hostKey, hostPublicKey := createSSHKey(t)
+	startInstance(t, sshSelfOptions(
+		option.SSHInboundOptions{
+			Users: []option.SSHUser{
+				{
+					Name:     "sekai",
+					Password: "password",
+				},
+			},
+			HostKey: []string{hostKey},
+		},
+		option.SSHOutboundOptions{
+			User:     "sekai",
+			Password: "password",
+			HostKey:  []string{hostPublicKey},
+		},
+	))
+	testTCP(t, clientPort, testPort)
+}
+
+func TestSSHSelfPublicKey(t *testing.T) {
+	userKey, userPublicKey := createSSHKey(t)
+	startInstance(t, sshSelfOptions(
+		option.SSHInboundOptions{
+			Users: []option.SSHUser{
+				{
+					Name:           "sekai",
+					AuthorizedKeys: []string{userPublicKey},
+				},
+			},
+		},
+		option.SSHOutboundOptions{
+			User:       "sekai",
+			PrivateKey: []string{userKey},
+		},
+	))
+	testTCP(t, clientPort, testPort)
+}
+
+func TestSSHSelfPermitOpen(t *testing.T) {
+	userKey, userPublicKey := createSSHKey(t)
+	startInstance(t, sshSelfOptions(
+		option.SSHInboundOptions{
+			Users: []option.SSHUser{
+				{
+					Name:           "sekai",
+					AuthorizedKeys: []string{F.ToString(`permitopen="127.0.0.1:`, testPort, `" `, userPublicKey)},
+				},
+			},
+		},
+		option.SSHOutboundOptions{
+			User:       "sekai",
+			PrivateKey: []string{userKey},
+		},
+	))
+	testTCP(t, clientPort, testPort)
+
+	listener, err := net.Listen("tcp", F.ToString("127.0.0.1:", otherPort))
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		serverConn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		serverConn.Write([]byte{0})
+		serverConn.Close()
+	}()
+	// the destination is not listed in permitopen, so the channel is rejected before reaching it
+	dialer := socks.NewClient(N.SystemDialer, M.ParseSocksaddrHostPort("127.0.0.1", clientPort), socks.Version5, "", "")
+	conn, err := dialer.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddrHostPort("127.0.0.1", otherPort))
+	if err == nil {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	require.Error(t, err)
+}
+
+func TestSSHSelfSniff(t *testing.T) {
+	options := sshSelfOptions(
+		option.SSHInboundOptions{
+			Users: []option.SSHUser{
+				{
+					Name:     "sekai",
+					Password: "password",
+				},
+			},
+		},
+		option.SSHOutboundOptions{
+			User:     "sekai",
+			Password: "password",
+		},
+	)
+	// only sniffed HTTP connections from the SSH inbound are routed to direct
+	options.Route.Rules[1].DefaultOptions.Protocol = []string{C.ProtocolHTTP}
+	options.Route.Rules = append([]option.Rule{
+		{
+			Type: C.RuleTypeDefault,
+			DefaultOptions: option.DefaultRule{
+				RawDefaultRule: option.RawDefaultRule{
+					Inbound: []string{"ssh-in"},
+				},
+				RuleAction: option.RuleAction{
+					Action: C.RuleActionTypeSniff,
+				},
+			},
+		},
+	}, options.Route.Rules...)
+	startInstance(t, options)
+
+	listener, err := net.Listen("tcp", F.ToString("127.0.0.1:", testPort))
+	require.NoError(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	dialer := socks.NewClient(N.SystemDialer, M.ParseSocksaddrHostPort("127.0.0.1", clientPort), socks.Version5, "", "")
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, M.ParseSocksaddr(address))
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+	response, err := client.Get(F.ToString("http://127.0.0.1:", testPort, "/"))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+}
+
+func sshSelfOptions(inboundOptions option.SSHInboundOptions, outboundOptions option.SSHOutboundOptions) option.Options {
+	inboundOptions.ListenOptions = option.ListenOptions{
+		Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+		ListenPort: serverPort,
+	}
+	outboundOptions.ServerOptions = option.ServerOptions{
+		Server:     "127.0.0.1",
+		ServerPort: serverPort,
+	}
+	return option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type:    C.TypeSSH,
+				Tag:     "ssh-in",
+				Options: &inboundOptions,
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+				Tag:  "direct",
+			},
+			{
+				Type: C.TypeBlock,
+				Tag:  "block",
+			},
+			{
+				Type:    C.TypeSSH,
+				Tag:     "ssh-out",
+				Options: &outboundOptions,
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "ssh-out",
+							},
+						},
+					},
+				},
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound:  []string{"ssh-in"},
+							AuthUser: []string{"sekai"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "direct",
+							},
+						},
+					},
+				},
+			},
+			Final: "block",
+		},
+	}
+}
+
+func createSSHKey(t *testing.T) (privateKey string, publicKey string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(block)), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
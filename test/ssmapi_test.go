@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/json/badjson"
+	"github.com/sagernet/sing/common/json/badoption"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSMAPIRelay(t *testing.T) {
+	const method = "2022-blake3-aes-128-gcm"
+	relayPassword := mkBase64(t, 16)
+	serverPassword := mkBase64(t, 16)
+	servers := new(badjson.TypedMap[string, string])
+	servers.Put("/relay", "ss-relay")
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type: C.TypeShadowsocks,
+				Tag:  "ss-relay",
+				Options: &option.ShadowsocksInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: serverPort,
+					},
+					Method:   method,
+					Password: relayPassword,
+					Managed:  true,
+					Relay:    true,
+				},
+			},
+			{
+				Type: C.TypeShadowsocks,
+				Tag:  "ss-in",
+				Options: &option.ShadowsocksInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: otherPort,
+					},
+					Method:   method,
+					Password: serverPassword,
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			{
+				Type: C.TypeShadowsocks,
+				Tag:  "ss-out",
+				Options: &option.ShadowsocksOutboundOptions{
+					ServerOptions: option.ServerOptions{
+						Server:     "127.0.0.1",
+						ServerPort: serverPort,
+					},
+					Method:   method,
+					Password: relayPassword + ":" + serverPassword,
+				},
+			},
+		},
+		Services: []option.Service{
+			{
+				Type: C.TypeSSMAPI,
+				Options: &option.SSMAPIServiceOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: otherClientPort,
+					},
+					Servers: servers,
+				},
+			},
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "ss-out",
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	apiURL := F.ToString("http://127.0.0.1:", otherClientPort, "/relay/server/v1")
+	request, err := json.Marshal(map[string]any{
+		"name":        "upstream",
+		"uPSK":        serverPassword,
+		"server":      "127.0.0.1",
+		"server_port": otherPort,
+	})
+	require.NoError(t, err)
+	response, err := http.Post(apiURL+"/destinations", "application/json", bytes.NewReader(request))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	testSuit(t, clientPort, testPort)
+
+	response, err = http.Get(apiURL + "/stats")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var stats struct {
+		Destinations []struct {
+			Name          string `json:"name"`
+			UplinkBytes   int64  `json:"uplinkBytes"`
+			DownlinkBytes int64  `json:"downlinkBytes"`
+			TCPSessions   int64  `json:"tcpSessions"`
+			UDPSessions   int64  `json:"udpSessions"`
+		} `json:"destinations"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&stats))
+	require.Len(t, stats.Destinations, 1)
+	require.Equal(t, "upstream", stats.Destinations[0].Name)
+	require.NotZero(t, stats.Destinations[0].UplinkBytes)
+	require.NotZero(t, stats.Destinations[0].DownlinkBytes)
+	require.NotZero(t, stats.Destinations[0].TCPSessions)
+	require.NotZero(t, stats.Destinations[0].UDPSessions)
+}
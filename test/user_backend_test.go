@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/protocol/socks"
+	"github.com/sagernet/sing/protocol/socks/socks4"
+	"github.com/sagernet/sing/protocol/socks/socks5"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserBackendHTPasswd(t *testing.T) {
+	passwordHash := sha1.Sum([]byte("password"))
+	htpasswdPath := filepath.Join(t.TempDir(), "htpasswd")
+	err := os.WriteFile(htpasswdPath, []byte("sekai:{SHA}"+base64.StdEncoding.EncodeToString(passwordHash[:])+"\n"), 0o644)
+	require.NoError(t, err)
+	for _, outboundType := range []string{C.TypeSOCKS, C.TypeHTTP} {
+		t.Run(outboundType, func(t *testing.T) {
+			startInstance(t, userBackendOptions(outboundType, option.UserBackendOptions{
+				Type: C.UserBackendTypeHTPasswd,
+				Path: htpasswdPath,
+			}))
+			if outboundType == C.TypeSOCKS {
+				testSuit(t, clientPort, testPort)
+			} else {
+				testTCP(t, clientPort, testPort)
+			}
+		})
+	}
+}
+
+func TestUserBackendHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body struct {
+			Inbound  string `json:"inbound"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if json.NewDecoder(request.Body).Decode(&body) != nil || request.Header.Get("Authorization") != "Bearer token" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(writer).Encode(map[string]any{
+			"allow": body.Inbound == "mixed-server" && body.Username == "sekai" && body.Password == "password",
+		})
+	}))
+	defer server.Close()
+	for _, outboundType := range []string{C.TypeSOCKS, C.TypeHTTP} {
+		t.Run(outboundType, func(t *testing.T) {
+			startInstance(t, userBackendOptions(outboundType, option.UserBackendOptions{
+				Type: C.UserBackendTypeHTTP,
+				URL:  server.URL,
+				Headers: badoption.HTTPHeader{
+					"Authorization": badoption.Listable[string]{"Bearer token"},
+				},
+			}))
+			if outboundType == C.TypeSOCKS {
+				testSuit(t, clientPort, testPort)
+			} else {
+				testTCP(t, clientPort, testPort)
+			}
+		})
+	}
+}
+
+func TestUserBackendSOCKSRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body struct {
+			Password string `json:"password"`
+		}
+		json.NewDecoder(request.Body).Decode(&body)
+		json.NewEncoder(writer).Encode(map[string]any{
+			"allow": body.Password != "wrong",
+		})
+	}))
+	defer server.Close()
+	startInstance(t, userBackendOptions(C.TypeSOCKS, option.UserBackendOptions{
+		Type: C.UserBackendTypeHTTP,
+		URL:  server.URL,
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	destination := M.SocksaddrFromNet(listener.Addr())
+	t.Run("socks4", func(t *testing.T) {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", F.ToString(serverPort)))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = socks.ClientHandshake4(conn, socks4.CommandConnect, destination, "sekai")
+		require.Error(t, err)
+	})
+	t.Run("socks5", func(t *testing.T) {
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", F.ToString(serverPort)))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = socks.ClientHandshake5(conn, socks5.CommandConnect, destination, "sekai", "wrong")
+		require.Error(t, err)
+	})
+}
+
+func userBackendOptions(outboundType string, backendOptions option.UserBackendOptions) option.Options {
+	outbound := option.Outbound{
+		Type: outboundType,
+		Tag:  "proxy-out",
+	}
+	serverOptions := option.ServerOptions{
+		Server:     "127.0.0.1",
+		ServerPort: serverPort,
+	}
+	switch outboundType {
+	case C.TypeSOCKS:
+		outbound.Options = &option.SOCKSOutboundOptions{
+			ServerOptions: serverOptions,
+			Username:      "sekai",
+			Password:      "password",
+		}
+	case C.TypeHTTP:
+		outbound.Options = &option.HTTPOutboundOptions{
+			ServerOptions: serverOptions,
+			Username:      "sekai",
+			Password:      "password",
+		}
+	}
+	return option.Options{
+		Inbounds: []option.Inbound{
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-in",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: clientPort,
+					},
+				},
+			},
+			{
+				Type: C.TypeMixed,
+				Tag:  "mixed-server",
+				Options: &option.HTTPMixedInboundOptions{
+					ListenOptions: option.ListenOptions{
+						Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+						ListenPort: serverPort,
+					},
+					UserBackend: &backendOptions,
+				},
+			},
+		},
+		Outbounds: []option.Outbound{
+			{
+				Type: C.TypeDirect,
+			},
+			outbound,
+		},
+		Route: &option.RouteOptions{
+			Rules: []option.Rule{
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							Inbound: []string{"mixed-in"},
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeRoute,
+							RouteOptions: option.RouteActionOptions{
+								Outbound: "proxy-out",
+							},
+						},
+					},
+				},
+				{
+					Type: C.RuleTypeDefault,
+					DefaultOptions: option.DefaultRule{
+						RawDefaultRule: option.RawDefaultRule{
+							AuthUser: []string{"sekai"},
+							Invert:   true,
+						},
+						RuleAction: option.RuleAction{
+							Action: C.RuleActionTypeReject,
+						},
+					},
+				},
+			},
+		},
+	}
+}
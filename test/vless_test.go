@@ -0,0 +1,350 @@
+package main
+
+import (
+	std_bufio "bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-vmess/vless"
+	"github.com/sagernet/sing/common"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/sing/protocol/socks"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/spyzhov/ajson"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVLESSVision(t *testing.T) {
+	_, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	user := newUUID()
+	startInstance(t, option.Options{
+		Inbounds:  []option.Inbound{vlessMixedInbound(), vlessVisionInbound(user, certPem, keyPem)},
+		Outbounds: []option.Outbound{{Type: C.TypeDirect}, vlessVisionOutbound(user, certPem)},
+		Route:     vlessMixedRoute(),
+	})
+	testSuit(t, clientPort, testPort)
+}
+
+func TestVLESSVisionInnerTLS(t *testing.T) {
+	caPem, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	user := newUUID()
+	startInstance(t, option.Options{
+		Inbounds:  []option.Inbound{vlessMixedInbound(), vlessVisionInbound(user, certPem, keyPem)},
+		Outbounds: []option.Outbound{{Type: C.TypeDirect}, vlessVisionOutbound(user, certPem)},
+		Route:     vlessMixedRoute(),
+	})
+	testVisionInnerTLS(t, caPem, certPem, keyPem)
+}
+
+func TestVLESSVisionXrayServer(t *testing.T) {
+	caPem, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	user := newUUID()
+	content, err := os.ReadFile("config/vless-tls-server.json")
+	require.NoError(t, err)
+	config, err := ajson.Unmarshal(content)
+	require.NoError(t, err)
+
+	inbound := config.MustKey("inbounds").MustIndex(0)
+	inbound.MustKey("port").SetNumeric(float64(serverPort))
+	client := inbound.MustKey("settings").MustKey("clients").MustIndex(0)
+	client.MustKey("id").SetString(user.String())
+	client.MustKey("flow").SetString(vless.FlowVision)
+
+	content, err = ajson.Marshal(config)
+	require.NoError(t, err)
+
+	startDockerContainer(t, DockerOptions{
+		Image:      ImageXRayCore,
+		Ports:      []uint16{serverPort, testPort},
+		EntryPoint: "xray",
+		Stdin:      content,
+		Bind: map[string]string{
+			certPem: "/path/to/certificate.crt",
+			keyPem:  "/path/to/private.key",
+		},
+	})
+
+	startInstance(t, option.Options{
+		Inbounds:  []option.Inbound{vlessMixedInbound()},
+		Outbounds: []option.Outbound{{Type: C.TypeDirect}, vlessVisionOutbound(user, certPem)},
+		Route:     vlessMixedRoute(),
+	})
+	testTCP(t, clientPort, testPort)
+	testVisionInnerTLS(t, caPem, certPem, keyPem)
+}
+
+func TestVLESSVisionXrayClient(t *testing.T) {
+	caPem, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	user := newUUID()
+	content, err := os.ReadFile("config/vless-tls-client.json")
+	require.NoError(t, err)
+	config, err := ajson.Unmarshal(content)
+	require.NoError(t, err)
+
+	config.MustKey("inbounds").MustIndex(0).MustKey("port").SetNumeric(float64(clientPort))
+	outbound := config.MustKey("outbounds").MustIndex(0)
+	server := outbound.MustKey("settings").MustKey("vnext").MustIndex(0)
+	server.MustKey("address").SetString("127.0.0.1")
+	server.MustKey("port").SetNumeric(float64(serverPort))
+	client := server.MustKey("users").MustIndex(0)
+	client.MustKey("id").SetString(user.String())
+	client.MustKey("flow").SetString(vless.FlowVision)
+
+	content, err = ajson.Marshal(config)
+	require.NoError(t, err)
+
+	startDockerContainer(t, DockerOptions{
+		Image:      ImageXRayCore,
+		Ports:      []uint16{clientPort, testPort},
+		EntryPoint: "xray",
+		Stdin:      content,
+		Bind: map[string]string{
+			caPem: "/path/to/ca.crt",
+		},
+	})
+
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{vlessVisionInbound(user, certPem, keyPem)},
+	})
+	testTCP(t, clientPort, testPort)
+	testVisionInnerTLS(t, caPem, certPem, keyPem)
+}
+
+// TestVLESSVisionXrayFraming replays a client stream laid out the way Xray's
+// XtlsPadding writes it and unpads the response the way XtlsUnpadding reads it.
+func TestVLESSVisionXrayFraming(t *testing.T) {
+	_, certPem, keyPem := createSelfSignedCertificate(t, "example.org")
+	user := newUUID()
+	startInstance(t, option.Options{
+		Inbounds: []option.Inbound{vlessVisionInbound(user, certPem, keyPem)},
+	})
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", F.ToString(testPort)))
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, aErr := listener.Accept()
+			if aErr != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", F.ToString(serverPort)), &tls.Config{
+		ServerName:         "example.org",
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+
+	// version, uuid, addons (flow), command, port, IPv4 address
+	var request []byte
+	request = append(request, 0)
+	request = append(request, user.Bytes()...)
+	request = append(request, byte(2+len(vless.FlowVision)), 0x0a, byte(len(vless.FlowVision)))
+	request = append(request, vless.FlowVision...)
+	request = append(request, 0x01)
+	request = binary.BigEndian.AppendUint16(request, testPort)
+	request = append(request, 0x01, 127, 0, 0, 1)
+	// uuid, padding end command, content length, padding length, content, padding
+	request = append(request, user.Bytes()...)
+	request = append(request, 0x01, 0x00, 0x05, 0x00, 0x0a)
+	request = append(request, "hello"...)
+	request = append(request, make([]byte, 10)...)
+	_, err = conn.Write(request)
+	require.NoError(t, err)
+	// not padded after the padding end command
+	_, err = conn.Write([]byte(" world"))
+	require.NoError(t, err)
+
+	reader := std_bufio.NewReader(conn)
+	require.NoError(t, vless.ReadResponse(reader))
+	response := make([]byte, len("hello world"))
+	_, err = io.ReadFull(xrayUnpadding(t, reader, user), response)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(response))
+}
+
+func xrayUnpadding(t *testing.T, reader *std_bufio.Reader, user uuid.UUID) io.Reader {
+	prefix := make([]byte, 16)
+	_, err := io.ReadFull(reader, prefix)
+	require.NoError(t, err)
+	require.Equal(t, user.Bytes(), prefix)
+	contentReader, contentWriter := io.Pipe()
+	go func() {
+		for {
+			var header [5]byte
+			_, err := io.ReadFull(reader, header[:])
+			if err != nil {
+				contentWriter.CloseWithError(err)
+				return
+			}
+			contentLen := int64(binary.BigEndian.Uint16(header[1:]))
+			paddingLen := int64(binary.BigEndian.Uint16(header[3:]))
+			_, err = io.CopyN(contentWriter, reader, contentLen)
+			if err == nil {
+				_, err = reader.Discard(int(paddingLen))
+			}
+			if err == nil && header[0] != 0x00 {
+				_, err = io.Copy(contentWriter, reader)
+			}
+			if err != nil || header[0] != 0x00 {
+				contentWriter.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return contentReader
+}
+
+func testVisionInnerTLS(t *testing.T, caPem string, certPem string, keyPem string) {
+	certificate, err := tls.LoadX509KeyPair(certPem, keyPem)
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", net.JoinHostPort("127.0.0.1", F.ToString(testPort)), &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, aErr := listener.Accept()
+			if aErr != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	caContent, err := os.ReadFile(caPem)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	require.True(t, rootCAs.AppendCertsFromPEM(caContent))
+	dialer := socks.NewClient(N.SystemDialer, M.ParseSocksaddrHostPort("127.0.0.1", clientPort), socks.Version5, "", "")
+	for _, tlsVersion := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		conn, err := dialer.DialContext(context.Background(), N.NetworkTCP, M.ParseSocksaddrHostPort("127.0.0.1", testPort))
+		require.NoError(t, err)
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: "example.org",
+			RootCAs:    rootCAs,
+			MinVersion: tlsVersion,
+			MaxVersion: tlsVersion,
+		})
+		require.NoError(t, tlsConn.Handshake())
+		for _, size := range []int{1, 1024, 16384, 1024 * 1024} {
+			payload := make([]byte, size)
+			common.Must1(io.ReadFull(rand.Reader, payload))
+			go tlsConn.Write(payload)
+			response := make([]byte, size)
+			_, err = io.ReadFull(tlsConn, response)
+			require.NoError(t, err)
+			require.Equal(t, payload, response)
+		}
+		tlsConn.Close()
+	}
+}
+
+func vlessMixedInbound() option.Inbound {
+	return option.Inbound{
+		Type: C.TypeMixed,
+		Tag:  "mixed-in",
+		Options: &option.HTTPMixedInboundOptions{
+			ListenOptions: option.ListenOptions{
+				Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+				ListenPort: clientPort,
+			},
+		},
+	}
+}
+
+func vlessVisionInbound(user uuid.UUID, certPem string, keyPem string) option.Inbound {
+	return option.Inbound{
+		Type: C.TypeVLESS,
+		Options: &option.VLESSInboundOptions{
+			ListenOptions: option.ListenOptions{
+				Listen:     common.Ptr(badoption.Addr(netip.IPv4Unspecified())),
+				ListenPort: serverPort,
+			},
+			Users: []option.VLESSUser{
+				{
+					UUID: user.String(),
+					Flow: vless.FlowVision,
+				},
+			},
+			InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{
+				TLS: &option.InboundTLSOptions{
+					Enabled:         true,
+					ServerName:      "example.org",
+					CertificatePath: certPem,
+					KeyPath:         keyPem,
+				},
+			},
+		},
+	}
+}
+
+func vlessVisionOutbound(user uuid.UUID, certPem string) option.Outbound {
+	return option.Outbound{
+		Type: C.TypeVLESS,
+		Tag:  "vless-out",
+		Options: &option.VLESSOutboundOptions{
+			ServerOptions: option.ServerOptions{
+				Server:     "127.0.0.1",
+				ServerPort: serverPort,
+			},
+			UUID: user.String(),
+			Flow: vless.FlowVision,
+			OutboundTLSOptionsContainer: option.OutboundTLSOptionsContainer{
+				TLS: &option.OutboundTLSOptions{
+					Enabled:         true,
+					ServerName:      "example.org",
+					CertificatePath: certPem,
+				},
+			},
+		},
+	}
+}
+
+func vlessMixedRoute() *option.RouteOptions {
+	return &option.RouteOptions{
+		Rules: []option.Rule{
+			{
+				Type: C.RuleTypeDefault,
+				DefaultOptions: option.DefaultRule{
+					RawDefaultRule: option.RawDefaultRule{
+						Inbound: []string{"mixed-in"},
+					},
+					RuleAction: option.RuleAction{
+						Action: C.RuleActionTypeRoute,
+						RouteOptions: option.RouteActionOptions{
+							Outbound: "vless-out",
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package obfs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	B "github.com/sagernet/sing/common/buf"
+)
+
+const maxHTTPRequestHeaderSize = 8192
+
+// HTTPObfsServer is the server side of HTTPObfs
+type HTTPObfsServer struct {
+	net.Conn
+	buf           []byte
+	offset        int
+	firstRequest  bool
+	firstResponse bool
+	websocketKey  string
+}
+
+func (hs *HTTPObfsServer) Read(b []byte) (int, error) {
+	if hs.buf != nil {
+		n := copy(b, hs.buf[hs.offset:])
+		hs.offset += n
+		if hs.offset == len(hs.buf) {
+			hs.buf = nil
+		}
+		return n, nil
+	}
+
+	if hs.firstRequest {
+		request := make([]byte, 0, B.BufferSize)
+		for {
+			if len(request) >= maxHTTPRequestHeaderSize {
+				return 0, io.ErrUnexpectedEOF
+			}
+			buf := make([]byte, B.BufferSize)
+			n, err := hs.Conn.Read(buf)
+			if err != nil {
+				return 0, err
+			}
+			request = append(request, buf[:n]...)
+			idx := bytes.Index(request, []byte("\r\n\r\n"))
+			if idx == -1 {
+				continue
+			}
+			hs.firstRequest = false
+			for _, line := range bytes.Split(request[:idx], []byte("\r\n")) {
+				key, value, found := bytes.Cut(line, []byte(":"))
+				if found && http.CanonicalHeaderKey(string(bytes.TrimSpace(key))) == "Sec-Websocket-Key" {
+					hs.websocketKey = string(bytes.TrimSpace(value))
+				}
+			}
+			payload := request[idx+4:]
+			n = copy(b, payload)
+			if n < len(payload) {
+				hs.buf = payload
+				hs.offset = n
+			}
+			return n, nil
+		}
+	}
+	return hs.Conn.Read(b)
+}
+
+func (hs *HTTPObfsServer) Write(b []byte) (int, error) {
+	if hs.firstResponse {
+		accept := sha1.Sum([]byte(hs.websocketKey + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		response := fmt.Sprintf("HTTP/1.1 101 Switching Protocols\r\n"+
+			"Server: nginx/1.%d.%d\r\n"+
+			"Date: %s\r\n"+
+			"Upgrade: websocket\r\n"+
+			"Connection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\n"+
+			"\r\n", time.Now().Unix()%12+14, time.Now().Unix()%3, time.Now().UTC().Format(http.TimeFormat), base64.StdEncoding.EncodeToString(accept[:]))
+		hs.firstResponse = false
+		_, err := hs.Conn.Write(append([]byte(response), b...))
+		return len(b), err
+	}
+
+	return hs.Conn.Write(b)
+}
+
+func (hs *HTTPObfsServer) Upstream() any {
+	return hs.Conn
+}
+
+// NewHTTPObfsServer return a HTTPObfsServer
+func NewHTTPObfsServer(conn net.Conn) net.Conn {
+	return &HTTPObfsServer{
+		Conn:          conn,
+		firstRequest:  true,
+		firstResponse: true,
+	}
+}
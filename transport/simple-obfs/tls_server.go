@@ -0,0 +1,244 @@
+package obfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	B "github.com/sagernet/sing/common/buf"
+)
+
+var errInvalidClientHello = errors.New("invalid simple-obfs tls client hello")
+
+// TLSObfsServer is the server side of TLSObfs
+type TLSObfsServer struct {
+	net.Conn
+	buf           []byte
+	offset        int
+	remain        int
+	sessionID     []byte
+	firstRequest  bool
+	firstResponse bool
+}
+
+func (ts *TLSObfsServer) Read(b []byte) (int, error) {
+	if ts.buf != nil {
+		n := copy(b, ts.buf[ts.offset:])
+		ts.offset += n
+		if ts.offset == len(ts.buf) {
+			ts.buf = nil
+		}
+		return n, nil
+	}
+
+	if ts.remain > 0 {
+		length := ts.remain
+		if length > len(b) {
+			length = len(b)
+		}
+
+		n, err := io.ReadFull(ts.Conn, b[:length])
+		ts.remain -= n
+		return n, err
+	}
+
+	if ts.firstRequest {
+		ts.firstRequest = false
+		payload, err := ts.readClientHello()
+		if err != nil {
+			return 0, err
+		}
+		n := copy(b, payload)
+		if n < len(payload) {
+			ts.buf = payload
+			ts.offset = n
+		}
+		return n, nil
+	}
+
+	header := make([]byte, 5)
+	_, err := io.ReadFull(ts.Conn, header)
+	if err != nil {
+		return 0, err
+	}
+	if header[0] != 0x17 {
+		return 0, errors.New("unexpected tls record type")
+	}
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	if length > len(b) {
+		n, err := ts.Conn.Read(b)
+		if err != nil {
+			return n, err
+		}
+		ts.remain = length - n
+		return n, nil
+	}
+	return io.ReadFull(ts.Conn, b[:length])
+}
+
+func (ts *TLSObfsServer) readClientHello() ([]byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(ts.Conn, header)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != 22 {
+		return nil, errInvalidClientHello
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	_, err = io.ReadFull(ts.Conn, record)
+	if err != nil {
+		return nil, err
+	}
+	reader := bytes.NewReader(record)
+	// handshake type, length, version, random
+	if reader.Len() < 1+3+2+32 || record[0] != 1 {
+		return nil, errInvalidClientHello
+	}
+	reader.Seek(1+3+2+32, io.SeekStart)
+	sessionIDLen, _ := reader.ReadByte()
+	ts.sessionID = make([]byte, sessionIDLen)
+	_, err = io.ReadFull(reader, ts.sessionID)
+	if err != nil {
+		return nil, errInvalidClientHello
+	}
+	var cipherSuitesLen uint16
+	err = binary.Read(reader, binary.BigEndian, &cipherSuitesLen)
+	if err != nil {
+		return nil, errInvalidClientHello
+	}
+	_, err = reader.Seek(int64(cipherSuitesLen), io.SeekCurrent)
+	if err != nil {
+		return nil, errInvalidClientHello
+	}
+	compressionMethodsLen, err := reader.ReadByte()
+	if err != nil {
+		return nil, errInvalidClientHello
+	}
+	_, err = reader.Seek(int64(compressionMethodsLen), io.SeekCurrent)
+	if err != nil {
+		return nil, errInvalidClientHello
+	}
+	var extensionsLen uint16
+	err = binary.Read(reader, binary.BigEndian, &extensionsLen)
+	if err != nil {
+		return nil, errInvalidClientHello
+	}
+	for reader.Len() >= 4 {
+		var extensionType, extensionLen uint16
+		binary.Read(reader, binary.BigEndian, &extensionType)
+		binary.Read(reader, binary.BigEndian, &extensionLen)
+		if int(extensionLen) > reader.Len() {
+			return nil, errInvalidClientHello
+		}
+		if extensionType == 0x0023 {
+			payload := make([]byte, extensionLen)
+			reader.Read(payload)
+			return payload, nil
+		}
+		reader.Seek(int64(extensionLen), io.SeekCurrent)
+	}
+	return nil, errInvalidClientHello
+}
+
+func (ts *TLSObfsServer) Write(b []byte) (int, error) {
+	length := len(b)
+	for i := 0; i < length || i == 0; i += chunkSize {
+		end := i + chunkSize
+		if end > length {
+			end = length
+		}
+
+		n, err := ts.write(b[i:end])
+		if err != nil {
+			return n, err
+		}
+	}
+	return length, nil
+}
+
+func (ts *TLSObfsServer) write(b []byte) (int, error) {
+	var serverHello []byte
+	if ts.firstResponse {
+		serverHello = makeServerHelloMsg(ts.sessionID)
+	}
+	buf := B.NewSize(len(serverHello) + 5 + len(b))
+	defer buf.Release()
+	if ts.firstResponse {
+		ts.firstResponse = false
+		buf.Write(serverHello)
+		// finished handshake record carries the first payload
+		buf.Write([]byte{0x16, 0x03, 0x03})
+	} else {
+		buf.Write([]byte{0x17, 0x03, 0x03})
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(b)))
+	buf.Write(b)
+	_, err := ts.Conn.Write(buf.Bytes())
+	return len(b), err
+}
+
+func (ts *TLSObfsServer) Upstream() any {
+	return ts.Conn
+}
+
+// NewTLSObfsServer return a TLSObfsServer
+func NewTLSObfsServer(conn net.Conn) net.Conn {
+	return &TLSObfsServer{
+		Conn:          conn,
+		firstRequest:  true,
+		firstResponse: true,
+	}
+}
+
+func makeServerHelloMsg(sessionID []byte) []byte {
+	random := make([]byte, 28)
+	rand.Read(random)
+
+	buf := &bytes.Buffer{}
+
+	// handshake, TLS 1.0 version, length
+	buf.WriteByte(22)
+	buf.Write([]byte{0x03, 0x01})
+	binary.Write(buf, binary.BigEndian, uint16(91))
+
+	// serverHello, length, TLS 1.2 version
+	buf.WriteByte(2)
+	buf.WriteByte(0)
+	binary.Write(buf, binary.BigEndian, uint16(87))
+	buf.Write([]byte{0x03, 0x03})
+
+	// random with timestamp, sid len, sid
+	binary.Write(buf, binary.BigEndian, uint32(time.Now().Unix()))
+	buf.Write(random)
+	buf.WriteByte(32)
+	if len(sessionID) == 32 {
+		buf.Write(sessionID)
+	} else {
+		buf.Write(make([]byte, 32))
+	}
+
+	// cipher suite, compression
+	buf.Write([]byte{0xcc, 0xa8, 0x00})
+
+	// extension length
+	binary.Write(buf, binary.BigEndian, uint16(15))
+
+	// renegotiation info
+	buf.Write([]byte{0xff, 0x01, 0x00, 0x01, 0x00})
+
+	// extended master secret
+	buf.Write([]byte{0x00, 0x17, 0x00, 0x00})
+
+	// ec_point
+	buf.Write([]byte{0x00, 0x0b, 0x00, 0x02, 0x01, 0x00})
+
+	// change cipher spec
+	buf.Write([]byte{0x14, 0x03, 0x03, 0x00, 0x01, 0x01})
+
+	return buf.Bytes()
+}
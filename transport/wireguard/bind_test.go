@@ -0,0 +1,236 @@
+package wireguard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sagernet/sing/common/logger"
+	N "github.com/sagernet/sing/common/network"
+	"github.com/sagernet/wireguard-go/device"
+	"github.com/sagernet/wireguard-go/tun"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestObfuscatedHandshake(t *testing.T) {
+	t.Parallel()
+	testObfuscation, err := newObfuscation(&AmneziaOptions{
+		JunkPacketCount:              3,
+		JunkPacketMinSize:            40,
+		JunkPacketMaxSize:            70,
+		InitPacketJunkSize:           15,
+		ResponsePacketJunkSize:       18,
+		InitPacketMagicHeader:        1020325451,
+		ResponsePacketMagicHeader:    3288052141,
+		CookieReplyPacketMagicHeader: 1766607858,
+		TransportPacketMagicHeader:   2528465083,
+	})
+	require.NoError(t, err)
+	serverPrivateKey, serverPublicKey := newTestKeyPair(t)
+	clientPrivateKey, clientPublicKey := newTestKeyPair(t)
+	serverAddress := netip.MustParseAddr("10.0.0.1")
+	clientAddress := netip.MustParseAddr("10.0.0.2")
+
+	serverTun := newChannelTun()
+	serverBind := newObfuscationBind(NewListenBind(nil), testObfuscation, nil)
+	serverDevice := device.NewDevice(context.Background(), serverTun, serverBind, device.NewLogger(device.LogLevelSilent, ""), 1)
+	defer serverDevice.Close()
+	require.NoError(t, serverDevice.IpcSet(strings.Join([]string{
+		"private_key=" + serverPrivateKey,
+		"listen_port=0",
+		"public_key=" + clientPublicKey,
+		"allowed_ip=" + clientAddress.String() + "/32",
+	}, "\n")))
+	require.NoError(t, serverDevice.Up())
+	serverPort := testListenPort(t, serverDevice)
+
+	serverEndpoint := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), serverPort)
+	clientTun := newChannelTun()
+	clientBind := NewClientBind(context.Background(), logger.NOP(), N.SystemDialer, true, serverEndpoint, [3]uint8{})
+	clientBind.obfuscated = func(endpoint netip.AddrPort) bool {
+		return true
+	}
+	clientDevice := device.NewDevice(context.Background(), clientTun, newObfuscationBind(clientBind, testObfuscation, nil), device.NewLogger(device.LogLevelSilent, ""), 1)
+	defer clientDevice.Close()
+	require.NoError(t, clientDevice.IpcSet(strings.Join([]string{
+		"private_key=" + clientPrivateKey,
+		"public_key=" + serverPublicKey,
+		"endpoint=" + serverEndpoint.String(),
+		"allowed_ip=" + serverAddress.String() + "/32",
+	}, "\n")))
+	require.NoError(t, clientDevice.Up())
+
+	packet := newTestIPv4Packet(clientAddress, serverAddress, []byte("hello"))
+	clientTun.inbound <- packet
+	select {
+	case received := <-serverTun.outbound:
+		require.Equal(t, packet, received)
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake timeout")
+	}
+	reply := newTestIPv4Packet(serverAddress, clientAddress, []byte("world"))
+	serverTun.inbound <- reply
+	select {
+	case received := <-clientTun.outbound:
+		require.Equal(t, reply, received)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply timeout")
+	}
+}
+
+func TestClientBindReservedPerPeer(t *testing.T) {
+	t.Parallel()
+	obfuscatedListener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer obfuscatedListener.Close()
+	reservedListener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer reservedListener.Close()
+	obfuscatedPeer := obfuscatedListener.LocalAddr().(*net.UDPAddr).AddrPort()
+	reservedPeer := reservedListener.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	bind := NewClientBind(context.Background(), logger.NOP(), N.SystemDialer, false, netip.AddrPort{}, [3]uint8{})
+	bind.SetReservedForEndpoint(reservedPeer, [3]uint8{1, 2, 3})
+	bind.obfuscated = func(endpoint netip.AddrPort) bool {
+		return endpoint == obfuscatedPeer
+	}
+	_, _, err = bind.Open(0)
+	require.NoError(t, err)
+	defer bind.Close()
+
+	for _, peer := range []struct {
+		listener *net.UDPConn
+		endpoint netip.AddrPort
+		expected []byte
+	}{
+		{obfuscatedListener, obfuscatedPeer, []byte{4, 5, 6, 7, 8}},
+		{reservedListener, reservedPeer, []byte{4, 1, 2, 3, 8}},
+	} {
+		require.NoError(t, bind.Send([][]byte{{4, 5, 6, 7, 8}}, remoteEndpoint(peer.endpoint), 0))
+		buffer := make([]byte, 16)
+		require.NoError(t, peer.listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, err := peer.listener.Read(buffer)
+		require.NoError(t, err)
+		require.Equal(t, peer.expected, buffer[:n])
+	}
+}
+
+func newTestKeyPair(t *testing.T) (privateKey string, publicKey string) {
+	var private [32]byte
+	_, err := rand.Read(private[:])
+	require.NoError(t, err)
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+	public, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	require.NoError(t, err)
+	return hex.EncodeToString(private[:]), hex.EncodeToString(public)
+}
+
+func testListenPort(t *testing.T, wgDevice *device.Device) uint16 {
+	configuration, err := wgDevice.IpcGet()
+	require.NoError(t, err)
+	for _, line := range strings.Split(configuration, "\n") {
+		value, found := strings.CutPrefix(line, "listen_port=")
+		if found {
+			port, err := strconv.ParseUint(value, 10, 16)
+			require.NoError(t, err)
+			return uint16(port)
+		}
+	}
+	t.Fatal("missing listen port")
+	return 0
+}
+
+func newTestIPv4Packet(source netip.Addr, destination netip.Addr, payload []byte) []byte {
+	packet := make([]byte, 20+len(payload))
+	packet[0] = 0x45
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+	packet[8] = 64
+	packet[9] = 17
+	copy(packet[12:16], source.AsSlice())
+	copy(packet[16:20], destination.AsSlice())
+	copy(packet[20:], payload)
+	return packet
+}
+
+var _ tun.Device = (*channelTun)(nil)
+
+// channelTun is an in-memory tun device, packets written to inbound are read by
+// the WireGuard device and packets it writes are delivered to outbound.
+type channelTun struct {
+	inbound  chan []byte
+	outbound chan []byte
+	events   chan tun.Event
+	done     chan struct{}
+}
+
+func newChannelTun() *channelTun {
+	return &channelTun{
+		inbound:  make(chan []byte),
+		outbound: make(chan []byte, 16),
+		events:   make(chan tun.Event, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *channelTun) File() *os.File {
+	return nil
+}
+
+func (c *channelTun) Read(bufs [][]byte, sizes []int, offset int) (n int, err error) {
+	select {
+	case packet := <-c.inbound:
+		sizes[0] = copy(bufs[0][offset:], packet)
+		return 1, nil
+	case <-c.done:
+		return 0, os.ErrClosed
+	}
+}
+
+func (c *channelTun) Write(bufs [][]byte, offset int) (int, error) {
+	for _, buffer := range bufs {
+		packet := append([]byte(nil), buffer[offset:]...)
+		select {
+		case c.outbound <- packet:
+		case <-c.done:
+			return 0, os.ErrClosed
+		}
+	}
+	return len(bufs), nil
+}
+
+func (c *channelTun) MTU() (int, error) {
+	return 1420, nil
+}
+
+func (c *channelTun) Name() (string, error) {
+	return "channel", nil
+}
+
+func (c *channelTun) Events() <-chan tun.Event {
+	return c.events
+}
+
+func (c *channelTun) Close() error {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+		close(c.events)
+	}
+	return nil
+}
+
+func (c *channelTun) BatchSize() int {
+	return 1
+}
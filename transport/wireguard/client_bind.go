@@ -34,6 +34,8 @@ type ClientBind struct {
 	isConnect           bool
 	connectAddr         netip.AddrPort
 	reserved            [3]uint8
+	// obfuscated packets carry no reserved bytes, they must be left untouched
+	obfuscated func(endpoint netip.AddrPort) bool
 }
 
 func NewClientBind(ctx context.Context, logger logger.Logger, dialer N.Dialer, isConnect bool, connectAddr netip.AddrPort, reserved [3]uint8) *ClientBind {
@@ -134,11 +136,12 @@ func (c *ClientBind) receive(packets [][]byte, sizes []int, eps []conn.Endpoint)
 		return
 	}
 	sizes[0] = n
-	if n > 3 {
+	source := M.SocksaddrFromNet(addr).Unwrap().AddrPort()
+	if n > 3 && !c.isObfuscated(source) {
 		b := packets[0]
 		clear(b[1:4])
 	}
-	eps[0] = remoteEndpoint(M.SocksaddrFromNet(addr).Unwrap().AddrPort())
+	eps[0] = remoteEndpoint(source)
 	count = 1
 	return
 }
@@ -174,7 +177,7 @@ func (c *ClientBind) Send(bufs [][]byte, ep conn.Endpoint, offset int) error {
 		if offset > 0 {
 			buf = buf[offset:]
 		}
-		if len(buf) > 3 {
+		if len(buf) > 3 && !c.isObfuscated(destination) {
 			reserved, loaded := c.reservedForEndpoint[destination]
 			if !loaded {
 				reserved = c.reserved
@@ -202,6 +205,10 @@ func (c *ClientBind) BatchSize() int {
 	return 1
 }
 
+func (c *ClientBind) isObfuscated(endpoint netip.AddrPort) bool {
+	return c.obfuscated != nil && c.obfuscated(endpoint)
+}
+
 func (c *ClientBind) SetReservedForEndpoint(destination netip.AddrPort, reserved [3]byte) {
 	c.reservedForEndpoint[destination] = reserved
 }
@@ -32,6 +32,7 @@ import (
 type Endpoint struct {
 	options        EndpointOptions
 	peers          []peerConfig
+	obfuscation    *obfuscation
 	ipcConf        string
 	allowedAddress []netip.Prefix
 	tunDevice      Device
@@ -55,6 +56,10 @@ func NewEndpoint(options EndpointOptions) (*Endpoint, error) {
 	if options.ListenPort != 0 {
 		ipcConf += "\nlisten_port=" + F.ToString(options.ListenPort)
 	}
+	endpointObfuscation, err := newObfuscation(options.Amnezia)
+	if err != nil {
+		return nil, E.Cause(err, "parse amnezia options")
+	}
 	var peers []peerConfig
 	for peerIndex, rawPeer := range options.Peers {
 		peer := peerConfig{
@@ -87,6 +92,16 @@ func NewEndpoint(options EndpointOptions) (*Endpoint, error) {
 			}
 			copy(peer.reserved[:], rawPeer.Reserved[:])
 		}
+		peer.obfuscation, err = newObfuscation(rawPeer.Amnezia)
+		if err != nil {
+			return nil, E.Cause(err, "parse amnezia options for peer ", peerIndex)
+		}
+		if peer.obfuscation == nil {
+			peer.obfuscation = endpointObfuscation
+		}
+		if peer.obfuscation != nil && peer.reserved != [3]uint8{} {
+			return nil, E.New("reserved value is conflict with amnezia options for peer ", peerIndex)
+		}
 		peers = append(peers, peer)
 	}
 	var allowedPrefixBuilder netipx.IPSetBuilder
@@ -126,6 +141,7 @@ func NewEndpoint(options EndpointOptions) (*Endpoint, error) {
 	return &Endpoint{
 		options:        options,
 		peers:          peers,
+		obfuscation:    endpointObfuscation,
 		ipcConf:        ipcConf,
 		allowedAddress: allowedAddresses,
 		tunDevice:      tunDevice,
@@ -153,10 +169,23 @@ func (e *Endpoint) Start(resolve bool) error {
 	} else if resolve {
 		return nil
 	}
+	var obfuscationForEndpoint map[netip.AddrPort]*obfuscation
+	if e.obfuscated() {
+		obfuscationForEndpoint = make(map[netip.AddrPort]*obfuscation)
+		for _, peer := range e.peers {
+			if peer.endpoint.IsValid() {
+				obfuscationForEndpoint[peer.endpoint] = peer.obfuscation
+			}
+		}
+	}
 	var bind conn.Bind
 	wgListener, isWgListener := common.Cast[dialer.WireGuardListener](e.options.Dialer)
 	if isWgListener {
-		bind = conn.NewStdNetBind(wgListener.WireGuardControl())
+		if e.obfuscated() {
+			bind = NewListenBind(wgListener.WireGuardControl())
+		} else {
+			bind = conn.NewStdNetBind(wgListener.WireGuardControl())
+		}
 	} else {
 		var (
 			isConnect   bool
@@ -168,7 +197,13 @@ func (e *Endpoint) Start(resolve bool) error {
 			connectAddr = e.peers[0].endpoint
 			reserved = e.peers[0].reserved
 		}
-		bind = NewClientBind(e.options.Context, e.options.Logger, e.options.Dialer, isConnect, connectAddr, reserved)
+		clientBind := NewClientBind(e.options.Context, e.options.Logger, e.options.Dialer, isConnect, connectAddr, reserved)
+		if e.obfuscated() {
+			clientBind.obfuscated = func(endpoint netip.AddrPort) bool {
+				return lookupObfuscation(e.obfuscation, obfuscationForEndpoint, endpoint) != nil
+			}
+		}
+		bind = clientBind
 	}
 	if isWgListener || len(e.peers) > 1 {
 		for _, peer := range e.peers {
@@ -177,6 +212,9 @@ func (e *Endpoint) Start(resolve bool) error {
 			}
 		}
 	}
+	if e.obfuscated() {
+		bind = newObfuscationBind(bind, e.obfuscation, obfuscationForEndpoint)
+	}
 	err := e.tunDevice.Start()
 	if err != nil {
 		return err
@@ -216,6 +254,12 @@ func (e *Endpoint) Start(resolve bool) error {
 	return nil
 }
 
+func (e *Endpoint) obfuscated() bool {
+	return e.obfuscation != nil || common.Any(e.peers, func(peer peerConfig) bool {
+		return peer.obfuscation != nil
+	})
+}
+
 func (e *Endpoint) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
 	if !destination.Addr.IsValid() {
 		return nil, E.Cause(os.ErrInvalid, "invalid non-IP destination")
@@ -274,6 +318,7 @@ type peerConfig struct {
 	allowedIPs      []netip.Prefix
 	keepalive       uint16
 	reserved        [3]uint8
+	obfuscation     *obfuscation
 }
 
 func (c peerConfig) GenerateIpcLines() string {
@@ -27,6 +27,7 @@ type EndpointOptions struct {
 	ResolvePeer  func(domain string) (netip.Addr, error)
 	Peers        []PeerOptions
 	Workers      int
+	Amnezia      *AmneziaOptions
 }
 
 type PeerOptions struct {
@@ -36,4 +37,17 @@ type PeerOptions struct {
 	AllowedIPs                  []netip.Prefix
 	PersistentKeepaliveInterval uint16
 	Reserved                    []uint8
+	Amnezia                     *AmneziaOptions
+}
+
+type AmneziaOptions struct {
+	JunkPacketCount              int
+	JunkPacketMinSize            int
+	JunkPacketMaxSize            int
+	InitPacketJunkSize           int
+	ResponsePacketJunkSize       int
+	InitPacketMagicHeader        uint32
+	ResponsePacketMagicHeader    uint32
+	CookieReplyPacketMagicHeader uint32
+	TransportPacketMagicHeader   uint32
 }
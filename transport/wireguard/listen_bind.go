@@ -0,0 +1,118 @@
+package wireguard
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/sagernet/sing/common/control"
+	F "github.com/sagernet/sing/common/format"
+	"github.com/sagernet/wireguard-go/conn"
+)
+
+var _ conn.Bind = (*ListenBind)(nil)
+
+// ListenBind is a minimal single socket bind for listening endpoints, unlike
+// conn.StdNetBind it only touches reserved bytes of peers configured with them,
+// and keeps other received packets untouched, which obfuscation requires.
+type ListenBind struct {
+	controlFunc         control.Func
+	reservedForEndpoint map[netip.AddrPort][3]uint8
+	access              sync.Mutex
+	conn                *net.UDPConn
+}
+
+func NewListenBind(controlFunc control.Func) *ListenBind {
+	return &ListenBind{
+		controlFunc:         controlFunc,
+		reservedForEndpoint: make(map[netip.AddrPort][3]uint8),
+	}
+}
+
+func (b *ListenBind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	b.access.Lock()
+	defer b.access.Unlock()
+	if b.conn != nil {
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+	listenConfig := net.ListenConfig{
+		Control: b.controlFunc,
+	}
+	packetConn, err := listenConfig.ListenPacket(context.Background(), "udp", ":"+F.ToString(port))
+	if err != nil {
+		return nil, 0, err
+	}
+	udpConn := packetConn.(*net.UDPConn)
+	b.conn = udpConn
+	return []conn.ReceiveFunc{b.receive(udpConn)}, uint16(udpConn.LocalAddr().(*net.UDPAddr).Port), nil
+}
+
+func (b *ListenBind) receive(udpConn *net.UDPConn) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (count int, err error) {
+		n, addr, err := udpConn.ReadFromUDPAddrPort(packets[0])
+		if err != nil {
+			return
+		}
+		sizes[0] = n
+		source := netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+		if _, loaded := b.reservedForEndpoint[source]; loaded && n > 3 {
+			clear(packets[0][1:4])
+		}
+		eps[0] = remoteEndpoint(source)
+		count = 1
+		return
+	}
+}
+
+func (b *ListenBind) Close() error {
+	b.access.Lock()
+	defer b.access.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+func (b *ListenBind) SetMark(mark uint32) error {
+	return nil
+}
+
+func (b *ListenBind) Send(bufs [][]byte, ep conn.Endpoint, offset int) error {
+	b.access.Lock()
+	udpConn := b.conn
+	b.access.Unlock()
+	if udpConn == nil {
+		return net.ErrClosed
+	}
+	destination := netip.AddrPort(ep.(remoteEndpoint))
+	reserved, hasReserved := b.reservedForEndpoint[destination]
+	for _, buf := range bufs {
+		if hasReserved && len(buf) > offset+3 {
+			copy(buf[offset+1:offset+4], reserved[:])
+		}
+		_, err := udpConn.WriteToUDPAddrPort(buf[offset:], destination)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *ListenBind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	return remoteEndpoint(ap), nil
+}
+
+func (b *ListenBind) BatchSize() int {
+	return 1
+}
+
+func (b *ListenBind) SetReservedForEndpoint(destination netip.AddrPort, reserved [3]byte) {
+	b.reservedForEndpoint[destination] = reserved
+}
@@ -0,0 +1,241 @@
+package wireguard
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	mRand "math/rand"
+	"net/netip"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	"github.com/sagernet/wireguard-go/conn"
+	"github.com/sagernet/wireguard-go/device"
+)
+
+// AmneziaWG limits, packets must still fit into a 1280 bytes IPv6 minimum MTU
+const (
+	maxJunkPacketCount        = 128
+	maxJunkPacketSize         = 1280
+	maxInitPacketJunkSize     = maxJunkPacketSize - device.MessageInitiationSize
+	maxResponsePacketJunkSize = maxJunkPacketSize - device.MessageResponseSize
+)
+
+type obfuscation struct {
+	junkPacketCount   int
+	junkPacketMinSize int
+	junkPacketMaxSize int
+	initJunkSize      int
+	responseJunkSize  int
+	initHeader        uint32
+	responseHeader    uint32
+	cookieReplyHeader uint32
+	transportHeader   uint32
+}
+
+func newObfuscation(options *AmneziaOptions) (*obfuscation, error) {
+	if options == nil {
+		return nil, nil
+	}
+	if options.JunkPacketCount < 0 || options.JunkPacketCount > maxJunkPacketCount {
+		return nil, E.New("junk packet count must be between 0 and ", maxJunkPacketCount)
+	}
+	if options.JunkPacketCount > 0 {
+		if options.JunkPacketMaxSize == 0 {
+			return nil, E.New("missing junk packet max size")
+		}
+		if options.JunkPacketMinSize < 0 || options.JunkPacketMinSize > options.JunkPacketMaxSize {
+			return nil, E.New("junk packet min size must be between 0 and junk packet max size")
+		}
+		if options.JunkPacketMaxSize > maxJunkPacketSize {
+			return nil, E.New("junk packet max size must not exceed ", maxJunkPacketSize)
+		}
+	}
+	if options.InitPacketJunkSize < 0 || options.InitPacketJunkSize > maxInitPacketJunkSize {
+		return nil, E.New("init packet junk size must be between 0 and ", maxInitPacketJunkSize)
+	}
+	if options.ResponsePacketJunkSize < 0 || options.ResponsePacketJunkSize > maxResponsePacketJunkSize {
+		return nil, E.New("response packet junk size must be between 0 and ", maxResponsePacketJunkSize)
+	}
+	if options.InitPacketJunkSize+device.MessageInitiationSize == options.ResponsePacketJunkSize+device.MessageResponseSize {
+		return nil, E.New("init and response packets must not have the same size after padding")
+	}
+	o := &obfuscation{
+		junkPacketCount:   options.JunkPacketCount,
+		junkPacketMinSize: options.JunkPacketMinSize,
+		junkPacketMaxSize: options.JunkPacketMaxSize,
+		initJunkSize:      options.InitPacketJunkSize,
+		responseJunkSize:  options.ResponsePacketJunkSize,
+		initHeader:        headerOrDefault(options.InitPacketMagicHeader, device.MessageInitiationType),
+		responseHeader:    headerOrDefault(options.ResponsePacketMagicHeader, device.MessageResponseType),
+		cookieReplyHeader: headerOrDefault(options.CookieReplyPacketMagicHeader, device.MessageCookieReplyType),
+		transportHeader:   headerOrDefault(options.TransportPacketMagicHeader, device.MessageTransportType),
+	}
+	headers := []uint32{o.initHeader, o.responseHeader, o.cookieReplyHeader, o.transportHeader}
+	for i := range headers {
+		for j := i + 1; j < len(headers); j++ {
+			if headers[i] == headers[j] {
+				return nil, E.New("magic headers must be distinct")
+			}
+		}
+	}
+	return o, nil
+}
+
+func headerOrDefault(header uint32, defaultHeader uint32) uint32 {
+	if header == 0 {
+		return defaultHeader
+	}
+	return header
+}
+
+func (o *obfuscation) junkPackets() [][]byte {
+	packets := make([][]byte, o.junkPacketCount)
+	for i := range packets {
+		packet := make([]byte, o.junkPacketMinSize+mRand.Intn(o.junkPacketMaxSize-o.junkPacketMinSize+1))
+		rand.Read(packet)
+		packets[i] = packet
+	}
+	return packets
+}
+
+// encode rewrites a WireGuard message starting at offset, it returns a new
+// buffer if junk has to be prepended.
+func (o *obfuscation) encode(buffer []byte, offset int) []byte {
+	packet := buffer[offset:]
+	if len(packet) < 4 {
+		return buffer
+	}
+	switch binary.LittleEndian.Uint32(packet) {
+	case device.MessageInitiationType:
+		if len(packet) == device.MessageInitiationSize {
+			return prependJunk(buffer, offset, o.initJunkSize, o.initHeader)
+		}
+	case device.MessageResponseType:
+		if len(packet) == device.MessageResponseSize {
+			return prependJunk(buffer, offset, o.responseJunkSize, o.responseHeader)
+		}
+	case device.MessageCookieReplyType:
+		if len(packet) == device.MessageCookieReplySize {
+			binary.LittleEndian.PutUint32(packet, o.cookieReplyHeader)
+		}
+	case device.MessageTransportType:
+		binary.LittleEndian.PutUint32(packet, o.transportHeader)
+	}
+	return buffer
+}
+
+func prependJunk(buffer []byte, offset int, junkSize int, header uint32) []byte {
+	if junkSize > 0 {
+		newBuffer := make([]byte, len(buffer)+junkSize)
+		copy(newBuffer[offset+junkSize:], buffer[offset:])
+		rand.Read(newBuffer[offset : offset+junkSize])
+		buffer = newBuffer
+	}
+	binary.LittleEndian.PutUint32(buffer[offset+junkSize:], header)
+	return buffer
+}
+
+// decode restores a received packet in place and returns its new size,
+// zero means the packet is junk and should be dropped.
+func (o *obfuscation) decode(packet []byte) int {
+	size := len(packet)
+	if size == o.initJunkSize+device.MessageInitiationSize && o.matchHeader(packet[o.initJunkSize:], o.initHeader) {
+		return restoreHeader(packet, o.initJunkSize, device.MessageInitiationType)
+	}
+	if size == o.responseJunkSize+device.MessageResponseSize && o.matchHeader(packet[o.responseJunkSize:], o.responseHeader) {
+		return restoreHeader(packet, o.responseJunkSize, device.MessageResponseType)
+	}
+	if size == device.MessageCookieReplySize && o.matchHeader(packet, o.cookieReplyHeader) {
+		return restoreHeader(packet, 0, device.MessageCookieReplyType)
+	}
+	if size >= device.MessageTransportSize && o.matchHeader(packet, o.transportHeader) {
+		return restoreHeader(packet, 0, device.MessageTransportType)
+	}
+	return 0
+}
+
+func (o *obfuscation) matchHeader(packet []byte, header uint32) bool {
+	return binary.LittleEndian.Uint32(packet) == header
+}
+
+func restoreHeader(packet []byte, junkSize int, messageType uint32) int {
+	if junkSize > 0 {
+		copy(packet, packet[junkSize:])
+	}
+	binary.LittleEndian.PutUint32(packet, messageType)
+	return len(packet) - junkSize
+}
+
+var _ conn.Bind = (*obfuscationBind)(nil)
+
+type obfuscationBind struct {
+	conn.Bind
+	obfuscation            *obfuscation
+	obfuscationForEndpoint map[netip.AddrPort]*obfuscation
+}
+
+func newObfuscationBind(bind conn.Bind, obfuscation *obfuscation, obfuscationForEndpoint map[netip.AddrPort]*obfuscation) *obfuscationBind {
+	return &obfuscationBind{
+		Bind:                   bind,
+		obfuscation:            obfuscation,
+		obfuscationForEndpoint: obfuscationForEndpoint,
+	}
+}
+
+func (b *obfuscationBind) lookup(endpoint conn.Endpoint) *obfuscation {
+	address, _ := netip.ParseAddrPort(endpoint.DstToString())
+	return lookupObfuscation(b.obfuscation, b.obfuscationForEndpoint, address)
+}
+
+func lookupObfuscation(defaultObfuscation *obfuscation, obfuscationForEndpoint map[netip.AddrPort]*obfuscation, address netip.AddrPort) *obfuscation {
+	endpointObfuscation, loaded := obfuscationForEndpoint[address]
+	if loaded {
+		return endpointObfuscation
+	}
+	return defaultObfuscation
+}
+
+func (b *obfuscationBind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	fns, actualPort, err = b.Bind.Open(port)
+	if err != nil {
+		return
+	}
+	for i, fn := range fns {
+		fns[i] = b.wrapReceive(fn)
+	}
+	return
+}
+
+func (b *obfuscationBind) wrapReceive(fn conn.ReceiveFunc) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (count int, err error) {
+		count, err = fn(packets, sizes, eps)
+		for i := 0; i < count; i++ {
+			endpointObfuscation := b.lookup(eps[i])
+			if endpointObfuscation != nil {
+				sizes[i] = endpointObfuscation.decode(packets[i][:sizes[i]])
+			}
+		}
+		return
+	}
+}
+
+func (b *obfuscationBind) Send(bufs [][]byte, ep conn.Endpoint, offset int) error {
+	endpointObfuscation := b.lookup(ep)
+	if endpointObfuscation == nil {
+		return b.Bind.Send(bufs, ep, offset)
+	}
+	encoded := make([][]byte, len(bufs))
+	for i, buffer := range bufs {
+		if endpointObfuscation.junkPacketCount > 0 && isInitiation(buffer[offset:]) {
+			err := b.Bind.Send(endpointObfuscation.junkPackets(), ep, 0)
+			if err != nil {
+				return err
+			}
+		}
+		encoded[i] = endpointObfuscation.encode(buffer, offset)
+	}
+	return b.Bind.Send(encoded, ep, offset)
+}
+
+func isInitiation(packet []byte) bool {
+	return len(packet) == device.MessageInitiationSize && binary.LittleEndian.Uint32(packet) == device.MessageInitiationType
+}
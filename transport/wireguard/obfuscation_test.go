@@ -0,0 +1,75 @@
+package wireguard
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/sagernet/wireguard-go/device"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObfuscation(t *testing.T) {
+	t.Parallel()
+	o, err := newObfuscation(&AmneziaOptions{
+		JunkPacketCount:              3,
+		JunkPacketMinSize:            40,
+		JunkPacketMaxSize:            70,
+		InitPacketJunkSize:           15,
+		ResponsePacketJunkSize:       18,
+		InitPacketMagicHeader:        1020325451,
+		ResponsePacketMagicHeader:    3288052141,
+		CookieReplyPacketMagicHeader: 1766607858,
+		TransportPacketMagicHeader:   2528465083,
+	})
+	require.NoError(t, err)
+	for _, junkPacket := range o.junkPackets() {
+		require.GreaterOrEqual(t, len(junkPacket), 40)
+		require.LessOrEqual(t, len(junkPacket), 70)
+		require.Zero(t, o.decode(junkPacket))
+	}
+	const offset = device.MessageEncapsulatingTransportSize
+	for _, message := range []struct {
+		messageType uint32
+		size        int
+		junkSize    int
+		header      uint32
+	}{
+		{device.MessageInitiationType, device.MessageInitiationSize, 15, 1020325451},
+		{device.MessageResponseType, device.MessageResponseSize, 18, 3288052141},
+		{device.MessageCookieReplyType, device.MessageCookieReplySize, 0, 1766607858},
+		{device.MessageTransportType, 1200, 0, 2528465083},
+	} {
+		buffer := make([]byte, offset+message.size)
+		binary.LittleEndian.PutUint32(buffer[offset:], message.messageType)
+		for i := offset + 4; i < len(buffer); i++ {
+			buffer[i] = byte(i)
+		}
+		original := append([]byte(nil), buffer[offset:]...)
+		encoded := o.encode(buffer, offset)[offset:]
+		require.Len(t, encoded, message.size+message.junkSize)
+		require.Equal(t, message.header, binary.LittleEndian.Uint32(encoded[message.junkSize:]))
+		require.Equal(t, message.size, o.decode(encoded))
+		require.Equal(t, original, encoded[:message.size])
+	}
+}
+
+func TestObfuscationInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := newObfuscation(&AmneziaOptions{
+		InitPacketMagicHeader:     5,
+		ResponsePacketMagicHeader: 5,
+	})
+	require.Error(t, err)
+	_, err = newObfuscation(&AmneziaOptions{
+		InitPacketJunkSize:     0,
+		ResponsePacketJunkSize: device.MessageInitiationSize - device.MessageResponseSize,
+	})
+	require.Error(t, err)
+	_, err = newObfuscation(&AmneziaOptions{
+		JunkPacketCount:   4,
+		JunkPacketMinSize: 100,
+		JunkPacketMaxSize: 50,
+	})
+	require.Error(t, err)
+}